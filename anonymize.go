@@ -0,0 +1,99 @@
+package crud
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var fakeFirstNames = []string{"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda", "David", "Elizabeth", "William", "Barbara", "Richard", "Susan", "Joseph", "Jessica"}
+
+var fakeLastNames = []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez", "Hernandez", "Lopez", "Wilson", "Anderson", "Thomas", "Taylor"}
+
+// sensitiveFakers are functions that return fake values for kinds of
+// sensitive fields, set with "sensitive:kind" tag, that are not longer than
+// maxLen when it is greater than 0. Values are derived from object's ID and
+// seed, so they are the same in every dump, name and email of an object
+// match, and emails are valid and unique when IDs are, whatever their length
+var sensitiveFakers = map[string]func(id int64, seed uint64, maxLen int) string{
+	"text": func(id int64, seed uint64, maxLen int) string {
+		return truncateFake("Lorem ipsum dolor sit amet", maxLen)
+	},
+	"name": func(id int64, seed uint64, maxLen int) string {
+		first, last := getFakeName(seed)
+		return fitFake(maxLen, first+" "+last, first[:1]+". "+last, last, truncateFake(last, maxLen))
+	},
+	"email": func(id int64, seed uint64, maxLen int) string {
+		first, last := getFakeName(seed)
+		first, last = strings.ToLower(first), strings.ToLower(last)
+		return fitFake(maxLen, fmt.Sprintf("%s.%s%d@example.com", first, last, id), fmt.Sprintf("%s%d@example.com", first, id), fmt.Sprintf("u%d@example.com", id), fmt.Sprintf("u%s@x.test", strconv.FormatInt(id, 36)))
+	},
+	"phone": func(id int64, seed uint64, maxLen int) string {
+		phone := fmt.Sprintf("+1555%07d", seed%10000000)
+		if maxLen > 0 && len(phone) > maxLen {
+			// Last digits are kept, so that the value is still a number
+			return phone[len(phone)-maxLen:]
+		}
+		return phone
+	},
+	"password": func(id int64, seed uint64, maxLen int) string {
+		return truncateFake(fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%d:%d", id, seed)))), maxLen)
+	},
+}
+
+// getFakeName returns fake first and last name for seed
+func getFakeName(seed uint64) (string, string) {
+	return fakeFirstNames[seed%uint64(len(fakeFirstNames))], fakeLastNames[seed/uint64(len(fakeFirstNames))%uint64(len(fakeLastNames))]
+}
+
+// fitFake returns the first of fakes that is not longer than maxLen, or the
+// last one when none of them is
+func fitFake(maxLen int, fakes ...string) string {
+	for _, v := range fakes {
+		if maxLen <= 0 || len(v) <= maxLen {
+			return v
+		}
+	}
+	return fakes[len(fakes)-1]
+}
+
+// truncateFake returns fake cut to maxLen when it is greater than 0
+func truncateFake(v string, maxLen int) string {
+	if maxLen > 0 && len(v) > maxLen {
+		return v[:maxLen]
+	}
+	return v
+}
+
+// Anonymize replaces values of fields with "sensitive" tag with realistic
+// fakes, eg. for producing staging datasets. The kind of fake value is set in
+// the tag, eg. "sensitive:name", and it can be one of "text" (default, or
+// "email" when the field has email tag), "name", "email", "phone" and
+// "password". Empty values are left empty
+func (c Controller) Anonymize(obj interface{}) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	h.anonymize(obj)
+	return nil
+}
+
+// anonymize replaces values of sensitive fields of an object
+func (h *Helper) anonymize(obj interface{}) {
+	val := reflect.ValueOf(obj).Elem()
+	id := val.FieldByName("ID").Int()
+	hash := fnv.New64a()
+	hash.Write([]byte(fmt.Sprintf("%s:%d", h.dbTbl, id)))
+	seed := hash.Sum64()
+	for _, k := range h.fields {
+		kind := h.fieldsSensitive[k]
+		if kind == "" || val.FieldByName(k).String() == "" {
+			continue
+		}
+		val.FieldByName(k).SetString(sensitiveFakers[kind](id, seed, h.fieldsLength[k][1]))
+	}
+}
@@ -0,0 +1,457 @@
+package crud
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values of ChangeRequest Status
+const (
+	ChangeRequestPending  = "pending"
+	ChangeRequestApproved = "approved"
+	ChangeRequestRejected = "rejected"
+)
+
+// ChangeRequest is a write of object that is waiting for a review instead of
+// being applied, see RequestChange
+type ChangeRequest struct {
+	ID int64 `json:"change_request_id"`
+	// ObjID is ID of updated or deleted object, or of the created one after
+	// the change is approved
+	ObjID int64 `json:"obj_id"`
+	// Op is OpCreate, OpUpdate or OpDelete
+	Op int `json:"op"`
+	// Changes are values of fields with JSON names as keys: all of them for
+	// create and only the changed ones for update
+	Changes    map[string]interface{} `json:"changes"`
+	Status     string                 `json:"status"`
+	CreatedBy  int64                  `json:"created_by"`
+	ReviewedBy int64                  `json:"reviewed_by"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+type approvalCtxKey struct{}
+
+// WithApprovalRequired returns shallow copy of the request that HTTP handler
+// stores writes of as change requests (see RequestChange) instead of applying
+// them, eg. for callers that are not privileged to change data directly.
+// Response to such write is "202 Accepted" with ID of the change request
+func WithApprovalRequired(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), approvalCtxKey{}, true))
+}
+
+// isApprovalRequired checks if request was marked with WithApprovalRequired
+func isApprovalRequired(r *http.Request) bool {
+	b, _ := r.Context().Value(approvalCtxKey{}).(bool)
+	return b
+}
+
+// CreateChangeRequestsTable creates the change requests table if it does not
+// exist
+func (c Controller) CreateChangeRequestsTable() *ErrController {
+	_, err := c.dbConn.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (change_request_id BIGSERIAL PRIMARY KEY,change_request_tbl VARCHAR(255) DEFAULT '',change_request_obj_id BIGINT DEFAULT 0,change_request_op INTEGER DEFAULT 0,change_request_payload JSONB,change_request_status VARCHAR(20) DEFAULT '%s',change_request_created_by BIGINT DEFAULT 0,change_request_reviewed_by BIGINT DEFAULT 0,change_request_created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW())", c.getChangeRequestsTbl(), ChangeRequestPending))
+	if err != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	_, err = c.dbConn.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_status_idx ON %s (change_request_tbl,change_request_status)", c.getChangeRequestsTbl(), c.getChangeRequestsTbl()))
+	if err != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	return nil
+}
+
+// RequestChange stores write of object as a pending change request, which
+// is applied only when it is approved with ApproveChangeRequest. op is
+// OpCreate, OpUpdate or OpDelete, and for the last two object must have ID
+// set. For update, only fields that differ from the object in the database
+// are stored. Fields hidden in JSON are not stored. It returns ID of the
+// change request
+func (c Controller) RequestChange(obj interface{}, op int, createdBy int64) (int64, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return 0, err
+	}
+
+	changes := map[string]interface{}{}
+	switch op {
+	case OpCreate:
+		for _, k := range h.fields {
+			if k != "ID" && !h.fieldsJSONHidden[k] {
+				changes[h.fieldsJSONName[k]] = reflect.ValueOf(obj).Elem().FieldByName(k).Interface()
+			}
+		}
+	case OpUpdate, OpDelete:
+		current := reflect.New(reflect.TypeOf(obj).Elem()).Interface()
+		err = c.SetFromDB(current, fmt.Sprintf("%d", c.GetModelIDValue(obj)))
+		if err != nil {
+			return 0, err
+		}
+		if c.GetModelIDValue(current) == 0 {
+			return 0, &ErrController{
+				Op:  "InvalidValue",
+				Err: fmt.Errorf("Object %d does not exist", c.GetModelIDValue(obj)),
+			}
+		}
+		if op == OpDelete {
+			break
+		}
+		diffs, err := c.Diff(current, obj)
+		if err != nil {
+			return 0, err
+		}
+		for _, d := range diffs {
+			if !h.fieldsJSONHidden[d.Name] {
+				changes[d.JSON] = d.New
+			}
+		}
+	default:
+		return 0, &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Invalid operation %d", op),
+		}
+	}
+
+	payload, err2 := json.Marshal(changes)
+	if err2 != nil {
+		return 0, &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Error marshalling changes: %w", err2),
+		}
+	}
+	var id int64
+	err2 = c.getQuerier().QueryRow(fmt.Sprintf("INSERT INTO %s(change_request_tbl,change_request_obj_id,change_request_op,change_request_payload,change_request_created_by) VALUES ($1,$2,$3,$4,$5) RETURNING change_request_id", c.getChangeRequestsTbl()), h.dbTbl, c.GetModelIDValue(obj), op, string(payload), createdBy).Scan(&id)
+	if err2 != nil {
+		return 0, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	return id, nil
+}
+
+// GetChangeRequestsFromDB returns change requests of model with status (one
+// of ChangeRequest* values, or all of them when it is empty), the oldest
+// first
+func (c Controller) GetChangeRequestsFromDB(obj interface{}, status string, limit int, offset int) ([]*ChangeRequest, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE change_request_tbl = $1", c.getChangeRequestCols(), c.getChangeRequestsTbl())
+	args := []interface{}{h.dbTbl}
+	if status != "" {
+		query += " AND change_request_status = $2"
+		args = append(args, status)
+	}
+	query += " ORDER BY change_request_id ASC"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	}
+	return c.queryChangeRequests(c.getQuerier(), query, args...)
+}
+
+// ApproveChangeRequest applies pending change request to the model's object
+// with SaveToDB or DeleteFromDB, so that validation and hooks run just like
+// for any other write, and marks it as approved by reviewedBy. Both happen
+// in a single transaction, and change request stays pending when write
+// fails. Change request cannot be approved by the one that created it, and
+// returned error has Op set to "SelfApproval" then. newObjFunc returns new
+// instance of the model struct
+func (c Controller) ApproveChangeRequest(newObjFunc func() interface{}, id int64, reviewedBy int64) *ErrController {
+	return c.withReviewTx(func(tc *Controller) *ErrController {
+		cr, err := tc.lockChangeRequest(newObjFunc(), id)
+		if err != nil {
+			return err
+		}
+		if reviewedBy == cr.CreatedBy {
+			return &ErrController{
+				Op:  "SelfApproval",
+				Err: fmt.Errorf("Change request %d cannot be approved by its creator", id),
+			}
+		}
+
+		obj := newObjFunc()
+		if cr.Op != OpCreate {
+			err = tc.SetFromDB(obj, fmt.Sprintf("%d", cr.ObjID))
+			if err != nil {
+				return err
+			}
+			if tc.GetModelIDValue(obj) == 0 {
+				return &ErrController{
+					Op:  "InvalidValue",
+					Err: fmt.Errorf("Object %d does not exist", cr.ObjID),
+				}
+			}
+		}
+		if cr.Op == OpDelete {
+			err = tc.DeleteFromDB(obj)
+		} else {
+			err = tc.applyChanges(obj, cr.Changes)
+			if err == nil {
+				err = tc.SaveToDB(obj)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return tc.setChangeRequestStatus(id, ChangeRequestApproved, reviewedBy, tc.GetModelIDValue(obj))
+	})
+}
+
+// RejectChangeRequest marks pending change request as rejected by
+// reviewedBy, without applying it
+func (c Controller) RejectChangeRequest(obj interface{}, id int64, reviewedBy int64) *ErrController {
+	return c.withReviewTx(func(tc *Controller) *ErrController {
+		cr, err := tc.lockChangeRequest(obj, id)
+		if err != nil {
+			return err
+		}
+		return tc.setChangeRequestStatus(id, ChangeRequestRejected, reviewedBy, cr.ObjID)
+	})
+}
+
+// GetChangeRequestsHTTPHandler returns HTTP handler for reviewers of change
+// requests of model, eg. to be attached to "/__crud/users/change_requests/".
+// GET lists change requests with "status" (pending by default), "limit" and
+// "offset" query parameters, and PUT of "/:id/approve" or "/:id/reject"
+// approves or rejects one of them. Identity of the request (see
+// WithIdentity) is stored as the reviewer. It is meant for reviewers so it
+// should be protected
+func (c Controller) GetChangeRequestsHTTPHandler(uri string, newObjFunc func() interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := c.withResponseSerializer(r).withRequest(r)
+		path, ok := c.getRelativePath(uri, r.URL.EscapedPath())
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(c.jsonError("invalid path"))
+			return
+		}
+		path = strings.SplitN(path, "?", 2)[0]
+
+		if r.Method == http.MethodGet && path == "" {
+			status := r.URL.Query().Get("status")
+			if status == "" {
+				status = ChangeRequestPending
+			}
+			if status != ChangeRequestPending && status != ChangeRequestApproved && status != ChangeRequestRejected {
+				c.writeErrText(w, http.StatusBadRequest, "invalid_status")
+				return
+			}
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			if limit < 1 {
+				limit = 10
+			}
+			if offset < 0 {
+				offset = 0
+			}
+			crs, err := c.GetChangeRequestsFromDB(newObjFunc(), status, limit, offset)
+			if err != nil {
+				c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+				return
+			}
+			items := make([]interface{}, len(crs))
+			for i, cr := range crs {
+				items[i] = cr
+				if c.jsonNaming == JSONNamingCamelCase {
+					items[i], err = c.getCamelCaseChangeRequest(cr, newObjFunc())
+					if err != nil {
+						c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+						return
+					}
+				}
+			}
+			c.writeResponse(w, http.StatusOK, NewListResponse(items, nil))
+			return
+		}
+
+		xs := strings.Split(path, "/")
+		if r.Method != http.MethodPut || len(xs) != 2 || !idRegExp.MatchString(xs[0]) || (xs[1] != "approve" && xs[1] != "reject") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		id, _ := strconv.ParseInt(xs[0], 10, 64)
+		var err *ErrController
+		if xs[1] == "approve" {
+			err = c.ApproveChangeRequest(newObjFunc, id, GetIdentity(r))
+		} else {
+			err = c.RejectChangeRequest(newObjFunc(), id, GetIdentity(r))
+		}
+		if err != nil && err.Op == "InvalidValue" {
+			c.writeErrText(w, http.StatusNotFound, "change_request_not_found")
+			return
+		}
+		if err != nil && err.Op == "SelfApproval" {
+			c.writeErrText(w, http.StatusForbidden, "self_approval")
+			return
+		}
+		if err != nil && err.Op == "Validate" {
+			c.writeErrText(w, http.StatusBadRequest, "validation_failed")
+			return
+		}
+		if err != nil {
+			c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_save_to_db")
+			return
+		}
+		c.writeResponse(w, http.StatusOK, NewIDResponse(id))
+	})
+}
+
+// writeChangeRequest stores write of object from HTTP request as a change
+// request and writes "202 Accepted" response with its ID
+func (c Controller) writeChangeRequest(w http.ResponseWriter, r *http.Request, obj interface{}, op int) {
+	id, err := c.RequestChange(obj, op, GetIdentity(r))
+	if err != nil {
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_save_to_db")
+		return
+	}
+	c.writeOK(w, http.StatusAccepted, map[string]interface{}{
+		c.getResponseJSONName("change_request_id"): id,
+	})
+}
+
+// getCamelCaseChangeRequest returns change request converted to map with
+// keys in camelCase, including the ones of changes, which are named like
+// fields of obj
+func (c Controller) getCamelCaseChangeRequest(cr *ChangeRequest, obj interface{}) (map[string]interface{}, *ErrController) {
+	m, err := c.getObjectMap(cr)
+	if err != nil {
+		return nil, err
+	}
+	changes := m["changes"]
+	delete(m, "changes")
+	m = renameJSONKeys(reflect.TypeOf(cr), m, true).(map[string]interface{})
+	m["changes"] = renameJSONKeys(reflect.TypeOf(obj), changes, true)
+	return m, nil
+}
+
+// getChangeRequestsTbl returns name of the change requests table
+func (c Controller) getChangeRequestsTbl() string {
+	return c.dbTblPrefix + "change_requests"
+}
+
+// getChangeRequestCols returns columns of the change requests table in the
+// order of ChangeRequest fields
+func (c Controller) getChangeRequestCols() string {
+	return "change_request_id,change_request_obj_id,change_request_op,change_request_payload,change_request_status,change_request_created_by,change_request_reviewed_by,change_request_created_at"
+}
+
+// withReviewTx calls fn with controller in a transaction, or with the
+// controller itself when it is already in one
+func (c Controller) withReviewTx(fn func(tc *Controller) *ErrController) *ErrController {
+	if c.tx != nil {
+		return fn(&c)
+	}
+	return c.WithTx(fn)
+}
+
+// lockChangeRequest returns pending change request of model with id and
+// locks it until the end of the transaction
+func (c Controller) lockChangeRequest(obj interface{}, id int64) (*ChangeRequest, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	crs, err := c.queryChangeRequests(c.getQuerier(), fmt.Sprintf("SELECT %s FROM %s WHERE change_request_id = $1 AND change_request_tbl = $2 AND change_request_status = $3 FOR UPDATE", c.getChangeRequestCols(), c.getChangeRequestsTbl()), id, h.dbTbl, ChangeRequestPending)
+	if err != nil {
+		return nil, err
+	}
+	if len(crs) == 0 {
+		return nil, &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Pending change request %d does not exist", id),
+		}
+	}
+	return crs[0], nil
+}
+
+// setChangeRequestStatus sets status and reviewer of change request, and ID
+// of object, which is new for the approved create
+func (c Controller) setChangeRequestStatus(id int64, status string, reviewedBy int64, objID int64) *ErrController {
+	_, err := c.getQuerier().Exec(fmt.Sprintf("UPDATE %s SET change_request_status = $1,change_request_reviewed_by = $2,change_request_obj_id = $3 WHERE change_request_id = $4", c.getChangeRequestsTbl()), status, reviewedBy, objID, id)
+	if err != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	return nil
+}
+
+// queryChangeRequests returns change requests from rows of query, which
+// selects columns from getChangeRequestCols
+func (c Controller) queryChangeRequests(q dbQuerier, query string, args ...interface{}) ([]*ChangeRequest, *ErrController) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	defer rows.Close()
+
+	crs := []*ChangeRequest{}
+	for rows.Next() {
+		cr := &ChangeRequest{}
+		var payload sql.NullString
+		err = rows.Scan(&cr.ID, &cr.ObjID, &cr.Op, &payload, &cr.Status, &cr.CreatedBy, &cr.ReviewedBy, &cr.CreatedAt)
+		if err != nil {
+			return nil, &ErrController{
+				Op:  "DBQueryRowsScan",
+				Err: fmt.Errorf("Error scanning DB query row: %w", err),
+			}
+		}
+		cr.Changes = map[string]interface{}{}
+		if payload.Valid {
+			// Numbers are kept as they are so that int64 values do not lose
+			// precision when changes are applied
+			d := json.NewDecoder(bytes.NewReader([]byte(payload.String)))
+			d.UseNumber()
+			err = d.Decode(&cr.Changes)
+			if err != nil {
+				return nil, &ErrController{
+					Op:  "DBQueryRowsScan",
+					Err: fmt.Errorf("Error unmarshalling change request payload: %w", err),
+				}
+			}
+		}
+		crs = append(crs, cr)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQueryRowsScan",
+			Err: fmt.Errorf("Error scanning DB query row: %w", err),
+		}
+	}
+	return crs, nil
+}
+
+// applyChanges sets fields of object to values from changes of change request
+func (c Controller) applyChanges(obj interface{}, changes map[string]interface{}) *ErrController {
+	b, err := json.Marshal(changes)
+	if err == nil {
+		err = json.Unmarshal(b, obj)
+	}
+	if err != nil {
+		return &ErrController{
+			Op:  "ApplyChanges",
+			Err: fmt.Errorf("Error applying changes: %w", err),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package crud
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// UpdateFromDB sets fields to values, keyed by field names, in all objects
+// matching filters with a single "UPDATE" query, without getting them from
+// the database, and returns number of updated objects. Values are validated
+// just like in SaveFieldsToDB and field with "updatedat" tag is set to current
+// time. Hooks are not run, but changes are recorded in versions and events
+// and mirrored to the secondary database just like in SaveFieldsToDB. At
+// least one filter is required, so that all objects are not updated by
+// mistake
+func (c Controller) UpdateFromDB(newObjFunc func() interface{}, filters map[string]interface{}, values map[string]interface{}) (int64, *ErrController) {
+	obj := newObjFunc()
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return 0, err
+	}
+	if len(filters) == 0 {
+		return 0, &ErrController{
+			Op:  "InvalidValue",
+			Err: errors.New("No filters"),
+		}
+	}
+	fields, err := c.setValues(h, obj, values)
+	if err != nil {
+		return 0, err
+	}
+
+	b, invalidFields, err2 := c.ValidateWithOptions(obj, nil, ValidationOptions{Op: OpUpdate, Fields: fields})
+	if err2 != nil {
+		return 0, &ErrController{
+			Op:  "Validate",
+			Err: fmt.Errorf("Error when trying to validate: %w", err2),
+		}
+	}
+	if !b {
+		return 0, &ErrController{
+			Op: "Validate",
+			Err: &ErrValidation{
+				Fields: invalidFields,
+			},
+		}
+	}
+
+	filters, dbFilters, err1 := c.prepareFilters(h, obj, filters)
+	if err1 != nil {
+		return 0, err1
+	}
+
+	val := reflect.ValueOf(obj).Elem()
+	args := []interface{}{}
+	for _, f := range fields {
+		args = append(args, h.getFieldInterface(val.FieldByName(f), f))
+	}
+	filterArgs := append(h.GetFilterArgs(dbFilters), c.getExpiresArgs(h)...)
+	query, args, errI := c.interceptQuery(h, OpUpdate, h.GetQueryUpdateWhere(fields, filters), append(args, filterArgs...))
+	if errI != nil {
+		return 0, errI
+	}
+	return c.execBulk(h, OpUpdate, newObjFunc, query, args, filters, filterArgs)
+}
+
+// DeleteManyFromDB removes all objects matching filters with a single
+// "DELETE" query, without getting them from the database, and returns number
+// of removed objects. When struct has field with "softdel" tag, objects are
+// soft-deleted instead. Hooks are not run, but changes are recorded in events
+// and mirrored to the secondary database just like in DeleteFromDB. At least
+// one filter is required, so that all objects are not removed by mistake
+func (c Controller) DeleteManyFromDB(newObjFunc func() interface{}, filters map[string]interface{}) (int64, *ErrController) {
+	obj := newObjFunc()
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return 0, err
+	}
+	if len(filters) == 0 {
+		return 0, &ErrController{
+			Op:  "InvalidValue",
+			Err: errors.New("No filters"),
+		}
+	}
+	filters, dbFilters, err1 := c.prepareFilters(h, obj, filters)
+	if err1 != nil {
+		return 0, err1
+	}
+
+	query, args := h.GetQueryDeleteWhere(filters), []interface{}{}
+	if h.fieldSoftDel != "" {
+		query, args = h.GetQuerySoftDeleteWhere(filters), []interface{}{c.clock.Now().Unix()}
+	}
+	args = append(append(args, h.GetFilterArgs(dbFilters)...), c.getExpiresArgs(h)...)
+	query, args, errI := c.interceptQuery(h, OpDelete, query, args)
+	if errI != nil {
+		return 0, errI
+	}
+	return c.execBulk(h, OpDelete, newObjFunc, query, args, nil, nil)
+}
+
+// setValues sets fields of object to values and returns names of the fields,
+// in the order of declaration. Field with "updatedat" tag is set as well
+func (c Controller) setValues(h *Helper, obj interface{}, values map[string]interface{}) ([]string, *ErrController) {
+	if len(values) == 0 {
+		return nil, &ErrController{
+			Op:  "InvalidValue",
+			Err: errors.New("No values"),
+		}
+	}
+	val := reflect.ValueOf(obj).Elem()
+	for k, v := range values {
+		if k == "ID" || h.dbFieldCols[k] == "" {
+			return nil, &ErrController{
+				Op:  "InvalidField",
+				Err: fmt.Errorf("Field %s cannot be saved", k),
+			}
+		}
+		valueField := val.FieldByName(k)
+		if v == nil {
+			valueField.Set(reflect.Zero(valueField.Type()))
+			continue
+		}
+		if !reflect.TypeOf(v).AssignableTo(valueField.Type()) {
+			return nil, &ErrController{
+				Op:  "InvalidValue",
+				Err: fmt.Errorf("Value of field %s has invalid type %T", k, v),
+			}
+		}
+		valueField.Set(reflect.ValueOf(v))
+	}
+	h.transformFields(val)
+	c.setTimestampFields(h, obj, OpUpdate)
+
+	fields := []string{}
+	for _, k := range h.fields {
+		if _, ok := values[k]; ok || k == h.fieldUpdatedAt {
+			fields = append(fields, k)
+		}
+	}
+	return fields, nil
+}
+
+// execBulk executes query that updates or removes many rows and returns
+// number of affected rows. When the changes are recorded in versions or events,
+// or mirrored to the secondary database, the affected rows are returned by the
+// query and recorded one by one. State of rows before the update is taken with
+// filters and their arguments
+func (c Controller) execBulk(h *Helper, op int, newObjFunc func() interface{}, query string, args []interface{}, filters map[string]interface{}, filterArgs []interface{}) (int64, *ErrController) {
+	if !c.recordsEvents(h, op) && !c.recordsVersions(h, op) && c.secondary == nil {
+		return c.execWithRowsAffected(h, op, query, args)
+	}
+	objs := []interface{}{}
+	err := c.runWithHints(h, op, func(q dbQuerier) error {
+		objs = objs[:0]
+		payloads, err := c.getVersionPayloads(q, h, op, filters, filterArgs)
+		if err != nil {
+			return err
+		}
+		rows, err := q.Query(query+h.queryReturning, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			obj := newObjFunc()
+			err = rows.Scan(append([]interface{}{c.GetModelIDInterface(obj)}, c.GetModelFieldInterfaces(obj)...)...)
+			if err != nil {
+				return err
+			}
+			objs = append(objs, obj)
+		}
+		err = rows.Err()
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			err = c.recordVersionPayload(q, h, c.GetModelIDValue(obj), payloads)
+			if err != nil {
+				return err
+			}
+			err = c.recordEvent(q, h, op, obj)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	for _, obj := range objs {
+		c.mirrorObject(h, op, obj)
+	}
+	return int64(len(objs)), nil
+}
+
+// execWithRowsAffected executes query and returns number of affected rows
+func (c Controller) execWithRowsAffected(h *Helper, op int, query string, args []interface{}) (int64, *ErrController) {
+	var cnt int64
+	err := c.runWithHints(h, op, func(q dbQuerier) error {
+		res, err := q.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		cnt, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	return cnt, nil
+}
@@ -0,0 +1,285 @@
+package crud
+
+import (
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+// clientTypes maps Go types of fields that are kept in the generated clients
+// to TypeScript types. Fields of other types are json.RawMessage in Go and
+// unknown in TypeScript
+var clientTypes = map[string]string{
+	"string": "string", "bool": "boolean",
+	"int": "number", "int8": "number", "int16": "number", "int32": "number", "int64": "number",
+	"uint": "number", "uint8": "number", "uint16": "number", "uint32": "number", "uint64": "number",
+	"float32": "number", "float64": "number",
+	"time.Time": "string",
+}
+
+// clientModel contains description of an endpoint's model used for generating
+// its client methods
+type clientModel struct {
+	path string
+	ops  int
+	desc *ModelDescription
+}
+
+// GenerateGoClient returns source of a Go package named pkg containing types
+// of the endpoints' models and Client with Get, List, Create, Update and
+// Delete methods for the operations that the endpoints allow
+func (c Controller) GenerateGoClient(pkg string, endpoints []Endpoint) (string, *ErrController) {
+	models, err := c.getClientModels(endpoints)
+	if err != nil {
+		return "", err
+	}
+
+	o := &strings.Builder{}
+	fmt.Fprintf(o, "// Code generated by go-crud. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	imports := []string{"bytes", "encoding/json", "fmt", "io", "net/http"}
+	for _, m := range models {
+		if m.ops&OpList != 0 {
+			imports = append(imports, "net/url")
+			break
+		}
+	}
+	if hasClientTimeField(models) {
+		imports = append(imports, "time")
+	}
+	for _, i := range imports {
+		fmt.Fprintf(o, "\t%q\n", i)
+	}
+	o.WriteString(")\n\n")
+
+	typesDone := map[string]bool{}
+	for _, m := range models {
+		if typesDone[m.desc.Name] {
+			continue
+		}
+		typesDone[m.desc.Name] = true
+		fmt.Fprintf(o, "type %s struct {\n", m.desc.Name)
+		for _, f := range m.desc.Fields {
+			if f.JSONHidden {
+				continue
+			}
+			t := f.Type
+			if clientTypes[f.Type] == "" {
+				t = "json.RawMessage"
+			}
+			tag := f.JSON
+			if f.OmitEmpty {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(o, "\t%s %s `json:%q`\n", f.Name, t, tag)
+		}
+		o.WriteString("}\n\n")
+	}
+
+	o.WriteString(`// Client calls the HTTP endpoints
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient returns new Client with endpoints under baseURL
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+type response struct {
+	OK      int8                       ` + "`json:\"ok\"`" + `
+	ErrText string                     ` + "`json:\"err_text\"`" + `
+	Data    map[string]json.RawMessage ` + "`json:\"data\"`" + `
+}
+
+func (c *Client) do(method string, path string, in interface{}, key string, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	r := response{}
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return err
+	}
+	if r.OK != 1 {
+		return fmt.Errorf("%s %s failed: %s", method, path, r.ErrText)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(r.Data[key], out)
+}
+`)
+
+	for _, m := range models {
+		n, p := m.desc.Name, m.path
+		if m.ops&OpRead != 0 {
+			fmt.Fprintf(o, "\nfunc (c *Client) Get%s(id int64) (*%s, error) {\n\to := &%s{}\n\terr := c.do(http.MethodGet, fmt.Sprintf(\"%s%%d\", id), nil, \"item\", o)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\treturn o, nil\n}\n", n, n, n, p)
+		}
+		if m.ops&OpList != 0 {
+			fmt.Fprintf(o, "\nfunc (c *Client) List%s(params url.Values) ([]*%s, error) {\n\tpath := \"%s\"\n\tif len(params) > 0 {\n\t\tpath += \"?\" + params.Encode()\n\t}\n\to := []*%s{}\n\terr := c.do(http.MethodGet, path, nil, \"items\", &o)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\treturn o, nil\n}\n", n, n, p, n)
+		}
+		if m.ops&OpCreate != 0 {
+			fmt.Fprintf(o, "\nfunc (c *Client) Create%s(o *%s) (int64, error) {\n\tvar id int64\n\terr := c.do(http.MethodPut, \"%s\", o, \"id\", &id)\n\treturn id, err\n}\n", n, n, p)
+		}
+		if m.ops&OpUpdate != 0 {
+			fmt.Fprintf(o, "\nfunc (c *Client) Update%s(id int64, o *%s) error {\n\treturn c.do(http.MethodPut, fmt.Sprintf(\"%s%%d\", id), o, \"\", nil)\n}\n", n, n, p)
+		}
+		if m.ops&OpDelete != 0 {
+			fmt.Fprintf(o, "\nfunc (c *Client) Delete%s(id int64) error {\n\treturn c.do(http.MethodDelete, fmt.Sprintf(\"%s%%d\", id), nil, \"\", nil)\n}\n", n, p)
+		}
+	}
+
+	b, err2 := format.Source([]byte(o.String()))
+	if err2 != nil {
+		return "", &ErrController{
+			Op:  "GenerateClient",
+			Err: fmt.Errorf("Error formatting generated source: %w", err2),
+		}
+	}
+	return string(b), nil
+}
+
+// GenerateTSClient returns source of a TypeScript module containing
+// interfaces of the endpoints' models and Client class with get, list,
+// create, update and delete methods for the operations that the endpoints
+// allow
+func (c Controller) GenerateTSClient(endpoints []Endpoint) (string, *ErrController) {
+	models, err := c.getClientModels(endpoints)
+	if err != nil {
+		return "", err
+	}
+
+	o := &strings.Builder{}
+	o.WriteString("// Code generated by go-crud. DO NOT EDIT.\n")
+
+	typesDone := map[string]bool{}
+	for _, m := range models {
+		if typesDone[m.desc.Name] {
+			continue
+		}
+		typesDone[m.desc.Name] = true
+		fmt.Fprintf(o, "\nexport interface %s {\n", m.desc.Name)
+		for _, f := range m.desc.Fields {
+			if f.JSONHidden {
+				continue
+			}
+			t := clientTypes[f.Type]
+			if t == "" {
+				t = "unknown"
+			}
+			optional := ""
+			if f.OmitEmpty {
+				optional = "?"
+			}
+			fmt.Fprintf(o, "  %q%s: %s;\n", f.JSON, optional, t)
+		}
+		o.WriteString("}\n")
+	}
+
+	o.WriteString(`
+export class Client {
+  constructor(private baseURL: string) {}
+
+  private async do<T>(method: string, path: string, body: unknown, key: string): Promise<T> {
+    const resp = await fetch(this.baseURL + path, {
+      method,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    const r = await resp.json();
+    if (r.ok !== 1) {
+      throw new Error(method + " " + path + " failed: " + r.err_text);
+    }
+    return (r.data || {})[key] as T;
+  }
+`)
+
+	for _, m := range models {
+		n, p := m.desc.Name, m.path
+		if m.ops&OpRead != 0 {
+			fmt.Fprintf(o, "\n  get%s(id: number): Promise<%s> {\n    return this.do<%s>(\"GET\", %q + id, undefined, \"item\");\n  }\n", n, n, n, p)
+		}
+		if m.ops&OpList != 0 {
+			fmt.Fprintf(o, "\n  list%s(params: Record<string, string> = {}): Promise<%s[]> {\n    const q = new URLSearchParams(params).toString();\n    return this.do<%s[]>(\"GET\", %q + (q ? \"?\" + q : \"\"), undefined, \"items\");\n  }\n", n, n, n, p)
+		}
+		if m.ops&OpCreate != 0 {
+			fmt.Fprintf(o, "\n  create%s(o: %s): Promise<number> {\n    return this.do<number>(\"PUT\", %q, o, \"id\");\n  }\n", n, n, p)
+		}
+		if m.ops&OpUpdate != 0 {
+			fmt.Fprintf(o, "\n  update%s(id: number, o: %s): Promise<number> {\n    return this.do<number>(\"PUT\", %q + id, o, \"id\");\n  }\n", n, n, p)
+		}
+		if m.ops&OpDelete != 0 {
+			fmt.Fprintf(o, "\n  delete%s(id: number): Promise<number> {\n    return this.do<number>(\"DELETE\", %q + id, undefined, \"id\");\n  }\n", n, p)
+		}
+	}
+	o.WriteString("}\n")
+	return o.String(), nil
+}
+
+// getClientModels returns descriptions of the endpoints' models. Endpoints
+// with the same model must not allow the same operations as names of the
+// generated methods would be duplicated
+func (c Controller) getClientModels(endpoints []Endpoint) ([]clientModel, *ErrController) {
+	models := []clientModel{}
+	opsDone := map[string]int{}
+	for _, e := range endpoints {
+		if e.Model == nil {
+			return nil, &ErrController{
+				Op:  "GenerateClient",
+				Err: fmt.Errorf("Endpoint %s has no model", e.Path),
+			}
+		}
+		d, err := c.Describe(e.Model())
+		if err != nil {
+			return nil, err
+		}
+		ops := e.Ops
+		if ops == 0 {
+			ops = OpCreate | OpRead | OpUpdate | OpDelete | OpList
+		}
+		if opsDone[d.Name]&ops != 0 {
+			return nil, &ErrController{
+				Op:  "GenerateClient",
+				Err: fmt.Errorf("Endpoint %s has operations of model %s that are already in another endpoint", e.Path, d.Name),
+			}
+		}
+		opsDone[d.Name] |= ops
+		models = append(models, clientModel{
+			path: e.Path,
+			ops:  ops,
+			desc: d,
+		})
+	}
+	return models, nil
+}
+
+// hasClientTimeField returns true when any of the models has a time.Time field
+// that is kept in the generated client
+func hasClientTimeField(models []clientModel) bool {
+	for _, m := range models {
+		for _, f := range m.desc.Fields {
+			if f.Type == "time.Time" && !f.JSONHidden {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package crud
+
+import "time"
+
+// Clock is the source of current time used for fields with "createdat",
+// "updatedat" and "expires" tags, so that it can be frozen in tests or
+// replaced with a synchronized one
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
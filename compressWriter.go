@@ -0,0 +1,111 @@
+package crud
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressWriter wraps http.ResponseWriter and compresses response body with
+// gzip when it is at least minSize bytes long and client accepts it. Status is
+// written together with the body because headers depend on its size. Brotli is
+// not supported because there is no encoder for it in the standard library
+type compressWriter struct {
+	http.ResponseWriter
+	minSize     int
+	status      int
+	wroteHeader bool
+	gz          *gzip.Writer
+}
+
+func newCompressWriter(w http.ResponseWriter, r *http.Request, minSize int) http.ResponseWriter {
+	if minSize <= 0 || !acceptsGzip(r) {
+		return w
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	return &compressWriter{
+		ResponseWriter: w,
+		minSize:        minSize,
+		status:         http.StatusOK,
+	}
+}
+
+// acceptsGzip checks if gzip is accepted by the Accept-Encoding header. The
+// encoding can be listed by name or matched by "*", and it is rejected when its
+// q-value is 0
+func acceptsGzip(r *http.Request) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(enc, ";")
+		q := 1.0
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 || strings.ToLower(kv[0]) != "q" {
+				continue
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			if err != nil {
+				f = 0
+			}
+			q = f
+		}
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case "gzip":
+			gzipQ = q
+		case "*":
+			anyQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return anyQ > 0
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader && len(b) >= cw.minSize {
+		cw.Header().Set("Content-Encoding", "gzip")
+		cw.Header().Del("Content-Length")
+		cw.gz = gzip.NewWriter(cw.ResponseWriter)
+	}
+	cw.writeHeader()
+	if cw.gz != nil {
+		return cw.gz.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// close writes the status when nothing has been written yet and flushes
+// compressed body
+func (cw *compressWriter) close() error {
+	cw.writeHeader()
+	if cw.gz != nil {
+		return cw.gz.Close()
+	}
+	return nil
+}
+
+// Flush writes the status and any compressed data buffered so far to the
+// client, so that streamed responses are not held back by compression
+func (cw *compressWriter) Flush() {
+	cw.writeHeader()
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) writeHeader() {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
@@ -0,0 +1,109 @@
+package crud
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Condition is an expression used to filter objects in
+// GetFromDBWithConditions. It is either a comparison of field with value,
+// created with Cond, or a group of conditions joined with AND or OR, created
+// with And and Or, eg. "status=1 OR (age>18 AND price<100)":
+//
+//	crud.Or(crud.Cond("Status", "=", 1), crud.And(crud.Cond("Age", ">", 18), crud.Cond("Price", "<", 100)))
+type Condition struct {
+	Field    string
+	Operator string
+	Value    interface{}
+	// Join is "AND" or "OR" for a group of Conditions
+	Join       string
+	Conditions []Condition
+}
+
+// Cond returns Condition comparing field with value. Operators are the same
+// as in FilterCondition
+func Cond(fieldName string, operator string, value interface{}) Condition {
+	return Condition{Field: fieldName, Operator: operator, Value: value}
+}
+
+// And returns Condition that is met when all of conds are met
+func And(conds ...Condition) Condition {
+	return Condition{Join: "AND", Conditions: conds}
+}
+
+// Or returns Condition that is met when any of conds is met
+func Or(conds ...Condition) Condition {
+	return Condition{Join: "OR", Conditions: conds}
+}
+
+// GetFromDBWithConditions returns objects matching cond, just like GetFromDB
+// does with filters, but conditions can be grouped with AND and OR
+func (c Controller) GetFromDBWithConditions(newObjFunc func() interface{}, order []string, limit int, offset int, cond Condition) ([]interface{}, *ErrController) {
+	obj := newObjFunc()
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	errHook := c.runHooks(HookBefore, OpList, obj)
+	if errHook != nil {
+		return nil, errHook
+	}
+	qWhere, args, i, err := c.getConditionSQL(h, obj, cond, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getFromDBWithQuery(h, newObjFunc, h.getQuerySelect(qWhere, i, c.getOrder(h, order), limit, offset, nil, c.getQueryHints(h, OpList)), append(args, c.getExpiresArgs(h)...))
+}
+
+// getConditionSQL returns SQL of condition with query arguments numbered
+// from i, values of the arguments and number of the next argument. Values
+// are validated just like filters. Groups of conditions are in parentheses
+func (c Controller) getConditionSQL(h *Helper, obj interface{}, cond Condition, i int) (string, []interface{}, int, *ErrController) {
+	if cond.Join != "" {
+		if cond.Join != "AND" && cond.Join != "OR" {
+			return "", nil, 0, &ErrController{
+				Op:  "InvalidValue",
+				Err: fmt.Errorf("Invalid join %s", cond.Join),
+			}
+		}
+		if len(cond.Conditions) == 0 {
+			return "", nil, 0, &ErrController{
+				Op:  "InvalidValue",
+				Err: errors.New("Empty group of conditions"),
+			}
+		}
+		s := ""
+		args := []interface{}{}
+		for _, sub := range cond.Conditions {
+			q, subArgs, j, err := c.getConditionSQL(h, obj, sub, i)
+			if err != nil {
+				return "", nil, 0, err
+			}
+			if s != "" {
+				s += " " + cond.Join + " "
+			}
+			s += q
+			args = append(args, subArgs...)
+			i = j
+		}
+		return "(" + s + ")", args, i, nil
+	}
+
+	if h.dbFieldCols[cond.Field] == "" {
+		return "", nil, 0, &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Invalid field %s", cond.Field),
+		}
+	}
+	filters := map[string]interface{}{
+		cond.Field: FilterCondition{Operator: strings.ToUpper(cond.Operator), Value: cond.Value},
+	}
+	filters, dbFilters, err := c.prepareFilters(h, obj, filters)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	q, i := h.getFiltersCondition(filters, nil, i)
+	return q, h.GetFilterArgs(dbFilters), i, nil
+}
@@ -0,0 +1,117 @@
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+)
+
+// OperationInfo describes operation that hooks, query interceptors and event
+// publishers with context are called for
+type OperationInfo struct {
+	// Model is name of the struct, eg. "User"
+	Model string
+	// Tbl is name of model's database table
+	Tbl string
+	// Op is OpCreate, OpRead, OpUpdate, OpDelete or OpList
+	Op int
+	// Actor is ID of the authenticated user attached to the context with
+	// WithIdentity or WithActor, or 0 when there is none
+	Actor int64
+	// Request is the HTTP request that the operation is made for, or nil
+	// when the operation is not made by HTTP handler
+	Request *http.Request
+}
+
+// WithContext returns copy of the controller that runs its operations with
+// the context: database queries are cancelled when it is done and it is passed
+// to hooks and query interceptors. HTTP handler uses context of the request
+func (c Controller) WithContext(ctx context.Context) *Controller {
+	c.ctx = ctx
+	return &c
+}
+
+// WithActor returns copy of context with ID of the user (or other actor) that
+// operations are made by, which is passed to hooks in OperationInfo
+func WithActor(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, identityCtxKey{}, id)
+}
+
+// AddContextHook registers a hook that gets context and OperationInfo. It is
+// run along with the ones added with AddHook, in the same order
+func (c *Controller) AddContextHook(when int, fn ContextHookFunc) {
+	c.hooks[when] = append(c.hooks[when], fn)
+}
+
+// AddContextQueryInterceptor registers an interceptor that gets context and
+// OperationInfo. It is run along with the ones added with AddQueryInterceptor,
+// in the same order
+func (c *Controller) AddContextQueryInterceptor(fn ContextQueryInterceptor) {
+	c.queryInterceptors = append(c.queryInterceptors, fn)
+}
+
+// withRequest returns copy of the controller that runs operations with
+// context of HTTP request
+func (c Controller) withRequest(r *http.Request) Controller {
+	c.ctx = r.Context()
+	c.req = r
+	return c
+}
+
+// getContext returns context set with WithContext or background context
+func (c Controller) getContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// getOperationInfo returns OperationInfo of operation on objects of a model.
+// h can be nil when object is not a valid model
+func (c Controller) getOperationInfo(h *Helper, op int) OperationInfo {
+	info := OperationInfo{
+		Op:      op,
+		Actor:   getContextIdentity(c.getContext()),
+		Request: c.req,
+	}
+	if h != nil {
+		info.Tbl = h.dbTbl
+		info.Model = h.modelName
+	}
+	return info
+}
+
+// dbContextQuerier is implemented by both *sql.DB and *sql.Tx
+type dbContextQuerier interface {
+	dbQuerier
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// ctxQuerier is dbQuerier that runs queries with context
+type ctxQuerier struct {
+	q   dbContextQuerier
+	ctx context.Context
+}
+
+func (q ctxQuerier) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return q.q.ExecContext(q.ctx, query, args...)
+}
+
+func (q ctxQuerier) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return q.q.QueryContext(q.ctx, query, args...)
+}
+
+func (q ctxQuerier) QueryRow(query string, args ...interface{}) *sql.Row {
+	return q.q.QueryRowContext(q.ctx, query, args...)
+}
+
+// withContextQuerier returns querier that runs queries with context set with
+// WithContext, or q when there is none
+func (c Controller) withContextQuerier(q dbContextQuerier) dbQuerier {
+	if c.ctx == nil {
+		return q
+	}
+	return ctxQuerier{q: q, ctx: c.ctx}
+}
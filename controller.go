@@ -1,10 +1,15 @@
 package crud
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -12,14 +17,89 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+var idRegExp = regexp.MustCompile(`^[0-9]+$`)
+var paramNameRegExp = regexp.MustCompile(`^[0-9a-zA-Z_]+$`)
+
+// uniqueViolationRegExp matches detail of unique violation error returned by
+// the database, eg. "Key (slug)=(post) already exists."
+var uniqueViolationRegExp = regexp.MustCompile(`^Key \(([^)]+)\)=\((.*)\) already exists`)
+
+// listParams are query parameters accepted by HTTP list endpoint, apart from
+// the ones starting with "filter_"
+var listParamNames = []string{"limit", "offset", "order", "order_direction", "include", "join", "count"}
+
 // Controller is the main component that gets and saves objects in the database
 // and generates CRUD HTTP handler that can be attached to an HTTP server.
+//
+// Controller is configured with methods that have pointer receiver, such as
+// AddRelation, AddHook, SetQueryHints or MountEndpoints, which must be called
+// before it is shared. After that it is safe to use it from many goroutines,
+// eg. in HTTP handlers: the other methods do not modify the configuration and
+// Helpers of models, which are created lazily, are guarded by a lock.
 type Controller struct {
 	dbConn       *sql.DB
+	tx           *sql.Tx
 	dbTblPrefix  string
 	modelHelpers map[string]*Helper
+	helpersMu    *sync.RWMutex
+	devMode      bool
+	verboseErrs  bool
+	errLogger    func(err *ErrController)
+	clock        Clock
+	serializer   Serializer
+	serializers  map[string]Serializer
+	strictMode   bool
+	sortedDDL    bool
+	strictParams bool
+	queryHints   map[string]map[int]QueryHints
+	orders       map[string][]string
+	hooks        map[int][]ContextHookFunc
+	outbox       bool
+	compressMin  int
+	relations    map[string]map[string]Relation
+	endpoints    map[string][]EndpointDescription
+	summaries    map[string]Summary
+	subjects     map[string]SubjectModel
+	webhooks     map[string][]Webhook
+	formatters   map[string]map[string]FieldFormatter
+	flagNames    map[string]map[string]flagBit
+	versioned    map[string]bool
+	metrics      *metrics
+	pool         *poolMonitor
+	jsonNaming   int
+	secondary    *secondaryDB
+	mirrorQueue  *[]mirrorWrite
+	tasksWG      *sync.WaitGroup
+	// taskOutputLimit is the maximum size of output of task in bytes
+	taskOutputLimit int
+
+	sessionSettings map[string]string
+	shareSecret     []byte
+
+	queryInterceptors []ContextQueryInterceptor
+
+	ctx context.Context
+	req *http.Request
+
+	withDeleted bool
+
+	dynamicModels map[reflect.Type]string
+
+	typeConverters map[reflect.Type]*TypeConverter
+}
+
+// dbQuerier is implemented by both *sql.DB and *sql.Tx so that the generated
+// queries can be run either directly or within a transaction
+type dbQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 // Values for CRUD operations
@@ -34,16 +114,417 @@ func NewController(dbConn *sql.DB, tblPrefix string) *Controller {
 	c := &Controller{
 		dbConn:      dbConn,
 		dbTblPrefix: tblPrefix,
+		clock:       systemClock{},
+		serializer:  JSONSerializer{},
 	}
 	c.modelHelpers = make(map[string]*Helper)
+	c.helpersMu = &sync.RWMutex{}
+	c.tasksWG = &sync.WaitGroup{}
+	c.taskOutputLimit = defaultTaskOutputLimit
+	c.queryHints = make(map[string]map[int]QueryHints)
+	c.orders = make(map[string][]string)
+	c.hooks = make(map[int][]ContextHookFunc)
+	c.dynamicModels = make(map[reflect.Type]string)
+	c.relations = make(map[string]map[string]Relation)
+	c.endpoints = make(map[string][]EndpointDescription)
+	c.summaries = make(map[string]Summary)
+	c.subjects = make(map[string]SubjectModel)
+	c.webhooks = make(map[string][]Webhook)
+	c.formatters = make(map[string]map[string]FieldFormatter)
+	c.flagNames = make(map[string]map[string]flagBit)
+	c.versioned = make(map[string]bool)
+	c.typeConverters = make(map[reflect.Type]*TypeConverter)
+	c.serializers = make(map[string]Serializer)
+	for _, s := range []Serializer{JSONSerializer{}, MsgpackSerializer{}, CBORSerializer{}} {
+		c.RegisterSerializer(s)
+	}
+	return c
+}
+
+// EnableMetrics starts collecting number of database operations, errors and
+// latencies per model, that are returned by GetMetrics. It is meant for
+// debugging, eg. in development
+func (c *Controller) EnableMetrics() {
+	c.metrics = newMetrics()
+}
+
+// GetMetrics returns statistics of database operations per model table and
+// operation name ("create", "read", "update", "delete" and "list"), with
+// p50 and p95 latencies of the latest operations. It returns nil when metrics
+// are not enabled
+func (c Controller) GetMetrics() map[string]map[string]*OpMetrics {
+	if c.metrics == nil {
+		return nil
+	}
+	return c.metrics.snapshot()
+}
+
+// GetMetricsHTTPHandler returns HTTP handler that responds with snapshot of
+// metrics and statistics of the connection pool
+func (c Controller) GetMetricsHTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c := c.withResponseSerializer(r)
+		if c.metrics == nil {
+			c.writeErrText(w, http.StatusNotFound, "metrics_disabled")
+			return
+		}
+		c.writeOK(w, http.StatusOK, map[string]interface{}{
+			"metrics": c.metrics.snapshot(),
+			"pool":    c.GetPoolStats(),
+		})
+	})
+}
+
+// SetClock sets the source of current time, which is the system clock by
+// default
+func (c *Controller) SetClock(clock Clock) {
+	c.clock = clock
+}
+
+// SetSerializer sets Serializer of bodies of HTTP requests and responses,
+// which is JSONSerializer by default. It is used when the request does not
+// specify any of the registered content types
+func (c *Controller) SetSerializer(s Serializer) {
+	c.serializer = s
+	c.RegisterSerializer(s)
+}
+
+// RegisterSerializer makes HTTP handler accept bodies of requests with
+// Content-Type of the Serializer, and respond with it when it is in the
+// Accept header. JSON, MessagePack and CBOR serializers are registered by
+// default
+func (c *Controller) RegisterSerializer(s Serializer) {
+	c.serializers[s.ContentType()] = s
+}
+
+// getRequestSerializer returns registered Serializer matching Content-Type of
+// the request, or the default one
+func (c Controller) getRequestSerializer(r *http.Request) Serializer {
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err == nil && c.serializers[t] != nil {
+		return c.serializers[t]
+	}
+	return c.serializer
+}
+
+// withResponseSerializer returns copy of the controller that writes
+// responses with the first registered Serializer from the Accept header of
+// the request
+func (c Controller) withResponseSerializer(r *http.Request) Controller {
+	for _, a := range strings.Split(r.Header.Get("Accept"), ",") {
+		t, _, err := mime.ParseMediaType(strings.TrimSpace(a))
+		if err == nil && c.serializers[t] != nil {
+			c.serializer = c.serializers[t]
+			break
+		}
+	}
 	return c
 }
 
+// RegisterTypeConverter makes fields of type t stored in columns of dbType
+// type, with values converted using toDB and fromDB funcs. fromDB is also used
+// to convert filter values from the HTTP endpoint URI. Converters must be
+// registered before the models are used
+func (c *Controller) RegisterTypeConverter(t reflect.Type, dbType string, toDB func(interface{}) (driver.Value, error), fromDB func(interface{}) (interface{}, error)) {
+	c.typeConverters[t] = &TypeConverter{
+		DBType: dbType,
+		ToDB:   toDB,
+		FromDB: fromDB,
+	}
+}
+
+// DefineModel creates a model from schema at runtime, so that application can
+// add models without compiling structs for them. Objects of the model are
+// created with New method of returned DynamicModel
+func (c *Controller) DefineModel(schema ModelSchema) (*DynamicModel, *ErrController) {
+	t, err := getDynamicModelType(schema)
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DefineModel",
+			Err: fmt.Errorf("Error defining model: %w", err),
+		}
+	}
+	c.dynamicModels[t] = schema.Name
+	m := &DynamicModel{
+		name: schema.Name,
+		typ:  t,
+	}
+	_, err2 := c.getHelper(m.New())
+	if err2 != nil {
+		delete(c.dynamicModels, t)
+		return nil, err2
+	}
+	return m, nil
+}
+
+// SetStrictMode enables or disables strict mode. In strict mode, structs
+// with exported fields of unsupported types cause an error when they are used
+// for the first time, instead of fields being silently skipped
+func (c *Controller) SetStrictMode(b bool) {
+	c.strictMode = b
+}
+
+// SetStrictQueryParams enables or disables strict query parameters mode. In
+// this mode, HTTP list requests with unknown query parameters (eg. a typo like
+// "ofset") or filters on non-existing fields are rejected with "400 Bad
+// Request" instead of being ignored
+func (c *Controller) SetStrictQueryParams(b bool) {
+	c.strictParams = b
+}
+
+// SetCompression enables gzip compression of HTTP responses that are at least
+// minSize bytes long, when client accepts it. Large lists benefit from it the
+// most. 0 disables compression. Only gzip is supported
+func (c *Controller) SetCompression(minSize int) {
+	c.compressMin = minSize
+}
+
+// SetSortedDDL enables or disables sorting columns by name in "CREATE TABLE"
+// queries executed by CreateDBTable, so that the generated DDL stays the same
+// when fields are reordered in the struct
+func (c *Controller) SetSortedDDL(b bool) {
+	c.sortedDDL = b
+}
+
+// SetQueryHints registers static SQL fragments that are added to queries
+// generated for specific model and operation (OpRead, OpList etc.). Hints are
+// shared between the model and all its structs used in HTTP handler
+func (c *Controller) SetQueryHints(obj interface{}, op int, hints QueryHints) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	if c.queryHints[h.dbTbl] == nil {
+		c.queryHints[h.dbTbl] = make(map[int]QueryHints)
+	}
+	c.queryHints[h.dbTbl][op] = hints
+	return nil
+}
+
+// AddHook registers a hook that is run for objects of every model, either
+// before (HookBefore) or after (HookAfter) they are saved, read, deleted or
+// listed. Hooks run before the operation are called in the order they were
+// added, and the ones run after it in the reverse order. Hooks for OpList are
+// called with an empty object before the query and with each of the returned
+// objects after it
+func (c *Controller) AddHook(when int, fn HookFunc) {
+	c.AddContextHook(when, func(ctx context.Context, info OperationInfo, obj interface{}) error {
+		return fn(info.Op, obj)
+	})
+}
+
+// SetOutbox enables or disables the transactional outbox. When enabled, every
+// object that is created, updated or deleted gets an event recorded in the
+// outbox table in the same transaction, and OutboxDispatcher publishes these
+// events later. Fields with "sensitive" tag are not included in the payload. Outbox table must be created with CreateOutboxTable
+func (c *Controller) SetOutbox(b bool) {
+	c.outbox = b
+}
+
+// CreateOutboxTable creates the outbox table if it does not exist
+func (c Controller) CreateOutboxTable() *ErrController {
+	_, err := c.dbConn.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (event_id BIGSERIAL PRIMARY KEY,event_tbl VARCHAR(255) DEFAULT '',event_op INTEGER DEFAULT 0,event_obj_id BIGINT DEFAULT 0,event_payload JSONB,event_created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),event_dispatched_at TIMESTAMP WITH TIME ZONE)", c.getOutboxTbl()))
+	if err != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	return nil
+}
+
+// AddQueryInterceptor registers an interceptor that can rewrite queries of
+// every model before they are executed. Interceptors are called in the order
+// they were added, each getting the query returned by the previous one.
+// Updates and deletes are passed without their RETURNING clause, so that
+// conditions can be appended to them. Interceptors must be added before HTTP
+// handlers are created
+func (c *Controller) AddQueryInterceptor(fn QueryInterceptor) {
+	c.AddContextQueryInterceptor(func(ctx context.Context, info OperationInfo, query string, args []interface{}) (string, []interface{}, error) {
+		return fn(info.Tbl, info.Op, query, args)
+	})
+}
+
+// AddRelation registers relation that can be embedded in objects returned by
+// HTTP endpoint when its name is passed in the "include" query parameter, eg.
+// "?include=created_by_user". fieldName is the field of obj containing ID of
+// the related object. Relations are shared between the model and all its
+// structs used in HTTP handler
+func (c *Controller) AddRelation(obj interface{}, name string, fieldName string, newObjFunc func() interface{}) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	if h.fieldsFlags[fieldName]&(TypeInt64|TypeInt) == 0 {
+		return &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Field %s is not an int64", fieldName),
+		}
+	}
+	_, err = c.getHelper(newObjFunc())
+	if err != nil {
+		return err
+	}
+	if c.relations[h.dbTbl] == nil {
+		c.relations[h.dbTbl] = make(map[string]Relation)
+	}
+	c.relations[h.dbTbl][name] = Relation{
+		Field:      fieldName,
+		NewObjFunc: newObjFunc,
+	}
+	return nil
+}
+
+// SetFieldFormatter sets function that formats value of a field in HTTP
+// responses, eg. to render Unix timestamp as a date in the locale of the
+// request, without changing the stored value. Like relations, formatters are
+// shared between the model and all its structs used in HTTP handler
+func (c *Controller) SetFieldFormatter(obj interface{}, fieldName string, fn FieldFormatter) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	if h.dbFieldCols[fieldName] == "" {
+		return &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Invalid field %s", fieldName),
+		}
+	}
+	if c.formatters[h.dbTbl] == nil {
+		c.formatters[h.dbTbl] = make(map[string]FieldFormatter)
+	}
+	c.formatters[h.dbTbl][fieldName] = fn
+	return nil
+}
+
+// AddSummary registers obj as summary model, whose table is filled with
+// numbers of objects of the source model by RefreshSummary. obj's table has
+// to be created just like tables of other models
+func (c *Controller) AddSummary(obj interface{}, summary Summary) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	if summary.Source == nil {
+		return &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Summary has no source"),
+		}
+	}
+	sh, err := c.getHelper(summary.Source())
+	if err != nil {
+		return err
+	}
+	if h.fieldsFlags[summary.CountField]&TypeInt64 == 0 {
+		return &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Field %s is not an int64", summary.CountField),
+		}
+	}
+	if len(summary.GroupBy) == 0 {
+		return &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Summary has no fields to group by"),
+		}
+	}
+	for _, f := range summary.GroupBy {
+		if f == "ID" || h.dbFieldCols[f] == "" || sh.dbFieldCols[f] == "" {
+			return &ErrController{
+				Op:  "InvalidField",
+				Err: fmt.Errorf("Invalid field %s", f),
+			}
+		}
+	}
+	c.summaries[h.dbTbl] = summary
+	return nil
+}
+
+// SetDefaultOrder sets order used by list queries of specific model when no
+// order is passed, eg. []string{"CreatedAt", "desc", "Name", "asc"}. Like
+// query hints, it is shared between the model and all its structs used in HTTP
+// handler
+func (c *Controller) SetDefaultOrder(obj interface{}, order []string) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	if len(order)%2 != 0 {
+		return &ErrController{
+			Op:  "InvalidOrder",
+			Err: fmt.Errorf("order must contain pairs of field and direction"),
+		}
+	}
+	for i := 0; i < len(order); i += 2 {
+		if h.dbFieldCols[order[i]] == "" {
+			return &ErrController{
+				Op:  "InvalidOrder",
+				Err: fmt.Errorf("invalid field %s", order[i]),
+			}
+		}
+		if d := strings.ToLower(order[i+1]); d != "asc" && d != "desc" {
+			return &ErrController{
+				Op:  "InvalidOrder",
+				Err: fmt.Errorf("invalid direction %s", order[i+1]),
+			}
+		}
+	}
+	c.orders[h.dbTbl] = order
+	return nil
+}
+
+// SetDevMode enables or disables development mode. In development mode, HTTP
+// list requests with "X-Crud-Explain: 1" header return query plan instead of
+// the objects
+func (c *Controller) SetDevMode(b bool) {
+	c.devMode = b
+}
+
+// SetJSONNaming sets naming of object keys in HTTP requests and responses,
+// which is JSONNamingTags (names from json tags) by default. With
+// JSONNamingCamelCase, keys are converted to camelCase, eg. "first_name" to
+// "firstName", which is what JavaScript frontends usually expect. Keys of
+// nested structs, eg. in JSONB fields and related objects, are converted as
+// well, and request bodies are accepted with keys in camelCase
+func (c *Controller) SetJSONNaming(naming int) {
+	c.jsonNaming = naming
+}
+
+// SetVerboseErrors enables or disables adding full error messages (with
+// operation name) to the HTTP error responses. As messages of database errors
+// may contain SQL and values, it is meant for development only. By default,
+// responses contain only the error codes, eg. "cannot_get_from_db"
+func (c *Controller) SetVerboseErrors(b bool) {
+	c.verboseErrs = b
+}
+
+// SetErrorLogger sets func that gets full errors, which are not written to the
+// HTTP responses
+func (c *Controller) SetErrorLogger(fn func(err *ErrController)) {
+	c.errLogger = fn
+}
+
+// logError passes error to the error logger, when it is set
+func (c Controller) logError(err *ErrController) {
+	if c.errLogger != nil {
+		c.errLogger(err)
+	}
+}
+
 // DropDBTables drop tables in the database for specified objects (see
 // DropDBTable for a single struct)
 func (c Controller) DropDBTables(xobj ...interface{}) *ErrController {
+	return c.DropDBTablesWithOptions(DDLOptions{}, xobj...)
+}
+
+// DropDBTablesWithOptions works like DropDBTables but the "DROP TABLE" queries
+// are changed according to opts
+func (c Controller) DropDBTablesWithOptions(opts DDLOptions, xobj ...interface{}) *ErrController {
 	for _, obj := range xobj {
-		err := c.DropDBTable(obj)
+		err := c.DropDBTableWithOptions(obj, opts)
 		if err != nil {
 			return err
 		}
@@ -54,8 +535,14 @@ func (c Controller) DropDBTables(xobj ...interface{}) *ErrController {
 // CreateDBTables creates tables in the database for specified objects (see
 // CreateDBTable for a single struct)
 func (c Controller) CreateDBTables(xobj ...interface{}) *ErrController {
+	return c.CreateDBTablesWithOptions(DDLOptions{}, xobj...)
+}
+
+// CreateDBTablesWithOptions works like CreateDBTables but the "CREATE TABLE"
+// queries are changed according to opts
+func (c Controller) CreateDBTablesWithOptions(opts DDLOptions, xobj ...interface{}) *ErrController {
 	for _, obj := range xobj {
-		err := c.CreateDBTable(obj)
+		err := c.CreateDBTableWithOptions(obj, opts)
 		if err != nil {
 			return err
 		}
@@ -68,37 +555,154 @@ func (c Controller) CreateDBTables(xobj ...interface{}) *ErrController {
 // (all lowercase with underscore), assigns column type based on the field type,
 // and then executes "CREATE TABLE" query on attached DB connection
 func (c Controller) CreateDBTable(obj interface{}) *ErrController {
+	return c.CreateDBTableWithOptions(obj, DDLOptions{})
+}
+
+// CreateDBTableWithOptions works like CreateDBTable but the "CREATE TABLE"
+// query is changed according to opts, and row-level security and grants are
+// added when set in opts. When table already exists, returned error has Op
+// set to "DBTableExists"
+func (c Controller) CreateDBTableWithOptions(obj interface{}, opts DDLOptions) *ErrController {
 	h, err := c.getHelper(obj)
 	if err != nil {
 		return err
 	}
 
-	_, err2 := c.dbConn.Exec(h.GetQueryCreateTable())
-	if err2 != nil {
-		return &ErrController{
-			Op:  "DBQuery",
-			Err: fmt.Errorf("Error executing DB query: %w", err2),
+	if c.sortedDDL {
+		opts.Sorted = true
+	}
+	for _, q := range h.GetQueriesCreateTableWithOptions(opts) {
+		_, err2 := c.dbConn.Exec(q)
+		if err2 != nil {
+			return c.getDDLError(err2)
+		}
+	}
+	return nil
+}
+
+// CreateDBIndexes creates indexes declared with "index" tags of specified
+// objects that do not exist yet, eg. when tags are added to structs of
+// existing tables. Indexes are built concurrently, so that writes to the
+// tables are not blocked, and index that failed to build is dropped.
+// CreateDBTable creates them together with the table
+func (c Controller) CreateDBIndexes(xobj ...interface{}) *ErrController {
+	for _, obj := range xobj {
+		h, err := c.getHelper(obj)
+		if err != nil {
+			return err
+		}
+		names := h.getIndexNames()
+		for i, q := range h.GetQueriesCreateIndexesConcurrently() {
+			_, err2 := c.dbConn.Exec(q)
+			if err2 != nil {
+				// Failed concurrent build leaves an invalid index
+				c.dbConn.Exec(fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s", names[i]))
+				return c.getDDLError(err2)
+			}
 		}
 	}
 	return nil
 }
 
+// GetDDL returns queries that CreateDBTableWithOptions would execute, eg. to
+// save them in a migration file
+func (c Controller) GetDDL(obj interface{}, opts DDLOptions) ([]string, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	if c.sortedDDL {
+		opts.Sorted = true
+	}
+	return h.GetQueriesCreateTableWithOptions(opts), nil
+}
+
 // DropDBTable drops database table used to store specified type of objects. It
 // just takes struct name, converts it to lowercase-with-underscore table name
 // and executes "DROP TABLE" query using attached DB connection
 func (c Controller) DropDBTable(obj interface{}) *ErrController {
+	return c.DropDBTableWithOptions(obj, DDLOptions{})
+}
+
+// DropDBTableWithOptions works like DropDBTable but the "DROP TABLE" query is
+// changed according to opts. When other objects depend on the table and
+// Cascade is not set, returned error has Op set to "DBTableHasDependents".
+// Sequence of the ID column set with "seq" tag is dropped as well, unless it
+// is still used by another table
+func (c Controller) DropDBTableWithOptions(obj interface{}, opts DDLOptions) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+
+	_, err2 := c.dbConn.Exec(h.GetQueryDropTableWithOptions(opts))
+	if err2 != nil {
+		return c.getDDLError(err2)
+	}
+	if query := h.GetQueryDropIDSequence(); query != "" {
+		_, err2 = c.dbConn.Exec(query)
+		if err2 != nil && c.getDDLError(err2).Op != "DBTableHasDependents" {
+			return c.getDDLError(err2)
+		}
+	}
+	return nil
+}
+
+// RenameDBTableColumns renames columns of fields that have previous column
+// name set with the "was" tag, eg. `crud:"was:old_name"`, so that the data is
+// kept when a field is renamed. Only columns that exist under the previous
+// name and do not exist under the new one are renamed, so it is safe to call
+// it many times
+func (c Controller) RenameDBTableColumns(obj interface{}) *ErrController {
 	h, err := c.getHelper(obj)
 	if err != nil {
 		return err
 	}
 
-	_, err2 := c.dbConn.Exec(h.GetQueryDropTable())
+	qs := h.GetQueriesRenameColumns()
+	renamedCols := h.getRenamedCols()
+	if len(qs) == 0 {
+		return nil
+	}
+
+	rows, err2 := c.dbConn.Query("SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1", h.dbTbl)
 	if err2 != nil {
 		return &ErrController{
 			Op:  "DBQuery",
 			Err: fmt.Errorf("Error executing DB query: %w", err2),
 		}
 	}
+	defer rows.Close()
+	existing := map[string]bool{}
+	for rows.Next() {
+		var col string
+		err3 := rows.Scan(&col)
+		if err3 != nil {
+			return &ErrController{
+				Op:  "DBQueryRowsScan",
+				Err: fmt.Errorf("Error scanning DB query row: %w", err3),
+			}
+		}
+		existing[col] = true
+	}
+
+	oldCols := []string{}
+	for oldCol := range qs {
+		oldCols = append(oldCols, oldCol)
+	}
+	sort.Strings(oldCols)
+	for _, oldCol := range oldCols {
+		if !existing[oldCol] || existing[renamedCols[oldCol]] {
+			continue
+		}
+		_, err4 := c.dbConn.Exec(qs[oldCol])
+		if err4 != nil {
+			return &ErrController{
+				Op:  "DBQuery",
+				Err: fmt.Errorf("Error executing DB query: %w", err4),
+			}
+		}
+	}
 	return nil
 }
 
@@ -107,14 +711,40 @@ func (c Controller) DropDBTable(obj interface{}) *ErrController {
 // If ID field is already set (it's greater than 0) then the function assumes
 // that record with such ID already exists in the database and the function with
 // execute an "UPDATE" query. Otherwise it will be "INSERT". After inserting,
-// new record ID is set to struct's ID field
+// new record ID is set to struct's ID field. After updating, all the fields
+// are set to the values returned by the database, eg. modified by triggers
 func (c Controller) SaveToDB(obj interface{}) *ErrController {
+	return c.saveToDB(obj, false)
+}
+
+// saveToDB works like SaveToDB, but transformations defined in tags are not
+// applied when transformed is true, as caller has done it already
+func (c Controller) saveToDB(obj interface{}, transformed bool) *ErrController {
 	h, err := c.getHelper(obj)
 	if err != nil {
 		return err
 	}
 
-	b, invalidFields, err2 := c.Validate(obj, nil)
+	op := OpCreate
+	if c.GetModelIDValue(obj) != 0 {
+		op = OpUpdate
+	}
+	errHook := c.runHooks(HookBefore, op, obj)
+	if errHook != nil {
+		return errHook
+	}
+
+	if !transformed {
+		h.transformFields(reflect.ValueOf(obj).Elem())
+	}
+	c.setTimestampFields(h, obj, op)
+
+	var slugs []string
+	if c.GetModelIDValue(obj) == 0 {
+		slugs = c.setSlugs(h, obj)
+	}
+
+	b, invalidFields, err2 := c.ValidateWithOptions(obj, nil, ValidationOptions{Op: op})
 	if err2 != nil {
 		return &ErrController{
 			Op:  "Validate",
@@ -131,11 +761,67 @@ func (c Controller) SaveToDB(obj interface{}) *ErrController {
 		}
 	}
 
+	missing, err4 := c.getMissingReferences(h, obj)
+	if err4 != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err4),
+		}
+	}
+	if len(missing) > 0 {
+		return &ErrController{
+			Op: "Validate",
+			Err: &ErrValidation{
+				Fields: missing,
+				Err:    errors.New("Linked objects do not exist"),
+			},
+		}
+	}
+
 	var err3 error
+	written := false
 	if c.GetModelIDValue(obj) != 0 {
-		_, err3 = c.dbConn.Exec(h.GetQueryUpdateById(), append(c.GetModelFieldInterfaces(obj), c.GetModelIDInterface(obj))...)
+		query, args, errI := c.interceptQuery(h, OpUpdate, h.GetQueryUpdateById(), append(c.GetModelFieldInterfaces(obj), c.GetModelIDInterface(obj)))
+		if errI != nil {
+			return errI
+		}
+		// RETURNING is added after interceptors, which can append conditions
+		query += h.queryReturning
+		err3 = c.runWithHints(h, OpUpdate, func(q dbQuerier) error {
+			err := c.recordVersion(q, h, OpUpdate, c.GetModelIDValue(obj))
+			if err != nil {
+				return err
+			}
+			err = q.QueryRow(query, args...).Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			written = true
+			return c.recordEvent(q, h, OpUpdate, obj)
+		})
 	} else {
-		err3 = c.dbConn.QueryRow(h.GetQueryInsert(), c.GetModelFieldInterfaces(obj)...).Scan(c.GetModelIDInterface(obj))
+		for {
+			query, args, errI := c.interceptQuery(h, OpCreate, h.GetQueryInsert(), c.GetModelFieldInterfaces(obj))
+			if errI != nil {
+				return errI
+			}
+			err3 = c.runWithHints(h, OpCreate, func(q dbQuerier) error {
+				err := q.QueryRow(query, args...).Scan(c.GetModelIDInterface(obj))
+				if err != nil {
+					return err
+				}
+				written = true
+				return c.recordEvent(q, h, OpCreate, obj)
+			})
+			// Generated slug that has been taken in the meantime is changed and
+			// insert is retried, unless it has aborted the caller's transaction
+			if err3 == nil || c.tx != nil || !c.setNextFreeSlug(h, []interface{}{obj}, map[interface{}][]string{obj: slugs}, nil, err3) {
+				break
+			}
+		}
 	}
 	if err3 != nil {
 		return &ErrController{
@@ -143,81 +829,1270 @@ func (c Controller) SaveToDB(obj interface{}) *ErrController {
 			Err: fmt.Errorf("Error executing DB query: %w", err3),
 		}
 	}
-	return nil
+	if written {
+		c.mirrorObject(h, op, obj)
+	}
+	return c.runHooks(HookAfter, op, obj)
 }
 
-// SetFromDB sets object's fields with values from the database table with a
-// specific id. If record does not exist in the database, all field values in
-// the struct are zeroed
-func (c Controller) SetFromDB(obj interface{}, id string) *ErrController {
-	idInt, err := strconv.Atoi(id)
+// UpdateWhere updates an existing object in the database only when the
+// current values of fields in guard match, eg. {"Status": "pending"}, and
+// returns number of updated rows, which is 0 when they do not. It can be used
+// for compare-and-set workflows
+func (c Controller) UpdateWhere(obj interface{}, guard map[string]interface{}) (int64, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return 0, err
+	}
+	if c.GetModelIDValue(obj) == 0 {
+		return 0, &ErrController{
+			Op:  "InvalidValue",
+			Err: errors.New("Object has no ID"),
+		}
+	}
+
+	errHook := c.runHooks(HookBefore, OpUpdate, obj)
+	if errHook != nil {
+		return 0, errHook
+	}
+
+	h.transformFields(reflect.ValueOf(obj).Elem())
+	c.setTimestampFields(h, obj, OpUpdate)
+
+	b, invalidFields, err2 := c.ValidateWithOptions(obj, nil, ValidationOptions{Op: OpUpdate})
+	if err2 != nil {
+		return 0, &ErrController{
+			Op:  "Validate",
+			Err: fmt.Errorf("Error when trying to validate: %w", err2),
+		}
+	}
+	if !b {
+		return 0, &ErrController{
+			Op: "Validate",
+			Err: &ErrValidation{
+				Fields: invalidFields,
+			},
+		}
+	}
+
+	guard, dbGuard, err1 := c.prepareFilters(h, obj, guard)
+	if err1 != nil {
+		return 0, err1
+	}
+
+	args := append(c.GetModelFieldInterfaces(obj), c.GetModelIDInterface(obj))
+	query, args, errI := c.interceptQuery(h, OpUpdate, h.getQueryUpdateByIdWhere(guard), append(args, h.GetFilterArgs(dbGuard)...))
+	if errI != nil {
+		return 0, errI
+	}
+	query += h.queryReturning
+	var cnt int64
+	err3 := c.runWithHints(h, OpUpdate, func(q dbQuerier) error {
+		// Version is recorded only when guard matches and the row is updated
+		payloads, err := c.getVersionPayloadsByIDs(q, h, OpUpdate, []int64{c.GetModelIDValue(obj)})
+		if err != nil {
+			return err
+		}
+		err = q.QueryRow(query, args...).Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cnt = 1
+		err = c.recordVersionPayload(q, h, c.GetModelIDValue(obj), payloads)
+		if err != nil {
+			return err
+		}
+		return c.recordEvent(q, h, OpUpdate, obj)
+	})
+	if err3 != nil {
+		return 0, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err3),
+		}
+	}
+	if cnt == 0 {
+		return 0, nil
+	}
+	c.mirrorObject(h, OpUpdate, obj)
+	return cnt, c.runHooks(HookAfter, OpUpdate, obj)
+}
+
+// maxQueryArgs is the maximum number of arguments of a single query in
+// PostgreSQL
+const maxQueryArgs = 65535
+
+// SaveManyToDB saves objects of the same struct in one transaction. Objects
+// without ID get IDs from the sequence and are inserted with multi-row
+// "INSERT" queries, as many rows in each as the limit of arguments allows,
+// and the other ones are updated. Afterwards, all the objects are set to the
+// values returned by the database, such as IDs and defaults. Slugs are unique
+// within the objects as well
+func (c Controller) SaveManyToDB(xobj ...interface{}) *ErrController {
+	if len(xobj) == 0 {
+		return nil
+	}
+	h, err := c.getHelper(xobj[0])
+	if err != nil {
+		return err
+	}
+
+	ops := make([]int, len(xobj))
+	newObjs := []interface{}{}
+	slugs := map[string]map[string]bool{}
+	generatedSlugs := map[interface{}][]string{}
+	for i, obj := range xobj {
+		hObj, err := c.getHelper(obj)
+		if err != nil {
+			return err
+		}
+		if hObj != h {
+			return &ErrController{
+				Op:  "InvalidValue",
+				Err: errors.New("Objects must be of the same struct"),
+			}
+		}
+		ops[i] = OpCreate
+		if c.GetModelIDValue(obj) != 0 {
+			ops[i] = OpUpdate
+		}
+		errHook := c.runHooks(HookBefore, ops[i], obj)
+		if errHook != nil {
+			return errHook
+		}
+
+		h.transformFields(reflect.ValueOf(obj).Elem())
+		c.setTimestampFields(h, obj, ops[i])
+		if ops[i] == OpCreate {
+			generatedSlugs[obj] = c.setSlugsSkipping(h, obj, slugs)
+			newObjs = append(newObjs, obj)
+		}
+
+		b, invalidFields, err2 := c.ValidateWithOptions(obj, nil, ValidationOptions{Op: ops[i]})
+		if err2 != nil {
+			return &ErrController{
+				Op:  "Validate",
+				Err: fmt.Errorf("Error when trying to validate: %w", err2),
+			}
+		}
+		if !b {
+			return &ErrController{
+				Op: "Validate",
+				Err: &ErrValidation{
+					Fields: invalidFields,
+				},
+			}
+		}
+	}
+
+	op := OpUpdate
+	if len(newObjs) > 0 {
+		op = OpCreate
+	}
+	var errI *ErrController
+	// Objects that have been written, with their operations, to be mirrored
+	// to the secondary database
+	var written []interface{}
+	var writtenOps []int
+	save := func(q dbQuerier) error {
+		written, writtenOps = written[:0], writtenOps[:0]
+		if len(newObjs) > 0 {
+			err := c.setNextIDs(q, h, newObjs)
+			if err != nil {
+				return err
+			}
+			n := maxQueryArgs / len(h.fields)
+			for from := 0; from < len(newObjs); from += n {
+				to := from + n
+				if to > len(newObjs) {
+					to = len(newObjs)
+				}
+				args := []interface{}{}
+				for _, obj := range newObjs[from:to] {
+					args = append(args, c.GetModelIDInterface(obj))
+					args = append(args, c.GetModelFieldInterfaces(obj)...)
+				}
+				var query string
+				query, args, errI = c.interceptQuery(h, OpCreate, h.GetQueryInsertManyWithID(to-from), args)
+				if errI != nil {
+					return errI
+				}
+				err = c.setFromInsertedRows(q, h, newObjs[from:to], query, args)
+				if err != nil {
+					return err
+				}
+			}
+			for _, obj := range newObjs {
+				err = c.recordEvent(q, h, OpCreate, obj)
+				if err != nil {
+					return err
+				}
+				written, writtenOps = append(written, obj), append(writtenOps, OpCreate)
+			}
+		}
+
+		updatedIDs := []int64{}
+		for i, obj := range xobj {
+			if ops[i] == OpUpdate {
+				updatedIDs = append(updatedIDs, c.GetModelIDValue(obj))
+			}
+		}
+		payloads, err := c.getVersionPayloadsByIDs(q, h, OpUpdate, updatedIDs)
+		if err != nil {
+			return err
+		}
+		for i, obj := range xobj {
+			if ops[i] != OpUpdate {
+				continue
+			}
+			var query string
+			var args []interface{}
+			query, args, errI = c.interceptQuery(h, OpUpdate, h.GetQueryUpdateById(), append(c.GetModelFieldInterfaces(obj), c.GetModelIDInterface(obj)))
+			if errI != nil {
+				return errI
+			}
+			query += h.queryReturning
+			err := q.QueryRow(query, args...).Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			err = c.recordVersionPayload(q, h, c.GetModelIDValue(obj), payloads)
+			if err != nil {
+				return err
+			}
+			err = c.recordEvent(q, h, OpUpdate, obj)
+			if err != nil {
+				return err
+			}
+			written, writtenOps = append(written, obj), append(writtenOps, OpUpdate)
+		}
+		return nil
+	}
+	var err3 error
+	for {
+		err3 = c.runInTx(h, op, save)
+		// Generated slug that has been taken in the meantime is changed and
+		// the transaction is retried, unless it is the caller's one
+		if err3 == nil || errI != nil || c.tx != nil || !c.setNextFreeSlug(h, newObjs, generatedSlugs, slugs, err3) {
+			break
+		}
+	}
+	if errI != nil || err3 != nil {
+		// Objects that were not inserted must not look like saved ones
+		for _, obj := range newObjs {
+			reflect.ValueOf(obj).Elem().FieldByName("ID").SetInt(0)
+		}
+	}
+	if errI != nil {
+		return errI
+	}
+	if err3 != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err3),
+		}
+	}
+	if c.secondary != nil {
+		ws := make([]mirrorWrite, 0, len(written))
+		for i, obj := range written {
+			ws = append(ws, c.getMirrorWrite(h, writtenOps[i], obj))
+		}
+		c.mirror(ws)
+	}
+	for i, obj := range xobj {
+		errHook := c.runHooks(HookAfter, ops[i], obj)
+		if errHook != nil {
+			return errHook
+		}
+	}
+	return nil
+}
+
+// setNextIDs sets IDs of objects to the next values of the ID sequence
+func (c Controller) setNextIDs(q dbQuerier, h *Helper, xobj []interface{}) error {
+	rows, err := q.Query(h.GetQueryNextIDs(), len(xobj))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	i := 0
+	for ; rows.Next() && i < len(xobj); i++ {
+		err = rows.Scan(c.GetModelIDInterface(xobj[i]))
+		if err != nil {
+			return err
+		}
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	if i < len(xobj) {
+		return fmt.Errorf("Got %d IDs for %d objects", i, len(xobj))
+	}
+	return nil
+}
+
+// setFromInsertedRows runs insert query that returns rows and sets objects
+// to the values of the rows with their IDs
+func (c Controller) setFromInsertedRows(q dbQuerier, h *Helper, xobj []interface{}, query string, args []interface{}) error {
+	byID := make(map[int64]reflect.Value, len(xobj))
+	for _, obj := range xobj {
+		byID[c.GetModelIDValue(obj)] = reflect.ValueOf(obj).Elem()
+	}
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row := reflect.New(reflect.TypeOf(xobj[0]).Elem()).Interface()
+		err = rows.Scan(append([]interface{}{c.GetModelIDInterface(row)}, c.GetModelFieldInterfaces(row)...)...)
+		if err != nil {
+			return err
+		}
+		val, ok := byID[c.GetModelIDValue(row)]
+		if !ok {
+			continue
+		}
+		for _, k := range h.fields {
+			val.FieldByName(k).Set(reflect.ValueOf(row).Elem().FieldByName(k))
+		}
+	}
+	return rows.Err()
+}
+
+// SaveFieldsToDB updates only the columns of specified fields of an existing
+// object in the database. Only these fields are validated, so it can be used
+// for targeted updates, eg. of flags, without loading the whole object. After
+// updating, all the fields are set to the values returned by the database
+func (c Controller) SaveFieldsToDB(obj interface{}, fields ...string) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	if c.GetModelIDValue(obj) == 0 {
+		return &ErrController{
+			Op:  "InvalidValue",
+			Err: errors.New("Object has no ID"),
+		}
+	}
+	if len(fields) == 0 {
+		return &ErrController{
+			Op:  "InvalidField",
+			Err: errors.New("No fields to save"),
+		}
+	}
+	for _, f := range fields {
+		if f == "ID" || h.dbFieldCols[f] == "" {
+			return &ErrController{
+				Op:  "InvalidField",
+				Err: fmt.Errorf("Field %s cannot be saved", f),
+			}
+		}
+	}
+
+	errHook := c.runHooks(HookBefore, OpUpdate, obj)
+	if errHook != nil {
+		return errHook
+	}
+
+	h.transformFields(reflect.ValueOf(obj).Elem())
+
+	b, invalidFields, err2 := c.ValidateWithOptions(obj, nil, ValidationOptions{Op: OpUpdate, Fields: fields})
+	if err2 != nil {
+		return &ErrController{
+			Op:  "Validate",
+			Err: fmt.Errorf("Error when trying to validate: %w", err2),
+		}
+	}
+	if !b {
+		return &ErrController{
+			Op: "Validate",
+			Err: &ErrValidation{
+				Fields: invalidFields,
+			},
+		}
+	}
+
+	val := reflect.ValueOf(obj).Elem()
+	args := []interface{}{}
+	for _, f := range fields {
+		args = append(args, h.getFieldInterface(val.FieldByName(f), f))
+	}
+	query, args, errI := c.interceptQuery(h, OpUpdate, h.GetQueryUpdateFieldsById(fields), append(args, c.GetModelIDInterface(obj)))
+	if errI != nil {
+		return errI
+	}
+	query += h.queryReturning
+	written := false
+	err3 := c.runWithHints(h, OpUpdate, func(q dbQuerier) error {
+		err := c.recordVersion(q, h, OpUpdate, c.GetModelIDValue(obj))
+		if err != nil {
+			return err
+		}
+		err = q.QueryRow(query, args...).Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		written = true
+		return c.recordEvent(q, h, OpUpdate, obj)
+	})
+	if err3 != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err3),
+		}
+	}
+	if written {
+		c.mirrorObject(h, OpUpdate, obj)
+	}
+	return c.runHooks(HookAfter, OpUpdate, obj)
+}
+
+// SetFromDB sets object's fields with values from the database table with a
+// specific id. If record does not exist in the database, all field values in
+// the struct are zeroed
+func (c Controller) SetFromDB(obj interface{}, id string) *ErrController {
+	idInt, err := strconv.Atoi(id)
 	if err != nil {
 		return &ErrController{
 			Op:  "IDToInt",
 			Err: fmt.Errorf("Error converting string to int: %w", err),
 		}
-	}
+	}
+
+	h, err2 := c.getHelper(obj)
+	if err2 != nil {
+		return err2
+	}
+	errHook := c.runHooks(HookBefore, OpRead, obj)
+	if errHook != nil {
+		return errHook
+	}
+	query, args, errI := c.interceptQuery(h, OpRead, h.GetQuerySelectById(), append([]interface{}{int64(idInt)}, c.getExpiresArgs(h)...))
+	if errI != nil {
+		return errI
+	}
+	err3 := c.runWithHints(h, OpRead, func(q dbQuerier) error {
+		return q.QueryRow(query, args...).Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+	})
+	switch {
+	case err3 == sql.ErrNoRows:
+		c.ResetFields(obj)
+		return nil
+	case err3 != nil:
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err3),
+		}
+	default:
+		return c.runHooks(HookAfter, OpRead, obj)
+	}
+}
+
+// SetFromDBByField sets object's fields with values from the database table
+// where field has a specific value, eg. slug. If record does not exist in the
+// database, all field values in the struct are zeroed
+func (c Controller) SetFromDBByField(obj interface{}, fieldName string, value interface{}) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	errHook := c.runHooks(HookBefore, OpRead, obj)
+	if errHook != nil {
+		return errHook
+	}
+	query, args, errI := c.interceptQuery(h, OpRead, h.GetQuerySelectByField(fieldName), append([]interface{}{value}, c.getExpiresArgs(h)...))
+	if errI != nil {
+		return errI
+	}
+	err2 := c.runWithHints(h, OpRead, func(q dbQuerier) error {
+		return q.QueryRow(query, args...).Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+	})
+	switch {
+	case err2 == sql.ErrNoRows:
+		c.ResetFields(obj)
+		return nil
+	case err2 != nil:
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	default:
+		return c.runHooks(HookAfter, OpRead, obj)
+	}
+}
+
+// DeleteFromDB removes object from the database table and it does that only
+// when ID field is set (greater than 0). Once deleted from the DB, all field
+// values are zeroed
+func (c Controller) DeleteFromDB(obj interface{}) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	if c.GetModelIDValue(obj) == 0 {
+		return nil
+	}
+	errHook := c.runHooks(HookBefore, OpDelete, obj)
+	if errHook != nil {
+		return errHook
+	}
+	query, args := h.GetQueryDeleteById(), []interface{}{c.GetModelIDInterface(obj)}
+	if h.fieldSoftDel != "" {
+		query, args = h.getQuerySoftDeleteById(), append(args, c.clock.Now().Unix())
+	}
+	query, args, errI := c.interceptQuery(h, OpDelete, query, args)
+	if errI != nil {
+		return errI
+	}
+	query += h.queryReturning
+	// Object is set to the values of the deleted row, so that they are
+	// recorded in the outbox and passed to the hooks
+	written := false
+	err2 := c.runWithHints(h, OpDelete, func(q dbQuerier) error {
+		err := q.QueryRow(query, args...).Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		written = true
+		return c.recordEvent(q, h, OpDelete, obj)
+	})
+	if err2 != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	if written {
+		c.mirrorObject(h, OpDelete, obj)
+	}
+	errHook = c.runHooks(HookAfter, OpDelete, obj)
+	c.ResetFields(obj)
+	return errHook
+}
+
+// PurgeFromDB removes objects where int64 field, such as ExpiresAt, is set and
+// its value is lower than before, and returns number of removed rows
+func (c Controller) PurgeFromDB(obj interface{}, fieldName string, before int64) (int64, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return 0, err
+	}
+	if h.fieldsFlags[fieldName]&(TypeInt64|TypeInt) == 0 {
+		return 0, &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Field %s is not an int64", fieldName),
+		}
+	}
+
+	query, args, errI := c.interceptQuery(h, OpDelete, h.GetQueryDeleteOlderThan(fieldName), []interface{}{before})
+	if errI != nil {
+		return 0, errI
+	}
+	var cnt int64
+	var ids []int64
+	err2 := c.runWithHints(h, OpDelete, func(q dbQuerier) error {
+		if c.secondary != nil {
+			// IDs of removed rows are returned, so that they are removed from
+			// the secondary database as well
+			var err error
+			ids, err = c.queryIDs(q, query+" RETURNING "+h.getFieldDBCol("ID"), args)
+			cnt = int64(len(ids))
+			return err
+		}
+		res, err := q.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		cnt, err = res.RowsAffected()
+		return err
+	})
+	if err2 != nil {
+		return 0, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	ws := make([]mirrorWrite, 0, len(ids))
+	for _, id := range ids {
+		ws = append(ws, c.getMirrorRemoval(h, id))
+	}
+	c.mirror(ws)
+	return cnt, nil
+}
+
+// RefreshSummary replaces objects of summary model registered with
+// AddSummary with current numbers of objects of its source model, in a
+// transaction so that readers never see the table empty. It returns number of
+// the summary objects
+func (c Controller) RefreshSummary(obj interface{}) (int64, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return 0, err
+	}
+	summary, ok := c.summaries[h.dbTbl]
+	if !ok {
+		return 0, &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Model %s is not a summary", h.dbTbl),
+		}
+	}
+	src := summary.Source()
+	sh, err := c.getHelper(src)
+	if err != nil {
+		return 0, err
+	}
+	filters, dbFilters, err1 := c.prepareFilters(sh, src, summary.Filters)
+	if err1 != nil {
+		return 0, err1
+	}
+
+	query, args, errI := c.interceptQuery(h, OpCreate, h.GetQueryInsertSummary(sh, summary.GroupBy, summary.CountField, filters), append(sh.GetFilterArgs(dbFilters), c.getExpiresArgs(sh)...))
+	if errI != nil {
+		return 0, errI
+	}
+	var cnt int64
+	var ws []mirrorWrite
+	err2 := c.runInTx(h, OpCreate, func(q dbQuerier) error {
+		if c.secondary == nil {
+			_, err := q.Exec(h.GetQueryDeleteAll())
+			if err != nil {
+				return err
+			}
+			res, err := q.Exec(query, args...)
+			if err != nil {
+				return err
+			}
+			cnt, err = res.RowsAffected()
+			return err
+		}
+
+		// Removed and inserted rows are returned, so that they are mirrored
+		// to the secondary database
+		ws = ws[:0]
+		ids, err := c.queryIDs(q, h.GetQueryDeleteAll()+" RETURNING "+h.getFieldDBCol("ID"), nil)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			ws = append(ws, c.getMirrorRemoval(h, id))
+		}
+		rows, err := q.Query(query+h.queryReturning, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		cnt = 0
+		for rows.Next() {
+			o := reflect.New(reflect.TypeOf(obj).Elem()).Interface()
+			err = rows.Scan(append([]interface{}{c.GetModelIDInterface(o)}, c.GetModelFieldInterfaces(o)...)...)
+			if err != nil {
+				return err
+			}
+			ws = append(ws, c.getMirrorWrite(h, OpCreate, o))
+			cnt++
+		}
+		return rows.Err()
+	})
+	if err2 != nil {
+		return 0, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	c.mirror(ws)
+	return cnt, nil
+}
+
+// PurgeExpiredFromDB removes objects that expired, based on the field with
+// "expires" tag, and returns number of removed rows
+func (c Controller) PurgeExpiredFromDB(obj interface{}) (int64, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return 0, err
+	}
+	if !h.hasExpires() {
+		return 0, &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Struct has no field with expires tag"),
+		}
+	}
+	return c.PurgeFromDB(obj, h.fieldExpires, c.clock.Now().Unix()+1)
+}
+
+// PurgeDeletedFromDB removes objects that were soft-deleted, based on the
+// field with "softdel" tag, more than olderThan ago, and returns number of
+// removed rows
+func (c Controller) PurgeDeletedFromDB(obj interface{}, olderThan time.Duration) (int64, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return 0, err
+	}
+	if h.fieldSoftDel == "" {
+		return 0, &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Struct has no field with softdel tag"),
+		}
+	}
+	return c.PurgeFromDB(obj, h.fieldSoftDel, c.clock.Now().Add(-olderThan).Unix()+1)
+}
+
+// WithDeleted returns copy of the controller that gets objects of models with
+// "softdel" field including the soft-deleted ones, eg. to restore an object
+// by setting the field to 0 and saving it
+func (c Controller) WithDeleted() *Controller {
+	c.withDeleted = true
+	return &c
+}
+
+// Stats returns statistics of database tables of specified objects, such as
+// number of rows and size on disk
+func (c Controller) Stats(xobj ...interface{}) ([]*ModelStats, *ErrController) {
+	stats := []*ModelStats{}
+	for _, obj := range xobj {
+		h, err := c.getHelper(obj)
+		if err != nil {
+			return nil, err
+		}
+		st := &ModelStats{Tbl: h.dbTbl}
+		err2 := c.dbConn.QueryRow(h.GetQueryStats(), h.dbTbl).Scan(&st.Rows, &st.TableSize, &st.IndexesSize, &st.TotalSize, &st.DeadTuples)
+		if err2 != nil {
+			return nil, &ErrController{
+				Op:  "DBQuery",
+				Err: fmt.Errorf("Error executing DB query: %w", err2),
+			}
+		}
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
+
+// Describe returns description of the model, with its database table, fields
+// and their validation rules, relations and mounted HTTP endpoints
+func (c Controller) Describe(obj interface{}) (*ModelDescription, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	s := reflect.Indirect(reflect.ValueOf(obj)).Type()
+
+	d := &ModelDescription{
+		Name:      c.getModelName(s),
+		Tbl:       h.dbTbl,
+		Fields:    []FieldDescription{},
+		Relations: []RelationDescription{},
+		Endpoints: []EndpointDescription{},
+	}
+	for _, k := range h.fields {
+		f := FieldDescription{
+			Name:       k,
+			Column:     h.dbFieldCols[k],
+			JSON:       h.fieldsJSONName[k],
+			JSONHidden: h.fieldsJSONHidden[k],
+			OmitEmpty:  h.fieldsJSONOmit[k],
+			DBType:     h.getDBColParams(k, h.fieldsUniq[k]),
+			Required:   h.fieldsRequired[k],
+			Email:      h.fieldsEmail[k],
+			Uniq:       h.fieldsUniq[k],
+			Lookup:     h.fieldsLookup[k],
+			Filterable: h.fieldsFilterable[k],
+			Searchable: h.fieldsSearchable[k],
+			Sensitive:  h.fieldsSensitive[k],
+			Flags:      c.getFlagNames(h, k),
+		}
+		if sf, ok := s.FieldByName(k); ok {
+			f.Type = sf.Type.String()
+		}
+		for _, opName := range []string{"create", "read", "update", "delete", "list"} {
+			if h.fieldsRequiredOps[k]&opNames[opName] != 0 {
+				f.RequiredOn = append(f.RequiredOn, opName)
+			}
+		}
+		l := h.fieldsLength[k]
+		if l[0] > -1 {
+			f.LenMin = &l[0]
+		}
+		if l[1] > -1 {
+			f.LenMax = &l[1]
+		}
+		v, notNil := h.fieldsValue[k], h.fieldsValueNotNil[k]
+		if v[0] != 0 || notNil[0] {
+			f.ValMin = &v[0]
+		}
+		if v[1] != 0 || notNil[1] {
+			f.ValMax = &v[1]
+		}
+		if h.fieldsRegExp[k] != nil {
+			f.RegExp = h.fieldsRegExp[k].String()
+		}
+		d.Fields = append(d.Fields, f)
+	}
+
+	names := []string{}
+	for name := range c.relations[h.dbTbl] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rel := c.relations[h.dbTbl][name]
+		relH, err := c.getHelper(rel.NewObjFunc())
+		if err != nil {
+			return nil, err
+		}
+		d.Relations = append(d.Relations, RelationDescription{
+			Name:  name,
+			Field: rel.Field,
+			Tbl:   relH.dbTbl,
+		})
+	}
+	d.Endpoints = append(d.Endpoints, c.endpoints[h.dbTbl]...)
+	return d, nil
+}
+
+// IncludeRelations gets related objects of relations with specified names and
+// returns objects converted to maps, with related objects added under keys
+// that are names of the relations. Objects must be of the same struct
+func (c Controller) IncludeRelations(xobj []interface{}, include []string) ([]interface{}, *ErrController) {
+	if len(xobj) == 0 || len(include) == 0 {
+		return xobj, nil
+	}
+	h, err := c.getHelper(xobj[0])
+	if err != nil {
+		return nil, err
+	}
+	if name := c.getInvalidInclude(h, include); name != "" {
+		return nil, &ErrController{
+			Op:  "InvalidInclude",
+			Err: fmt.Errorf("Invalid relation %s", name),
+		}
+	}
+
+	related := map[string]map[int64]interface{}{}
+	for _, name := range include {
+		rel := c.relations[h.dbTbl][name]
+		ids := []interface{}{}
+		for _, obj := range xobj {
+			f := reflect.ValueOf(obj).Elem().FieldByName(rel.Field)
+			if f.IsValid() && f.Int() > 0 {
+				ids = append(ids, f.Int())
+			}
+		}
+		related[name] = map[int64]interface{}{}
+		if len(ids) == 0 {
+			continue
+		}
+		xrel, err := c.GetFromDB(rel.NewObjFunc, nil, 0, 0, map[string]interface{}{"ID": ids})
+		if err != nil {
+			return nil, err
+		}
+		for _, relObj := range xrel {
+			related[name][c.GetModelIDValue(relObj)] = relObj
+		}
+	}
+
+	o := make([]interface{}, len(xobj))
+	for i, obj := range xobj {
+		m, err := c.getObjectMap(obj)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range include {
+			f := reflect.ValueOf(obj).Elem().FieldByName(c.relations[h.dbTbl][name].Field)
+			m[name] = nil
+			if f.IsValid() && related[name][f.Int()] != nil {
+				m[name] = related[name][f.Int()]
+			}
+		}
+		o[i] = m
+	}
+	return o, nil
+}
+
+// getResponseItems returns objects as they are written in HTTP responses,
+// with related objects from include, with fields that have formatters
+// formatted for the locale of the request and with keys named as set with
+// SetJSONNaming. Objects implementing json.Marshaler are converted to maps
+// with it, so that other response formats get the same representation
+func (c Controller) getResponseItems(r *http.Request, xobj []interface{}, include []string) ([]interface{}, *ErrController) {
+	o, err := c.IncludeRelations(xobj, include)
+	if err != nil || len(xobj) == 0 {
+		return o, err
+	}
+	h, err := c.getHelper(xobj[0])
+	if err != nil {
+		return nil, err
+	}
+	_, isMarshaler := xobj[0].(json.Marshaler)
+	if len(c.formatters[h.dbTbl]) == 0 && c.jsonNaming == JSONNamingTags && (!isMarshaler || isJSONSerializer(c.serializer)) {
+		return o, nil
+	}
+
+	// Objects are replaced with maps in a copy, as o can be xobj itself
+	o = append([]interface{}{}, o...)
+	locale := getLocale(r)
+	for i, obj := range xobj {
+		m, ok := o[i].(map[string]interface{})
+		if !ok {
+			m, err = c.getObjectMap(obj)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for fieldName, fn := range c.formatters[h.dbTbl] {
+			if h.dbFieldCols[fieldName] == "" || h.fieldsJSONHidden[fieldName] {
+				continue
+			}
+			// Field with "omitempty" that was omitted stays omitted
+			if _, ok := m[h.fieldsJSONName[fieldName]]; !ok {
+				continue
+			}
+			m[h.fieldsJSONName[fieldName]] = fn(reflect.ValueOf(obj).Elem().FieldByName(fieldName).Interface(), locale)
+		}
+		if c.jsonNaming == JSONNamingCamelCase {
+			rels := map[string]interface{}{}
+			for _, name := range include {
+				rel := m[name]
+				delete(m, name)
+				if rel != nil {
+					relMap, err := c.getObjectMap(rel)
+					if err != nil {
+						return nil, err
+					}
+					rel = renameJSONKeys(reflect.TypeOf(rel), relMap, true)
+				}
+				rels[getCamelCaseName(name)] = rel
+			}
+			m = renameJSONKeys(reflect.TypeOf(obj), m, true).(map[string]interface{})
+			for name, rel := range rels {
+				m[name] = rel
+			}
+		}
+		o[i] = m
+	}
+	return o, nil
+}
+
+// getObjectMap returns object converted to map with keys that are the names
+// of its fields in JSON. Integers are decoded as int64, so that large IDs are
+// not rounded like with float64
+func (c Controller) getObjectMap(obj interface{}) (map[string]interface{}, *ErrController) {
+	j, err := json.Marshal(obj)
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "JSONMarshal",
+			Err: fmt.Errorf("Error marshaling object: %w", err),
+		}
+	}
+	m := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+	err = dec.Decode(&m)
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "JSONMarshal",
+			Err: fmt.Errorf("Error unmarshaling object: %w", err),
+		}
+	}
+	return convertJSONNumbers(m).(map[string]interface{}), nil
+}
+
+// convertJSONNumbers replaces json.Number values in maps and slices with
+// int64 or float64, so that serializers other than JSON write them as
+// numbers. Integers that do not fit in int64 are left as json.Number
+func convertJSONNumbers(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = convertJSONNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = convertJSONNumbers(e)
+		}
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		if strings.ContainsAny(string(x), ".eE") {
+			if f, err := x.Float64(); err == nil {
+				return f
+			}
+		}
+	}
+	return v
+}
+
+// getInvalidInclude returns first of the names that is not a registered
+// relation of the model
+func (c Controller) getInvalidInclude(h *Helper, include []string) string {
+	for _, name := range include {
+		if _, ok := c.relations[h.dbTbl][name]; !ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// ListJoined gets objects created with newObjFunc together with their related
+// objects of relation with specified name, in a single JOIN query, eg.
+// sessions with users that created them. Filters and order apply to the
+// objects, relatedFilters to the related objects. Objects without related
+// object are not returned
+func (c Controller) ListJoined(newObjFunc func() interface{}, relation string, order []string, limit int, offset int, filters map[string]interface{}, relatedFilters map[string]interface{}) ([]*JoinedObject, *ErrController) {
+	obj := newObjFunc()
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	rel, ok := c.relations[h.dbTbl][relation]
+	if !ok {
+		return nil, &ErrController{
+			Op:  "InvalidInclude",
+			Err: fmt.Errorf("Invalid relation %s", relation),
+		}
+	}
+	relObj := rel.NewObjFunc()
+	rh, err := c.getHelper(relObj)
+	if err != nil {
+		return nil, err
+	}
+
+	errHook := c.runHooks(HookBefore, OpList, obj)
+	if errHook != nil {
+		return nil, errHook
+	}
+	filters, dbFilters, err1 := c.prepareFilters(h, obj, filters)
+	if err1 != nil {
+		return nil, err1
+	}
+	relatedFilters, dbRelatedFilters, err1 := c.prepareFilters(rh, relObj, relatedFilters)
+	if err1 != nil {
+		return nil, err1
+	}
+
+	query := h.GetQuerySelectJoined(rh, rel.Field, c.getOrder(h, order), limit, offset, filters, relatedFilters)
+	args := append(h.GetFilterArgs(dbFilters), rh.GetFilterArgs(dbRelatedFilters)...)
+	args = append(append(args, c.getExpiresArgs(h)...), c.getExpiresArgs(rh)...)
+	query, args, errI := c.interceptQuery(h, OpList, query, args)
+	if errI != nil {
+		return nil, errI
+	}
+
+	var v []*JoinedObject
+	var errScan error
+	err2 := c.runWithHints(h, OpList, func(q dbQuerier) error {
+		rows, err := q.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			j := &JoinedObject{
+				Obj:     newObjFunc(),
+				Related: rel.NewObjFunc(),
+			}
+			dest := append([]interface{}{c.GetModelIDInterface(j.Obj)}, c.GetModelFieldInterfaces(j.Obj)...)
+			dest = append(append(dest, c.GetModelIDInterface(j.Related)), c.GetModelFieldInterfaces(j.Related)...)
+			errScan = rows.Scan(dest...)
+			if errScan != nil {
+				return errScan
+			}
+			v = append(v, j)
+		}
+		errScan = rows.Err()
+		return errScan
+	})
+	if errScan != nil {
+		return nil, &ErrController{
+			Op:  "DBQueryRowsScan",
+			Err: fmt.Errorf("Error scanning DB query row: %w", errScan),
+		}
+	}
+	if err2 != nil {
+		return nil, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	for _, j := range v {
+		errHook := c.runHooks(HookAfter, OpList, j.Obj)
+		if errHook != nil {
+			return nil, errHook
+		}
+	}
+	return v, nil
+}
+
+// GetFromDB runs a select query on the database with specified filters, order,
+// limit and offset and returns a list of objects. String filter values are
+// transformed the same way as fields are before saving
+func (c Controller) GetFromDB(newObjFunc func() interface{}, order []string, limit int, offset int, filters map[string]interface{}) ([]interface{}, *ErrController) {
+	obj := newObjFunc()
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	errHook := c.runHooks(HookBefore, OpList, obj)
+	if errHook != nil {
+		return nil, errHook
+	}
+	filters, dbFilters, err1 := c.prepareFilters(h, obj, filters)
+	if err1 != nil {
+		return nil, err1
+	}
+
+	return c.getFromDBWithQuery(h, newObjFunc, h.GetQuerySelectWithHints(c.getOrder(h, order), limit, offset, filters, nil, nil, c.getQueryHints(h, OpList)), append(h.GetFilterArgs(dbFilters), c.getExpiresArgs(h)...))
+}
+
+// GetCountFromDB returns number of objects matching filters, eg. for
+// pagination of GetFromDB results. Filters are the same as in GetFromDB
+func (c Controller) GetCountFromDB(newObjFunc func() interface{}, filters map[string]interface{}) (int64, *ErrController) {
+	obj := newObjFunc()
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return 0, err
+	}
+	filters, dbFilters, err1 := c.prepareFilters(h, obj, filters)
+	if err1 != nil {
+		return 0, err1
+	}
+
+	query, args, errI := c.interceptQuery(h, OpList, h.GetQueryCount(filters, nil), append(h.GetFilterArgs(dbFilters), c.getExpiresArgs(h)...))
+	if errI != nil {
+		return 0, errI
+	}
+	var cnt int64
+	err2 := c.runWithHints(h, OpList, func(q dbQuerier) error {
+		return q.QueryRow(query, args...).Scan(&cnt)
+	})
+	if err2 != nil {
+		return 0, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	return cnt, nil
+}
+
+// getFromDBWithQuery runs a select query and returns objects created with
+// newObjFunc, with values from the returned rows
+func (c Controller) getFromDBWithQuery(h *Helper, newObjFunc func() interface{}, query string, args []interface{}) ([]interface{}, *ErrController) {
+	query, args, errI := c.interceptQuery(h, OpList, query, args)
+	if errI != nil {
+		return nil, errI
+	}
+
+	var v []interface{}
+	var errScan error
+	err2 := c.runWithHints(h, OpList, func(q dbQuerier) error {
+		rows, err := q.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
 
-	h, err2 := c.getHelper(obj)
-	if err2 != nil {
-		return err2
+		for rows.Next() {
+			newObj := newObjFunc()
+			errScan = rows.Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(newObj)), c.GetModelFieldInterfaces(newObj)...)...)
+			if errScan != nil {
+				return errScan
+			}
+			v = append(v, newObj)
+		}
+		return rows.Err()
+	})
+	if errScan != nil {
+		return nil, &ErrController{
+			Op:  "DBQueryRowsScan",
+			Err: fmt.Errorf("Error scanning DB query row: %w", errScan),
+		}
 	}
-	err3 := c.dbConn.QueryRow(h.GetQuerySelectById(), int64(idInt)).Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
-	switch {
-	case err3 == sql.ErrNoRows:
-		c.ResetFields(obj)
-		return nil
-	case err3 != nil:
-		return &ErrController{
+	if err2 != nil {
+		return nil, &ErrController{
 			Op:  "DBQuery",
-			Err: fmt.Errorf("Error executing DB query: %w", err),
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	for _, o := range v {
+		errHook := c.runHooks(HookAfter, OpList, o)
+		if errHook != nil {
+			return nil, errHook
 		}
-	default:
-		return nil
 	}
+	return v, nil
 }
 
-// DeleteFromDB removes object from the database table and it does that only
-// when ID field is set (greater than 0). Once deleted from the DB, all field
-// values are zeroed
-func (c Controller) DeleteFromDB(obj interface{}) *ErrController {
+// ExplainGetFromDB runs "EXPLAIN (ANALYZE, FORMAT JSON)" on the select query
+// that GetFromDB would execute with the same arguments and returns the query
+// plan in JSON. It is meant to help with tuning indexes for filters
+func (c Controller) ExplainGetFromDB(newObjFunc func() interface{}, order []string, limit int, offset int, filters map[string]interface{}) (string, *ErrController) {
+	obj := newObjFunc()
 	h, err := c.getHelper(obj)
 	if err != nil {
-		return err
+		return "", err
 	}
-	if c.GetModelIDValue(obj) == 0 {
-		return nil
+
+	filters, dbFilters, err1 := c.prepareFilters(h, obj, filters)
+	if err1 != nil {
+		return "", err1
+	}
+
+	query, args, errI := c.interceptQuery(h, OpList, h.GetQuerySelectWithHints(c.getOrder(h, order), limit, offset, filters, nil, nil, c.getQueryHints(h, OpList)), append(h.GetFilterArgs(dbFilters), c.getExpiresArgs(h)...))
+	if errI != nil {
+		return "", errI
 	}
-	_, err2 := c.dbConn.Exec(h.GetQueryDeleteById(), c.GetModelIDInterface(obj))
+
+	var plan string
+	err2 := c.runWithHints(h, OpList, func(q dbQuerier) error {
+		return q.QueryRow(h.GetQueryExplain(query), args...).Scan(&plan)
+	})
 	if err2 != nil {
-		return &ErrController{
+		return "", &ErrController{
 			Op:  "DBQuery",
 			Err: fmt.Errorf("Error executing DB query: %w", err2),
 		}
 	}
-	c.ResetFields(obj)
-	return nil
+	return plan, nil
 }
 
-// GetFromDB runs a select query on the database with specified filters, order,
-// limit and offset and returns a list of objects
-func (c Controller) GetFromDB(newObjFunc func() interface{}, order []string, limit int, offset int, filters map[string]interface{}) ([]interface{}, *ErrController) {
-	obj := newObjFunc()
+// TransformFields applies transformations defined in tags (such as "trim" or
+// "lower") to object's fields. It is called by SaveToDB before validation
+func (c Controller) TransformFields(obj interface{}) *ErrController {
 	h, err := c.getHelper(obj)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	h.transformFields(reflect.ValueOf(obj).Elem())
+	return nil
+}
 
-	b, invalidFields, err1 := c.Validate(obj, filters)
-	if err1 != nil {
-		return nil, &ErrController{
+// prepareFilters transforms and validates filters. It returns transformed
+// filters and the same filters with values converted for the database
+func (c Controller) prepareFilters(h *Helper, obj interface{}, filters map[string]interface{}) (map[string]interface{}, map[string]interface{}, *ErrController) {
+	filters = c.transformFilters(h, filters)
+
+	b, invalidFields, err := c.Validate(obj, filters)
+	if err != nil {
+		return nil, nil, &ErrController{
 			Op:  "ValidateFilters",
-			Err: fmt.Errorf("Error when trying to validate filters: %w", err1),
+			Err: fmt.Errorf("Error when trying to validate filters: %w", err),
 		}
 	}
 
 	if !b {
-		return nil, &ErrController{
+		return nil, nil, &ErrController{
 			Op: "ValidateFilters",
 			Err: &ErrValidation{
 				Fields: invalidFields,
@@ -225,28 +2100,33 @@ func (c Controller) GetFromDB(newObjFunc func() interface{}, order []string, lim
 		}
 	}
 
-	var v []interface{}
-	rows, err2 := c.dbConn.Query(h.GetQuerySelect(order, limit, offset, filters, nil, nil), c.GetFiltersInterfaces(filters)...)
+	dbFilters, err2 := h.convertFiltersToDB(filters)
 	if err2 != nil {
-		return nil, &ErrController{
-			Op:  "DBQuery",
-			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		return nil, nil, &ErrController{
+			Op:  "ValidateFilters",
+			Err: fmt.Errorf("Error when trying to convert filters: %w", err2),
 		}
 	}
-	defer rows.Close()
+	return filters, dbFilters, nil
+}
 
-	for rows.Next() {
-		newObj := newObjFunc()
-		err3 := rows.Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(newObj)), c.GetModelFieldInterfaces(newObj)...)...)
-		if err3 != nil {
-			return nil, &ErrController{
-				Op:  "DBQueryRowsScan",
-				Err: fmt.Errorf("Error scanning DB query row: %w", err3),
+// transformFilters returns copy of filters with transformations applied to
+// string values
+func (c Controller) transformFilters(h *Helper, filters map[string]interface{}) map[string]interface{} {
+	if len(filters) == 0 || len(h.fieldsTransforms) == 0 {
+		return filters
+	}
+	o := make(map[string]interface{}, len(filters))
+	for k, v := range filters {
+		k := k
+		o[k], _ = mapFilterValue(v, func(iv interface{}) (interface{}, error) {
+			if s, ok := iv.(string); ok {
+				return h.transformValue(k, s), nil
 			}
-		}
-		v = append(v, newObj)
+			return iv, nil
+		})
 	}
-	return v, nil
+	return o
 }
 
 // GetModelIDInterface returns an interface{} to ID field of an object
@@ -262,15 +2142,19 @@ func (c *Controller) GetModelIDValue(obj interface{}) int64 {
 // GetModelFieldInterfaces returns list of interfaces to object's fields without
 // the ID field
 func (c Controller) GetModelFieldInterfaces(obj interface{}) []interface{} {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil
+	}
+
 	val := reflect.ValueOf(obj).Elem()
 
 	var v []interface{}
-	for i := 1; i < val.NumField(); i++ {
-		valueField := val.Field(i)
-		if valueField.Kind() != reflect.Int64 && valueField.Kind() != reflect.Int && valueField.Kind() != reflect.String {
+	for _, k := range h.fields {
+		if k == "ID" {
 			continue
 		}
-		v = append(v, valueField.Addr().Interface())
+		v = append(v, h.getFieldInterface(val.FieldByName(k), k))
 	}
 	return v
 }
@@ -288,78 +2172,447 @@ func (c Controller) GetFiltersInterfaces(mf map[string]interface{}) []interface{
 		sort.Strings(sorted)
 
 		for _, v := range sorted {
+			if xv, ok := mf[v].([]interface{}); ok {
+				xi = append(xi, xv...)
+				continue
+			}
 			xi = append(xi, mf[v])
 		}
 	}
-	return xi
+	return xi
+}
+
+// ResetFields zeroes object's field values
+func (c Controller) ResetFields(obj interface{}) {
+	val := reflect.ValueOf(obj).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		valueField := val.Field(i)
+		if !valueField.CanSet() {
+			continue
+		}
+		if valueField.Kind() == reflect.Ptr {
+			valueField.Set(reflect.Zero(valueField.Type()))
+		}
+		if valueField.Kind() >= reflect.Int && valueField.Kind() <= reflect.Int64 {
+			valueField.SetInt(0)
+		}
+		if valueField.Kind() >= reflect.Uint && valueField.Kind() <= reflect.Uint64 {
+			valueField.SetUint(0)
+		}
+		if valueField.Kind() == reflect.String {
+			valueField.SetString("")
+		}
+		if valueField.Kind() == reflect.Struct || valueField.Kind() == reflect.Map || valueField.Kind() == reflect.Slice || valueField.Kind() == reflect.Array {
+			valueField.Set(reflect.Zero(valueField.Type()))
+		}
+	}
+}
+
+// GetHTTPHandler returns a CRUD HTTP handler that can be attached to HTTP
+// server. It creates a CRUD endpoint for creating, reading, updating, deleting
+// and listing objects.
+// Each of the func() argument should be funcs that create new object (instance
+// of a struct). For each of the operation (create, read etc.), a different
+// struct with different fields can be used.
+// It's important to pass "uri" argument same as the one that the handler is
+// attached to.
+func (c Controller) GetHTTPHandler(uri string, newObjFunc func() interface{}, newObjCreateFunc func() interface{}, newObjReadFunc func() interface{}, newObjUpdateFunc func() interface{}, newObjDeleteFunc func() interface{}, newObjListFunc func() interface{}) http.Handler {
+	c.initHelpersForHTTPHandler(newObjFunc, newObjCreateFunc, newObjReadFunc, newObjUpdateFunc, newObjDeleteFunc, newObjListFunc)
+
+	slugField := ""
+	h, err := c.getHelper(newObjFunc())
+	if err == nil {
+		slugField = h.getSlugField()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := c.withResponseSerializer(r).withRequest(r)
+		if settings := GetSessionSettings(r); settings != nil {
+			c.sessionSettings = settings
+		}
+		w = newCompressWriter(w, r, c.compressMin)
+		if cw, ok := w.(*compressWriter); ok {
+			defer cw.close()
+		}
+
+		path, ok := c.getRelativePath(uri, r.URL.EscapedPath())
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(c.jsonError("invalid path"))
+			return
+		}
+		path = c.getPathWithParsedIDs(path, h)
+
+		if id, otherID, versionID, ok := c.getDiffFromURI(path, h); ok {
+			c.handleHTTPDiff(w, r, newObjReadFunc, id, otherID, versionID)
+			return
+		}
+		if id, versionID, ok := c.getVersionsFromURI(path, h); ok {
+			if r.Method == http.MethodPut {
+				c.handleHTTPVersions(w, r, newObjUpdateFunc, id, versionID)
+			} else {
+				c.handleHTTPVersions(w, r, newObjReadFunc, id, versionID)
+			}
+			return
+		}
+
+		if r.Method == http.MethodPut && strings.SplitN(path, "?", 2)[0] == "validate" {
+			if r.URL.Query().Get("id") == "" {
+				c.handleHTTPValidate(w, r, newObjCreateFunc)
+			} else {
+				c.handleHTTPValidate(w, r, newObjUpdateFunc)
+			}
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			fieldName, value, ok := c.getLookupFromURI(path, newObjFunc())
+			if ok {
+				c.handleHTTPGetByField(w, r, newObjReadFunc, fieldName, value)
+				return
+			}
+		}
+
+		id, b := c.getIDFromURI(path, w, slugField != "" && r.Method == http.MethodGet)
+		if !b {
+			return
+		}
+		if r.Method == http.MethodPut && id == "" {
+			c.handleHTTPPut(w, r, newObjCreateFunc, id)
+			return
+		}
+		if r.Method == http.MethodPut && id != "" {
+			c.handleHTTPPut(w, r, newObjUpdateFunc, id)
+			return
+		}
+		if r.Method == http.MethodGet && id != "" {
+			c.handleHTTPGet(w, r, newObjReadFunc, id, slugField)
+			return
+		}
+		if r.Method == http.MethodGet && id == "" {
+			c.handleHTTPGet(w, r, newObjListFunc, id, "")
+			return
+		}
+		if r.Method == http.MethodDelete && id != "" {
+			c.handleHTTPDelete(w, r, newObjFunc, id)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+	})
+}
+
+// GetVersionedHTTPHandler returns HTTP handler just like GetHTTPHandler does
+// but with different structs (DTOs) used for each version of the API, so that
+// fields can change without breaking existing clients. Version is taken from
+// the path prefix (eg. "/v2/users/1" for "/users/" uri and "v2" version) or
+// from "version" parameter of the Accept header (eg. "application/json;
+// version=v2"). When there is none, defaultVersion is used. Requests for
+// versions that are not registered get "406 Not Acceptable"
+func (c Controller) GetVersionedHTTPHandler(uri string, newObjFunc func() interface{}, versions map[string]EndpointDTOs, defaultVersion string) http.Handler {
+	handlers := map[string]http.Handler{}
+	pathHandlers := map[string]http.Handler{}
+	for v, dtos := range versions {
+		xf := []func() interface{}{dtos.Create, dtos.Read, dtos.Update, dtos.Delete, dtos.List}
+		for i := range xf {
+			if xf[i] == nil {
+				xf[i] = newObjFunc
+			}
+		}
+		handlers[v] = c.GetHTTPHandler(uri, newObjFunc, xf[0], xf[1], xf[2], xf[3], xf[4])
+		pathHandlers[v] = c.GetHTTPHandler("/"+v+uri, newObjFunc, xf[0], xf[1], xf[2], xf[3], xf[4])
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for v, hdl := range pathHandlers {
+			if strings.HasPrefix(r.URL.Path, "/"+v+"/") {
+				hdl.ServeHTTP(w, r)
+				return
+			}
+		}
+		v := c.getAPIVersion(r)
+		if v == "" {
+			v = defaultVersion
+		}
+		hdl, ok := handlers[v]
+		if !ok {
+			c.withResponseSerializer(r).writeErrText(w, http.StatusNotAcceptable, "unsupported_version")
+			return
+		}
+		hdl.ServeHTTP(w, r)
+	})
+}
+
+// getAPIVersion returns value of "version" parameter of the Accept header
+func (c Controller) getAPIVersion(r *http.Request) string {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && params["version"] != "" {
+			return params["version"]
+		}
+	}
+	return ""
+}
+
+// MountEndpoints creates HTTP handlers for endpoints and registers them on mux,
+// so that whole API can be declared in one place
+func (c Controller) MountEndpoints(endpoints []Endpoint, mux HTTPMux) *ErrController {
+	for _, e := range endpoints {
+		if e.Model == nil {
+			return &ErrController{
+				Op:  "MountEndpoint",
+				Err: fmt.Errorf("Endpoint %s has no model", e.Path),
+			}
+		}
+		dtos := []func() interface{}{e.DTOs.Create, e.DTOs.Read, e.DTOs.Update, e.DTOs.Delete, e.DTOs.List}
+		for i := range dtos {
+			if dtos[i] == nil {
+				dtos[i] = e.Model
+			}
+		}
+		err := c.initHelpersForHTTPHandler(e.Model, dtos[0], dtos[1], dtos[2], dtos[3], dtos[4])
+		if err != nil {
+			return err
+		}
+
+		var hdl http.Handler = c.GetHTTPHandler(e.Path, e.Model, dtos[0], dtos[1], dtos[2], dtos[3], dtos[4])
+		hdl = c.getEndpointHandler(e, hdl)
+		for i := len(e.Hooks) - 1; i >= 0; i-- {
+			hdl = e.Hooks[i](hdl)
+		}
+		mux.Handle(e.Path, hdl)
+
+		h, _ := c.getHelper(e.Model())
+		c.endpoints[h.dbTbl] = append(c.endpoints[h.dbTbl], EndpointDescription{
+			Path: e.Path,
+			Ops:  e.Ops,
+		})
+	}
+	return nil
+}
+
+// getEndpointHandler wraps handler with checks of allowed operations, auth
+// (or share token) and rate limit of an endpoint
+func (c Controller) getEndpointHandler(e Endpoint, hdl http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := c.withResponseSerializer(r)
+		op := c.getHTTPRequestOp(e.Path, r)
+		if op == 0 || (e.Ops != 0 && e.Ops&op == 0) {
+			c.writeErrText(w, http.StatusMethodNotAllowed, "operation_not_allowed")
+			return
+		}
+		shared := e.Auth != nil && e.Share && op == OpRead && c.hasShareToken(e, r)
+		if e.Auth != nil && !shared && !e.Auth(r, op) {
+			c.writeErrText(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		// Diff of two objects reads both of them, so none of them can be
+		// read with share token of the other one
+		if other := c.getOtherDiffRequest(e.Path, r); e.Auth != nil && other != nil && !e.Auth(other, op) {
+			c.writeErrText(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if shared {
+			r = withoutRelationParams(r)
+		}
+		if e.RateLimit != nil && !e.RateLimit(r, op) {
+			c.writeErrText(w, http.StatusTooManyRequests, "rate_limit_exceeded")
+			return
+		}
+		if e.Identity != nil {
+			r = WithIdentity(r, e.Identity(r))
+		}
+		if e.SessionSettings != nil {
+			r = WithSessionSettings(r, e.SessionSettings(r))
+		}
+		if e.Approval != nil && op&(OpCreate|OpUpdate|OpDelete) != 0 && e.Approval(r, op) {
+			r = WithApprovalRequired(r)
+		}
+		hdl.ServeHTTP(w, r)
+	})
+}
+
+// getHTTPRequestOp returns operation (OpRead, OpList etc.) that HTTP request
+// is for, or 0 when method is not supported
+func (c Controller) getHTTPRequestOp(uri string, r *http.Request) int {
+	path, _ := c.getRelativePath(uri, r.URL.EscapedPath())
+	switch r.Method {
+	case http.MethodGet:
+		if path == "" {
+			return OpList
+		}
+		return OpRead
+	case http.MethodPut:
+		if path == "" {
+			return OpCreate
+		}
+		// Validation is allowed and authorized like the write that it checks
+		if strings.SplitN(path, "?", 2)[0] == "validate" && r.URL.Query().Get("id") == "" {
+			return OpCreate
+		}
+		return OpUpdate
+	case http.MethodDelete:
+		return OpDelete
+	}
+	return 0
+}
+
+// GetStatsHTTPHandler returns HTTP handler that responds with Stats of
+// specified objects and statistics of the connection pool (see GetPoolStats),
+// eg. to be attached to "/__crud/stats". It is meant for
+// administrators so it should be protected
+func (c Controller) GetStatsHTTPHandler(xobj ...interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		stats, err := c.Stats(xobj...)
+		if err != nil {
+			c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_stats")
+			return
+		}
+		c.writeOK(w, http.StatusOK, map[string]interface{}{
+			"stats": stats,
+			"pool":  c.GetPoolStats(),
+		})
+	})
+}
+
+// ValidateDBTableBatch gets up to limit rows with ID greater than afterID
+// from the database and validates them with the current field tags, eg. to
+// find legacy data that does not pass tightened validation
+func (c Controller) ValidateDBTableBatch(newObjFunc func() interface{}, afterID int64, limit int) (*ValidationReport, *ErrController) {
+	h, err := c.getHelper(newObjFunc())
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	report := &ValidationReport{
+		Tbl:     h.dbTbl,
+		LastID:  afterID,
+		Invalid: []InvalidRow{},
+	}
+	rows, err2 := c.getQuerier().Query(h.GetQuerySelectAfterID(), afterID, limit)
+	if err2 != nil {
+		return nil, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		obj := newObjFunc()
+		err2 = rows.Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+		if err2 != nil {
+			return nil, &ErrController{
+				Op:  "DBQueryRowsScan",
+				Err: fmt.Errorf("Error scanning DB query row: %w", err2),
+			}
+		}
+		report.Scanned++
+		report.LastID = c.GetModelIDValue(obj)
+		b, fields, err3 := c.Validate(obj, nil)
+		if err3 != nil {
+			return nil, &ErrController{
+				Op:  "Validate",
+				Err: fmt.Errorf("Error validating object: %w", err3),
+			}
+		}
+		if !b {
+			report.Invalid = append(report.Invalid, InvalidRow{
+				ID:     report.LastID,
+				Fields: fields,
+			})
+		}
+	}
+	err2 = rows.Err()
+	if err2 != nil {
+		return nil, &ErrController{
+			Op:  "DBQueryRowsScan",
+			Err: fmt.Errorf("Error scanning DB query row: %w", err2),
+		}
+	}
+	report.Done = report.Scanned < limit
+	return report, nil
 }
 
-// ResetFields zeroes object's field values
-func (c Controller) ResetFields(obj interface{}) {
-	val := reflect.ValueOf(obj).Elem()
-	for i := 0; i < val.NumField(); i++ {
-		valueField := val.Field(i)
-		if valueField.Kind() == reflect.Ptr {
-			valueField.Set(reflect.Zero(valueField.Type()))
-		}
-		if valueField.Kind() == reflect.Int64 {
-			valueField.SetInt(0)
+// ValidateDBTable validates all rows of the database table in batches of
+// batchSize, calling progress after each batch when it is not nil, and
+// returns all the invalid rows
+func (c Controller) ValidateDBTable(newObjFunc func() interface{}, batchSize int, progress func(*ValidationReport)) ([]InvalidRow, *ErrController) {
+	invalid := []InvalidRow{}
+	var afterID int64
+	for {
+		report, err := c.ValidateDBTableBatch(newObjFunc, afterID, batchSize)
+		if err != nil {
+			return nil, err
 		}
-		if valueField.Kind() == reflect.Int {
-			valueField.SetInt(0)
+		invalid = append(invalid, report.Invalid...)
+		if progress != nil {
+			progress(report)
 		}
-		if valueField.Kind() == reflect.String {
-			valueField.SetString("")
+		if report.Done {
+			return invalid, nil
 		}
+		afterID = report.LastID
 	}
 }
 
-// GetHTTPHandler returns a CRUD HTTP handler that can be attached to HTTP
-// server. It creates a CRUD endpoint for creating, reading, updating, deleting
-// and listing objects.
-// Each of the func() argument should be funcs that create new object (instance
-// of a struct). For each of the operation (create, read etc.), a different
-// struct with different fields can be used.
-// It's important to pass "uri" argument same as the one that the handler is
-// attached to.
-func (c Controller) GetHTTPHandler(uri string, newObjFunc func() interface{}, newObjCreateFunc func() interface{}, newObjReadFunc func() interface{}, newObjUpdateFunc func() interface{}, newObjDeleteFunc func() interface{}, newObjListFunc func() interface{}) http.Handler {
-	c.initHelpersForHTTPHandler(newObjFunc, newObjCreateFunc, newObjReadFunc, newObjUpdateFunc, newObjDeleteFunc, newObjListFunc)
-
+// GetValidationReportHTTPHandler returns HTTP handler that responds with
+// ValidationReport of a batch of rows. Batch is selected with "after_id" and
+// "limit" query parameters, and "last_id" from the response is the "after_id"
+// of the next one. It is meant for administrators so it should be protected
+func (c Controller) GetValidationReportHTTPHandler(newObjFunc func() interface{}) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id, b := c.getIDFromURI(r.RequestURI[len(uri):], w)
-		if !b {
-			return
-		}
-		if r.Method == http.MethodPut && id == "" {
-			c.handleHTTPPut(w, r, newObjCreateFunc, id)
-			return
-		}
-		if r.Method == http.MethodPut && id != "" {
-			c.handleHTTPPut(w, r, newObjUpdateFunc, id)
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if r.Method == http.MethodGet && id != "" {
-			c.handleHTTPGet(w, r, newObjReadFunc, id)
-			return
+		q := r.URL.Query()
+		var afterID int64
+		limit := 0
+		var err error
+		if q.Get("after_id") != "" {
+			afterID, err = strconv.ParseInt(q.Get("after_id"), 10, 64)
+			if err != nil || afterID < 0 {
+				c.writeErrText(w, http.StatusBadRequest, "invalid_after_id")
+				return
+			}
 		}
-		if r.Method == http.MethodGet && id == "" {
-			c.handleHTTPGet(w, r, newObjListFunc, id)
-			return
+		if q.Get("limit") != "" {
+			limit, err = strconv.Atoi(q.Get("limit"))
+			if err != nil || limit < 1 {
+				c.writeErrText(w, http.StatusBadRequest, "invalid_limit")
+				return
+			}
 		}
-		if r.Method == http.MethodDelete && id != "" {
-			c.handleHTTPDelete(w, r, newObjFunc, id)
+		report, err2 := c.ValidateDBTableBatch(newObjFunc, afterID, limit)
+		if err2 != nil {
+			c.writeDBErrText(w, err2, http.StatusInternalServerError, "cannot_validate_db_table")
 			return
 		}
-
-		w.WriteHeader(http.StatusBadRequest)
+		c.writeOK(w, http.StatusOK, map[string]interface{}{
+			"report": report,
+		})
 	})
 }
 
 // Validate checks object's fields. It returns result of validation as
 // a bool and list of fields with invalid value
 func (c Controller) Validate(obj interface{}, filters map[string]interface{}) (bool, []string, error) {
+	return c.ValidateWithOptions(obj, filters, ValidationOptions{})
+}
+
+// ValidateWithOptions checks object's fields just like Validate does, but
+// with options that can stop validation early. Invalid fields are returned in
+// the order in which they are declared in the struct
+func (c Controller) ValidateWithOptions(obj interface{}, filters map[string]interface{}, opts ValidationOptions) (bool, []string, error) {
 	failedFields := []string{}
-	b := true
 
 	h, err := c.getHelper(obj)
 	if err != nil {
@@ -368,169 +2621,33 @@ func (c Controller) Validate(obj interface{}, filters map[string]interface{}) (b
 
 	val := reflect.ValueOf(obj).Elem()
 
-	// Check required fields only when we are not validating filters
-	if filters == nil {
-		for k := range h.fieldsRequired {
-			valueField := val.FieldByName(k)
-			canBeZero := false
-			if len(h.fieldsValueNotNil[k]) == 2 && (h.fieldsValueNotNil[k][0] || h.fieldsValueNotNil[k][1]) {
-				canBeZero = true
-			}
-			if !c.validateFieldRequired(valueField, canBeZero) {
-				failedFields = append(failedFields, k)
-				b = false
-			}
-		}
-	}
-	for k, v := range h.fieldsLength {
-		if filters != nil && !c.isKeyInMap(k, filters) {
-			continue
-		}
-		if filters != nil && reflect.ValueOf(filters[k]).Type().Name() != val.FieldByName(k).Type().Name() {
-			failedFields = append(failedFields, k)
-			b = false
-		}
-		var valueField reflect.Value
-		if filters != nil {
-			valueField = reflect.ValueOf(filters[k])
-		} else {
-			valueField = val.FieldByName(k)
-		}
-		if !c.validateFieldLength(valueField, v) {
-			failedFields = append(failedFields, k)
-			b = false
+	var onlyFields map[string]bool
+	if len(opts.Fields) > 0 {
+		onlyFields = map[string]bool{}
+		for _, f := range opts.Fields {
+			onlyFields[f] = true
 		}
 	}
-	for k, v := range h.fieldsValue {
-		if filters != nil && !c.isKeyInMap(k, filters) {
-			continue
-		}
-		if filters != nil && reflect.ValueOf(filters[k]).Type().Name() != val.FieldByName(k).Type().Name() {
-			failedFields = append(failedFields, k)
-			b = false
-		}
-		var valueField reflect.Value
-		if filters != nil {
-			valueField = reflect.ValueOf(filters[k])
-		} else {
-			valueField = val.FieldByName(k)
-		}
-		minIsZero := false
-		maxIsZero := false
-		if len(h.fieldsValueNotNil[k]) == 2 {
-			minIsZero = h.fieldsValueNotNil[k][0]
-			maxIsZero = h.fieldsValueNotNil[k][1]
-		}
-		if !c.validateFieldValue(valueField, v, minIsZero, maxIsZero) {
-			failedFields = append(failedFields, k)
-			b = false
-		}
 
-	}
-	for k := range h.fieldsEmail {
-		if filters != nil && !c.isKeyInMap(k, filters) {
-			continue
-		}
-		if filters != nil && reflect.ValueOf(filters[k]).Type().Name() != val.FieldByName(k).Type().Name() {
-			failedFields = append(failedFields, k)
-			b = false
-		}
-		var valueField reflect.Value
-		if filters != nil {
-			valueField = reflect.ValueOf(filters[k])
-		} else {
-			valueField = val.FieldByName(k)
-		}
-		if !c.validateFieldEmail(valueField) {
-			failedFields = append(failedFields, k)
-			b = false
-		}
-	}
-	for k, v := range h.fieldsRegExp {
-		if filters != nil && !c.isKeyInMap(k, filters) {
+FIELDS:
+	for _, k := range h.fields {
+		if onlyFields != nil && !onlyFields[k] {
 			continue
 		}
-		if filters != nil && reflect.ValueOf(filters[k]).Type().Name() != val.FieldByName(k).Type().Name() {
-			failedFields = append(failedFields, k)
-			b = false
+		failed := []string{}
+		if !h.validateField(val, k, filters, opts.Op) {
+			failed = append(failed, k)
+		} else if filters == nil {
+			failed = h.validateNestedField(val.FieldByName(k), k, opts.Op)
 		}
-		var valueField reflect.Value
-		if filters != nil {
-			valueField = reflect.ValueOf(filters[k])
-		} else {
-			valueField = val.FieldByName(k)
-		}
-		if !c.validateFieldRegExp(valueField, v) {
-			failedFields = append(failedFields, k)
-			b = false
+		for _, f := range failed {
+			failedFields = append(failedFields, f)
+			if opts.FailFast || (opts.MaxErrors > 0 && len(failedFields) >= opts.MaxErrors) {
+				break FIELDS
+			}
 		}
 	}
-	return b, failedFields, nil
-}
-
-// validateFieldRequired checks if field that is required has a value
-func (c *Controller) validateFieldRequired(valueField reflect.Value, canBeZero bool) bool {
-	if valueField.Type().Name() == "string" && valueField.String() == "" {
-		return false
-	}
-	if valueField.Type().Name() == "int" && valueField.Int() == 0 && !canBeZero {
-		return false
-	}
-	if valueField.Type().Name() == "int64" && valueField.Int() == 0 && !canBeZero {
-		return false
-	}
-	return true
-}
-
-// validateFieldLength checks string field's length
-func (c *Controller) validateFieldLength(valueField reflect.Value, length [2]int) bool {
-	if valueField.Type().Name() != "string" {
-		return true
-	}
-	if length[0] > -1 && len(valueField.String()) < length[0] {
-		return false
-	}
-	if length[1] > -1 && len(valueField.String()) > length[1] {
-		return false
-	}
-	return true
-}
-
-// validateFieldValue checks int field's value
-func (c *Controller) validateFieldValue(valueField reflect.Value, value [2]int, minIsZero bool, maxIsZero bool) bool {
-	if valueField.Type().Name() != "int" && valueField.Type().Name() != "int64" {
-		return true
-	}
-	// Minimal value is 0 only when canBeZero is true; otherwise it's not defined
-	if ((minIsZero && value[0] == 0) || value[0] != 0) && valueField.Int() < int64(value[0]) {
-		return false
-	}
-	// Maximal value is 0 only when canBeZero is true; otherwise it's not defined
-	if ((maxIsZero && value[1] == 0) || value[1] != 0) && valueField.Int() > int64(value[1]) {
-		return false
-	}
-	return true
-}
-
-// validateFieldEmail checks if email field has a valid value
-func (c *Controller) validateFieldEmail(valueField reflect.Value) bool {
-	if valueField.Type().Name() != "string" {
-		return true
-	}
-	var emailRegex = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-	return emailRegex.MatchString(valueField.String())
-}
-
-// validateFieldRegExp checks if string field's value matches the regular
-// expression
-func (c *Controller) validateFieldRegExp(valueField reflect.Value, re *regexp.Regexp) bool {
-	if valueField.Type().Name() != "string" {
-		return true
-	}
-	if !re.MatchString(valueField.String()) {
-		return false
-	}
-	return true
+	return len(failedFields) == 0, failedFields, nil
 }
 
 // initHelpers creates all the Helper objects. For HTTP endpoints, it is
@@ -540,7 +2657,7 @@ func (c *Controller) initHelpersForHTTPHandler(newObjFunc func() interface{}, ne
 	v := reflect.ValueOf(obj)
 	i := reflect.Indirect(v)
 	s := i.Type()
-	forceName := s.Name()
+	forceName := c.getModelName(s)
 
 	h, cErr := c.getHelper(obj)
 	if cErr != nil {
@@ -580,36 +2697,501 @@ func (c *Controller) initHelper(newObjFunc func() interface{}, forceName string,
 	v := reflect.ValueOf(obj)
 	i := reflect.Indirect(v)
 	s := i.Type()
-	n := s.Name()
-	h := NewHelper(obj, c.dbTblPrefix, forceName, sourceHelper)
+	n := c.getHelperKey(s)
+	h := c.newHelper(obj, forceName, sourceHelper)
 	if h.Err() != nil {
 		return &ErrController{
 			Op:  "InitHelperWithForcedName",
 			Err: fmt.Errorf("Error initialising Helper with forced name: %w", h.Err()),
 		}
 	}
-	c.modelHelpers[n] = h
+	c.setHelper(n, h)
+	return nil
+}
+
+// setSlugs generates values for empty fields with "slug" tag from the fields
+// they point to, and returns names of the fields that have been set. Slugs are
+// not looked up in the database here, as another insert could take the same
+// one in the meantime. Unique constraint of the column is relied on instead,
+// see setNextFreeSlug
+func (c *Controller) setSlugs(h *Helper, obj interface{}) []string {
+	return c.setSlugsSkipping(h, obj, nil)
+}
+
+// setSlugsSkipping works like setSlugs, but also skips slugs that are set in
+// used (by field name), and adds slugs of object to it, so that objects saved
+// together get different slugs
+func (c *Controller) setSlugsSkipping(h *Helper, obj interface{}, used map[string]map[string]bool) []string {
+	val := reflect.ValueOf(obj).Elem()
+	generated := []string{}
+	for _, k := range h.fields {
+		if h.fieldsSlug[k] == "" {
+			continue
+		}
+		valueField := val.FieldByName(k)
+		srcField := val.FieldByName(h.fieldsSlug[k])
+		if used != nil && used[k] == nil {
+			used[k] = map[string]bool{}
+		}
+		if valueField.Kind() == reflect.String && valueField.String() != "" && used != nil {
+			used[k][valueField.String()] = true
+		}
+		if valueField.Kind() != reflect.String || valueField.String() != "" || srcField.Kind() != reflect.String {
+			continue
+		}
+
+		base := h.getSlug(srcField.String())
+		if base == "" {
+			continue
+		}
+		slug := h.getFreeSlug(base, used[k])
+		valueField.SetString(slug)
+		generated = append(generated, k)
+		if used != nil {
+			used[k][slug] = true
+		}
+	}
+	return generated
+}
+
+// setNextFreeSlug checks if err is a unique violation on a slug that has been
+// generated for one of xobj (generated has names of such fields by object) and
+// sets it to the next one that is taken neither in the database nor in used.
+// It returns false when err is caused by something else and the query should
+// not be retried
+func (c *Controller) setNextFreeSlug(h *Helper, xobj []interface{}, generated map[interface{}][]string, used map[string]map[string]bool, err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return false
+	}
+	m := uniqueViolationRegExp.FindStringSubmatch(pqErr.Detail)
+	if m == nil {
+		return false
+	}
+	k := h.dbCols[m[1]]
+	for _, obj := range xobj {
+		val := reflect.ValueOf(obj).Elem()
+		for _, f := range generated[obj] {
+			if f != k || val.FieldByName(f).String() != m[2] {
+				continue
+			}
+			base := h.getSlug(val.FieldByName(h.fieldsSlug[f]).String())
+			taken, err := c.getTakenSlugs(h, f, base)
+			if err != nil {
+				return false
+			}
+			for slug := range used[f] {
+				taken[slug] = true
+			}
+			slug := h.getFreeSlug(base, taken)
+			val.FieldByName(f).SetString(slug)
+			if used != nil {
+				used[f][slug] = true
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// getTakenSlugs returns values of slug field that are equal to base or have
+// a suffix added to it
+func (c *Controller) getTakenSlugs(h *Helper, fieldName string, base string) (map[string]bool, error) {
+	rows, err := c.getQuerier().Query(h.getQuerySelectSlugs(fieldName), base, base+"-%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	taken := map[string]bool{}
+	for rows.Next() {
+		var slug string
+		err = rows.Scan(&slug)
+		if err != nil {
+			return nil, err
+		}
+		taken[slug] = true
+	}
+	return taken, rows.Err()
+}
+
+// getMissingReferences returns fields with "fk" tag that link to objects that
+// do not exist. Field of int64 type set to 0 does not link to any object,
+// while sql.NullInt64 can be NULL
+func (c *Controller) getMissingReferences(h *Helper, obj interface{}) ([]string, error) {
+	val := reflect.ValueOf(obj).Elem()
+	missing := []string{}
+	for _, k := range h.fields {
+		if h.fieldsFK[k] == "" {
+			continue
+		}
+		var id int64
+		if n, ok := val.FieldByName(k).Interface().(sql.NullInt64); ok {
+			if !n.Valid {
+				continue
+			}
+			id = n.Int64
+		} else {
+			id = val.FieldByName(k).Int()
+		}
+		if id != 0 {
+			var cnt int64
+			err := c.getQuerier().QueryRow(h.GetQueryCountReferenced(k), id).Scan(&cnt)
+			if err != nil {
+				return nil, err
+			}
+			if cnt > 0 {
+				continue
+			}
+		}
+		missing = append(missing, k)
+	}
+	return missing, nil
+}
+
+// getDDLError wraps error returned by the database for "CREATE TABLE" or
+// "DROP TABLE" query, setting Op so that caller can tell an existing table
+// (or dependent objects) apart from other failures
+func (c Controller) getDDLError(err error) *ErrController {
+	op := "DBQuery"
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "42P07":
+			op = "DBTableExists"
+		case "2BP01":
+			op = "DBTableHasDependents"
+		}
+	}
+	return &ErrController{
+		Op:  op,
+		Err: fmt.Errorf("Error executing DB query: %w", err),
+	}
+}
+
+// runHooks calls hooks registered for when (HookBefore or HookAfter) and stops
+// on the first one that returns an error
+func (c Controller) runHooks(when int, op int, obj interface{}) *ErrController {
+	hooks := c.hooks[when]
+	if len(hooks) == 0 {
+		return nil
+	}
+	h, _ := c.getHelper(obj)
+	info := c.getOperationInfo(h, op)
+	for i := range hooks {
+		fn := hooks[i]
+		if when == HookAfter {
+			fn = hooks[len(hooks)-1-i]
+		}
+		err := fn(c.getContext(), info, obj)
+		if err != nil {
+			return &ErrController{
+				Op:  "Hook",
+				Err: fmt.Errorf("Hook aborted operation: %w", err),
+			}
+		}
+	}
+	return nil
+}
+
+// interceptQuery passes query and its arguments through query interceptors
+func (c Controller) interceptQuery(h *Helper, op int, query string, args []interface{}) (string, []interface{}, *ErrController) {
+	if len(c.queryInterceptors) == 0 {
+		return query, args, nil
+	}
+	info := c.getOperationInfo(h, op)
+	for _, fn := range c.queryInterceptors {
+		var err error
+		query, args, err = fn(c.getContext(), info, query, args)
+		if err != nil {
+			return "", nil, &ErrController{
+				Op:  "QueryInterceptor",
+				Err: fmt.Errorf("Query interceptor failed: %w", err),
+			}
+		}
+	}
+	return query, args, nil
+}
+
+// getExpiresArgs returns current Unix timestamp as query argument when model
+// has field with "expires" tag
+func (c Controller) getExpiresArgs(h *Helper) []interface{} {
+	if !h.hasExpires() {
+		return nil
+	}
+	return []interface{}{c.clock.Now().Unix()}
+}
+
+// getOrder returns order when it is not empty, and default order set for
+// model's table otherwise
+func (c Controller) getOrder(h *Helper, order []string) []string {
+	if len(order) > 0 || c.orders == nil {
+		return order
+	}
+	return c.orders[h.dbTbl]
+}
+
+// getQueryHints returns hints registered for model's table and operation
+func (c *Controller) getQueryHints(h *Helper, op int) QueryHints {
+	if c.queryHints[h.dbTbl] == nil {
+		return QueryHints{}
+	}
+	return c.queryHints[h.dbTbl][op]
+}
+
+// runWithHints calls fn with the database connection. When there are settings
+// in hints for model and operation or session settings, fn is called within
+// a transaction in which the settings are executed first. Writes are run in
+// a transaction as well when outbox is enabled, model has webhooks or versions
+// of objects are stored on update. When
+// controller is in a transaction (see Begin), fn is always called within it
+func (c *Controller) runWithHints(h *Helper, op int, fn func(dbQuerier) error) error {
+	hints := c.getQueryHints(h, op)
+	if c.tx == nil && len(hints.Settings) == 0 && len(c.sessionSettings) == 0 && !c.recordsEvents(h, op) && !c.recordsVersions(h, op) {
+		return c.measure(h, op, func() error {
+			return fn(c.withContextQuerier(c.dbConn))
+		})
+	}
+	return c.runInTx(h, op, fn)
+}
+
+// runInTx runs fn in a transaction, with session settings and settings from
+// query hints for the operation applied first. When controller is in
+// a transaction (see Begin), fn is run within it and it is not committed
+func (c *Controller) runInTx(h *Helper, op int, fn func(dbQuerier) error) error {
+	return c.measure(h, op, func() error {
+		hints := c.getQueryHints(h, op)
+		if c.tx != nil {
+			for _, setting := range hints.Settings {
+				_, err := c.tx.Exec(setting)
+				if err != nil {
+					return err
+				}
+			}
+			return fn(c.withContextQuerier(c.tx))
+		}
+		tx, err := c.dbConn.BeginTx(c.getContext(), nil)
+		if err != nil {
+			return err
+		}
+		err = c.applySessionSettings(tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for _, setting := range hints.Settings {
+			_, err = tx.Exec(setting)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		err = fn(c.withContextQuerier(tx))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// measure calls fn and records its duration and error in metrics when they
+// are enabled. Pool is checked for waits for connections afterwards
+func (c *Controller) measure(h *Helper, op int, fn func() error) error {
+	defer c.checkPool(h, op)
+	if c.metrics == nil {
+		return fn()
+	}
+	start := time.Now()
+	err := fn()
+	c.metrics.record(h.dbTbl, op, time.Since(start), err)
+	return err
+}
+
+// recordsEvents returns true when changes of model made by the operation are
+// recorded in the outbox or webhook deliveries tables
+func (c Controller) recordsEvents(h *Helper, op int) bool {
+	return op&(OpCreate|OpUpdate|OpDelete) > 0 && (c.outbox || c.hasWebhooks(h, op))
+}
+
+// recordEvent inserts event about object's change into the outbox table when
+// outbox is enabled, and deliveries for model's webhooks
+func (c Controller) recordEvent(q dbQuerier, h *Helper, op int, obj interface{}) error {
+	if !c.recordsEvents(h, op) {
+		return nil
+	}
+	payload, err := h.getEventPayload(obj)
+	if err != nil {
+		return err
+	}
+	if c.outbox {
+		_, err = q.Exec(fmt.Sprintf("INSERT INTO %s(event_tbl,event_op,event_obj_id,event_payload) VALUES ($1,$2,$3,$4)", c.getOutboxTbl()), h.dbTbl, op, c.GetModelIDValue(obj), string(payload))
+		if err != nil {
+			return err
+		}
+	}
+	return c.recordWebhookDeliveries(q, h, op, obj, payload)
+}
+
+// getOutboxTbl returns name of the outbox table
+func (c Controller) getOutboxTbl() string {
+	return c.dbTblPrefix + "crud_outbox"
+}
+
+// newHelper creates Helper with Controller settings such as strict mode
+func (c *Controller) newHelper(obj interface{}, forceName string, sourceHelper *Helper) *Helper {
+	return newHelperWithOptions(obj, c.dbTblPrefix, forceName, sourceHelper, helperOptions{
+		strict:         c.strictMode,
+		typeConverters: c.typeConverters,
+		fkHelper:       c.getModelHelper,
+	})
+}
+
+// getModelHelper returns Helper of model with name, without the ones of DTOs,
+// or nil when the model has not been used yet
+func (c *Controller) getModelHelper(model string) *Helper {
+	c.helpersMu.RLock()
+	defer c.helpersMu.RUnlock()
+	for _, h := range c.modelHelpers {
+		if h.modelName == model && h.sourceDBTbl == "" {
+			return h
+		}
+	}
 	return nil
 }
 
+// getModelName returns name of struct type or name of model defined with
+// DefineModel
+func (c *Controller) getModelName(s reflect.Type) string {
+	if s.Name() == "" {
+		return c.dynamicModels[s]
+	}
+	return s.Name()
+}
+
+// getHelperKey returns key under which Helper for struct type is stored.
+// Structs of models defined at runtime have no name so the whole type
+// definition is used
+func (c *Controller) getHelperKey(s reflect.Type) string {
+	if s.Name() == "" {
+		return s.String()
+	}
+	return s.Name()
+}
+
 // getHelper returns a special Helper instance which reflects the struct type
 // to get SQL queries, validation etc.
 func (c *Controller) getHelper(obj interface{}) (*Helper, *ErrController) {
 	v := reflect.ValueOf(obj)
 	i := reflect.Indirect(v)
 	s := i.Type()
-	n := s.Name()
-	if c.modelHelpers[n] == nil {
-		h := NewHelper(obj, c.dbTblPrefix, "", nil)
-		if h.Err() != nil {
-			return nil, &ErrController{
-				Op:  "GetHelper",
-				Err: fmt.Errorf("Error getting Helper: %w", h.Err()),
-			}
+	n := c.getHelperKey(s)
+	c.helpersMu.RLock()
+	h := c.modelHelpers[n]
+	c.helpersMu.RUnlock()
+	if h != nil {
+		return c.getHelperVariant(h), nil
+	}
+	h = c.newHelper(obj, c.dynamicModels[s], nil)
+	if h.Err() != nil {
+		return nil, &ErrController{
+			Op:  "GetHelper",
+			Err: fmt.Errorf("Error getting Helper: %w", h.Err()),
 		}
+	}
+	c.helpersMu.Lock()
+	defer c.helpersMu.Unlock()
+	if c.modelHelpers[n] == nil {
 		c.modelHelpers[n] = h
 	}
-	return c.modelHelpers[n], nil
+	return c.getHelperVariant(c.modelHelpers[n]), nil
+}
+
+// getHelperVariant returns Helper that includes soft-deleted objects when
+// controller was returned by WithDeleted
+func (c *Controller) getHelperVariant(h *Helper) *Helper {
+	if c.withDeleted && h.helperWithDeleted != nil {
+		return h.helperWithDeleted
+	}
+	return h
+}
+
+// setHelper stores Helper under a key. Helpers are created lazily when
+// objects are used for the first time, which can happen in many goroutines
+// at once, so access to them is guarded by a lock shared by copies of
+// Controller
+func (c *Controller) setHelper(n string, h *Helper) {
+	c.helpersMu.Lock()
+	c.modelHelpers[n] = h
+	c.helpersMu.Unlock()
+}
+
+// unmarshalRequestBody parses request body into obj. When obj implements
+// json.Unmarshaler, body in other format is converted to JSON first, so that
+// obj is decoded the same way regardless of the format
+func (c Controller) unmarshalRequestBody(serializer Serializer, body []byte, obj interface{}) error {
+	body = c.replaceJSONAliases(obj, serializer, body)
+	if _, ok := obj.(json.Unmarshaler); !ok || isJSONSerializer(serializer) {
+		return serializer.Unmarshal(body, obj)
+	}
+	m := map[string]interface{}{}
+	err := serializer.Unmarshal(body, &m)
+	if err != nil {
+		return err
+	}
+	j, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, obj)
+}
+
+// replaceJSONAliases returns request body with keys that are aliases of
+// fields, set with the "jsonalias" tag, or their names in camelCase when it
+// is set with SetJSONNaming, replaced with the JSON names of the fields. When
+// body contains both, value under the JSON name is kept. Body is returned
+// unchanged when it cannot be parsed
+func (c Controller) replaceJSONAliases(obj interface{}, serializer Serializer, body []byte) []byte {
+	h, err := c.getHelper(obj)
+	if err != nil || (len(h.jsonAliases) == 0 && c.jsonNaming != JSONNamingCamelCase) {
+		return body
+	}
+
+	m := map[string]interface{}{}
+	if isJSONSerializer(serializer) {
+		// Numbers are kept as json.Number so that they do not lose precision
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		if d.Decode(&m) != nil {
+			return body
+		}
+	} else if serializer.Unmarshal(body, &m) != nil {
+		return body
+	}
+
+	replaced := false
+	if c.jsonNaming == JSONNamingCamelCase {
+		m = renameJSONKeys(reflect.TypeOf(obj), m, false).(map[string]interface{})
+		replaced = true
+	}
+	for alias, fieldName := range h.jsonAliases {
+		v, ok := m[alias]
+		if !ok || h.fieldsJSONHidden[fieldName] {
+			continue
+		}
+		delete(m, alias)
+		replaced = true
+		if _, ok := m[h.fieldsJSONName[fieldName]]; !ok {
+			m[h.fieldsJSONName[fieldName]] = v
+		}
+	}
+	if !replaced {
+		return body
+	}
+	b, err2 := serializer.Marshal(m)
+	if err2 != nil {
+		return body
+	}
+	return b
 }
 
 func (c Controller) handleHTTPPut(w http.ResponseWriter, r *http.Request, newObjFunc func() interface{}, id string) {
@@ -621,111 +3203,255 @@ func (c Controller) handleHTTPPut(w http.ResponseWriter, r *http.Request, newObj
 
 	objClone := newObjFunc()
 
+	var stored map[string]interface{}
 	if id != "" {
 		err2 := c.SetFromDB(objClone, id)
 		if err2 != nil {
-			c.writeErrText(w, http.StatusInternalServerError, "cannot_get_from_db")
+			c.writeDBErrText(w, err2, http.StatusInternalServerError, "cannot_get_from_db")
 			return
 		}
 		if c.GetModelIDValue(objClone) == 0 {
 			c.writeErrText(w, http.StatusNotFound, "not_found_in_db")
 			return
 		}
+		stored = c.getAuditFields(objClone)
 	} else {
 		c.ResetFields(objClone)
 	}
 
-	err = json.Unmarshal(body, objClone)
+	err = c.unmarshalRequestBody(c.getRequestSerializer(r), body, objClone)
 	if err != nil {
 		c.writeErrText(w, http.StatusBadRequest, "invalid_json")
 		return
 	}
 
-	b, _, err := c.Validate(objClone, nil)
+	c.TransformFields(objClone)
+
+	op := OpCreate
+	if id != "" {
+		op = OpUpdate
+	}
+	c.setIdentityFields(objClone, op, GetIdentity(r), stored)
+	b, _, err := c.ValidateWithOptions(objClone, nil, ValidationOptions{Op: op})
 	if !b || err != nil {
 		c.writeErrText(w, http.StatusBadRequest, "validation_failed")
 		return
 	}
 
-	err2 := c.SaveToDB(objClone)
+	if isApprovalRequired(r) {
+		c.writeChangeRequest(w, r, objClone, op)
+		return
+	}
+
+	// Fields have been transformed before validation above
+	err2 := c.saveToDB(objClone, true)
+	if err2 != nil && err2.Op == "Validate" {
+		// Linked objects are checked only when saving
+		c.writeErrText(w, http.StatusBadRequest, "validation_failed")
+		return
+	}
 	if err2 != nil {
-		c.writeErrText(w, http.StatusInternalServerError, "cannot_save_to_db")
+		c.writeDBErrText(w, err2, http.StatusInternalServerError, "cannot_save_to_db")
 		return
 	}
 
 	if id != "" {
-		c.writeOK(w, http.StatusOK, map[string]interface{}{
-			"id": c.GetModelIDValue(objClone),
-		})
+		c.writeResponse(w, http.StatusOK, NewIDResponse(c.GetModelIDValue(objClone)))
 	} else {
-		c.writeOK(w, http.StatusCreated, map[string]interface{}{
-			"id": c.GetModelIDValue(objClone),
-		})
+		c.writeResponse(w, http.StatusCreated, NewIDResponse(c.GetModelIDValue(objClone)))
+	}
+}
+
+// getAuditFields returns values of fields with "createdby", "createdat" and
+// "updatedby" tags
+func (c Controller) getAuditFields(obj interface{}) map[string]interface{} {
+	stored := map[string]interface{}{}
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return stored
+	}
+	v := reflect.ValueOf(obj).Elem()
+	for _, f := range []string{h.fieldCreatedBy, h.fieldCreatedAt, h.fieldUpdatedBy} {
+		if f != "" {
+			stored[f] = v.FieldByName(f).Interface()
+		}
+	}
+	return stored
+}
+
+// setIdentityFields sets fields with "createdby" (on create) and "updatedby"
+// tags to the identity. On update, fields from stored (see getAuditFields)
+// are set back to their values so that they cannot be changed with the
+// payload, and "updatedby" field keeps its value when there is no identity
+func (c Controller) setIdentityFields(obj interface{}, op int, identity int64, stored map[string]interface{}) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return
+	}
+	v := reflect.ValueOf(obj).Elem()
+	if op == OpUpdate {
+		for f, val := range stored {
+			v.FieldByName(f).Set(reflect.ValueOf(val))
+		}
+	}
+	if h.fieldCreatedBy != "" && op == OpCreate {
+		v.FieldByName(h.fieldCreatedBy).SetInt(identity)
+	}
+	if h.fieldUpdatedBy != "" && (op == OpCreate || identity != 0) {
+		v.FieldByName(h.fieldUpdatedBy).SetInt(identity)
+	}
+}
+
+// setTimestampFields sets fields with "createdat" (on create) and "updatedat"
+// tags to the current time, which is Unix timestamp for int64 fields
+func (c Controller) setTimestampFields(h *Helper, obj interface{}, op int) {
+	v := reflect.ValueOf(obj).Elem()
+	now := c.clock.Now()
+	for _, f := range []string{h.fieldCreatedAt, h.fieldUpdatedAt} {
+		if f == "" || (f == h.fieldCreatedAt && op != OpCreate) {
+			continue
+		}
+		if h.fieldsFlags[f]&TypeTime > 0 {
+			v.FieldByName(f).Set(reflect.ValueOf(now))
+		} else {
+			v.FieldByName(f).SetInt(now.Unix())
+		}
 	}
 }
 
-func (c Controller) handleHTTPGet(w http.ResponseWriter, r *http.Request, newObjFunc func() interface{}, id string) {
+func (c Controller) handleHTTPGet(w http.ResponseWriter, r *http.Request, newObjFunc func() interface{}, id string, slugField string) {
 	if id == "" {
 		obj := newObjFunc()
-		params := c.getParamsFromURI(r.RequestURI)
-
-		limit, _ := strconv.Atoi(params["limit"])
-		offset, _ := strconv.Atoi(params["offset"])
-		if limit < 1 {
-			limit = 10
-		}
-		if offset < 0 {
-			offset = 0
-		}
-
-		order := []string{}
-		if params["order"] != "" {
-			order = append(order, params["order"])
-			order = append(order, params["order_direction"])
-		}
-
-		filters := make(map[string]interface{})
-		for k, v := range params {
-			if strings.HasPrefix(k, "filter_") {
-				k = k[7:]
-				fieldName, fieldValue, errF := c.uriFilterToFilter(obj, k, v)
-				if errF != nil {
-					if errF.Op == "GetHelper" {
-						c.writeErrText(w, http.StatusInternalServerError, "get_helper")
-						return
-					} else {
-						c.writeErrText(w, http.StatusBadRequest, "invalid_filter")
-						return
-					}
-				}
-				if fieldName != "" {
-					filters[fieldName] = fieldValue
-				}
+
+		if c.strictParams {
+			if p := c.getUnknownParam(r, obj); p != "" {
+				c.writeErrTextWithData(w, http.StatusBadRequest, "unknown_param", map[string]interface{}{
+					"param":   p,
+					"allowed": listParamNames,
+				})
+				return
 			}
 		}
+
+		params, badParam, errP := c.parseListParams(r, obj)
+		if errP != nil {
+			if errP.Op == "GetHelper" {
+				c.writeDBErrText(w, errP, http.StatusInternalServerError, "get_helper")
+			} else if errP.Op == "FilterNotAllowed" {
+				c.writeErrTextWithData(w, http.StatusBadRequest, "filter_not_allowed", map[string]interface{}{
+					"param": badParam,
+				})
+			} else {
+				c.writeErrText(w, http.StatusBadRequest, "invalid_filter")
+			}
+			return
+		}
+		order, limit, offset, filters := params.Order, params.Limit, params.Offset, params.Filters
+		if !c.checkIncludeParam(w, obj, params.Include) {
+			return
+		}
+		joinFields, ok := c.checkJoinParam(w, obj, params.Join)
+		if !ok {
+			return
+		}
+
+		if c.devMode && r.Header.Get("X-Crud-Explain") == "1" {
+			plan, err1 := c.ExplainGetFromDB(newObjFunc, order, limit, offset, filters)
+			if err1 != nil {
+				c.writeListErrText(w, err1, "cannot_explain_in_db")
+				return
+			}
+			// Plan is decoded so that serializers other than JSON write it
+			// as a structure rather than as bytes
+			var planObj interface{}
+			err := json.Unmarshal([]byte(plan), &planObj)
+			if err != nil {
+				c.writeDBErrText(w, &ErrController{
+					Op:  "UnmarshalPlan",
+					Err: fmt.Errorf("Error unmarshalling query plan: %w", err),
+				}, http.StatusInternalServerError, "cannot_explain_in_db")
+				return
+			}
+			c.writeOK(w, http.StatusOK, map[string]interface{}{
+				"plan": planObj,
+			})
+			return
+		}
+
 		xobj, err1 := c.GetFromDB(newObjFunc, order, limit, offset, filters)
 		if err1 != nil {
-			if err1.Op == "ValidateFilters" {
-				c.writeErrText(w, http.StatusBadRequest, "invalid_filter_value")
-				return
-			} else {
-				c.writeErrText(w, http.StatusInternalServerError, "cannot_get_from_db")
+			c.writeListErrText(w, err1, "cannot_get_from_db")
+			return
+		}
+		if !c.loadJoinFields(w, xobj, joinFields) {
+			return
+		}
+		items, err1 := c.getResponseItems(r, xobj, params.Include)
+		if err1 != nil {
+			c.writeDBErrText(w, err1, http.StatusInternalServerError, "cannot_get_from_db")
+			return
+		}
+
+		var totalItems *int64
+		if params.Count {
+			cnt, err1 := c.GetCountFromDB(newObjFunc, filters)
+			if err1 != nil {
+				c.writeDBErrText(w, err1, http.StatusInternalServerError, "cannot_get_from_db")
 				return
 			}
+			totalItems = &cnt
 		}
+		c.writeResponse(w, http.StatusOK, NewListResponse(c.getOrderedItems(xobj, items, params.Include), totalItems))
 
-		c.writeOK(w, http.StatusOK, map[string]interface{}{
-			"items": xobj,
-		})
+		return
+	}
+
+	objClone := newObjFunc()
+	include := c.getIncludeParam(r)
+	if !c.checkIncludeParam(w, objClone, include) {
+		return
+	}
+	joinFields, ok := c.checkJoinParam(w, objClone, getQueryParamList(r, "join"))
+	if !ok {
+		return
+	}
+
+	var err *ErrController
+	if slugField != "" && !idRegExp.MatchString(id) {
+		err = c.SetFromDBByField(objClone, slugField, id)
+	} else {
+		err = c.SetFromDB(objClone, id)
+	}
+	if err != nil {
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+		return
+	}
+
+	if c.GetModelIDValue(objClone) == 0 {
+		c.writeErrText(w, http.StatusNotFound, "not_found_in_db")
+		return
+	}
 
+	if !c.loadJoinFields(w, []interface{}{objClone}, joinFields) {
 		return
 	}
+	c.writeItemWithRelations(w, r, objClone, include)
+}
 
+func (c Controller) handleHTTPGetByField(w http.ResponseWriter, r *http.Request, newObjFunc func() interface{}, fieldName string, value interface{}) {
 	objClone := newObjFunc()
+	include := c.getIncludeParam(r)
+	if !c.checkIncludeParam(w, objClone, include) {
+		return
+	}
+	joinFields, ok := c.checkJoinParam(w, objClone, getQueryParamList(r, "join"))
+	if !ok {
+		return
+	}
 
-	err := c.SetFromDB(objClone, id)
+	err := c.SetFromDBByField(objClone, fieldName, value)
 	if err != nil {
-		c.writeErrText(w, http.StatusInternalServerError, "cannot_get_from_db")
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
 		return
 	}
 
@@ -734,9 +3460,38 @@ func (c Controller) handleHTTPGet(w http.ResponseWriter, r *http.Request, newObj
 		return
 	}
 
-	c.writeOK(w, http.StatusOK, map[string]interface{}{
-		"item": objClone,
-	})
+	if !c.loadJoinFields(w, []interface{}{objClone}, joinFields) {
+		return
+	}
+	c.writeItemWithRelations(w, r, objClone, include)
+}
+
+// checkIncludeParam writes "400 Bad Request" response and returns false when
+// any of the names in include is not a relation of the model
+func (c Controller) checkIncludeParam(w http.ResponseWriter, obj interface{}, include []string) bool {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "get_helper")
+		return false
+	}
+	if name := c.getInvalidInclude(h, include); name != "" {
+		c.writeErrTextWithData(w, http.StatusBadRequest, "invalid_include", map[string]interface{}{
+			"include": name,
+		})
+		return false
+	}
+	return true
+}
+
+// writeItemWithRelations writes response with object that has related objects
+// from include embedded in it and fields formatted, like list items are
+func (c Controller) writeItemWithRelations(w http.ResponseWriter, r *http.Request, obj interface{}, include []string) {
+	items, err := c.getResponseItems(r, []interface{}{obj}, include)
+	if err != nil {
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+		return
+	}
+	c.writeResponse(w, http.StatusOK, NewItemResponse(c.getOrderedItems([]interface{}{obj}, items, include)[0]))
 }
 
 func (c Controller) handleHTTPDelete(w http.ResponseWriter, r *http.Request, newObjFunc func() interface{}, id string) {
@@ -749,7 +3504,7 @@ func (c Controller) handleHTTPDelete(w http.ResponseWriter, r *http.Request, new
 
 	err := c.SetFromDB(objClone, id)
 	if err != nil {
-		c.writeErrText(w, http.StatusInternalServerError, "cannot_get_from_db")
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
 		return
 	}
 	if c.GetModelIDValue(objClone) == 0 {
@@ -757,24 +3512,53 @@ func (c Controller) handleHTTPDelete(w http.ResponseWriter, r *http.Request, new
 		return
 	}
 
+	if isApprovalRequired(r) {
+		c.writeChangeRequest(w, r, objClone, OpDelete)
+		return
+	}
+
+	// DeleteFromDB resets fields of the object, including ID
+	deletedID := c.GetModelIDValue(objClone)
 	err = c.DeleteFromDB(objClone)
 	if err != nil {
-		c.writeErrText(w, http.StatusInternalServerError, "cannot_delete_from_db")
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_delete_from_db")
 		return
 	}
 
-	c.writeOK(w, http.StatusOK, map[string]interface{}{
-		"id": id,
-	})
+	c.writeResponse(w, http.StatusOK, NewIDResponse(deletedID))
+}
+
+// getRelativePath returns part of the request path after uri that handler was
+// registered with. When handler is wrapped with http.StripPrefix, path does not
+// start with the whole uri, so the longest ending of uri (starting with "/")
+// that path starts with is removed instead, and path stripped completely (not
+// starting with "/") is used as it is. Path without the trailing slash of
+// uri (eg. "/users" for "/users/") is treated as the list path
+func (c Controller) getRelativePath(uri string, path string) (string, bool) {
+	for i := 0; i < len(uri); i++ {
+		if i > 0 && uri[i] != '/' {
+			continue
+		}
+		prefix := uri[i:]
+		if strings.HasPrefix(path, prefix) {
+			return path[len(prefix):], true
+		}
+		if strings.HasSuffix(prefix, "/") && path == strings.TrimSuffix(prefix, "/") {
+			return "", true
+		}
+	}
+	if uri == "" || !strings.HasPrefix(path, "/") {
+		return strings.TrimPrefix(path, "/"), true
+	}
+	return "", false
 }
 
-func (c Controller) getIDFromURI(uri string, w http.ResponseWriter) (string, bool) {
+func (c Controller) getIDFromURI(uri string, w http.ResponseWriter, allowSlug bool) (string, bool) {
 	xs := strings.SplitN(uri, "?", 2)
 	if xs[0] == "" {
 		return "", true
 	}
-	matched, err := regexp.Match(`^[0-9]+$`, []byte(xs[0]))
-	if err != nil || !matched {
+	if !idRegExp.MatchString(xs[0]) && !(allowSlug && slugRegExp.MatchString(xs[0])) {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write(c.jsonError("invalid id"))
 		return "", false
@@ -782,26 +3566,161 @@ func (c Controller) getIDFromURI(uri string, w http.ResponseWriter) (string, boo
 	return xs[0], true
 }
 
-func (c Controller) getParamsFromURI(uri string) map[string]string {
-	o := make(map[string]string)
-	xs := strings.SplitN(uri, "?", 2)
-	if len(xs) < 2 || xs[1] == "" {
-		return o
-	}
-	xp := strings.SplitN(xs[1], "&", -1)
-	for _, p := range xp {
-		pv := strings.SplitN(p, "=", 2)
-		matched, err := regexp.Match(`^[0-9a-zA-Z_]+$`, []byte(pv[0]))
-		if len(pv) == 1 || err != nil || !matched {
+// getLookupFromURI checks if URI is in the "column/value" format, where column
+// belongs to a field that has "uniq" and "lookup" tags, and returns the field
+// name and the value
+func (c Controller) getLookupFromURI(uri string, obj interface{}) (string, interface{}, bool) {
+	xs := strings.SplitN(strings.SplitN(uri, "?", 2)[0], "/", 2)
+	if len(xs) != 2 || xs[1] == "" {
+		return "", nil, false
+	}
+
+	h, err := c.getHelper(obj)
+	if err != nil || !h.fieldsLookup[h.dbCols[xs[0]]] {
+		return "", nil, false
+	}
+
+	value, err2 := url.PathUnescape(xs[1])
+	if err2 != nil {
+		return "", nil, false
+	}
+
+	fieldName, fieldValue, err3 := c.uriFilterToFilter(obj, xs[0], value)
+	if err3 != nil || fieldName == "" {
+		return "", nil, false
+	}
+	return fieldName, fieldValue, true
+}
+
+// GetListParams parses limit, offset, order and filters out from the query
+// string of HTTP list request, the same way HTTP handler does it, so that
+// middleware can check them. obj is used to get field names and types for
+// filters
+func (c Controller) GetListParams(r *http.Request, obj interface{}) (*ListParams, *ErrController) {
+	params, _, err := c.parseListParams(r, obj)
+	return params, err
+}
+
+// parseListParams works like GetListParams but it also returns name of the
+// query parameter that could not be parsed
+func (c Controller) parseListParams(r *http.Request, obj interface{}) (*ListParams, string, *ErrController) {
+	q := r.URL.Query()
+
+	params := &ListParams{
+		Order:   []string{},
+		Filters: make(map[string]interface{}),
+	}
+	params.Limit, _ = strconv.Atoi(q.Get("limit"))
+	params.Offset, _ = strconv.Atoi(q.Get("offset"))
+	if params.Limit < 1 {
+		params.Limit = 10
+	}
+	if params.Offset < 0 {
+		params.Offset = 0
+	}
+	if q.Get("order") != "" {
+		params.Order = append(params.Order, q.Get("order"), q.Get("order_direction"))
+	}
+	params.Include = c.getIncludeParam(r)
+	params.Join = getQueryParamList(r, "join")
+	params.Count = q.Get("count") == "1" || q.Get("count") == "true"
+
+	names := []string{}
+	for k := range q {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		if !strings.HasPrefix(k, "filter_") {
 			continue
 		}
-		unesc, err := url.QueryUnescape(pv[1])
-		if err != nil {
+		filterName := strings.TrimSuffix(k[7:], "[]")
+		if !paramNameRegExp.MatchString(filterName) {
+			continue
+		}
+		operator := ""
+		if h, err := c.getHelper(obj); err == nil {
+			filterName, operator = h.getFilterNameOperator(filterName)
+		}
+		xv := []interface{}{}
+		fieldName := ""
+		for _, v := range q[k] {
+			values := []string{v}
+			if operator == "IN" {
+				values = strings.Split(v, ",")
+			}
+			for _, sv := range values {
+				n, fieldValue, err := c.uriFilterToFilter(obj, filterName, sv)
+				if err != nil {
+					return nil, k, err
+				}
+				fieldName = n
+				xv = append(xv, fieldValue)
+			}
+		}
+		if fieldName == "" {
+			continue
+		}
+		if operator == "" {
+			if len(xv) == 1 {
+				params.Filters[fieldName] = xv[0]
+			} else {
+				params.Filters[fieldName] = xv
+			}
 			continue
 		}
-		o[pv[0]] = unesc
+		// Filters with operators on the same field, eg. a range, go after
+		// the one without operator, as names are sorted
+		conds := []FilterCondition{}
+		if v, ok := params.Filters[fieldName]; ok {
+			conds = getFilterConditions(v)
+		}
+		if operator == "IN" {
+			conds = append(conds, FilterCondition{Operator: operator, Value: xv})
+		} else {
+			for _, v := range xv {
+				conds = append(conds, FilterCondition{Operator: operator, Value: v})
+			}
+		}
+		params.Filters[fieldName] = conds
 	}
-	return o
+	return params, "", nil
+}
+
+// getIncludeParam returns names of relations from comma separated "include"
+// query parameter
+func (c Controller) getIncludeParam(r *http.Request) []string {
+	return getQueryParamList(r, "include")
+}
+
+// getUnknownParam returns first (in alphabetical order) query parameter of
+// a list request that is not known, or a filter on a field that does not exist
+func (c Controller) getUnknownParam(r *http.Request, obj interface{}) string {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return ""
+	}
+	names := []string{}
+	for k := range r.URL.Query() {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+NAMES:
+	for _, k := range names {
+		if strings.HasPrefix(k, "filter_") {
+			if n, _ := h.getFilterNameOperator(strings.TrimSuffix(k[7:], "[]")); h.dbCols[n] == "" {
+				return k
+			}
+			continue
+		}
+		for _, p := range listParamNames {
+			if k == p {
+				continue NAMES
+			}
+		}
+		return k
+	}
+	return ""
 }
 
 func (c Controller) jsonError(e string) []byte {
@@ -812,15 +3731,6 @@ func (c Controller) jsonID(id int64) []byte {
 	return []byte(fmt.Sprintf("{\"id\":\"%d\"}", id))
 }
 
-func (c Controller) isKeyInMap(k string, m map[string]interface{}) bool {
-	for _, key := range reflect.ValueOf(m).MapKeys() {
-		if key.String() == k {
-			return true
-		}
-	}
-	return false
-}
-
 func (c Controller) uriFilterToFilter(obj interface{}, filterName string, filterValue string) (string, interface{}, *ErrController) {
 	h, err := c.getHelper(obj)
 	if err != nil {
@@ -830,54 +3740,121 @@ func (c Controller) uriFilterToFilter(obj interface{}, filterName string, filter
 		}
 	}
 
-	if h.dbCols[filterName] == "" {
+	if h.dbCols[filterName] == "" && !h.hasFilterableFields() {
 		return "", nil, nil
 	}
+	if !h.isFilterable(h.dbCols[filterName]) {
+		return "", nil, &ErrController{
+			Op:  "FilterNotAllowed",
+			Err: fmt.Errorf("Filtering by %s is not allowed", filterName),
+		}
+	}
 
 	val := reflect.ValueOf(obj).Elem()
 	valueField := val.FieldByName(h.dbCols[filterName])
-	if valueField.Type().Name() == "int" {
-		filterInt, err := strconv.Atoi(filterValue)
+	if h.fieldsFlags[h.dbCols[filterName]]&TypeConverted > 0 {
+		v, err := h.getTypeConverter(h.dbCols[filterName]).FromDB(filterValue)
 		if err != nil {
 			return "", nil, &ErrController{
 				Op:  "InvalidValue",
-				Err: fmt.Errorf("Error converting string to int: %w", err),
+				Err: fmt.Errorf("Error converting string to %s: %w", valueField.Type().Name(), err),
 			}
 		}
-		return h.dbCols[filterName], filterInt, nil
+		return h.dbCols[filterName], v, nil
 	}
-	if valueField.Type().Name() == "int64" {
-		filterInt64, err := strconv.ParseInt(filterValue, 10, 64)
+	if h.fieldsFlags[h.dbCols[filterName]]&TypeTime > 0 {
+		v, err := time.Parse(time.RFC3339, filterValue)
 		if err != nil {
 			return "", nil, &ErrController{
 				Op:  "InvalidValue",
-				Err: fmt.Errorf("Error converting string to int64: %w", err),
+				Err: fmt.Errorf("Error converting string to time: %w", err),
 			}
 		}
-		return h.dbCols[filterName], filterInt64, nil
+		return h.dbCols[filterName], v, nil
 	}
-	if valueField.Type().Name() == "string" {
-		return h.dbCols[filterName], filterValue, nil
+
+	switch valueField.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		filterUint64, err := strconv.ParseUint(filterValue, 10, valueField.Type().Bits())
+		if err != nil {
+			return "", nil, &ErrController{
+				Op:  "InvalidValue",
+				Err: fmt.Errorf("Error converting string to %s: %w", valueField.Type().Name(), err),
+			}
+		}
+		return h.dbCols[filterName], reflect.ValueOf(filterUint64).Convert(valueField.Type()).Interface(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		filterInt64, err := strconv.ParseInt(filterValue, 10, valueField.Type().Bits())
+		if err != nil {
+			return "", nil, &ErrController{
+				Op:  "InvalidValue",
+				Err: fmt.Errorf("Error converting string to %s: %w", valueField.Type().Name(), err),
+			}
+		}
+		return h.dbCols[filterName], reflect.ValueOf(filterInt64).Convert(valueField.Type()).Interface(), nil
+	case reflect.String:
+		return h.dbCols[filterName], reflect.ValueOf(filterValue).Convert(valueField.Type()).Interface(), nil
 	}
 
 	return "", nil, nil
 }
 
-func (c Controller) writeErrText(w http.ResponseWriter, status int, errText string) {
-	r := NewHTTPResponse(0, errText)
-	j, err := json.Marshal(r)
+// writeResponse writes HTTPResponse or one of the typed responses, eg.
+// ItemResponse, in the format of the serializer
+func (c Controller) writeResponse(w http.ResponseWriter, status int, r interface{}) {
+	b, err := c.serializer.Marshal(r)
+	w.Header().Set("Content-Type", c.serializer.ContentType())
 	w.WriteHeader(status)
 	if err == nil {
-		w.Write(j)
+		w.Write(b)
+	}
+}
+
+func (c Controller) writeErrText(w http.ResponseWriter, status int, errText string) {
+	r := NewHTTPResponse(0, errText)
+	c.writeResponse(w, status, r)
+}
+
+// writeDBErrText writes error response for error returned from database
+// operation, or "403 Forbidden" when the operation was aborted by a hook.
+// Full error goes to the error logger and it is added to the response only
+// in verbose mode
+func (c Controller) writeDBErrText(w http.ResponseWriter, err *ErrController, status int, errText string) {
+	if c.errLogger != nil {
+		c.errLogger(err)
+	}
+	if err.Op == "Hook" {
+		status, errText = http.StatusForbidden, "operation_aborted"
+	}
+	if c.verboseErrs {
+		c.writeErrTextWithData(w, status, errText, map[string]interface{}{
+			"op":    err.Op,
+			"error": err.Error(),
+		})
+		return
+	}
+	c.writeErrText(w, status, errText)
+}
+
+// writeListErrText writes error response for error returned when listing
+// objects, which is "400 Bad Request" when filter values are invalid and
+// errText from database operation otherwise
+func (c Controller) writeListErrText(w http.ResponseWriter, err *ErrController, errText string) {
+	if err.Op == "ValidateFilters" {
+		c.writeErrText(w, http.StatusBadRequest, "invalid_filter_value")
+		return
 	}
+	c.writeDBErrText(w, err, http.StatusInternalServerError, errText)
+}
+
+func (c Controller) writeErrTextWithData(w http.ResponseWriter, status int, errText string, data map[string]interface{}) {
+	r := NewHTTPResponse(0, errText)
+	r.Data = data
+	c.writeResponse(w, status, r)
 }
 
 func (c Controller) writeOK(w http.ResponseWriter, status int, data map[string]interface{}) {
 	r := NewHTTPResponse(1, "")
 	r.Data = data
-	j, err := json.Marshal(r)
-	w.WriteHeader(status)
-	if err == nil {
-		w.Write(j)
-	}
+	c.writeResponse(w, status, r)
 }
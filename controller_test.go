@@ -1,14 +1,26 @@
 package crud
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // TestGetModelIDInterface tests if GetModelIDInterface return pointer to ID
@@ -101,6 +113,42 @@ func TestValidateWithInvalidStruct(t *testing.T) {
 	}
 }
 
+// TestValidateWithOptions tests if ValidateWithOptions stops validation
+// early and returns invalid fields in the declaration order
+func TestValidateWithOptions(t *testing.T) {
+	ts := getTestStructWithData()
+	ts.PrimaryEmail = "invalidemail"
+	ts.EmailSecondary = "invalidemail"
+	ts.FirstName = "x"
+	ts.Price = 1000
+
+	b, failedFields, err := testController.ValidateWithOptions(ts, nil, ValidationOptions{FailFast: true})
+	if err != nil || b {
+		t.Fatalf("ValidateWithOptions failed to return false for struct with invalid field values")
+	}
+	if len(failedFields) != 1 || failedFields[0] != "PrimaryEmail" {
+		t.Fatalf("ValidateWithOptions with FailFast returned invalid fields, want [PrimaryEmail], got %v", failedFields)
+	}
+
+	_, failedFields, _ = testController.ValidateWithOptions(ts, nil, ValidationOptions{MaxErrors: 3})
+	if strings.Join(failedFields, ",") != "PrimaryEmail,EmailSecondary,FirstName" {
+		t.Fatalf("ValidateWithOptions with MaxErrors returned invalid fields, want [PrimaryEmail EmailSecondary FirstName], got %v", failedFields)
+	}
+
+	_, failedFields, _ = testController.ValidateWithOptions(ts, nil, ValidationOptions{})
+	if strings.Join(failedFields, ",") != "PrimaryEmail,EmailSecondary,FirstName,Price" {
+		t.Fatalf("ValidateWithOptions returned invalid fields, want [PrimaryEmail EmailSecondary FirstName Price], got %v", failedFields)
+	}
+}
+
+// BenchmarkValidate measures performance of validating a valid object
+func BenchmarkValidate(b *testing.B) {
+	ts := getTestStructWithData()
+	for i := 0; i < b.N; i++ {
+		testController.Validate(ts, nil)
+	}
+}
+
 // TestSaveToDB tests if SaveToDB properly inserts and updates object in the
 // database
 func TestSaveToDB(t *testing.T) {
@@ -211,210 +259,3709 @@ func TestGetFromDB(t *testing.T) {
 	}
 }
 
-// TestHTTPHanlderPutMethodForValidations checks if HTTP endpoint returns
-// validation failed error when PUT request with invalid input is made
-func TestHTTPHandlerPutMethodForValidation(t *testing.T) {
-	j := `{
-		"email": "invalid",
-		"first_name": "J",
-		"last_name": "S",
-		"key": "12"
-	}`
-	b := makePUTInsertRequest(j, http.StatusBadRequest, t)
-	if !strings.Contains(string(b), "validation_failed") {
-		t.Fatalf("PUT method for invalid request did not output validation_failed error text")
+// TestGetFromDBWithDefaultOrder tests if GetFromDB uses default order set for
+// the model when no order is passed
+func TestGetFromDBWithDefaultOrder(t *testing.T) {
+	c := NewController(dbConn, "")
+	err := c.SetDefaultOrder(&TestStruct{}, []string{"Age", "desc"})
+	if err != nil {
+		t.Fatalf("SetDefaultOrder failed: %s", err.Op)
+	}
+	if c.SetDefaultOrder(&TestStruct{}, []string{"NonExisting", "desc"}) == nil {
+		t.Fatalf("SetDefaultOrder failed to return error for invalid field")
+	}
+
+	testStructs, err := c.GetFromDB(testStructNewFunc, nil, 10, 0, map[string]interface{}{"Price": 444})
+	if err != nil {
+		t.Fatalf("GetFromDB failed to return list of objects: %s", err.Op)
+	}
+	if len(testStructs) == 0 || testStructs[0].(*TestStruct).Age != 80 {
+		t.Fatalf("GetFromDB failed to use default order")
 	}
 }
 
-// TestHTTPHandlerPutMethodForCreating tests if HTTP endpoint properly creates
-// new object in the database, when PUT request is made, without object ID
-func TestHTTPHandlerPutMethodForCreating(t *testing.T) {
-	j := `{
-		"email": "test@example.com",
-		"first_name": "John",
-		"last_name": "Smith",
-		"key": "123456789012345678901234567890aa"
-	}`
-	b := makePUTInsertRequest(j, http.StatusCreated, t)
+type testPublisher struct {
+	events []*Event
+}
 
-	id, flags, primaryEmail, emailSecondary, firstName, lastName, age, price, postCode, postCode2, password, createdByUserID, key, err := getRow()
+func (p *testPublisher) Publish(e *Event) error {
+	p.events = append(p.events, e)
+	return nil
+}
+
+// TestOutbox tests if changes are recorded in the outbox table and published
+// once by OutboxDispatcher
+func TestOutbox(t *testing.T) {
+	c := NewController(dbConn, "gen64_")
+	c.SetOutbox(true)
+	err := c.CreateOutboxTable()
 	if err != nil {
-		t.Fatalf("PUT method failed to insert struct to the table: %s", err.Error())
-	}
-	if id == 0 || flags != 0 || primaryEmail != "test@example.com" || emailSecondary != "" || firstName != "John" || lastName != "Smith" || age != 0 || price != 0 || postCode != "" || postCode2 != "" || createdByUserID != 0 || key != "123456789012345678901234567890aa" || password != "" {
-		t.Fatalf("PUT method failed to insert struct to the table")
+		t.Fatalf("CreateOutboxTable failed: %s", err.Op)
 	}
 
-	r := NewHTTPResponse(1, "")
-	err = json.Unmarshal(b, &r)
+	ts := getTestStructWithData()
+	ts.ID = 0
+	err = c.SaveToDB(ts)
 	if err != nil {
-		t.Fatalf("PUT method returned wrong json output, error marshaling: %s", err.Error())
+		t.Fatalf("SaveToDB failed: %s", err.Op)
 	}
 
-	if r.Data["id"].(float64) == 0 {
-		t.Fatalf("PUT method did not return id")
+	pub := &testPublisher{}
+	d := NewOutboxDispatcher(c, pub)
+	cnt, err2 := d.DispatchOnce()
+	if err2 != nil || cnt != 1 || len(pub.events) != 1 {
+		t.Fatalf("DispatchOnce failed to publish event, published %d: %v", cnt, err2)
+	}
+	if pub.events[0].Op != OpCreate || pub.events[0].ObjID != ts.ID || pub.events[0].Tbl != "gen64_test_structs" {
+		t.Fatalf("DispatchOnce published invalid event: %v", pub.events[0])
+	}
+
+	cnt, _ = d.DispatchOnce()
+	if cnt != 0 {
+		t.Fatalf("DispatchOnce published event that was already dispatched")
 	}
 }
 
-// TestHTTPHandlerPutMethodForUpdating tests if HTTP endpoint successfully
-// updates object details when PUT request with ID is being made
-func TestHTTPHandlerPutMethodForUpdating(t *testing.T) {
-	j := `{
-		"test_struct_flags": 8,
-		"email": "test11@example.com",
-		"email2": "test22@example.com",
-		"first_name": "John2",
-		"last_name": "Smith2",
-		"age": 39,
-		"price": 199,
-		"post_code": "22-222",
-		"post_code2": "33-333",
-		"password": "password123updated",
-		"created_by_user_id": 12,
-		"key": "123456789012345678901234567890nbh"
-	}`
-	_ = makePUTUpdateRequest(j, 54, false, t)
+// TestWebhooks tests if webhook deliveries are recorded, sent with signature
+// and retried
+func TestWebhooks(t *testing.T) {
+	var body []byte
+	var signature string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get("X-Crud-Signature")
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
 
-	id, flags, primaryEmail, emailSecondary, firstName, lastName, age, price, postCode, postCode2, password, createdByUserID, key, err := getRow()
+	c := NewController(dbConn, "gen64_")
+	err := c.CreateWebhookDeliveriesTable()
 	if err != nil {
-		t.Fatalf("PUT method failed to update struct to the table: %s", err.Error())
+		t.Fatalf("CreateWebhookDeliveriesTable failed: %s", err.Op)
 	}
-	// Only 2 fields should be updated: FirstName and LastName. Check the TestStruct_Update struct
-	if id == 0 || flags != 0 || primaryEmail != "test@example.com" || emailSecondary != "" || firstName != "John2" || lastName != "Smith2" || age != 0 || price != 0 || postCode != "" || postCode2 != "" || createdByUserID != 0 || key != "123456789012345678901234567890aa" || password != "" {
-		t.Fatalf("PUT method failed to update struct in the table")
+	err = c.AddWebhook(&TestStruct{}, Webhook{URL: srv.URL, Ops: OpCreate | OpDelete, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("AddWebhook failed: %s", err.Op)
+	}
+
+	ts := getTestStructWithData()
+	ts.ID = 0
+	err = c.SaveToDB(ts)
+	if err != nil {
+		t.Fatalf("SaveToDB failed: %s", err.Op)
+	}
+	d := NewWebhookDispatcher(c)
+	cnt, err2 := d.DispatchOnce()
+	if err2 != nil || cnt != 1 {
+		t.Fatalf("DispatchOnce failed to send delivery, sent %d: %v", cnt, err2)
+	}
+	payload := &WebhookPayload{}
+	json.Unmarshal(body, payload)
+	if payload.Op != "create" || payload.ObjID != ts.ID || payload.Tbl != "gen64_test_structs" || payload.Timestamp == 0 || signature != GetWebhookSignature("s3cret", body) {
+		t.Fatalf("DispatchOnce sent invalid request: %s", string(body))
+	}
+
+	status = http.StatusInternalServerError
+	d.SetRetries(2, 0)
+	c.DeleteFromDB(ts)
+	cnt, _ = d.DispatchOnce()
+	if cnt != 0 {
+		t.Fatalf("DispatchOnce counted failed delivery")
 	}
+	cnt, _ = d.DispatchOnce()
+	var deliveryStatus string
+	var attempts int
+	dbConn.QueryRow("SELECT delivery_status, delivery_attempts FROM gen64_webhook_deliveries WHERE delivery_op = $1 AND delivery_obj_id = $2", OpDelete, ts.ID).Scan(&deliveryStatus, &attempts)
+	if cnt != 0 || deliveryStatus != WebhookFailed || attempts != 2 {
+		t.Fatalf("DispatchOnce failed to retry delivery: %s after %d attempts", deliveryStatus, attempts)
+	}
+
+	// Delivery claimed by a dispatcher that stopped is sent after the lease
+	status = http.StatusOK
+	ts.ID = 0
+	c.SaveToDB(ts)
+	dbConn.Exec("UPDATE gen64_webhook_deliveries SET delivery_status = $1, delivery_next_attempt_at = NOW() + INTERVAL '1 hour' WHERE delivery_obj_id = $2", WebhookSending, ts.ID)
+	cnt, _ = d.DispatchOnce()
+	if cnt != 0 {
+		t.Fatalf("DispatchOnce sent delivery claimed by another dispatcher")
+	}
+	dbConn.Exec("UPDATE gen64_webhook_deliveries SET delivery_next_attempt_at = NOW() - INTERVAL '1 second' WHERE delivery_obj_id = $1", ts.ID)
+	cnt, _ = d.DispatchOnce()
+	if cnt != 1 {
+		t.Fatalf("DispatchOnce failed to send delivery with expired lease")
+	}
+	c.DeleteFromDB(ts)
 }
 
-// TestHTTPHandlerPutMethodForUpdatingOnCustomEndpoint tests if HTTP endpoint
-// successfully updates object when PUT request with ID is being made, and
-// when the endpoint is a custom endpoint (it actually does not matter that much)
-func TestHTTPHandlerPutMethodForUpdatingOnCustomEndpoint(t *testing.T) {
-	j := `{
-		"test_struct_flags": 8,
-		"email": "test11@example.com",
-		"email2": "test22@example.com",
-		"first_name": "John2",
-		"last_name": "Smith2",
-		"age": 39,
-		"price": 444,
-		"post_code": "22-222",
-		"post_code2": "33-333",
-		"password": "password123updated",
-		"created_by_user_id": 12,
-		"key": "123456789012345678901234567890nbh"
-	}`
-	_ = makePUTUpdateRequest(j, 54, true, t)
+// TestAddWebhook tests if invalid webhooks are rejected
+func TestAddWebhook(t *testing.T) {
+	c := NewController(nil, "")
+	err := c.AddWebhook(&TestStruct{}, Webhook{URL: "ftp://example.com", Ops: OpCreate})
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("AddWebhook failed to reject invalid URL")
+	}
+	err = c.AddWebhook(&TestStruct{}, Webhook{URL: "https://example.com/hook", Ops: OpRead})
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("AddWebhook failed to reject invalid operations")
+	}
+	err = c.AddWebhook(&TestStruct{}, Webhook{URL: "https://example.com/hook", Ops: OpUpdate})
+	h, _ := c.getHelper(&TestStruct{})
+	if err != nil || !c.hasWebhooks(h, OpUpdate) || c.hasWebhooks(h, OpCreate) {
+		t.Fatalf("AddWebhook failed to add webhook")
+	}
+}
 
-	id, flags, _, _, _, _, _, price, _, _, _, _, _, err := getRow()
+// TestWithTx tests if objects are saved in a transaction that is committed or
+// rolled back
+func TestWithTx(t *testing.T) {
+	ts1 := getTestStructWithData()
+	ts1.ID = 0
+	ts2 := getTestStructWithData()
+	ts2.ID = 0
+	err := testController.WithTx(func(tc *Controller) *ErrController {
+		err := tc.SaveToDB(ts1)
+		if err != nil {
+			return err
+		}
+		return tc.SaveToDB(ts2)
+	})
 	if err != nil {
-		t.Fatalf("PUT method failed to update struct to the table: %s", err.Error())
+		t.Fatalf("WithTx failed: %s", err.Op)
 	}
-	// Only Price field should be updated. Check the TestStruct_Update struct
-	if id == 0 || flags != 0 || price != 444 {
-		t.Fatalf(strconv.Itoa(price))
-		t.Fatalf("PUT method on a custom endpoint failed to update struct in the table")
+	defer testController.DeleteFromDB(ts1)
+	defer testController.DeleteFromDB(ts2)
+	_, _, _, _, _, _, _, _, _, _, _, _, err2 := getRowById(ts2.ID)
+	if err2 != nil {
+		t.Fatalf("WithTx failed to commit transaction: %s", err2)
+	}
+
+	tc, err := testController.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %s", err.Op)
+	}
+	_, err = tc.Begin()
+	if err == nil || err.Op != "DBTx" {
+		t.Fatalf("Begin failed to reject nested transaction")
+	}
+	ts3 := getTestStructWithData()
+	ts3.ID = 0
+	err = tc.SaveToDB(ts3)
+	if err != nil {
+		t.Fatalf("SaveToDB failed in transaction: %s", err.Op)
+	}
+	err = tc.DeleteFromDB(ts1)
+	if err != nil {
+		t.Fatalf("DeleteFromDB failed in transaction: %s", err.Op)
+	}
+	err = tc.Rollback()
+	if err != nil {
+		t.Fatalf("Rollback failed: %s", err.Op)
+	}
+	_, _, _, _, _, _, _, _, _, _, _, _, err2 = getRowById(ts3.ID)
+	if err2 != sql.ErrNoRows {
+		t.Fatalf("Rollback failed to discard saved object")
+	}
+	_, _, _, _, _, _, _, _, _, _, _, _, err2 = getRowById(ts1.ID)
+	if err2 != nil {
+		t.Fatalf("Rollback failed to discard deletion")
+	}
+
+	err = testController.Commit()
+	if err == nil || err.Op != "DBTx" {
+		t.Fatalf("Commit failed to reject controller that is not in a transaction")
+	}
+
+	ts4 := getTestStructWithData()
+	ts4.ID = 0
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("WithTx failed to propagate panic")
+			}
+		}()
+		testController.WithTx(func(tc *Controller) *ErrController {
+			tc.SaveToDB(ts4)
+			panic("test")
+		})
+	}()
+	_, _, _, _, _, _, _, _, _, _, _, _, err2 = getRowById(ts4.ID)
+	if err2 != sql.ErrNoRows {
+		t.Fatalf("WithTx failed to roll back transaction on panic")
 	}
 }
 
-// TestHTTPHandlerGetMethodOnExisting checks if HTTP endpoint properly return
-// object details, when GET request with object ID is made
-func TestHTTPHandlerGetMethodOnExisting(t *testing.T) {
-	resp := makeGETReadRequest(54, t)
+// TestStats tests if Stats returns statistics of the table
+func TestStats(t *testing.T) {
+	stats, err := testController.Stats(&TestStruct{})
+	if err != nil {
+		t.Fatalf("Stats failed: %s", err.Op)
+	}
+	if len(stats) != 1 || stats[0].Tbl != "gen64_test_structs" || stats[0].Rows == 0 || stats[0].TotalSize == 0 {
+		t.Fatalf("Stats returned invalid statistics: %v", stats)
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("GET method returned wrong status code, want %d, got %d", http.StatusOK, resp.StatusCode)
+	pool := testController.GetPoolStats()
+	if pool == nil || pool.OpenConnections == 0 {
+		t.Fatalf("GetPoolStats returned invalid statistics: %v", pool)
 	}
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// TestSaveFieldsToDB tests if only specified fields are validated and saved
+func TestSaveFieldsToDB(t *testing.T) {
+	ts := getTestStructWithData()
+	ts.ID = 0
+	err := testController.SaveToDB(ts)
 	if err != nil {
-		t.Fatalf("GET method failed")
+		t.Fatalf("SaveToDB failed: %s", err.Op)
 	}
+	defer testController.DeleteFromDB(ts)
 
-	r := NewHTTPResponse(1, "")
-	err = json.Unmarshal(body, &r)
+	ts.Flags = 8
+	ts.Age = 99
+	ts.PrimaryEmail = "invalid"
+	err = testController.SaveFieldsToDB(ts, "Flags", "Age")
 	if err != nil {
-		t.Fatalf("GET method failed to return unmarshable JSON: " + err.Error())
+		t.Fatalf("SaveFieldsToDB failed: %s", err.Op)
 	}
-	if r.Data["item"].(map[string]interface{})["age"].(float64) != 0 {
-		t.Fatalf("GET method returned invalid values")
+	flags, primaryEmail, _, _, _, age, _, _, _, _, _, _, err2 := getRowById(ts.ID)
+	if err2 != nil {
+		t.Fatalf("Failed to get row: %s", err2.Error())
 	}
-	if r.Data["item"].(map[string]interface{})["price"].(float64) != 444 {
-		t.Fatalf("GET method returned invalid values")
+	if flags != 8 || age != 99 || primaryEmail == "invalid" {
+		t.Fatalf("SaveFieldsToDB failed to update only specified fields")
 	}
-	if strings.Contains(string(body), "email2") {
-		t.Fatalf("GET method returned output with field that should have been hidden")
+
+	ts.Age = 200
+	err = testController.SaveFieldsToDB(ts, "Age")
+	if err == nil || err.Op != "Validate" {
+		t.Fatalf("SaveFieldsToDB failed to validate field")
 	}
-	if strings.Contains(string(body), "post_code2") {
-		t.Fatalf("GET method returned output with field that should have been hidden")
+	err = testController.SaveFieldsToDB(ts, "NonExisting")
+	if err == nil || err.Op != "InvalidField" {
+		t.Fatalf("SaveFieldsToDB failed to return error for invalid field")
 	}
 }
 
-// TestHTTPHandlerDeleteMethod tests if HTTP endpoint removes object from the
-// database, when DELETE request is made
-func TestHTTPHandlerDeleteMethod(t *testing.T) {
-	makeDELETERequest(54, t)
+// TestSaveManyToDB tests if objects are inserted and updated in a batch and
+// get values returned by the database
+func TestSaveManyToDB(t *testing.T) {
+	ts1 := getTestStructWithData()
+	ts1.ID = 0
+	err := testController.SaveToDB(ts1)
+	if err != nil {
+		t.Fatalf("SaveToDB failed: %s", err.Op)
+	}
+	ts2 := getTestStructWithData()
+	ts2.ID = 0
+	ts3 := getTestStructWithData()
+	ts3.ID = 0
+	defer testController.DeleteFromDB(ts1)
+	defer testController.DeleteFromDB(ts2)
+	defer testController.DeleteFromDB(ts3)
 
-	cnt, err2 := getRowCntById(54)
-	if err2 != nil {
-		t.Fatalf("DELETE handler failed to delete struct from the table")
+	ts1.Age = 44
+	err = testController.SaveManyToDB(ts1, ts2, ts3)
+	if err != nil {
+		t.Fatalf("SaveManyToDB failed: %s", err.Op)
 	}
-	if cnt > 0 {
-		t.Fatalf("DELETE handler failed to delete struct from the table")
+	if ts2.ID == 0 || ts3.ID == 0 || ts2.ID == ts3.ID {
+		t.Fatalf("SaveManyToDB failed to set IDs of inserted objects: %d, %d", ts2.ID, ts3.ID)
+	}
+	_, _, _, _, _, age, _, _, _, _, _, _, err2 := getRowById(ts1.ID)
+	if err2 != nil || age != 44 {
+		t.Fatalf("SaveManyToDB failed to update object in the database")
+	}
+	cnt, _ := getRowCntById(ts3.ID)
+	if cnt != 1 {
+		t.Fatalf("SaveManyToDB failed to insert object to the database")
 	}
-}
 
-// TestHTTPHandlerGetMethodOnNonExisting checks HTTP endpoint response when
-// making GET request with non-existing object ID
-func TestHTTPHandlerGetMethodOnNonExisting(t *testing.T) {
-	resp := makeGETReadRequest(54, t)
+	type TestBatchPost struct {
+		ID    int64
+		Title string
+		Slug  string `crud:"slug:Title uniq"`
+	}
+	err = testController.CreateDBTables(&TestBatchPost{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestBatchPost{})
+	xobj := []interface{}{&TestBatchPost{Slug: "post"}, &TestBatchPost{Title: "Post"}, &TestBatchPost{Title: "Post"}}
+	err = testController.SaveManyToDB(xobj...)
+	if err != nil {
+		t.Fatalf("SaveManyToDB failed: %s", err.Op)
+	}
+	if xobj[1].(*TestBatchPost).Slug != "post-2" || xobj[2].(*TestBatchPost).Slug != "post-3" {
+		t.Fatalf("SaveManyToDB failed to set different slugs of objects")
+	}
 
-	if resp.StatusCode != http.StatusNotFound {
-		t.Fatalf("GET method returned wrong status code, want %d, got %d", http.StatusNotFound, resp.StatusCode)
+	// Objects that do not fit in one query are inserted in many
+	h, _ := testController.getHelper(&TestBatchPost{})
+	xobj = []interface{}{}
+	for i := 0; i < maxQueryArgs/len(h.fields)+1; i++ {
+		xobj = append(xobj, &TestBatchPost{Title: fmt.Sprintf("Batch %d", i)})
+	}
+	err = testController.SaveManyToDB(xobj...)
+	if err != nil {
+		t.Fatalf("SaveManyToDB failed: %s", err.Op)
+	}
+	for _, obj := range []interface{}{xobj[0], xobj[len(xobj)-1]} {
+		p := obj.(*TestBatchPost)
+		got := &TestBatchPost{}
+		testController.SetFromDB(got, fmt.Sprintf("%d", p.ID))
+		if got.ID == 0 || got.Title != p.Title || got.Slug != p.Slug {
+			t.Fatalf("SaveManyToDB set invalid values of object: %v, %v", p, got)
+		}
 	}
 }
 
-// TestHTTPHandlerGetMethodWithoutID tests if HTTP endpoint returns list of
-// objects when GET request without ID is done; request contains filters, order and result limit
-func TestHTTPHandlerGetMethodWithoutID(t *testing.T) {
-	ts := testStructNewFunc().(*TestStruct)
-	for i := 1; i <= 55; i++ {
-		testController.ResetFields(ts)
-		ts.ID = 0
-		testController.SetFromDB(ts, fmt.Sprintf("%d", i))
-		if ts.ID != 0 {
-			ts.Password = "abcdefghijklopqrwwe"
-			testController.SaveToDB(ts)
+// TestSaveToDBSlugs tests if generated slug that is already taken gets a number
+// suffix when unique constraint of the column rejects it
+func TestSaveToDBSlugs(t *testing.T) {
+	type TestSlugPost struct {
+		ID    int64
+		Title string
+		Slug  string `crud:"slug:Title"`
+	}
+	err := testController.CreateDBTables(&TestSlugPost{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestSlugPost{})
+
+	for _, p := range []*TestSlugPost{{Slug: "post"}, {Slug: "post-2"}} {
+		err = testController.SaveToDB(p)
+		if err != nil {
+			t.Fatalf("SaveToDB failed: %s", err.Op)
 		}
 	}
-	b := makeGETListRequest(map[string]string{
-		"limit":                "10",
-		"offset":               "20",
-		"order":                "age",
-		"order_direction":      "asc",
-		"filter_price":         "444",
-		"filter_primary_email": "primary@gen64.net",
-	}, t)
+	p := &TestSlugPost{Title: "Post"}
+	err = testController.SaveToDB(p)
+	if err != nil || p.Slug != "post-3" {
+		t.Fatalf("SaveToDB failed to add number to taken slug: %v", p)
+	}
 
-	r := NewHTTPResponse(1, "")
-	err := json.Unmarshal(b, &r)
+	xobj := []interface{}{&TestSlugPost{Title: "Post"}, &TestSlugPost{Title: "2024"}}
+	err2 := testController.SaveManyToDB(xobj...)
+	if err2 != nil || xobj[0].(*TestSlugPost).Slug != "post-4" || xobj[1].(*TestSlugPost).Slug != "2024-2" {
+		t.Fatalf("SaveManyToDB failed to add number to taken or numeric slug: %v, %v", xobj[0], xobj[1])
+	}
+
+	tx, _ := testController.Begin()
+	defer tx.Rollback()
+	err = tx.SaveToDB(&TestSlugPost{Title: "Post"})
+	if err == nil || err.Op != "DBQuery" {
+		t.Fatalf("SaveToDB in transaction did not fail on taken slug")
+	}
+}
+
+// TestListJoined tests if objects are returned with their related objects
+func TestListJoined(t *testing.T) {
+	ts1 := getTestStructWithData()
+	ts1.ID = 0
+	err := testController.SaveToDB(ts1)
 	if err != nil {
-		t.Fatalf("GET method returned wrong json output, error marshaling: %s", err.Error())
+		t.Fatalf("SaveToDB failed: %s", err.Op)
+	}
+	defer testController.DeleteFromDB(ts1)
+	ts2 := getTestStructWithData()
+	ts2.ID = 0
+	ts2.CreatedByUserID = ts1.ID
+	err = testController.SaveToDB(ts2)
+	if err != nil {
+		t.Fatalf("SaveToDB failed: %s", err.Op)
 	}
+	defer testController.DeleteFromDB(ts2)
 
-	if len(r.Data["items"].([]interface{})) != 10 {
-		t.Fatalf("GET method returned invalid number of rows, want %d got %d", 10, len(r.Data["items"].([]interface{})))
+	testController.AddRelation(&TestStruct{}, "created_by", "CreatedByUserID", testStructNewFunc)
+	xj, err := testController.ListJoined(testStructNewFunc, "created_by", nil, 10, 0, map[string]interface{}{"ID": ts2.ID}, map[string]interface{}{"ID": ts1.ID})
+	if err != nil {
+		t.Fatalf("ListJoined failed: %s", err.Op)
+	}
+	if len(xj) != 1 || xj[0].Obj.(*TestStruct).ID != ts2.ID || xj[0].Related.(*TestStruct).ID != ts1.ID {
+		t.Fatalf("ListJoined returned invalid objects")
 	}
+	if xj[0].Related.(*TestStruct).FirstName != ts1.FirstName {
+		t.Fatalf("ListJoined failed to set fields of related object")
+	}
+}
 
-	if r.Data["items"].([]interface{})[2].(map[string]interface{})["age"].(float64) != 52 {
-		t.Fatalf("GET method returned invalid row, want %d got %f", 52, r.Data["items"].([]interface{})[2].(map[string]interface{})["age"].(float64))
+// TestRefreshSummary tests if summary model table is filled with numbers of
+// objects of its source model
+func TestRefreshSummary(t *testing.T) {
+	type TestAgeSummary struct {
+		ID    int64
+		Age   int
+		Count int64
 	}
+	summary := &TestAgeSummary{}
+	err := testController.CreateDBTables(summary)
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(summary)
 
-	if strings.Contains(string(b), "email2") {
-		t.Fatalf("GET method returned output with field that should have been hidden")
+	for i := 0; i < 2; i++ {
+		ts := getTestStructWithData()
+		ts.ID = 0
+		ts.Age = 77
+		err = testController.SaveToDB(ts)
+		if err != nil {
+			t.Fatalf("SaveToDB failed: %s", err.Op)
+		}
+		defer testController.DeleteFromDB(ts)
 	}
-	if strings.Contains(string(b), "post_code2") {
+
+	err = testController.AddSummary(summary, Summary{
+		Source:     testStructNewFunc,
+		GroupBy:    []string{"Age"},
+		CountField: "Count",
+		Filters:    map[string]interface{}{"Age": 77},
+	})
+	if err != nil {
+		t.Fatalf("AddSummary failed: %s", err.Op)
+	}
+	cnt, err := testController.RefreshSummary(summary)
+	if err != nil || cnt != 1 {
+		t.Fatalf("RefreshSummary failed to insert summary objects")
+	}
+	xs, err := testController.GetFromDB(func() interface{} { return &TestAgeSummary{} }, nil, 10, 0, nil)
+	if err != nil || len(xs) != 1 || xs[0].(*TestAgeSummary).Age != 77 || xs[0].(*TestAgeSummary).Count != 2 {
+		t.Fatalf("RefreshSummary failed to set numbers of objects")
+	}
+}
+
+// TestDumpModel tests if objects are dumped and loaded with their IDs
+func TestTimeFieldsInDB(t *testing.T) {
+	type TestEvent struct {
+		ID      int64
+		Name    string
+		StartAt time.Time
+	}
+	newFunc := func() interface{} { return &TestEvent{} }
+	err := testController.CreateDBTables(&TestEvent{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestEvent{})
+
+	startAt := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	for i, n := range []string{"first", "second"} {
+		err = testController.SaveToDB(&TestEvent{Name: n, StartAt: startAt.Add(time.Duration(i) * time.Hour)})
+		if err != nil {
+			t.Fatalf("SaveToDB failed: %s", err.Op)
+		}
+	}
+	o := &TestEvent{}
+	err = testController.SetFromDB(o, "2")
+	if err != nil || !o.StartAt.Equal(startAt.Add(time.Hour)) {
+		t.Fatalf("SetFromDB failed to get time field: %v", o.StartAt)
+	}
+
+	xobj, err := testController.GetFromDB(newFunc, nil, 10, 0, map[string]interface{}{"StartAt": startAt})
+	if err != nil || len(xobj) != 1 || xobj[0].(*TestEvent).Name != "first" {
+		t.Fatalf("GetFromDB failed to filter by time field")
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	type TestNote struct {
+		ID        int64
+		Text      string
+		DeletedAt int64 `crud:"softdel"`
+	}
+	newFunc := func() interface{} { return &TestNote{} }
+	err := testController.CreateDBTables(&TestNote{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestNote{})
+
+	for _, n := range []string{"first", "second"} {
+		err = testController.SaveToDB(&TestNote{Text: n})
+		if err != nil {
+			t.Fatalf("SaveToDB failed: %s", err.Op)
+		}
+	}
+	err = testController.DeleteFromDB(&TestNote{ID: 1})
+	if err != nil {
+		t.Fatalf("DeleteFromDB failed: %s", err.Op)
+	}
+	o := &TestNote{}
+	err = testController.SetFromDB(o, "1")
+	if err != nil || o.ID != 0 {
+		t.Fatalf("SetFromDB returned soft-deleted object")
+	}
+	xobj, err := testController.GetFromDB(newFunc, nil, 10, 0, nil)
+	if err != nil || len(xobj) != 1 || xobj[0].(*TestNote).Text != "second" {
+		t.Fatalf("GetFromDB returned soft-deleted objects")
+	}
+
+	wc := testController.WithDeleted()
+	xobj, err = wc.GetFromDB(newFunc, nil, 10, 0, nil)
+	if err != nil || len(xobj) != 2 {
+		t.Fatalf("GetFromDB of controller with deleted objects failed to return them")
+	}
+	err = wc.SetFromDB(o, "1")
+	if err != nil || o.ID != 1 || o.DeletedAt == 0 {
+		t.Fatalf("SetFromDB of controller with deleted objects failed to return soft-deleted object")
+	}
+	o.DeletedAt = 0
+	err = testController.SaveToDB(o)
+	if err != nil {
+		t.Fatalf("SaveToDB failed to restore object: %s", err.Op)
+	}
+	err = testController.SetFromDB(o, "1")
+	if err != nil || o.ID != 1 {
+		t.Fatalf("SetFromDB failed to return restored object")
+	}
+
+	testController.DeleteFromDB(&TestNote{ID: 2})
+	cnt, err := testController.PurgeDeletedFromDB(&TestNote{}, time.Hour)
+	if err != nil || cnt != 0 {
+		t.Fatalf("PurgeDeletedFromDB removed objects deleted recently")
+	}
+	cnt, err = testController.PurgeDeletedFromDB(&TestNote{}, -time.Minute)
+	if err != nil || cnt != 1 {
+		t.Fatalf("PurgeDeletedFromDB failed to remove soft-deleted objects")
+	}
+}
+
+func TestForEachInDB(t *testing.T) {
+	type TestJob struct {
+		ID     int64
+		Status string
+	}
+	newFunc := func() interface{} { return &TestJob{} }
+	err := testController.CreateDBTables(&TestJob{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestJob{})
+
+	for i := 0; i < 7; i++ {
+		status := "new"
+		if i%3 == 0 {
+			status = "done"
+		}
+		testController.SaveToDB(&TestJob{Status: status})
+	}
+	ids := []int64{}
+	err = testController.ForEachInDB(newFunc, map[string]interface{}{"Status": "new"}, 2, func(obj interface{}) error {
+		ids = append(ids, obj.(*TestJob).ID)
+		return nil
+	})
+	if err != nil || fmt.Sprint(ids) != "[2 3 5 6]" {
+		t.Fatalf("ForEachInDB failed to go through objects: %v", ids)
+	}
+
+	err = testController.ForEachInDB(newFunc, nil, 0, func(obj interface{}) error {
+		return fmt.Errorf("stop")
+	})
+	if err == nil || err.Op != "ForEach" {
+		t.Fatalf("ForEachInDB failed to return error from fn")
+	}
+}
+
+func TestMigrateDBTable(t *testing.T) {
+	{
+		type TestMigration struct {
+			ID    int64
+			Title string
+			Price string
+		}
+		err := testController.CreateDBTable(&TestMigration{})
+		if err != nil {
+			t.Fatalf("CreateDBTable failed: %s", err.Op)
+		}
+		defer testController.DropDBTable(&TestMigration{})
+		err = testController.SaveToDB(&TestMigration{Title: "Book", Price: "12"})
+		if err != nil {
+			t.Fatalf("SaveToDB failed: %s", err.Op)
+		}
+	}
+
+	// Struct has the same name so controller without cached Helper is used
+	type TestMigration struct {
+		ID    int64
+		Name  string `crud:"was:title"`
+		Price int64
+		Stock int64
+	}
+	c := NewController(dbConn, "gen64_")
+	err := c.MigrateDBTable(&TestMigration{})
+	if err != nil {
+		t.Fatalf("MigrateDBTable failed: %s", err.Error())
+	}
+	o := &TestMigration{}
+	err = c.SetFromDB(o, "1")
+	if err != nil || o.Name != "Book" || o.Price != 12 || o.Stock != 0 {
+		t.Fatalf("MigrateDBTable failed to keep data: %v", o)
+	}
+	qs, err := c.GetMigrationDDL(&TestMigration{})
+	if err != nil || len(qs) != 0 {
+		t.Fatalf("GetMigrationDDL returned queries for migrated table: %v", qs)
+	}
+}
+
+func TestGetMapsFromDB(t *testing.T) {
+	type TestReportRow struct {
+		ID       int64  `json:"row_id"`
+		Region   string `json:"region"`
+		Amount   int64  `json:"amount"`
+		Internal string `json:"-"`
+	}
+	newFunc := func() interface{} { return &TestReportRow{} }
+	err := testController.CreateDBTables(&TestReportRow{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestReportRow{})
+
+	for i, region := range []string{"eu", "us", "eu"} {
+		testController.SaveToDB(&TestReportRow{Region: region, Amount: int64(i + 1), Internal: "x"})
+	}
+	maps, err := testController.GetMapsFromDB(newFunc, ListParams{
+		Order:   []string{"Amount", "desc"},
+		Filters: map[string]interface{}{"Region": "eu"},
+	})
+	if err != nil {
+		t.Fatalf("GetMapsFromDB failed: %s", err.Op)
+	}
+	b, _ := json.Marshal(maps)
+	if string(b) != `[{"amount":3,"region":"eu","row_id":3},{"amount":1,"region":"eu","row_id":1}]` {
+		t.Fatalf("GetMapsFromDB returned invalid maps: %s", string(b))
+	}
+}
+
+func TestDumpModel(t *testing.T) {
+	type TestBackup struct {
+		ID     int64
+		Name   string
+		Secret string `json:"-"`
+	}
+	newFunc := func() interface{} { return &TestBackup{} }
+	err := testController.CreateDBTables(&TestBackup{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestBackup{})
+
+	for _, n := range []string{"first", "second"} {
+		err = testController.SaveToDB(&TestBackup{Name: n, Secret: "s-" + n})
+		if err != nil {
+			t.Fatalf("SaveToDB failed: %s", err.Op)
+		}
+	}
+	b := &bytes.Buffer{}
+	cnt, err := testController.DumpModel(newFunc, b)
+	if err != nil || cnt != 2 {
+		t.Fatalf("DumpModel failed to dump objects")
+	}
+	if !strings.HasPrefix(b.String(), `{"format":"go-crud-dump","version":1,"table":"test_backups","columns":["test_backup_id","name","secret"],"types":["SERIAL","VARCHAR(255)","VARCHAR(255)"]}`) {
+		t.Fatalf("DumpModel wrote invalid header: %s", b.String())
+	}
+	dump := b.String()
+
+	testController.DropDBTables(&TestBackup{})
+	testController.CreateDBTables(&TestBackup{})
+	cnt, err = testController.LoadModel(newFunc, b)
+	if err != nil || cnt != 2 {
+		t.Fatalf("LoadModel failed to load objects")
+	}
+	o := &TestBackup{ID: 2}
+	err = testController.SetFromDB(o, "2")
+	if err != nil || o.Name != "second" || o.Secret != "s-second" {
+		t.Fatalf("LoadModel failed to load object with its ID")
+	}
+	o = &TestBackup{Name: "third"}
+	err = testController.SaveToDB(o)
+	if err != nil || o.ID != 3 {
+		t.Fatalf("LoadModel failed to reset ID sequence")
+	}
+
+	_, err = testController.LoadModel(testStructNewFunc, strings.NewReader(`{"format":"go-crud-dump","version":1,"table":"test_backups","columns":["id"]}`))
+	if err == nil || err.Op != "InvalidDump" {
+		t.Fatalf("LoadModel failed to reject dump of another table")
+	}
+	_, err = testController.LoadModel(newFunc, strings.NewReader(strings.Replace(dump, `"VARCHAR(255)","VARCHAR(255)"`, `"VARCHAR(255)","BIGINT"`, 1)))
+	if err == nil || err.Op != "InvalidDump" {
+		t.Fatalf("LoadModel failed to reject dump with different column types")
+	}
+}
+
+// TestEraseSubject tests if subject's objects are exported, deleted and
+// redacted
+func TestEraseSubject(t *testing.T) {
+	type TestSubjectUser struct {
+		ID    int64
+		Email string `crud:"sensitive"`
+	}
+	type TestSubjectOrder struct {
+		ID        int64
+		Name      string `crud:"sensitive:name"`
+		CreatedBy int64  `crud:"createdby"`
+	}
+	newUser := func() interface{} { return &TestSubjectUser{} }
+	newOrder := func() interface{} { return &TestSubjectOrder{} }
+	err := testController.CreateDBTables(&TestSubjectUser{}, &TestSubjectOrder{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestSubjectUser{}, &TestSubjectOrder{})
+
+	u := &TestSubjectUser{Email: "john@example.com"}
+	testController.SaveToDB(u)
+	o1 := &TestSubjectOrder{Name: "John Doe", CreatedBy: u.ID}
+	testController.SaveToDB(o1)
+	o2 := &TestSubjectOrder{Name: "Jane Doe", CreatedBy: u.ID + 1}
+	testController.SaveToDB(o2)
+
+	c := NewController(testController.dbConn, "")
+	err = c.AddSubjectModel(SubjectModel{NewObjFunc: newUser, Field: "ID"})
+	if err != nil {
+		t.Fatalf("AddSubjectModel failed: %s", err.Op)
+	}
+	err = c.AddSubjectModel(SubjectModel{NewObjFunc: newOrder, Redact: true})
+	if err != nil {
+		t.Fatalf("AddSubjectModel failed to use createdby field: %s", err.Op)
+	}
+
+	report, err := c.ExportSubject(u.ID)
+	if err != nil || len(report.Data["test_subject_users"]) != 1 || len(report.Data["test_subject_orders"]) != 1 || report.Data["test_subject_orders"][0].(*TestSubjectOrder).Name != "John Doe" {
+		t.Fatalf("ExportSubject failed to export subject's objects")
+	}
+
+	report, err = c.EraseSubject(u.ID)
+	if err != nil || len(report.Tables) != 2 || report.Tables[0].Redacted != 1 || report.Tables[1].Deleted != 1 {
+		t.Fatalf("EraseSubject returned invalid report: %v", report)
+	}
+	deleted := &TestSubjectUser{}
+	err = c.SetFromDB(deleted, strconv.FormatInt(u.ID, 10))
+	if err != nil || deleted.ID != 0 {
+		t.Fatalf("EraseSubject failed to delete subject")
+	}
+	o := &TestSubjectOrder{}
+	c.SetFromDB(o, strconv.FormatInt(o1.ID, 10))
+	if o.Name == "John Doe" || o.CreatedBy != 0 {
+		t.Fatalf("EraseSubject failed to redact object")
+	}
+	o = &TestSubjectOrder{}
+	c.SetFromDB(o, strconv.FormatInt(o2.ID, 10))
+	if o.Name != "Jane Doe" {
+		t.Fatalf("EraseSubject modified object of another subject")
+	}
+
+	// Objects linking to deleted ones are deleted first, with their versions
+	type TestSubjectAddress struct {
+		ID     int64
+		UserID int64 `crud:"fk:TestSubjectUser"`
+		City   string
+	}
+	type TestSubjectParcel struct {
+		ID        int64
+		AddressID int64 `crud:"fk:TestSubjectAddress"`
+	}
+	err = c.CreateDBTables(&TestSubjectAddress{}, &TestSubjectParcel{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer c.DropDBTables(&TestSubjectParcel{}, &TestSubjectAddress{})
+	err = c.CreateVersionsTable()
+	if err != nil {
+		t.Fatalf("CreateVersionsTable failed: %s", err.Op)
+	}
+	defer dbConn.Exec("DROP TABLE versions")
+	c.EnableVersions(&TestSubjectAddress{})
+
+	u = &TestSubjectUser{Email: "ann@example.com"}
+	c.SaveToDB(u)
+	a := &TestSubjectAddress{UserID: u.ID, City: "Paris"}
+	c.SaveToDB(a)
+	a.City = "Rome"
+	c.SaveToDB(a)
+	c.SaveToDB(&TestSubjectParcel{AddressID: a.ID})
+	report, err = c.EraseSubject(u.ID)
+	if err != nil {
+		t.Fatalf("EraseSubject failed: %s", err.Op)
+	}
+	got := []string{}
+	for _, tr := range report.Tables {
+		got = append(got, fmt.Sprintf("%s:%d", tr.Tbl, tr.Deleted))
+	}
+	want := "test_subject_parcels:1 test_subject_addresses:1 test_subject_orders:0 test_subject_users:1 versions:1"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("EraseSubject returned invalid report, want %s, got %s", want, strings.Join(got, " "))
+	}
+}
+
+// TestSessionSettings tests if queries are run with session settings
+func TestSessionSettings(t *testing.T) {
+	c := testController.WithSessionSettings(map[string]string{"statement_timeout": "5s", "app.tenant_id": "5"})
+	if testController.sessionSettings != nil {
+		t.Fatalf("WithSessionSettings modified the original controller")
+	}
+	_, err := c.GetFromDB(testStructNewFunc, nil, 1, 0, nil)
+	if err != nil {
+		t.Fatalf("GetFromDB with session settings failed: %s", err.Op)
+	}
+	_, err = testController.WithSessionSettings(map[string]string{"no_such_setting": "1"}).GetFromDB(testStructNewFunc, nil, 1, 0, nil)
+	if err == nil {
+		t.Fatalf("GetFromDB should fail with invalid session setting")
+	}
+
+	r := WithSessionSettings(httptest.NewRequest("GET", "/", nil), map[string]string{"role": "app"})
+	if GetSessionSettings(r)["role"] != "app" {
+		t.Fatalf("GetSessionSettings returned wrong settings")
+	}
+}
+
+// TestUpdateWhere tests if object is updated only when guard conditions are
+// met
+func TestUpdateWhere(t *testing.T) {
+	ts := getTestStructWithData()
+	ts.ID = 0
+	ts.Age = 30
+	err := testController.SaveToDB(ts)
+	if err != nil {
+		t.Fatalf("SaveToDB failed: %s", err.Op)
+	}
+	defer testController.DeleteFromDB(ts)
+
+	ts.Age = 31
+	cnt, err := testController.UpdateWhere(ts, map[string]interface{}{"Age": 29})
+	if err != nil || cnt != 0 {
+		t.Fatalf("UpdateWhere updated object when guard was not met: %d", cnt)
+	}
+	cnt, err = testController.UpdateWhere(ts, map[string]interface{}{"Age": 30})
+	if err != nil || cnt != 1 {
+		t.Fatalf("UpdateWhere failed to update object when guard was met: %d", cnt)
+	}
+	_, _, _, _, _, age, _, _, _, _, _, _, err2 := getRowById(ts.ID)
+	if err2 != nil || age != 31 {
+		t.Fatalf("UpdateWhere failed to update object in the database")
+	}
+}
+
+func TestUpdateFromDBAndDeleteManyFromDB(t *testing.T) {
+	type TestTask struct {
+		ID        int64
+		Queue     string
+		Status    string `crud:"lenmax:10"`
+		UpdatedAt int64  `crud:"updatedat"`
+	}
+	newFunc := func() interface{} { return &TestTask{} }
+	err := testController.CreateDBTables(&TestTask{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestTask{})
+
+	for _, q := range []string{"mail", "mail", "sms"} {
+		testController.SaveToDB(&TestTask{Queue: q, Status: "new"})
+	}
+	cnt, err := testController.UpdateFromDB(newFunc, map[string]interface{}{"Queue": "mail"}, map[string]interface{}{"Status": "done"})
+	if err != nil || cnt != 2 {
+		t.Fatalf("UpdateFromDB failed to update objects matching filters: %d", cnt)
+	}
+	_, err = testController.UpdateFromDB(newFunc, map[string]interface{}{"Queue": "sms"}, map[string]interface{}{"Status": "cancelled by user"})
+	if err == nil || err.Op != "Validate" {
+		t.Fatalf("UpdateFromDB failed to return error for invalid value")
+	}
+	xobj, _ := testController.GetFromDB(newFunc, []string{"ID", "asc"}, 10, 0, map[string]interface{}{"Status": "done"})
+	if len(xobj) != 2 || xobj[0].(*TestTask).Queue != "mail" || xobj[0].(*TestTask).UpdatedAt == 0 {
+		t.Fatalf("UpdateFromDB failed to set values in the database")
+	}
+
+	cnt, err = testController.DeleteManyFromDB(newFunc, map[string]interface{}{"Status": "done"})
+	if err != nil || cnt != 2 {
+		t.Fatalf("DeleteManyFromDB failed to remove objects matching filters: %d", cnt)
+	}
+	cnt, _ = testController.GetCountFromDB(newFunc, nil)
+	if cnt != 1 {
+		t.Fatalf("DeleteManyFromDB removed objects not matching filters")
+	}
+}
+
+// TestBulkOperationsRecordChanges tests if changes made by UpdateFromDB and
+// DeleteManyFromDB are recorded in versions and outbox
+func TestBulkOperationsRecordChanges(t *testing.T) {
+	type TestTask struct {
+		ID     int64
+		Queue  string
+		Status string
+	}
+	newFunc := func() interface{} { return &TestTask{} }
+	c := NewController(dbConn, "gen64_bulk_")
+	c.SetOutbox(true)
+	c.EnableVersions(&TestTask{})
+	for _, fn := range []func() *ErrController{c.CreateOutboxTable, c.CreateVersionsTable} {
+		err := fn()
+		if err != nil {
+			t.Fatalf("Creating table failed: %s", err.Op)
+		}
+	}
+	defer dbConn.Exec("DROP TABLE gen64_bulk_crud_outbox")
+	defer dbConn.Exec("DROP TABLE gen64_bulk_versions")
+	err := c.CreateDBTables(&TestTask{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer c.DropDBTables(&TestTask{})
+
+	tasks := []*TestTask{{Queue: "mail", Status: "new"}, {Queue: "mail", Status: "new"}, {Queue: "sms", Status: "new"}}
+	for _, task := range tasks {
+		c.SaveToDB(task)
+	}
+	cnt, err := c.UpdateFromDB(newFunc, map[string]interface{}{"Queue": "mail"}, map[string]interface{}{"Status": "done"})
+	if err != nil || cnt != 2 {
+		t.Fatalf("UpdateFromDB failed to update objects matching filters: %d", cnt)
+	}
+	versions, _ := c.GetVersionsFromDB(tasks[0], 10, 0)
+	if len(versions) != 1 || versions[0].Obj.(*TestTask).Status != "new" {
+		t.Fatalf("UpdateFromDB failed to record versions")
+	}
+	versions, _ = c.GetVersionsFromDB(tasks[2], 10, 0)
+	if len(versions) != 0 {
+		t.Fatalf("UpdateFromDB recorded version of object not matching filters")
+	}
+
+	cnt, err = c.DeleteManyFromDB(newFunc, map[string]interface{}{"Status": "done"})
+	if err != nil || cnt != 2 {
+		t.Fatalf("DeleteManyFromDB failed to remove objects matching filters: %d", cnt)
+	}
+	var events int
+	dbConn.QueryRow("SELECT COUNT(*) FROM gen64_bulk_crud_outbox WHERE event_obj_id = $1", tasks[1].ID).Scan(&events)
+	if events != 3 {
+		t.Fatalf("UpdateFromDB and DeleteManyFromDB failed to record events, got %d", events)
+	}
+}
+
+// TestBulkOperationsInvalidArgs tests if UpdateFromDB and DeleteManyFromDB
+// reject arguments before running queries
+func TestBulkOperationsInvalidArgs(t *testing.T) {
+	c := NewController(nil, "")
+	newFunc := func() interface{} { return &TestStruct{} }
+
+	_, err := c.DeleteManyFromDB(newFunc, nil)
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("DeleteManyFromDB failed to return error when there are no filters")
+	}
+	_, err = c.UpdateFromDB(newFunc, map[string]interface{}{"Age": 30}, nil)
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("UpdateFromDB failed to return error when there are no values")
+	}
+	_, err = c.UpdateFromDB(newFunc, map[string]interface{}{"Age": 30}, map[string]interface{}{"ID": int64(1)})
+	if err == nil || err.Op != "InvalidField" {
+		t.Fatalf("UpdateFromDB failed to return error for ID field")
+	}
+	_, err = c.UpdateFromDB(newFunc, map[string]interface{}{"Age": 30}, map[string]interface{}{"Age": "31"})
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("UpdateFromDB failed to return error for value of invalid type")
+	}
+	_, err = c.UpdateFromDB(newFunc, map[string]interface{}{"Age": 30}, map[string]interface{}{"Age": 150})
+	if err == nil || err.Op != "Validate" {
+		t.Fatalf("UpdateFromDB failed to return error for invalid value")
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	type TestAuthor struct {
+		ID   int64
+		Name string
+	}
+	type TestBook struct {
+		ID       int64
+		AuthorID int64 `crud:"fk:TestAuthor ondelete:cascade"`
+		Title    string
+	}
+	err := testController.CreateDBTables(&TestAuthor{}, &TestBook{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestBook{}, &TestAuthor{})
+
+	a := &TestAuthor{Name: "Stanisław Lem"}
+	testController.SaveToDB(a)
+	for _, authorID := range []int64{0, a.ID + 1} {
+		err = testController.SaveToDB(&TestBook{AuthorID: authorID, Title: "Solaris"})
+		if err == nil || err.Op != "Validate" {
+			t.Fatalf("SaveToDB failed to return error for book linked to author that does not exist")
+		}
+		var errValidation *ErrValidation
+		if !errors.As(err, &errValidation) || len(errValidation.Fields) != 1 || errValidation.Fields[0] != "AuthorID" {
+			t.Fatalf("SaveToDB returned error with invalid fields")
+		}
+	}
+	b := &TestBook{AuthorID: a.ID, Title: "Solaris"}
+	err = testController.SaveToDB(b)
+	if err != nil {
+		t.Fatalf("SaveToDB failed: %s", err.Op)
+	}
+
+	err = testController.DeleteFromDB(a)
+	if err != nil {
+		t.Fatalf("DeleteFromDB failed: %s", err.Op)
+	}
+	cnt, _ := testController.GetCountFromDB(func() interface{} { return &TestBook{} }, nil)
+	if cnt != 0 {
+		t.Fatalf("Deleting author failed to delete its books")
+	}
+}
+
+// TestLoadRelations tests if fields with "rel" tag are set with related
+// objects in code and with "join" query parameter in HTTP handler
+func TestLoadRelations(t *testing.T) {
+	type TestWriter struct {
+		ID   int64  `json:"test_writer_id"`
+		Name string `json:"name"`
+	}
+	type TestNovel struct {
+		ID       int64         `json:"test_novel_id"`
+		WriterID int64         `json:"writer_id"`
+		EditorID sql.NullInt64 `json:"editor_id"`
+		Title    string        `json:"title"`
+		Writer   *TestWriter   `json:"writer" crud:"rel:WriterID"`
+		Editor   *TestWriter   `json:"editor" crud:"rel:EditorID"`
+	}
+	novelNewFunc := func() interface{} { return &TestNovel{} }
+	err := testController.CreateDBTables(&TestWriter{}, &TestNovel{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer testController.DropDBTables(&TestNovel{}, &TestWriter{})
+
+	w1 := &TestWriter{Name: "Stanisław Lem"}
+	w2 := &TestWriter{Name: "Ursula K. Le Guin"}
+	testController.SaveToDB(w1)
+	testController.SaveToDB(w2)
+	n1 := &TestNovel{WriterID: w1.ID, EditorID: sql.NullInt64{Int64: w2.ID, Valid: true}, Title: "Solaris"}
+	n2 := &TestNovel{WriterID: w2.ID, Title: "The Dispossessed"}
+	testController.SaveToDB(n1)
+	testController.SaveToDB(n2)
+
+	n := &TestNovel{}
+	err = testController.SetFromDBWithRelations(n, fmt.Sprintf("%d", n1.ID))
+	if err != nil {
+		t.Fatalf("SetFromDBWithRelations failed: %s", err.Op)
+	}
+	if n.Writer == nil || n.Writer.Name != w1.Name || n.Editor == nil || n.Editor.ID != w2.ID {
+		t.Fatalf("SetFromDBWithRelations failed to set related objects: %v %v", n.Writer, n.Editor)
+	}
+
+	xobj, err := testController.GetFromDBWithRelations(novelNewFunc, []string{"ID", "asc"}, 10, 0, nil)
+	if err != nil {
+		t.Fatalf("GetFromDBWithRelations failed: %s", err.Op)
+	}
+	if len(xobj) != 2 || xobj[1].(*TestNovel).Writer == nil || xobj[1].(*TestNovel).Writer.ID != w2.ID || xobj[1].(*TestNovel).Editor != nil {
+		t.Fatalf("GetFromDBWithRelations failed to set related objects")
+	}
+
+	hdl := testController.GetHTTPHandler("/novels/", novelNewFunc, nil, novelNewFunc, nil, nil, novelNewFunc)
+	for _, q := range []string{fmt.Sprintf("/novels/%d?join=writer", n1.ID), "/novels/?join=writer&order=test_novel_id&order_direction=asc"} {
+		w := httptest.NewRecorder()
+		hdl.ServeHTTP(w, httptest.NewRequest("GET", q, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"writer":{"test_writer_id":`) || !strings.Contains(w.Body.String(), `"editor":null`) {
+			t.Fatalf("GET method returned invalid response for %s: %d %s", q, w.Code, w.Body.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", "/novels/?join=title", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_join") {
+		t.Fatalf("GET method returned invalid response for invalid join: %d %s", w.Code, w.Body.String())
+	}
+}
+
+// TestDivergences tests if rows that are missing, extra or different in the
+// secondary database are found
+func TestDivergences(t *testing.T) {
+	type Note struct {
+		ID    int64
+		Title string
+	}
+	c := NewController(nil, "")
+	h, _ := c.getHelper(&Note{})
+	objs := []interface{}{&Note{ID: 1, Title: "a"}, &Note{ID: 2, Title: "b"}, &Note{ID: 4, Title: "d"}}
+	secObjs := []interface{}{&Note{ID: 1, Title: "a"}, &Note{ID: 3, Title: "c"}, &Note{ID: 4, Title: "x"}, &Note{ID: 5, Title: "e"}}
+	divs := c.getDivergences(h, objs, secObjs)
+	want := []Divergence{{Tbl: "notes", ID: 2, Reason: DivergenceMissing}, {Tbl: "notes", ID: 3, Reason: DivergenceExtra}, {Tbl: "notes", ID: 4, Reason: DivergenceDifferent}, {Tbl: "notes", ID: 5, Reason: DivergenceExtra}}
+	if len(divs) != len(want) {
+		t.Fatalf("getDivergences returned invalid number of divergences, want %d, got %d", len(want), len(divs))
+	}
+	for i, d := range divs {
+		if *d != want[i] {
+			t.Fatalf("getDivergences returned invalid divergence, want %v, got %v", want[i], *d)
+		}
+	}
+
+	_, err := c.VerifySecondaryDB(func() interface{} { return &Note{} }, 10)
+	if err == nil || err.Op != "SecondaryDB" {
+		t.Fatalf("VerifySecondaryDB failed to return error when secondary database is not set")
+	}
+}
+
+// TestSecondaryDB tests if writes are mirrored to the secondary database,
+// within transactions as well, and VerifySecondaryDB finds differences
+func TestSecondaryDB(t *testing.T) {
+	type TestMirrored struct {
+		ID    int64
+		Title string
+	}
+	newObjFunc := func() interface{} { return &TestMirrored{} }
+	_, err := dbConn.Exec("CREATE DATABASE gen64_secondary")
+	if err != nil {
+		t.Fatalf("Failed to create database: %s", err.Error())
+	}
+	secConn, err := sql.Open("postgres", fmt.Sprintf("host=localhost user=%s password=%s port=%s dbname=gen64_secondary sslmode=disable", dbUser, dbPass, dockerResource.GetPort("5432/tcp")))
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %s", err.Error())
+	}
+	defer dbConn.Exec("DROP DATABASE gen64_secondary")
+	defer secConn.Close()
+
+	divs := []*Divergence{}
+	c := NewController(dbConn, "gen64_")
+	c.SetSecondaryDB(secConn, func(d *Divergence) {
+		divs = append(divs, d)
+	})
+	sc := NewController(secConn, "gen64_")
+	for _, ctl := range []*Controller{c, sc} {
+		err2 := ctl.CreateDBTables(&TestMirrored{})
+		if err2 != nil {
+			t.Fatalf("CreateDBTables failed: %s", err2.Op)
+		}
+	}
+	defer c.DropDBTables(&TestMirrored{})
+
+	o1 := &TestMirrored{Title: "a"}
+	o2 := &TestMirrored{Title: "b"}
+	c.SaveToDB(o1)
+	c.SaveToDB(o2)
+	o1.Title = "aa"
+	c.SaveToDB(o1)
+	c.WithTx(func(tc *Controller) *ErrController {
+		tc.SaveToDB(&TestMirrored{Title: "c"})
+		return &ErrController{Op: "Test"}
+	})
+	c.WithTx(func(tc *Controller) *ErrController {
+		tc.DeleteFromDB(&TestMirrored{ID: o2.ID})
+		return tc.SaveToDB(&TestMirrored{Title: "d"})
+	})
+	if len(divs) != 0 {
+		t.Fatalf("Mirroring writes failed: %v", *divs[0])
+	}
+
+	xobj, err2 := sc.GetFromDB(newObjFunc, []string{"ID", "asc"}, 10, 0, nil)
+	if err2 != nil {
+		t.Fatalf("GetFromDB failed: %s", err2.Op)
+	}
+	if len(xobj) != 2 || xobj[0].(*TestMirrored).Title != "aa" || xobj[1].(*TestMirrored).Title != "d" {
+		t.Fatalf("Writes were not mirrored to secondary database")
+	}
+
+	dbConn.Exec("UPDATE gen64_test_mirroreds SET title = 'x' WHERE test_mirrored_id = $1", o1.ID)
+	got, err2 := c.VerifySecondaryDB(newObjFunc, 1)
+	if err2 != nil {
+		t.Fatalf("VerifySecondaryDB failed: %s", err2.Op)
+	}
+	if len(got) != 1 || got[0].ID != o1.ID || got[0].Reason != DivergenceDifferent || len(divs) != 1 {
+		t.Fatalf("VerifySecondaryDB returned invalid divergences: %v", got)
+	}
+
+	o3 := &TestMirrored{Title: "e"}
+	err2 = sc.SaveToDB(o3)
+	if err2 != nil || o3.ID <= xobj[1].(*TestMirrored).ID {
+		t.Fatalf("ID sequence of secondary database was not reset")
+	}
+}
+
+// TestSecondaryDBWritePaths tests if writes of many rows, conditional updates,
+// purges and summary refreshes are mirrored to the secondary database
+func TestSecondaryDBWritePaths(t *testing.T) {
+	type TestMirroredPost struct {
+		ID      int64
+		Title   string
+		Views   int64
+		PurgeAt int64
+	}
+	type TestMirroredViews struct {
+		ID    int64
+		Views int64
+		Count int64
+	}
+	newPostFunc := func() interface{} { return &TestMirroredPost{} }
+	newViewsFunc := func() interface{} { return &TestMirroredViews{} }
+	_, err := dbConn.Exec("CREATE DATABASE gen64_secondary_paths")
+	if err != nil {
+		t.Fatalf("Failed to create database: %s", err.Error())
+	}
+	secConn, err := sql.Open("postgres", fmt.Sprintf("host=localhost user=%s password=%s port=%s dbname=gen64_secondary_paths sslmode=disable", dbUser, dbPass, dockerResource.GetPort("5432/tcp")))
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %s", err.Error())
+	}
+	defer dbConn.Exec("DROP DATABASE gen64_secondary_paths")
+	defer secConn.Close()
+
+	divs := []*Divergence{}
+	c := NewController(dbConn, "gen64_")
+	c.SetSecondaryDB(secConn, func(d *Divergence) {
+		divs = append(divs, d)
+	})
+	sc := NewController(secConn, "gen64_")
+	for _, ctl := range []*Controller{c, sc} {
+		err2 := ctl.CreateDBTables(&TestMirroredPost{}, &TestMirroredViews{})
+		if err2 != nil {
+			t.Fatalf("CreateDBTables failed: %s", err2.Op)
+		}
+	}
+	defer c.DropDBTables(&TestMirroredPost{}, &TestMirroredViews{})
+
+	checkSecondary := func(method string, want int) {
+		for _, newObjFunc := range []func() interface{}{newPostFunc, newViewsFunc} {
+			got, err2 := c.VerifySecondaryDB(newObjFunc, 10)
+			if err2 != nil {
+				t.Fatalf("VerifySecondaryDB failed: %s", err2.Op)
+			}
+			if len(got) > 0 || len(divs) > 0 {
+				t.Fatalf("%s was not mirrored to secondary database: %v %v", method, got, divs)
+			}
+		}
+		xobj, err2 := sc.GetFromDB(newPostFunc, nil, 10, 0, nil)
+		if err2 != nil || len(xobj) != want {
+			t.Fatalf("%s was not mirrored to secondary database, want %d objects, got %d", method, want, len(xobj))
+		}
+	}
+
+	p1 := &TestMirroredPost{Title: "a", Views: 1}
+	p2 := &TestMirroredPost{Title: "b", Views: 1, PurgeAt: 50}
+	err2 := c.SaveManyToDB(p1, p2)
+	if err2 != nil {
+		t.Fatalf("SaveManyToDB failed: %s", err2.Op)
+	}
+	checkSecondary("SaveManyToDB insert", 2)
+	p1.Views = 2
+	err2 = c.SaveManyToDB(p1, &TestMirroredPost{Title: "c", Views: 2})
+	if err2 != nil {
+		t.Fatalf("SaveManyToDB failed: %s", err2.Op)
+	}
+	checkSecondary("SaveManyToDB update", 3)
+
+	p1.Title = "aa"
+	cnt, err2 := c.UpdateWhere(p1, map[string]interface{}{"Title": "a"})
+	if err2 != nil || cnt != 1 {
+		t.Fatalf("UpdateWhere failed to update object")
+	}
+	checkSecondary("UpdateWhere", 3)
+
+	cnt, err2 = c.PurgeFromDB(&TestMirroredPost{}, "PurgeAt", 100)
+	if err2 != nil || cnt != 1 {
+		t.Fatalf("PurgeFromDB failed to remove object")
+	}
+	checkSecondary("PurgeFromDB", 2)
+
+	err2 = c.AddSummary(&TestMirroredViews{}, Summary{
+		Source:     newPostFunc,
+		GroupBy:    []string{"Views"},
+		CountField: "Count",
+	})
+	if err2 != nil {
+		t.Fatalf("AddSummary failed: %s", err2.Op)
+	}
+	for i := 0; i < 2; i++ {
+		cnt, err2 = c.RefreshSummary(&TestMirroredViews{})
+		if err2 != nil || cnt != 1 {
+			t.Fatalf("RefreshSummary failed to insert summary objects")
+		}
+		checkSecondary("RefreshSummary", 2)
+	}
+	xobj, err2 := sc.GetFromDB(newViewsFunc, nil, 10, 0, nil)
+	if err2 != nil || len(xobj) != 1 || xobj[0].(*TestMirroredViews).Count != 2 {
+		t.Fatalf("RefreshSummary was not mirrored to secondary database")
+	}
+}
+
+// TestGetVersionsFromURI tests if paths of versions are recognized only for
+// models with versions enabled
+func TestGetVersionsFromURI(t *testing.T) {
+	type Page struct {
+		ID    int64
+		Title string
+	}
+	type Tag struct {
+		ID   int64
+		Name string
+	}
+	c := NewController(nil, "")
+	c.EnableVersions(&Page{})
+	h, _ := c.getHelper(&Page{})
+	th, _ := c.getHelper(&Tag{})
+	for _, tc := range []struct {
+		path      string
+		h         *Helper
+		id        string
+		versionID string
+		ok        bool
+	}{
+		{"12/versions", h, "12", "", true},
+		{"12/versions?limit=5", h, "12", "", true},
+		{"12/versions/3", h, "12", "3", true},
+		{"12/versions/x", h, "", "", false},
+		{"12/history", h, "", "", false},
+		{"x/versions", h, "", "", false},
+		{"12/versions", th, "", "", false},
+	} {
+		id, versionID, ok := c.getVersionsFromURI(tc.path, tc.h)
+		if id != tc.id || versionID != tc.versionID || ok != tc.ok {
+			t.Fatalf("getVersionsFromURI returned invalid values for %s: %s %s %v", tc.path, id, versionID, ok)
+		}
+	}
+}
+
+// TestChangeRequests tests if writes of requests that require approval are
+// stored as change requests, which are applied only when approved
+func TestChangeRequests(t *testing.T) {
+	type TestPage struct {
+		ID    int64  `json:"test_page_id"`
+		Title string `json:"title" crud:"req"`
+		Views int64  `json:"views"`
+	}
+	newObjFunc := func() interface{} { return &TestPage{} }
+	c := NewController(dbConn, "gen64_")
+	err := c.CreateChangeRequestsTable()
+	if err != nil {
+		t.Fatalf("CreateChangeRequestsTable failed: %s", err.Op)
+	}
+	defer dbConn.Exec("DROP TABLE gen64_change_requests")
+	err = c.CreateDBTables(&TestPage{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer c.DropDBTables(&TestPage{})
+
+	p := &TestPage{Title: "a", Views: 1}
+	c.SaveToDB(p)
+
+	hdl := c.GetHTTPHandler("/pages/", newObjFunc, newObjFunc, newObjFunc, newObjFunc, newObjFunc, newObjFunc)
+	w := httptest.NewRecorder()
+	hdl.ServeHTTP(w, WithApprovalRequired(httptest.NewRequest("PUT", fmt.Sprintf("/pages/%d", p.ID), strings.NewReader(`{"title":"b","views":1}`))))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("PUT method returned wrong status code, want %d, got %d", http.StatusAccepted, w.Code)
+	}
+	w = httptest.NewRecorder()
+	hdl.ServeHTTP(w, WithApprovalRequired(httptest.NewRequest("PUT", "/pages/", strings.NewReader(`{"title":"c","views":2}`))))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("PUT method returned wrong status code, want %d, got %d", http.StatusAccepted, w.Code)
+	}
+	_, err = c.RequestChange(p, OpDelete, 5)
+	if err != nil {
+		t.Fatalf("RequestChange failed: %s", err.Op)
+	}
+
+	p2 := &TestPage{}
+	c.SetFromDB(p2, fmt.Sprintf("%d", p.ID))
+	if p2.Title != "a" {
+		t.Fatalf("PUT method applied change that requires approval")
+	}
+	crs, err := c.GetChangeRequestsFromDB(&TestPage{}, ChangeRequestPending, 10, 0)
+	if err != nil {
+		t.Fatalf("GetChangeRequestsFromDB failed: %s", err.Op)
+	}
+	if len(crs) != 3 || crs[0].Op != OpUpdate || len(crs[0].Changes) != 1 || crs[0].Changes["title"] != "b" || crs[1].Op != OpCreate || crs[2].Op != OpDelete || crs[2].CreatedBy != 5 {
+		t.Fatalf("GetChangeRequestsFromDB returned invalid change requests")
+	}
+
+	rev := c.GetChangeRequestsHTTPHandler("/change_requests/", newObjFunc)
+	for _, cr := range crs[:2] {
+		w = httptest.NewRecorder()
+		rev.ServeHTTP(w, WithIdentity(httptest.NewRequest("PUT", fmt.Sprintf("/change_requests/%d/approve", cr.ID), nil), 7))
+		if w.Code != http.StatusOK {
+			t.Fatalf("PUT method failed to approve change request, got %d %s", w.Code, w.Body.String())
+		}
+	}
+	c.SetFromDB(p2, fmt.Sprintf("%d", p.ID))
+	if p2.Title != "b" {
+		t.Fatalf("ApproveChangeRequest failed to apply update, got %s", p2.Title)
+	}
+	xobj, _ := c.GetFromDB(newObjFunc, nil, 0, 0, map[string]interface{}{"Title": "c"})
+	if len(xobj) != 1 || xobj[0].(*TestPage).Views != 2 {
+		t.Fatalf("ApproveChangeRequest failed to apply create")
+	}
+	w = httptest.NewRecorder()
+	rev.ServeHTTP(w, httptest.NewRequest("PUT", fmt.Sprintf("/change_requests/%d/approve", crs[0].ID), nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("PUT method approved change request twice, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	rev.ServeHTTP(w, WithIdentity(httptest.NewRequest("PUT", fmt.Sprintf("/change_requests/%d/approve", crs[2].ID), nil), 5))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("PUT method approved change request by its creator, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	rev.ServeHTTP(w, httptest.NewRequest("PUT", fmt.Sprintf("/change_requests/%d/reject", crs[2].ID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT method failed to reject change request, got %d", w.Code)
+	}
+	c.SetFromDB(p2, fmt.Sprintf("%d", p.ID))
+	if p2.ID != p.ID {
+		t.Fatalf("RejectChangeRequest applied delete")
+	}
+
+	crs, _ = c.GetChangeRequestsFromDB(&TestPage{}, "", 0, 0)
+	if crs[0].Status != ChangeRequestApproved || crs[0].ReviewedBy != 7 || crs[1].ObjID != xobj[0].(*TestPage).ID || crs[2].Status != ChangeRequestRejected {
+		t.Fatalf("Change requests were not marked as reviewed")
+	}
+	w = httptest.NewRecorder()
+	rev.ServeHTTP(w, httptest.NewRequest("GET", "/change_requests/?status=approved", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"title":"c"`) {
+		t.Fatalf("GET method returned invalid change requests: %d %s", w.Code, w.Body.String())
+	}
+}
+
+// TestSearchAll tests if objects of many models are found by searchable
+// fields
+func TestSearchAll(t *testing.T) {
+	type TestProduct struct {
+		ID   int64  `json:"test_product_id"`
+		Name string `json:"name" crud:"searchable"`
+	}
+	type TestCustomer struct {
+		ID    int64  `json:"test_customer_id"`
+		Name  string `json:"name" crud:"searchable"`
+		Email string `json:"email" crud:"searchable"`
+	}
+	newProductFunc := func() interface{} { return &TestProduct{} }
+	newCustomerFunc := func() interface{} { return &TestCustomer{} }
+	c := NewController(dbConn, "gen64_")
+	err := c.CreateDBTables(&TestProduct{}, &TestCustomer{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer c.DropDBTables(&TestProduct{}, &TestCustomer{})
+
+	c.SaveToDB(&TestProduct{Name: "Blue Widget"})
+	c.SaveToDB(&TestProduct{Name: "Red Gadget"})
+	c.SaveToDB(&TestCustomer{Name: "Ann", Email: "ann@widgets.example.com"})
+	c.SaveToDB(&TestCustomer{Name: "Bob", Email: "bob_100%@example.com"})
+
+	results, err := c.SearchAll("widget", 10, newProductFunc, newCustomerFunc)
+	if err != nil {
+		t.Fatalf("SearchAll failed: %s", err.Op)
+	}
+	if len(results) != 2 || results[0].Model != "test_products" || len(results[0].Items) != 1 || results[0].Items[0].(*TestProduct).Name != "Blue Widget" || len(results[1].Items) != 1 || results[1].Items[0].(*TestCustomer).Name != "Ann" {
+		t.Fatalf("SearchAll returned invalid results")
+	}
+	results, _ = c.SearchAll("100%", 10, newCustomerFunc)
+	if len(results[0].Items) != 1 {
+		t.Fatalf("SearchAll failed to search for string with special characters")
+	}
+
+	hdl := c.GetSearchHTTPHandler(10, newProductFunc, newCustomerFunc)
+	w := httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", "/search?q=gadget", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"Red Gadget"`) || strings.Contains(w.Body.String(), `"name":"Ann"`) {
+		t.Fatalf("GET method returned invalid results: %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", "/search", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("GET method returned wrong status code for empty query, got %d", w.Code)
+	}
+
+	type TestCustomerList struct {
+		ID   int64  `json:"test_customer_id"`
+		Name string `json:"name"`
+	}
+	newCustomerListFunc := func() interface{} { return &TestCustomerList{} }
+	hdl = c.GetSearchHTTPHandlerWithListDTOs(10, []func() interface{}{newProductFunc, newCustomerFunc}, []func() interface{}{nil, newCustomerListFunc})
+	w = httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", "/search?q=widget", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"Ann"`) || strings.Contains(w.Body.String(), `"email"`) {
+		t.Fatalf("GET method returned invalid list DTOs: %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", "/search?q=nothing", nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "null") {
+		t.Fatalf("GET method returned invalid empty results: %d %s", w.Code, w.Body.String())
+	}
+}
+
+// TestIsUnique tests if values of fields taken by other objects are found,
+// and fields are checked without saving at the validate path
+func TestIsUnique(t *testing.T) {
+	type TestAccount struct {
+		ID       int64  `json:"test_account_id"`
+		Username string `json:"username" crud:"req uniq lenmin:3"`
+		Email    string `json:"email" crud:"req email"`
+	}
+	newObjFunc := func() interface{} { return &TestAccount{} }
+	c := NewController(dbConn, "gen64_")
+	err := c.CreateDBTables(&TestAccount{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer c.DropDBTables(&TestAccount{})
+
+	a := &TestAccount{Username: "ann", Email: "ann@example.com"}
+	c.SaveToDB(a)
+
+	unique, err := c.IsUnique(newObjFunc, "Username", "ann", 0)
+	if err != nil || unique {
+		t.Fatalf("IsUnique failed to find value that is taken")
+	}
+	unique, err = c.IsUnique(newObjFunc, "Username", "ann", a.ID)
+	if err != nil || !unique {
+		t.Fatalf("IsUnique failed to exclude object with ID")
+	}
+	_, err = c.IsUnique(newObjFunc, "Missing", "ann", 0)
+	if err == nil || err.Op != "InvalidField" {
+		t.Fatalf("IsUnique failed to return error for invalid field")
+	}
+
+	hdl := c.GetHTTPHandler("/accounts/", newObjFunc, newObjFunc, newObjFunc, newObjFunc, newObjFunc, newObjFunc)
+	w := httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("PUT", "/accounts/validate", strings.NewReader(`{"username":"ann","email":"x"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"invalid_fields":["email"]`) || !strings.Contains(w.Body.String(), `"taken_fields":["username"]`) {
+		t.Fatalf("PUT method returned invalid validation result: %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("PUT", fmt.Sprintf("/accounts/validate?id=%d", a.ID), strings.NewReader(`{"username":"ann"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"valid":true`) {
+		t.Fatalf("PUT method returned invalid validation result: %d %s", w.Code, w.Body.String())
+	}
+	xobj, _ := c.GetFromDB(newObjFunc, nil, 0, 0, nil)
+	if len(xobj) != 1 {
+		t.Fatalf("PUT method saved validated object")
+	}
+}
+
+// TestFormatModelID tests if IDs are formatted with prefix and padding from
+// tags and parsed back, also in the HTTP path
+func TestFormatModelID(t *testing.T) {
+	type Invoice struct {
+		ID     int64 `crud:"idprefix:INV- idpad:6"`
+		Amount int64
+	}
+	c := NewController(nil, "")
+	s, err := c.FormatModelID(&Invoice{ID: 123})
+	if err != nil || s != "INV-000123" {
+		t.Fatalf("FormatModelID returned invalid ID: %s", s)
+	}
+	for s, want := range map[string]int64{"INV-000123": 123, "INV-7": 7, "45": 45, "INV-": 0, "INV-0": 0, "X-1": 0} {
+		id, ok := c.ParseModelID(&Invoice{}, s)
+		if id != want || ok != (want > 0) {
+			t.Fatalf("ParseModelID(%s) want %d, got %d", s, want, id)
+		}
+	}
+	h, _ := c.getHelper(&Invoice{})
+	path := c.getPathWithParsedIDs("INV-000012/diff/INV-000003?to=1", h)
+	if path != "12/diff/3?to=1" {
+		t.Fatalf("getPathWithParsedIDs returned invalid path: %s", path)
+	}
+}
+
+// TestIDSequence tests if models with the same "seq" tag share the sequence
+// and if formatted IDs are accepted in the HTTP path
+func TestIDSequence(t *testing.T) {
+	type Invoice struct {
+		ID     int64 `json:"invoice_id" crud:"seq:documents idprefix:INV- idpad:6"`
+		Amount int64 `json:"amount"`
+	}
+	type CreditNote struct {
+		ID     int64 `json:"credit_note_id" crud:"seq:documents idprefix:CN- idpad:6"`
+		Amount int64 `json:"amount"`
+	}
+	c := NewController(dbConn, "gen64_")
+	err := c.CreateDBTables(&Invoice{}, &CreditNote{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer dbConn.Exec("DROP SEQUENCE gen64_documents_seq")
+	defer c.DropDBTables(&Invoice{}, &CreditNote{})
+
+	invoice := &Invoice{Amount: 100}
+	creditNote := &CreditNote{Amount: 50}
+	c.SaveToDB(invoice)
+	c.SaveToDB(creditNote)
+	if invoice.ID != 1 || creditNote.ID != 2 {
+		t.Fatalf("SaveToDB failed to get IDs from the sequence: %d %d", invoice.ID, creditNote.ID)
+	}
+
+	newObjFunc := func() interface{} { return &CreditNote{} }
+	h := c.GetHTTPHandler("/credit_notes/", newObjFunc, newObjFunc, newObjFunc, newObjFunc, newObjFunc, newObjFunc)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/credit_notes/CN-000002", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"amount":50`) {
+		t.Fatalf("GET method returned invalid object: %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/credit_notes/CN-2", strings.NewReader(`{"amount":60}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT method returned wrong status code, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("DELETE", "/credit_notes/CN-000002", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":2`) {
+		t.Fatalf("DELETE method returned invalid response: %d %s", w.Code, w.Body.String())
+	}
+
+	var exists bool
+	err = c.DropDBTable(&Invoice{})
+	dbConn.QueryRow("SELECT to_regclass('gen64_documents_seq') IS NOT NULL").Scan(&exists)
+	if err != nil || !exists {
+		t.Fatalf("DropDBTable dropped sequence used by another table")
+	}
+	err = c.DropDBTable(&CreditNote{})
+	dbConn.QueryRow("SELECT to_regclass('gen64_documents_seq') IS NOT NULL").Scan(&exists)
+	if err != nil || exists {
+		t.Fatalf("DropDBTable failed to drop sequence")
+	}
+}
+
+// TestHTTPDeleteResponse tests if DELETE method responds with ID of the
+// deleted object
+func TestHTTPDeleteResponse(t *testing.T) {
+	type TestNote struct {
+		ID   int64  `json:"test_note_id"`
+		Text string `json:"text"`
+	}
+	newObjFunc := func() interface{} { return &TestNote{} }
+	c := NewController(dbConn, "gen64_")
+	err := c.CreateDBTable(&TestNote{})
+	if err != nil {
+		t.Fatalf("CreateDBTable failed: %s", err.Op)
+	}
+	defer c.DropDBTable(&TestNote{})
+	c.SaveToDB(&TestNote{Text: "a"})
+	c.SaveToDB(&TestNote{Text: "b"})
+
+	h := c.GetHTTPHandler("/notes/", newObjFunc, newObjFunc, newObjFunc, newObjFunc, newObjFunc, newObjFunc)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("DELETE", "/notes/2", nil))
+	var res IDResponse
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || res.OK != 1 || res.Data.ID != 2 {
+		t.Fatalf("DELETE method returned invalid response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+// TestTasks tests if bulk operations are run in the background with async
+// parameter and their status is stored
+func TestTasks(t *testing.T) {
+	type TestItem struct {
+		ID    int64  `json:"test_item_id"`
+		Name  string `json:"name"`
+		Stock int64  `json:"stock"`
+	}
+	newObjFunc := func() interface{} { return &TestItem{} }
+	c := NewController(dbConn, "gen64_")
+	err := c.CreateTasksTable()
+	if err != nil {
+		t.Fatalf("CreateTasksTable failed: %s", err.Op)
+	}
+	defer dbConn.Exec("DROP TABLE gen64_tasks")
+	err = c.CreateDBTables(&TestItem{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer c.DropDBTables(&TestItem{})
+
+	c.SaveToDB(&TestItem{Name: "a", Stock: 0})
+	c.SaveToDB(&TestItem{Name: "b", Stock: 0})
+	c.SaveToDB(&TestItem{Name: "c", Stock: 5})
+
+	bulk := c.GetBulkHTTPHandler("/bulk/items/", newObjFunc)
+	tasks := c.GetTasksHTTPHandler("/tasks/")
+	w := httptest.NewRecorder()
+	bulk.ServeHTTP(w, httptest.NewRequest("GET", "/bulk/items/export?async=1", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("GET method returned wrong status code, want %d, got %d", http.StatusAccepted, w.Code)
+	}
+	var res struct {
+		Data struct {
+			TaskID int64 `json:"task_id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	c.WaitTasks()
+
+	task, err := c.GetTaskFromDB(res.Data.TaskID)
+	if err != nil || task == nil {
+		t.Fatalf("GetTaskFromDB failed")
+	}
+	if task.Status != TaskDone || task.Name != "gen64_test_items.export" || task.Result["count"] != float64(3) || !task.HasOutput || task.FinishedAt == nil {
+		t.Fatalf("Task was not finished: %v", task)
+	}
+	w = httptest.NewRecorder()
+	tasks.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/tasks/%d/output", task.ID), nil))
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "\n") != 4 {
+		t.Fatalf("GET method returned invalid output: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	tasks.ServeHTTP(w, WithIdentity(httptest.NewRequest("GET", fmt.Sprintf("/tasks/%d/output", task.ID), nil), 3))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("GET method returned task of another identity, got %d", w.Code)
+	}
+
+	id, err := c.RunTask("panic", func(tc *Controller, output io.Writer) (map[string]interface{}, error) {
+		panic("test")
+	})
+	if err != nil {
+		t.Fatalf("RunTask failed: %s", err.Op)
+	}
+	c.WaitTasks()
+	task, _ = c.GetTaskFromDB(id)
+	if task.Status != TaskFailed || task.Error != "cannot_run_panic" {
+		t.Fatalf("Task that panicked was not marked as failed: %v", task)
+	}
+	logged := []*ErrController{}
+	vc := NewController(dbConn, "gen64_")
+	vc.SetErrorLogger(func(err *ErrController) {
+		logged = append(logged, err)
+	})
+	for _, verbose := range []bool{false, true} {
+		vc.SetVerboseErrors(verbose)
+		id, _ = vc.RunTask("gen64_test_items.delete", func(tc *Controller, output io.Writer) (map[string]interface{}, error) {
+			_, err := tc.getQuerier().Exec("DELETE FROM gen64_missing_items")
+			return nil, err
+		})
+		vc.WaitTasks()
+		task, _ = vc.GetTaskFromDB(id)
+		if task.Status != TaskFailed || !strings.HasPrefix(task.Error, "cannot_run_delete") || strings.Contains(task.Error, "gen64_missing_items") != verbose {
+			t.Fatalf("Task stored invalid error in verbose mode %v: %s", verbose, task.Error)
+		}
+	}
+	if len(logged) != 2 || !strings.Contains(logged[0].Error(), "gen64_missing_items") {
+		t.Fatalf("Task error was not passed to the error logger")
+	}
+	lc := NewController(dbConn, "gen64_")
+	lc.SetTaskOutputLimit(10)
+	id, _ = lc.RunTask("export", func(tc *Controller, output io.Writer) (map[string]interface{}, error) {
+		_, err := tc.DumpModel(newObjFunc, output)
+		return nil, err
+	})
+	lc.WaitTasks()
+	task, _ = c.GetTaskFromDB(id)
+	if task.Status != TaskFailed || task.HasOutput {
+		t.Fatalf("Task with output over the limit was not marked as failed: %v", task)
+	}
+
+	w = httptest.NewRecorder()
+	bulk.ServeHTTP(w, WithApprovalRequired(httptest.NewRequest("DELETE", "/bulk/items/?filter_stock=0", nil)))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("DELETE method that requires approval returned wrong status code, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	bulk.ServeHTTP(w, httptest.NewRequest("DELETE", "/bulk/items/", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("DELETE method without filters returned wrong status code, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	bulk.ServeHTTP(w, httptest.NewRequest("DELETE", "/bulk/items/?filter_stock=0&async=1", nil))
+	json.Unmarshal(w.Body.Bytes(), &res)
+	c.WaitTasks()
+	w = httptest.NewRecorder()
+	tasks.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/tasks/%d", res.Data.TaskID), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"done"`) || !strings.Contains(w.Body.String(), `"count":2`) {
+		t.Fatalf("GET method returned invalid task: %d %s", w.Code, w.Body.String())
+	}
+	xobj, _ := c.GetFromDB(newObjFunc, nil, 0, 0, nil)
+	if len(xobj) != 1 {
+		t.Fatalf("Task failed to delete objects")
+	}
+
+	w = httptest.NewRecorder()
+	bulk.ServeHTTP(w, httptest.NewRequest("PUT", "/bulk/items/import", strings.NewReader("{}")))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("PUT method with invalid dump returned wrong status code, got %d", w.Code)
+	}
+}
+
+// TestDiff tests if fields with different values of two objects are returned
+// and paths of diffs are recognized
+func TestDiff(t *testing.T) {
+	type Page struct {
+		ID       int64  `json:"page_id"`
+		Title    string `json:"title"`
+		Views    int64  `json:"views"`
+		Password string `json:"-"`
+	}
+	c := NewController(nil, "")
+	diffs, err := c.Diff(&Page{ID: 1, Title: "a", Views: 3}, &Page{ID: 2, Title: "b", Views: 3, Password: "x"})
+	if err != nil {
+		t.Fatalf("Diff failed: %s", err.Op)
+	}
+	want := []FieldDiff{{Name: "Title", JSON: "title", Old: "a", New: "b"}, {Name: "Password", JSON: "-", Old: "", New: "x"}}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Fatalf("Diff returned invalid diffs, want %v, got %v", want, diffs)
+	}
+	_, err = c.Diff(&Page{}, &TestStruct{})
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("Diff failed to return error for objects of different structs")
+	}
+
+	h, _ := c.getHelper(&Page{})
+	id, otherID, versionID, ok := c.getDiffFromURI("1/diff/2", h)
+	if id != "1" || otherID != "2" || versionID != "" || !ok {
+		t.Fatalf("getDiffFromURI returned invalid values: %s %s %s %v", id, otherID, versionID, ok)
+	}
+	_, _, _, ok = c.getDiffFromURI("1/versions/2/diff", h)
+	if ok {
+		t.Fatalf("getDiffFromURI returned diff of version of model without versions")
+	}
+	c.EnableVersions(&Page{})
+	id, otherID, versionID, ok = c.getDiffFromURI("1/versions/2/diff?to=3", h)
+	if id != "1" || otherID != "" || versionID != "2" || !ok {
+		t.Fatalf("getDiffFromURI returned invalid values: %s %s %s %v", id, otherID, versionID, ok)
+	}
+
+	mux := http.NewServeMux()
+	c.MountEndpoints([]Endpoint{{
+		Path:  "/v1/pages/",
+		Model: func() interface{} { return &Page{} },
+		Auth: func(r *http.Request, op int) bool {
+			return r.URL.Path != "/v1/pages/2"
+		},
+	}}, mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/v1/pages/1/diff/2", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("GET method returned diff with object that is not authorized: %d", w.Code)
+	}
+	if other := c.getOtherDiffRequest("/v1/pages/", httptest.NewRequest("GET", "/v1/pages/1/diff/3?x=1", nil)); other == nil || other.URL.Path != "/v1/pages/3" || other.URL.RawQuery != "x=1" {
+		t.Fatalf("getOtherDiffRequest returned invalid request")
+	}
+}
+
+// TestVersions tests if previous versions of objects are stored on update,
+// listed and restored, also with HTTP handler
+func TestVersions(t *testing.T) {
+	type TestPage struct {
+		ID    int64  `json:"test_page_id"`
+		Title string `json:"title"`
+		Notes string `json:"notes"`
+	}
+	type TestPageRead struct {
+		ID    int64  `json:"test_page_id"`
+		Title string `json:"title"`
+	}
+	newObjFunc := func() interface{} { return &TestPage{} }
+	newObjReadFunc := func() interface{} { return &TestPageRead{} }
+	c := NewController(dbConn, "gen64_")
+	c.EnableVersions(&TestPage{})
+	err := c.CreateVersionsTable()
+	if err != nil {
+		t.Fatalf("CreateVersionsTable failed: %s", err.Op)
+	}
+	defer dbConn.Exec("DROP TABLE gen64_versions")
+	err = c.CreateDBTables(&TestPage{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer c.DropDBTables(&TestPage{})
+
+	p := &TestPage{Title: "a", Notes: "internal"}
+	c.SaveToDB(p)
+	p.Title = "b"
+	c.SaveToDB(p)
+	p.Title = "c"
+	c.SaveFieldsToDB(p, "Title")
+
+	versions, err := c.GetVersionsFromDB(p, 10, 0)
+	if err != nil {
+		t.Fatalf("GetVersionsFromDB failed: %s", err.Op)
+	}
+	if len(versions) != 2 || versions[0].Obj.(*TestPage).Title != "b" || versions[1].Obj.(*TestPage).Title != "a" || versions[1].Obj.(*TestPage).ID != p.ID {
+		t.Fatalf("GetVersionsFromDB returned invalid versions")
+	}
+
+	err = c.RestoreVersion(p, versions[1].ID)
+	if err != nil {
+		t.Fatalf("RestoreVersion failed: %s", err.Op)
+	}
+	p2 := &TestPage{}
+	c.SetFromDB(p2, fmt.Sprintf("%d", p.ID))
+	if p2.Title != "a" {
+		t.Fatalf("RestoreVersion failed to restore object, got %s", p2.Title)
+	}
+	err = c.RestoreVersion(p, versions[1].ID+100)
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("RestoreVersion failed to return error for version that does not exist")
+	}
+
+	hdl := c.GetHTTPHandler("/pages/", newObjFunc, newObjFunc, newObjReadFunc, newObjFunc, newObjFunc, newObjFunc)
+	w := httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/pages/%d/versions?limit=1", p.ID), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"title":"c"`) || strings.Contains(w.Body.String(), `"title":"b"`) || strings.Contains(w.Body.String(), "internal") {
+		t.Fatalf("GET method returned invalid versions: %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("PUT", fmt.Sprintf("/pages/%d/versions/%d", p.ID, versions[0].ID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT method returned wrong status code, want %d, got %d", http.StatusOK, w.Code)
+	}
+	c.SetFromDB(p2, fmt.Sprintf("%d", p.ID))
+	if p2.Title != "b" {
+		t.Fatalf("PUT method failed to restore version, got %s", p2.Title)
+	}
+
+	err = c.CreateChangeRequestsTable()
+	if err != nil {
+		t.Fatalf("CreateChangeRequestsTable failed: %s", err.Op)
+	}
+	defer dbConn.Exec("DROP TABLE gen64_change_requests")
+	w = httptest.NewRecorder()
+	hdl.ServeHTTP(w, WithApprovalRequired(httptest.NewRequest("PUT", fmt.Sprintf("/pages/%d/versions/%d", p.ID, versions[1].ID), nil)))
+	c.SetFromDB(p2, fmt.Sprintf("%d", p.ID))
+	if w.Code != http.StatusAccepted || p2.Title != "b" {
+		t.Fatalf("PUT method restored version that requires approval, got %d %s", w.Code, p2.Title)
+	}
+
+	diffs, err := c.DiffVersions(p2, versions[1].ID, 0)
+	if err != nil {
+		t.Fatalf("DiffVersions failed: %s", err.Op)
+	}
+	if len(diffs) != 1 || diffs[0].Old != "a" || diffs[0].New != "b" {
+		t.Fatalf("DiffVersions returned invalid diffs: %v", diffs)
+	}
+	w = httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/pages/%d/versions/%d/diff?to=%d", p.ID, versions[1].ID, versions[0].ID), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"old":"a","new":"b"`) {
+		t.Fatalf("GET method returned invalid diff: %d %s", w.Code, w.Body.String())
+	}
+}
+
+// TestVersionsOfConditionalAndBatchUpdates tests if UpdateWhere and
+// SaveManyToDB store previous versions of updated objects
+func TestVersionsOfConditionalAndBatchUpdates(t *testing.T) {
+	type TestVersionedPage struct {
+		ID     int64
+		Title  string
+		Status string
+	}
+	c := NewController(dbConn, "gen64_")
+	c.EnableVersions(&TestVersionedPage{})
+	err := c.CreateVersionsTable()
+	if err != nil {
+		t.Fatalf("CreateVersionsTable failed: %s", err.Op)
+	}
+	defer dbConn.Exec("DROP TABLE gen64_versions")
+	err = c.CreateDBTables(&TestVersionedPage{})
+	if err != nil {
+		t.Fatalf("CreateDBTables failed: %s", err.Op)
+	}
+	defer c.DropDBTables(&TestVersionedPage{})
+
+	p1 := &TestVersionedPage{Title: "a", Status: "draft"}
+	p2 := &TestVersionedPage{Title: "b", Status: "draft"}
+	err = c.SaveManyToDB(p1, p2)
+	if err != nil {
+		t.Fatalf("SaveManyToDB failed: %s", err.Op)
+	}
+
+	p1.Status = "published"
+	cnt, err := c.UpdateWhere(p1, map[string]interface{}{"Status": "draft"})
+	if err != nil || cnt != 1 {
+		t.Fatalf("UpdateWhere failed to update object")
+	}
+	p1.Status = "archived"
+	cnt, err = c.UpdateWhere(p1, map[string]interface{}{"Status": "draft"})
+	if err != nil || cnt != 0 {
+		t.Fatalf("UpdateWhere updated object that does not match guard")
+	}
+	versions, err := c.GetVersionsFromDB(p1, 10, 0)
+	if err != nil {
+		t.Fatalf("GetVersionsFromDB failed: %s", err.Op)
+	}
+	if len(versions) != 1 || versions[0].Obj.(*TestVersionedPage).Status != "draft" {
+		t.Fatalf("UpdateWhere stored invalid versions: %d", len(versions))
+	}
+
+	p1.Title, p1.Status = "aa", "published"
+	p2.Title = "bb"
+	err = c.SaveManyToDB(p1, p2, &TestVersionedPage{Title: "c"})
+	if err != nil {
+		t.Fatalf("SaveManyToDB failed: %s", err.Op)
+	}
+	for _, tc := range []struct {
+		obj    *TestVersionedPage
+		titles []string
+	}{
+		{p1, []string{"a", "a"}},
+		{p2, []string{"b"}},
+	} {
+		versions, err = c.GetVersionsFromDB(tc.obj, 10, 0)
+		if err != nil {
+			t.Fatalf("GetVersionsFromDB failed: %s", err.Op)
+		}
+		if len(versions) != len(tc.titles) {
+			t.Fatalf("SaveManyToDB stored invalid versions of object %d, want %d, got %d", tc.obj.ID, len(tc.titles), len(versions))
+		}
+		for i, title := range tc.titles {
+			if versions[i].Obj.(*TestVersionedPage).Title != title {
+				t.Fatalf("SaveManyToDB stored invalid version of object %d: %v", tc.obj.ID, versions[i].Obj)
+			}
+		}
+	}
+	if versions, _ = c.GetVersionsFromDB(p1, 1, 0); versions[0].Obj.(*TestVersionedPage).Status != "published" {
+		t.Fatalf("SaveManyToDB stored invalid version of object %d: %v", p1.ID, versions[0].Obj)
+	}
+}
+
+// TestReportInvalidRows tests if rows that do not pass validation are reported
+func TestReportInvalidRows(t *testing.T) {
+	ts := getTestStructWithData()
+	ts.ID = 0
+	err := testController.SaveToDB(ts)
+	if err != nil {
+		t.Fatalf("SaveToDB failed: %s", err.Op)
+	}
+	_, err2 := dbConn.Exec("UPDATE gen64_test_structs SET primary_email = 'invalid' WHERE test_struct_id = $1", ts.ID)
+	if err2 != nil {
+		t.Fatalf("Failed to update row: %s", err2.Error())
+	}
+	defer testController.DeleteFromDB(ts)
+
+	batches := 0
+	invalid, err := testController.ValidateDBTable(testStructNewFunc, 2, func(r *ValidationReport) {
+		batches++
+	})
+	if err != nil {
+		t.Fatalf("ValidateDBTable failed: %s", err.Op)
+	}
+	found := false
+	for _, row := range invalid {
+		if row.ID == ts.ID && len(row.Fields) == 1 && row.Fields[0] == "PrimaryEmail" {
+			found = true
+		}
+	}
+	if !found || batches < 2 {
+		t.Fatalf("ValidateDBTable failed to report invalid row in %d batches: %v", batches, invalid)
+	}
+}
+
+// TestHTTPHanlderPutMethodForValidations checks if HTTP endpoint returns
+// validation failed error when PUT request with invalid input is made
+func TestHTTPHandlerPutMethodForValidation(t *testing.T) {
+	j := `{
+		"email": "invalid",
+		"first_name": "J",
+		"last_name": "S",
+		"key": "12"
+	}`
+	b := makePUTInsertRequest(j, http.StatusBadRequest, t)
+	if !strings.Contains(string(b), "validation_failed") {
+		t.Fatalf("PUT method for invalid request did not output validation_failed error text")
+	}
+}
+
+// TestHTTPHandlerPutMethodForCreating tests if HTTP endpoint properly creates
+// new object in the database, when PUT request is made, without object ID
+func TestHTTPHandlerPutMethodForCreating(t *testing.T) {
+	j := `{
+		"email": "test@example.com",
+		"first_name": "John",
+		"last_name": "Smith",
+		"key": "123456789012345678901234567890aa"
+	}`
+	b := makePUTInsertRequest(j, http.StatusCreated, t)
+
+	id, flags, primaryEmail, emailSecondary, firstName, lastName, age, price, postCode, postCode2, password, createdByUserID, key, err := getRow()
+	if err != nil {
+		t.Fatalf("PUT method failed to insert struct to the table: %s", err.Error())
+	}
+	if id == 0 || flags != 0 || primaryEmail != "test@example.com" || emailSecondary != "" || firstName != "John" || lastName != "Smith" || age != 0 || price != 0 || postCode != "" || postCode2 != "" || createdByUserID != 0 || key != "123456789012345678901234567890aa" || password != "" {
+		t.Fatalf("PUT method failed to insert struct to the table")
+	}
+
+	r := NewHTTPResponse(1, "")
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		t.Fatalf("PUT method returned wrong json output, error marshaling: %s", err.Error())
+	}
+
+	if r.Data["id"].(float64) == 0 {
+		t.Fatalf("PUT method did not return id")
+	}
+}
+
+// TestHTTPHandlerPutMethodForUpdating tests if HTTP endpoint successfully
+// updates object details when PUT request with ID is being made
+func TestHTTPHandlerPutMethodForUpdating(t *testing.T) {
+	j := `{
+		"test_struct_flags": 8,
+		"email": "test11@example.com",
+		"email2": "test22@example.com",
+		"first_name": "John2",
+		"last_name": "Smith2",
+		"age": 39,
+		"price": 199,
+		"post_code": "22-222",
+		"post_code2": "33-333",
+		"password": "password123updated",
+		"created_by_user_id": 12,
+		"key": "123456789012345678901234567890nbh"
+	}`
+	_ = makePUTUpdateRequest(j, 54, false, t)
+
+	id, flags, primaryEmail, emailSecondary, firstName, lastName, age, price, postCode, postCode2, password, createdByUserID, key, err := getRow()
+	if err != nil {
+		t.Fatalf("PUT method failed to update struct to the table: %s", err.Error())
+	}
+	// Only 2 fields should be updated: FirstName and LastName. Check the TestStruct_Update struct
+	if id == 0 || flags != 0 || primaryEmail != "test@example.com" || emailSecondary != "" || firstName != "John2" || lastName != "Smith2" || age != 0 || price != 0 || postCode != "" || postCode2 != "" || createdByUserID != 0 || key != "123456789012345678901234567890aa" || password != "" {
+		t.Fatalf("PUT method failed to update struct in the table")
+	}
+}
+
+// TestHTTPHandlerPutMethodForUpdatingOnCustomEndpoint tests if HTTP endpoint
+// successfully updates object when PUT request with ID is being made, and
+// when the endpoint is a custom endpoint (it actually does not matter that much)
+func TestHTTPHandlerPutMethodForUpdatingOnCustomEndpoint(t *testing.T) {
+	j := `{
+		"test_struct_flags": 8,
+		"email": "test11@example.com",
+		"email2": "test22@example.com",
+		"first_name": "John2",
+		"last_name": "Smith2",
+		"age": 39,
+		"price": 444,
+		"post_code": "22-222",
+		"post_code2": "33-333",
+		"password": "password123updated",
+		"created_by_user_id": 12,
+		"key": "123456789012345678901234567890nbh"
+	}`
+	_ = makePUTUpdateRequest(j, 54, true, t)
+
+	id, flags, _, _, _, _, _, price, _, _, _, _, _, err := getRow()
+	if err != nil {
+		t.Fatalf("PUT method failed to update struct to the table: %s", err.Error())
+	}
+	// Only Price field should be updated. Check the TestStruct_Update struct
+	if id == 0 || flags != 0 || price != 444 {
+		t.Fatalf(strconv.Itoa(price))
+		t.Fatalf("PUT method on a custom endpoint failed to update struct in the table")
+	}
+}
+
+// TestHTTPHandlerGetMethodOnExisting checks if HTTP endpoint properly return
+// object details, when GET request with object ID is made
+func TestHTTPHandlerGetMethodOnExisting(t *testing.T) {
+	resp := makeGETReadRequest(54, t)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET method returned wrong status code, want %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET method failed")
+	}
+
+	r := NewHTTPResponse(1, "")
+	err = json.Unmarshal(body, &r)
+	if err != nil {
+		t.Fatalf("GET method failed to return unmarshable JSON: " + err.Error())
+	}
+	if r.Data["item"].(map[string]interface{})["age"].(float64) != 0 {
+		t.Fatalf("GET method returned invalid values")
+	}
+	if r.Data["item"].(map[string]interface{})["price"].(float64) != 444 {
+		t.Fatalf("GET method returned invalid values")
+	}
+	if strings.Contains(string(body), "email2") {
+		t.Fatalf("GET method returned output with field that should have been hidden")
+	}
+	if strings.Contains(string(body), "post_code2") {
+		t.Fatalf("GET method returned output with field that should have been hidden")
+	}
+}
+
+// TestHTTPHandlerDeleteMethod tests if HTTP endpoint removes object from the
+// database, when DELETE request is made
+func TestHTTPHandlerDeleteMethod(t *testing.T) {
+	makeDELETERequest(54, t)
+
+	cnt, err2 := getRowCntById(54)
+	if err2 != nil {
+		t.Fatalf("DELETE handler failed to delete struct from the table")
+	}
+	if cnt > 0 {
+		t.Fatalf("DELETE handler failed to delete struct from the table")
+	}
+}
+
+// TestHTTPHandlerGetMethodOnNonExisting checks HTTP endpoint response when
+// making GET request with non-existing object ID
+func TestHTTPHandlerGetMethodOnNonExisting(t *testing.T) {
+	resp := makeGETReadRequest(54, t)
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET method returned wrong status code, want %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+// TestHTTPHandlerGetMethodWithoutID tests if HTTP endpoint returns list of
+// objects when GET request without ID is done; request contains filters, order and result limit
+func TestHTTPHandlerGetMethodWithoutID(t *testing.T) {
+	ts := testStructNewFunc().(*TestStruct)
+	for i := 1; i <= 55; i++ {
+		testController.ResetFields(ts)
+		ts.ID = 0
+		testController.SetFromDB(ts, fmt.Sprintf("%d", i))
+		if ts.ID != 0 {
+			ts.Password = "abcdefghijklopqrwwe"
+			testController.SaveToDB(ts)
+		}
+	}
+	b := makeGETListRequest(map[string]string{
+		"limit":                "10",
+		"offset":               "20",
+		"order":                "age",
+		"order_direction":      "asc",
+		"filter_price":         "444",
+		"filter_primary_email": "primary@gen64.net",
+	}, t)
+
+	r := NewHTTPResponse(1, "")
+	err := json.Unmarshal(b, &r)
+	if err != nil {
+		t.Fatalf("GET method returned wrong json output, error marshaling: %s", err.Error())
+	}
+
+	if len(r.Data["items"].([]interface{})) != 10 {
+		t.Fatalf("GET method returned invalid number of rows, want %d got %d", 10, len(r.Data["items"].([]interface{})))
+	}
+
+	if r.Data["items"].([]interface{})[2].(map[string]interface{})["age"].(float64) != 52 {
+		t.Fatalf("GET method returned invalid row, want %d got %f", 52, r.Data["items"].([]interface{})[2].(map[string]interface{})["age"].(float64))
+	}
+
+	if strings.Contains(string(b), "email2") {
 		t.Fatalf("GET method returned output with field that should have been hidden")
 	}
+	if strings.Contains(string(b), "post_code2") {
+		t.Fatalf("GET method returned output with field that should have been hidden")
+	}
+}
+
+// TestHTTPHandlerGetMethodWithCount tests if list response contains number of
+// all objects matching filters when it is requested
+func TestHTTPHandlerGetMethodWithCount(t *testing.T) {
+	filters := map[string]interface{}{"Price": 444, "PrimaryEmail": "primary@gen64.net"}
+	cnt, err := testController.GetCountFromDB(testStructNewFunc, filters)
+	if err != nil || cnt <= 10 {
+		t.Fatalf("GetCountFromDB returned invalid number of objects: %d", cnt)
+	}
+
+	b := makeGETListRequest(map[string]string{
+		"limit":                "10",
+		"filter_price":         "444",
+		"filter_primary_email": "primary@gen64.net",
+		"count":                "1",
+	}, t)
+	r := NewHTTPResponse(1, "")
+	err2 := json.Unmarshal(b, &r)
+	if err2 != nil {
+		t.Fatalf("GET method returned wrong json output, error marshaling: %s", err2.Error())
+	}
+	if len(r.Data["items"].([]interface{})) != 10 || r.Data["total_items"].(float64) != float64(cnt) {
+		t.Fatalf("GET method returned invalid total_items, want %d got %v", cnt, r.Data["total_items"])
+	}
+}
+
+// TestHTTPHandlerGetMethodWithFilterOperators tests if list request with
+// operator suffixes in filter names returns objects matching the conditions
+func TestHTTPHandlerGetMethodWithFilterOperators(t *testing.T) {
+	filters := map[string]interface{}{
+		"Age":          []FilterCondition{{Operator: ">=", Value: 40}, {Operator: "<", Value: 50}},
+		"PrimaryEmail": FilterCondition{Operator: "LIKE", Value: "primary@%"},
+	}
+	cnt, err := testController.GetCountFromDB(testStructNewFunc, filters)
+	if err != nil || cnt == 0 {
+		t.Fatalf("GetCountFromDB returned invalid number of objects: %d", cnt)
+	}
+
+	b := makeGETListRequest(map[string]string{
+		"limit":                     "100",
+		"filter_age_gte":            "40",
+		"filter_age_lt":             "50",
+		"filter_primary_email_like": "primary@%",
+		"count":                     "1",
+	}, t)
+	r := NewHTTPResponse(1, "")
+	err2 := json.Unmarshal(b, &r)
+	if err2 != nil {
+		t.Fatalf("GET method returned wrong json output, error marshaling: %s", err2.Error())
+	}
+	if r.Data["total_items"].(float64) != float64(cnt) {
+		t.Fatalf("GET method returned invalid total_items, want %d got %v", cnt, r.Data["total_items"])
+	}
+	for _, item := range r.Data["items"].([]interface{}) {
+		age := item.(map[string]interface{})["age"].(float64)
+		if age < 40 || age >= 50 {
+			t.Fatalf("GET method returned object not matching filters: %v", item)
+		}
+	}
+}
+
+// TestConditions tests if conditions grouped with AND and OR are converted
+// to SQL with arguments in the right order
+func TestConditions(t *testing.T) {
+	c := NewController(nil, "")
+	obj := &TestStruct{}
+	h, _ := c.getHelper(obj)
+
+	cond := Or(Cond("Price", "=", 444), And(Cond("Age", ">", 18), Cond("Age", "<=", 30), Cond("FirstName", "like", "J%")))
+	q, args, i, err := c.getConditionSQL(h, obj, cond, 1)
+	if err != nil {
+		t.Fatalf("getConditionSQL failed: %s", err.Op)
+	}
+	want := "(price=$1 OR (age > $2 AND age <= $3 AND first_name LIKE $4))"
+	if q != want || i != 5 || !reflect.DeepEqual(args, []interface{}{444, 18, 30, "J%"}) {
+		t.Fatalf("Want %v, got %v with args %v", want, q, args)
+	}
+
+	got := h.getQuerySelect(q, i, nil, 10, 0, nil, QueryHints{})
+	if !strings.HasSuffix(got, " FROM test_structs WHERE (price=$1 OR (age > $2 AND age <= $3 AND first_name LIKE $4)) LIMIT 10") {
+		t.Fatalf("getQuerySelect returned invalid query with conditions: %s", got)
+	}
+
+	for _, tc := range []struct {
+		cond Condition
+		op   string
+	}{
+		{Cond("NonExisting", "=", 1), "InvalidField"},
+		{Cond("Age", "~", 1), "ValidateFilters"},
+		{Cond("Age", "=", "1"), "ValidateFilters"},
+		{Or(), "InvalidValue"},
+		{Condition{Join: "XOR", Conditions: []Condition{Cond("Age", "=", 1)}}, "InvalidValue"},
+	} {
+		_, _, _, err = c.getConditionSQL(h, obj, tc.cond, 1)
+		if err == nil || err.Op != tc.op {
+			t.Fatalf("getConditionSQL failed to return %s error for %v", tc.op, tc.cond)
+		}
+	}
+}
+
+// TestGetFromDBWithConditions tests if objects matching conditions grouped
+// with OR are returned
+func TestGetFromDBWithConditions(t *testing.T) {
+	cond := Or(Cond("Price", "=", 444), And(Cond("Age", ">=", 40), Cond("Age", "<", 50)))
+	xobj, err := testController.GetFromDBWithConditions(testStructNewFunc, []string{"ID", "asc"}, 100, 0, cond)
+	if err != nil || len(xobj) == 0 {
+		t.Fatalf("GetFromDBWithConditions failed to return objects")
+	}
+	for _, o := range xobj {
+		ts := o.(*TestStruct)
+		if ts.Price != 444 && (ts.Age < 40 || ts.Age >= 50) {
+			t.Fatalf("GetFromDBWithConditions returned object not matching conditions: %v", ts)
+		}
+	}
+}
+
+// TestGetRelativePath tests if part of request path after handler's uri is
+// found when the handler is registered with or without http.StripPrefix
+func TestGetRelativePath(t *testing.T) {
+	c := NewController(nil, "")
+	for _, tc := range [][3]string{
+		{"/v1/users/", "/v1/users/123", "123"},
+		{"/v1/users/", "/v1/users/", ""},
+		{"/v1/users/", "/v1/users", ""},
+		{"/v1/users/", "/users/123", "123"},
+		{"/v1/users/", "123", "123"},
+		{"", "/123", "123"},
+	} {
+		got, ok := c.getRelativePath(tc[0], tc[1])
+		if !ok || got != tc[2] {
+			t.Fatalf("getRelativePath(%s, %s) returned %s, want %s", tc[0], tc[1], got, tc[2])
+		}
+	}
+}
+
+// TestHooks tests if hooks are run in the right order and if the operation is
+// aborted when hook returns an error
+func TestHooks(t *testing.T) {
+	c := NewController(nil, "gen64_")
+	calls := []string{}
+	for _, name := range []string{"first", "second"} {
+		name := name
+		c.AddHook(HookBefore, func(op int, obj interface{}) error {
+			calls = append(calls, "before_"+name)
+			return nil
+		})
+		c.AddHook(HookAfter, func(op int, obj interface{}) error {
+			calls = append(calls, "after_"+name)
+			return nil
+		})
+	}
+	c.runHooks(HookBefore, OpCreate, &TestStruct{})
+	c.runHooks(HookAfter, OpCreate, &TestStruct{})
+	if strings.Join(calls, ",") != "before_first,before_second,after_second,after_first" {
+		t.Fatalf("Hooks were run in wrong order: %v", calls)
+	}
+
+	c.AddHook(HookBefore, func(op int, obj interface{}) error {
+		if op == OpCreate {
+			return fmt.Errorf("creating is disabled")
+		}
+		return nil
+	})
+	err := c.SaveToDB(getTestStructWithData())
+	if err == nil || err.Op != "Hook" {
+		t.Fatalf("SaveToDB failed to return error from hook")
+	}
+}
+
+type testCtxKey struct{}
+
+// TestContextHooks tests if hooks and query interceptors with context get
+// context of the operation and OperationInfo
+func TestContextHooks(t *testing.T) {
+	c := NewController(nil, "gen64_")
+	infos := []OperationInfo{}
+	c.AddContextHook(HookBefore, func(ctx context.Context, info OperationInfo, obj interface{}) error {
+		if ctx.Value(testCtxKey{}) != "trace" {
+			return fmt.Errorf("hook got context without value")
+		}
+		infos = append(infos, info)
+		return fmt.Errorf("stop")
+	})
+	c.AddContextQueryInterceptor(func(ctx context.Context, info OperationInfo, query string, args []interface{}) (string, []interface{}, error) {
+		return fmt.Sprintf("/* %s %s %d */ %s", ctx.Value(testCtxKey{}), info.Model, info.Actor, query), args, nil
+	})
+
+	ctx := WithActor(context.WithValue(context.Background(), testCtxKey{}, "trace"), 3)
+	tc := c.WithContext(ctx)
+	err := tc.SaveToDB(getTestStructWithData())
+	if err == nil || err.Op != "Hook" {
+		t.Fatalf("SaveToDB failed to return error from hook")
+	}
+	if len(infos) != 1 || infos[0] != (OperationInfo{Model: "TestStruct", Tbl: "gen64_test_structs", Op: OpCreate, Actor: 3}) {
+		t.Fatalf("Hook got invalid OperationInfo: %v", infos)
+	}
+	h, _ := tc.getHelper(&TestStruct{})
+	query, _, _ := tc.interceptQuery(h, OpRead, "SELECT 1", nil)
+	if query != "/* trace TestStruct 3 */ SELECT 1" {
+		t.Fatalf("Query interceptor got invalid context or OperationInfo: %s", query)
+	}
+
+	hdl := c.GetHTTPHandler("/ctx/", testStructNewFunc, nil, nil, nil, nil, testStructListNewFunc)
+	r := httptest.NewRequest("GET", "/ctx/", nil)
+	r = WithIdentity(r.WithContext(context.WithValue(r.Context(), testCtxKey{}, "trace")), 5)
+	hdl.ServeHTTP(httptest.NewRecorder(), r)
+	if len(infos) != 2 || infos[1].Op != OpList || infos[1].Actor != 5 || infos[1].Request != r {
+		t.Fatalf("Hook got invalid OperationInfo in HTTP handler: %v", infos)
+	}
+}
+
+// TestHTTPErrorRedaction tests if full errors are passed to the error logger
+// and written to the response only in verbose mode
+func TestHTTPErrorRedaction(t *testing.T) {
+	c := NewController(nil, "gen64_")
+	c.AddQueryInterceptor(func(tbl string, op int, query string, args []interface{}) (string, []interface{}, error) {
+		return "", nil, fmt.Errorf("cannot run %s", query)
+	})
+	logged := []*ErrController{}
+	c.SetErrorLogger(func(err *ErrController) {
+		logged = append(logged, err)
+	})
+
+	for _, verbose := range []bool{false, true} {
+		c.SetVerboseErrors(verbose)
+		hdl := c.GetHTTPHandler("/redacted/", testStructNewFunc, nil, nil, nil, nil, testStructListNewFunc)
+		w := httptest.NewRecorder()
+		hdl.ServeHTTP(w, httptest.NewRequest("GET", "/redacted/", nil))
+		if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "cannot_get_from_db") {
+			t.Fatalf("GET method returned wrong response: %d %s", w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), "SELECT") != verbose {
+			t.Fatalf("GET method returned wrong error details with verbose set to %v: %s", verbose, w.Body.String())
+		}
+	}
+	if len(logged) != 2 || !strings.Contains(logged[0].Error(), "SELECT") {
+		t.Fatalf("Error logger got wrong errors: %v", logged)
+	}
+}
+
+// TestQueryInterceptors tests if query interceptors rewrite queries in order
+// and stop the query from being executed on error
+func TestQueryInterceptors(t *testing.T) {
+	c := NewController(nil, "gen64_")
+	c.AddQueryInterceptor(func(tbl string, op int, query string, args []interface{}) (string, []interface{}, error) {
+		if op == OpDelete {
+			return "", nil, fmt.Errorf("deleting is disabled")
+		}
+		return query + " AND tenant_id = $2", append(args, 7), nil
+	})
+	c.AddQueryInterceptor(func(tbl string, op int, query string, args []interface{}) (string, []interface{}, error) {
+		return "/* " + tbl + " */ " + query, args, nil
+	})
+
+	h, _ := c.getHelper(&TestStruct{})
+	query, args, err := c.interceptQuery(h, OpRead, "SELECT 1 WHERE id = $1", []interface{}{1})
+	if err != nil || query != "/* gen64_test_structs */ SELECT 1 WHERE id = $1 AND tenant_id = $2" || len(args) != 2 {
+		t.Fatalf("interceptQuery returned invalid query %s with args %v", query, args)
+	}
+
+	ts := getTestStructWithData()
+	ts.ID = 1
+	err = c.DeleteFromDB(ts)
+	if err == nil || err.Op != "QueryInterceptor" {
+		t.Fatalf("DeleteFromDB failed to return error from query interceptor")
+	}
+}
+
+// TestReturningWithQueryInterceptors tests if conditions appended by query
+// interceptors to updates and deletes are placed before RETURNING
+func TestReturningWithQueryInterceptors(t *testing.T) {
+	c := NewController(dbConn, "gen64_")
+	c.AddQueryInterceptor(func(tbl string, op int, query string, args []interface{}) (string, []interface{}, error) {
+		if op&(OpUpdate|OpDelete) != 0 {
+			return query + " AND 1 = 1", args, nil
+		}
+		return query, args, nil
+	})
+	ts := getTestStructWithData()
+	ts.ID = 0
+	err := c.SaveToDB(ts)
+	if err != nil {
+		t.Fatalf("SaveToDB failed: %s", err.Op)
+	}
+	ts.Age = 40
+	err = c.SaveToDB(ts)
+	if err != nil {
+		t.Fatalf("SaveToDB failed to update object with intercepted query: %s", err.Err.Error())
+	}
+	err = c.SaveFieldsToDB(ts, "Age")
+	if err != nil {
+		t.Fatalf("SaveFieldsToDB failed with intercepted query: %s", err.Err.Error())
+	}
+	err = c.DeleteFromDB(ts)
+	if err != nil {
+		t.Fatalf("DeleteFromDB failed with intercepted query: %s", err.Err.Error())
+	}
+}
+
+// TestDefineModel tests if model defined at runtime gets table and validation
+// just like a struct
+func TestDefineModel(t *testing.T) {
+	c := NewController(nil, "gen64_")
+	m, err := c.DefineModel(ModelSchema{
+		Name: "PluginItem",
+		Fields: []ModelField{
+			{Name: "Title", Type: "string", JSON: "title", Crud: "req lenmin:3"},
+			{Name: "Quantity", Type: "int", Crud: "valmax:10"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DefineModel failed: %s", err.Error())
+	}
+
+	h, _ := c.getHelper(m.New())
+	want := "CREATE TABLE gen64_plugin_items (plugin_item_id SERIAL PRIMARY KEY,title VARCHAR(255) DEFAULT '',quantity BIGINT DEFAULT 0)"
+	if h.GetQueryCreateTable() != want {
+		t.Fatalf("Want %v, got %v", want, h.GetQueryCreateTable())
+	}
+
+	r := m.NewRecord()
+	if r.Set("Title", "ab") != nil || r.Set("Quantity", 20) != nil {
+		t.Fatalf("Record.Set failed to set values")
+	}
+	if r.Set("Quantity", "20") == nil || r.Set("NonExisting", 1) == nil {
+		t.Fatalf("Record.Set failed to return error for invalid value or field")
+	}
+	b, failedFields, _ := c.Validate(r.Obj(), nil)
+	if b || len(failedFields) != 2 {
+		t.Fatalf("Validate returned invalid result for dynamic model: %v", failedFields)
+	}
+	if r.Map()["Title"] != "ab" || r.Get("Quantity") != 20 {
+		t.Fatalf("Record returned invalid values: %v", r.Map())
+	}
+
+	_, err = c.DefineModel(ModelSchema{Name: "Invalid", Fields: []ModelField{{Name: "Price", Type: "float"}}})
+	if err == nil {
+		t.Fatalf("DefineModel failed to return error for unsupported type")
+	}
+}
+
+// TestGetAPIVersion tests if API version is taken from the Accept header
+func TestGetAPIVersion(t *testing.T) {
+	c := NewController(nil, "")
+	r := httptest.NewRequest("GET", "/users/", nil)
+	r.Header.Set("Accept", "text/html, application/json; version=v2")
+	if c.getAPIVersion(r) != "v2" {
+		t.Fatalf("getAPIVersion failed to return version from Accept header")
+	}
+
+	hdl := c.GetVersionedHTTPHandler("/users/", testStructNewFunc, map[string]EndpointDTOs{"v1": {}}, "v1")
+	w := httptest.NewRecorder()
+	hdl.ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("GET method returned wrong status code, want %d, got %d", http.StatusNotAcceptable, w.Code)
+	}
+}
+
+// TestHTTPHandlerCompression tests if HTTP endpoint compresses responses when
+// client accepts gzip
+func TestHTTPHandlerCompression(t *testing.T) {
+	c := NewController(nil, "")
+	c.SetStrictQueryParams(true)
+	c.SetCompression(10)
+	hdl := c.GetHTTPHandler("/compressed/", testStructNewFunc, nil, nil, nil, nil, testStructListNewFunc)
+
+	r := httptest.NewRequest("GET", "/compressed/?ofset=10", nil)
+	r.Header.Set("Accept-Encoding", "deflate, gzip;q=1.0")
+	w := httptest.NewRecorder()
+	hdl.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("GET method returned uncompressed response with status code %d", w.Code)
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("GET method returned invalid gzip response: %s", err.Error())
+	}
+	b, _ := ioutil.ReadAll(gz)
+	if !strings.Contains(string(b), "unknown_param") {
+		t.Fatalf("GET method returned invalid compressed body: %s", string(b))
+	}
+
+	for enc, want := range map[string]bool{
+		"gzip;q=0":           false,
+		"gzip; q=0.0, *":     false,
+		"*;q=0.5":            true,
+		"*;q=0":              false,
+		"br, deflate":        false,
+		"GZIP;Q=0.1, br;q=1": true,
+	} {
+		r := httptest.NewRequest("GET", "/compressed/?ofset=10", nil)
+		r.Header.Set("Accept-Encoding", enc)
+		w := httptest.NewRecorder()
+		hdl.ServeHTTP(w, r)
+		if (w.Header().Get("Content-Encoding") == "gzip") != want {
+			t.Fatalf("GET method with Accept-Encoding %q returned wrong Content-Encoding %q", enc, w.Header().Get("Content-Encoding"))
+		}
+	}
+
+	w = httptest.NewRecorder()
+	cw := newCompressWriter(w, r, 1)
+	f, ok := cw.(http.Flusher)
+	if !ok {
+		t.Fatalf("compressWriter does not implement http.Flusher")
+	}
+	cw.Write([]byte("streamed"))
+	f.Flush()
+	if !w.Flushed {
+		t.Fatalf("compressWriter did not flush underlying writer")
+	}
+	gz, err = gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("compressWriter flushed invalid gzip data: %s", err.Error())
+	}
+	b = make([]byte, 8)
+	if _, err := io.ReadFull(gz, b); err != nil || string(b) != "streamed" {
+		t.Fatalf("compressWriter did not flush compressed data, got %q", string(b))
+	}
+}
+
+// TestMountEndpoints tests if endpoints mounted with MountEndpoints reject
+// operations that are not allowed and requests that fail auth
+func TestMountEndpoints(t *testing.T) {
+	c := NewController(nil, "")
+	mux := http.NewServeMux()
+	err := c.MountEndpoints([]Endpoint{
+		{
+			Path:  "/v1/read_only/",
+			Model: testStructNewFunc,
+			Ops:   OpRead | OpList,
+			DTOs:  EndpointDTOs{List: testStructListNewFunc},
+		},
+		{
+			Path:  "/v1/private/",
+			Model: testStructNewFunc,
+			Auth: func(r *http.Request, op int) bool {
+				return r.Header.Get("Authorization") != ""
+			},
+		},
+	}, mux)
+	if err != nil {
+		t.Fatalf("MountEndpoints failed: %s", err.Op)
+	}
+
+	for _, tc := range []struct {
+		method string
+		uri    string
+		status int
+	}{
+		{"DELETE", "/v1/read_only/1", http.StatusMethodNotAllowed},
+		{"PUT", "/v1/read_only/", http.StatusMethodNotAllowed},
+		{"GET", "/v1/private/1", http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(tc.method, tc.uri, nil))
+		if w.Code != tc.status {
+			t.Fatalf("%s %s returned wrong status code, want %d, got %d", tc.method, tc.uri, tc.status, w.Code)
+		}
+	}
+}
+
+// TestShareToken tests if share tokens are verified and grant read access in
+// endpoints with Share
+func TestShareToken(t *testing.T) {
+	type TestOther struct {
+		ID   int64
+		Name string
+	}
+	c := NewController(nil, "")
+	c.SetClock(testClock{now: time.Unix(1000, 0)})
+	_, err := c.GetShareToken(&TestStruct{ID: 5}, time.Hour)
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("GetShareToken failed to require share secret")
+	}
+	c.SetShareSecret("s3cret")
+	token, err := c.GetShareToken(&TestStruct{ID: 5}, time.Hour)
+	if err != nil {
+		t.Fatalf("GetShareToken failed: %s", err.Op)
+	}
+	if !c.VerifyShareToken(&TestStruct{}, 5, token) || c.VerifyShareToken(&TestStruct{}, 6, token) || c.VerifyShareToken(&TestOther{}, 5, token) {
+		t.Fatalf("VerifyShareToken failed to verify ID and model")
+	}
+	if c.VerifyShareToken(&TestStruct{}, 5, strings.Replace(token, ".4600.", ".4601.", 1)) {
+		t.Fatalf("VerifyShareToken accepted token with modified expiry")
+	}
+
+	e := Endpoint{
+		Path:  "/v1/items/",
+		Model: testStructNewFunc,
+		Share: true,
+		Auth: func(r *http.Request, op int) bool {
+			return false
+		},
+	}
+	hdl := c.getEndpointHandler(e, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("include") != "" || r.URL.Query().Get("join") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	for _, tc := range []struct {
+		method string
+		uri    string
+		status int
+	}{
+		{"GET", "/v1/items/5?share_token=" + token, http.StatusOK},
+		{"GET", "/v1/items/5?include=author&join=tags&share_token=" + token, http.StatusOK},
+		{"GET", "/v1/items/6?share_token=" + token, http.StatusUnauthorized},
+		{"DELETE", "/v1/items/5?share_token=" + token, http.StatusUnauthorized},
+		{"GET", "/v1/items/5", http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		hdl.ServeHTTP(w, httptest.NewRequest(tc.method, tc.uri, nil))
+		if w.Code != tc.status {
+			t.Fatalf("%s %s returned wrong status code, want %d, got %d", tc.method, tc.uri, tc.status, w.Code)
+		}
+	}
+
+	// Objects with formatted IDs are shared by them
+	type TestInvoice struct {
+		ID int64 `crud:"idprefix:INV- idpad:4"`
+	}
+	invoiceToken, _ := c.GetShareToken(&TestInvoice{ID: 7}, time.Hour)
+	e.Path = "/v1/invoices/"
+	e.Model = func() interface{} { return &TestInvoice{} }
+	hdl = c.getEndpointHandler(e, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", "/v1/invoices/INV-0007?share_token="+invoiceToken, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET method returned wrong status code for formatted ID, got %d", w.Code)
+	}
+
+	c.SetClock(testClock{now: time.Unix(5000, 0)})
+	if c.VerifyShareToken(&TestStruct{}, 5, token) {
+		t.Fatalf("VerifyShareToken accepted expired token")
+	}
+}
+
+// TestGetListParams tests if query string of HTTP list request is parsed
+// properly, with repeated filters turned into list of values
+func TestGetListParams(t *testing.T) {
+	c := NewController(nil, "")
+	r := httptest.NewRequest("GET", "/list/?limit=5&order=age&order_direction=desc&filter_age=30&filter_age=40&filter_first_name=J%C3%B3zef", nil)
+
+	params, err := c.GetListParams(r, &TestStruct{})
+	if err != nil {
+		t.Fatalf("GetListParams failed: %s", err.Op)
+	}
+	if params.Limit != 5 || params.Offset != 0 || len(params.Order) != 2 || params.Order[1] != "desc" {
+		t.Fatalf("GetListParams returned invalid limit, offset or order: %v", params)
+	}
+	ages, ok := params.Filters["Age"].([]interface{})
+	if !ok || len(ages) != 2 || ages[0].(int) != 30 || ages[1].(int) != 40 {
+		t.Fatalf("GetListParams returned invalid repeated filter: %v", params.Filters["Age"])
+	}
+	if params.Count {
+		t.Fatalf("GetListParams set count without count parameter")
+	}
+	if params.Filters["FirstName"] != "Józef" {
+		t.Fatalf("GetListParams returned invalid encoded filter: %v", params.Filters["FirstName"])
+	}
+
+	r = httptest.NewRequest("GET", "/list/?filter_age_gt=30&filter_age_lte=40&filter_price_in=1,2,3&filter_last_name_like=Kow%25", nil)
+	params, err = c.GetListParams(r, &TestStruct{})
+	if err != nil {
+		t.Fatalf("GetListParams failed: %s", err.Op)
+	}
+	want := map[string]interface{}{
+		"Age":      []FilterCondition{{Operator: ">", Value: 30}, {Operator: "<=", Value: 40}},
+		"Price":    []FilterCondition{{Operator: "IN", Value: []interface{}{1, 2, 3}}},
+		"LastName": []FilterCondition{{Operator: "LIKE", Value: "Kow%"}},
+	}
+	if !reflect.DeepEqual(params.Filters, want) {
+		t.Fatalf("GetListParams returned invalid filters with operators: %v", params.Filters)
+	}
+	_, err = c.GetListParams(httptest.NewRequest("GET", "/list/?filter_age_gt=abc", nil), &TestStruct{})
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("GetListParams failed to return error for invalid value of filter with operator")
+	}
+}
+
+// TestHTTPHandlerStrictQueryParams tests if HTTP endpoint in strict query
+// parameters mode rejects list requests with unknown parameters
+func TestHTTPHandlerStrictQueryParams(t *testing.T) {
+	c := NewController(nil, "")
+	c.SetStrictQueryParams(true)
+	hdl := c.GetHTTPHandler("/strict/", testStructNewFunc, nil, nil, nil, nil, testStructListNewFunc)
+
+	for _, q := range []string{"ofset=10", "limit=10&filter_nonexisting=1"} {
+		w := httptest.NewRecorder()
+		hdl.ServeHTTP(w, httptest.NewRequest("GET", "/strict/?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("GET method returned wrong status code for %s, want %d, got %d", q, http.StatusBadRequest, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "unknown_param") {
+			t.Fatalf("GET method returned wrong error for %s: %s", q, w.Body.String())
+		}
+	}
+}
+
+// TestHTTPHandlerInclude tests if HTTP handler rejects relations that have not
+// been registered
+func TestHTTPHandlerInclude(t *testing.T) {
+	c := NewController(nil, "")
+	err := c.AddRelation(testStructNewFunc(), "created_by", "PrimaryEmail", testStructNewFunc)
+	if err == nil || err.Op != "InvalidField" {
+		t.Fatalf("AddRelation should fail on field that is not an int64")
+	}
+	err = c.AddRelation(testStructNewFunc(), "created_by", "CreatedByUserID", testStructNewFunc)
+	if err != nil {
+		t.Fatalf("AddRelation failed: %s", err.Op)
+	}
+	hdl := c.GetHTTPHandler("/include/", testStructNewFunc, nil, testStructReadNewFunc, nil, nil, testStructListNewFunc)
+
+	for _, q := range []string{"/include/?include=user", "/include/?include=created_by,user", "/include/1?include=user"} {
+		w := httptest.NewRecorder()
+		hdl.ServeHTTP(w, httptest.NewRequest("GET", q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("GET method returned wrong status code for %s, want %d, got %d", q, http.StatusBadRequest, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "invalid_include") {
+			t.Fatalf("GET method returned wrong error for %s: %s", q, w.Body.String())
+		}
+	}
+}
+
+// TestFieldFormatter tests if fields with formatters are formatted for locale
+// of the request
+func TestFieldFormatter(t *testing.T) {
+	type Event struct {
+		ID        int64  `json:"event_id"`
+		Name      string `json:"name"`
+		StartedAt int64  `json:"started_at"`
+	}
+	c := NewController(nil, "")
+	err := c.SetFieldFormatter(&Event{}, "NonExisting", nil)
+	if err == nil || err.Op != "InvalidField" {
+		t.Fatalf("SetFieldFormatter should fail on invalid field")
+	}
+	err = c.SetFieldFormatter(&Event{}, "StartedAt", func(v interface{}, locale string) interface{} {
+		layout := "2006-01-02"
+		if locale == "en-US" {
+			layout = "01/02/2006"
+		}
+		return time.Unix(v.(int64), 0).UTC().Format(layout)
+	})
+	if err != nil {
+		t.Fatalf("SetFieldFormatter failed: %s", err.Op)
+	}
+
+	r := httptest.NewRequest("GET", "/events/", nil)
+	r.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	xobj, err := c.getResponseItems(r, []interface{}{&Event{ID: 1, Name: "a", StartedAt: 86400}}, nil)
+	if err != nil {
+		t.Fatalf("getResponseItems failed: %s", err.Op)
+	}
+	m := xobj[0].(map[string]interface{})
+	if m["started_at"] != "01/02/1970" || m["name"] != "a" {
+		t.Fatalf("getResponseItems returned invalid item: %v", m)
+	}
+}
+
+// TestGetHTTPRequestOp tests if operations of HTTP requests are recognized,
+// with validation being the write that it checks
+func TestGetHTTPRequestOp(t *testing.T) {
+	c := NewController(nil, "")
+	ops := map[string]int{
+		"GET /notes/":              OpList,
+		"GET /notes/1":             OpRead,
+		"PUT /notes/":              OpCreate,
+		"PUT /notes/1":             OpUpdate,
+		"PUT /notes/validate":      OpCreate,
+		"PUT /notes/validate?id=1": OpUpdate,
+		"DELETE /notes/1":          OpDelete,
+		"POST /notes/":             0,
+	}
+	for k, want := range ops {
+		xs := strings.SplitN(k, " ", 2)
+		if got := c.getHTTPRequestOp("/notes/", httptest.NewRequest(xs[0], xs[1], nil)); got != want {
+			t.Fatalf("getHTTPRequestOp returned wrong operation for %s, want %d, got %d", k, want, got)
+		}
+	}
+}
+
+// TestJSONNaming tests if keys of objects in responses are converted to
+// camelCase
+func TestJSONNaming(t *testing.T) {
+	names := map[string]string{"first_name": "firstName", "FirstName": "firstName", "ID": "id", "URLPath": "urlPath", "test_struct_id": "testStructId", "age": "age"}
+	for k, want := range names {
+		if got := getCamelCaseName(k); got != want {
+			t.Fatalf("getCamelCaseName returned wrong name for %s, want %s, got %s", k, want, got)
+		}
+	}
+
+	c := NewController(nil, "")
+	c.SetJSONNaming(JSONNamingCamelCase)
+	r := httptest.NewRequest("GET", "/test_structs/", nil)
+	xobj, err := c.getResponseItems(r, []interface{}{&TestStruct{ID: 3, FirstName: "John"}}, nil)
+	if err != nil {
+		t.Fatalf("getResponseItems failed: %s", err.Op)
+	}
+	m := xobj[0].(map[string]interface{})
+	if m["firstName"] != "John" || m["testStructId"] != int64(3) || m["first_name"] != nil {
+		t.Fatalf("getResponseItems returned invalid item: %v", m)
+	}
+
+	type Address struct {
+		PostCode string `json:"post_code"`
+	}
+	type Customer struct {
+		ID        int64             `json:"customer_id"`
+		Address   Address           `json:"home_address" crud:"jsonb"`
+		Addresses []*Address        `json:"other_addresses" crud:"jsonb"`
+		Labels    map[string]string `json:"labels" crud:"jsonb"`
+	}
+	obj := &Customer{ID: 1, Address: Address{PostCode: "a"}, Addresses: []*Address{{PostCode: "b"}}, Labels: map[string]string{"label_name": "c"}}
+	xobj, err = c.getResponseItems(r, []interface{}{obj}, nil)
+	if err != nil {
+		t.Fatalf("getResponseItems failed: %s", err.Op)
+	}
+	b, _ := json.Marshal(xobj[0])
+	want := `{"customerId":1,"homeAddress":{"postCode":"a"},"labels":{"label_name":"c"},"otherAddresses":[{"postCode":"b"}]}`
+	if string(b) != want {
+		t.Fatalf("getResponseItems returned invalid nested keys, want %s, got %s", want, string(b))
+	}
+
+	got := &Customer{}
+	err2 := c.unmarshalRequestBody(JSONSerializer{}, b, got)
+	if err2 != nil || !reflect.DeepEqual(got, obj) {
+		t.Fatalf("unmarshalRequestBody failed to decode camelCase keys: %v", got)
+	}
+	got = &Customer{}
+	err2 = c.unmarshalRequestBody(JSONSerializer{}, []byte(`{"customer_id":2,"customerId":3}`), got)
+	if err2 != nil || got.ID != 2 {
+		t.Fatalf("unmarshalRequestBody failed to keep value under JSON name: %v", got)
+	}
+}
+
+// TestOrderedObject tests if objects converted to maps are written with keys
+// in the order of struct fields
+func TestOrderedObject(t *testing.T) {
+	type Event struct {
+		ID        int64  `json:"id"`
+		Name      string `json:"name"`
+		StartedAt int64  `json:"started_at"`
+		Area      string `json:"area"`
+	}
+	c := NewController(nil, "")
+	c.SetFieldFormatter(&Event{}, "StartedAt", func(v interface{}, locale string) interface{} {
+		return "1970-01-02"
+	})
+	r := httptest.NewRequest("GET", "/events/", nil)
+	xobj := []interface{}{&Event{ID: 1, Name: "a", StartedAt: 86400, Area: "b"}}
+	items, err := c.getResponseItems(r, xobj, nil)
+	if err != nil {
+		t.Fatalf("getResponseItems failed: %s", err.Op)
+	}
+	items[0].(map[string]interface{})["extra"] = 1
+	b, _ := json.Marshal(c.getOrderedItems(xobj, items, nil))
+	if string(b) != `[{"id":1,"name":"a","started_at":"1970-01-02","area":"b","extra":1}]` {
+		t.Fatalf("getOrderedItems returned keys in invalid order: %s", string(b))
+	}
+
+	c.SetJSONNaming(JSONNamingCamelCase)
+	items, _ = c.getResponseItems(r, xobj, nil)
+	b, _ = json.Marshal(c.getOrderedItems(xobj, items, nil))
+	if string(b) != `[{"id":1,"name":"a","startedAt":"1970-01-02","area":"b"}]` {
+		t.Fatalf("getOrderedItems returned camelCase keys in invalid order: %s", string(b))
+	}
+}
+
+// TestTypedResponses tests if typed responses are written with the same
+// envelope as HTTPResponse
+func TestTypedResponses(t *testing.T) {
+	c := NewController(nil, "")
+	total := int64(25)
+	for _, tc := range []struct {
+		r    interface{}
+		want string
+	}{
+		{NewItemResponse(map[string]interface{}{"name": "a"}), `{"ok":1,"err_text":"","data":{"item":{"name":"a"}}}`},
+		{NewListResponse([]interface{}{1, 2}, nil), `{"ok":1,"err_text":"","data":{"items":[1,2]}}`},
+		{NewListResponse([]interface{}{1, 2}, &total), `{"ok":1,"err_text":"","data":{"items":[1,2],"total_items":25}}`},
+		{NewIDResponse(7), `{"ok":1,"err_text":"","data":{"id":7}}`},
+	} {
+		w := httptest.NewRecorder()
+		c.writeResponse(w, http.StatusOK, tc.r)
+		if w.Body.String() != tc.want {
+			t.Fatalf("writeResponse wrote invalid body, want %s, got %s", tc.want, w.Body.String())
+		}
+	}
+
+	b, err := MsgpackSerializer{}.Marshal(NewListResponse([]interface{}{1}, &total))
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	r := NewHTTPResponse(0, "")
+	err = MsgpackSerializer{}.Unmarshal(b, &r)
+	if err != nil || r.OK != 1 || r.Data["total_items"] == nil || r.Data["items"] == nil {
+		t.Fatalf("ListResponse has invalid keys in MessagePack: %v", r)
+	}
+}
+
+// TestConcurrentUse tests if Controller can be shared by goroutines which
+// create Helpers lazily, and should be run with -race
+func TestConcurrentUse(t *testing.T) {
+	c := NewController(nil, "")
+	r := httptest.NewRequest("GET", "/list/", nil)
+	newObjFuncs := []func() interface{}{
+		func() interface{} { return getTestStructWithData() },
+		func() interface{} { return &TestStruct_Read{} },
+		func() interface{} { return &TestStruct_List{} },
+	}
+	var wg sync.WaitGroup
+	errs := make(chan string, 60)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for _, f := range newObjFuncs {
+				obj := f()
+				if _, err := c.getHelper(obj); err != nil {
+					errs <- err.Error()
+					return
+				}
+				c.GetModelFieldInterfaces(obj)
+				items, err := c.getResponseItems(r, []interface{}{obj}, nil)
+				if err != nil || len(c.getOrderedItems([]interface{}{obj}, items, nil)) != 1 {
+					errs <- fmt.Sprintf("getResponseItems failed in goroutine %d", i)
+					return
+				}
+			}
+			if b, _, _ := c.Validate(getTestStructWithData(), nil); !b {
+				errs <- fmt.Sprintf("Validate failed in goroutine %d", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Fatal(e)
+	}
+	if len(c.modelHelpers) != 3 {
+		t.Fatalf("Controller has invalid number of Helpers: %d", len(c.modelHelpers))
+	}
+}
+
+// TestJSONAliases tests if request bodies with aliases of fields set with
+// "jsonalias" tag are accepted
+func TestJSONAliases(t *testing.T) {
+	type Customer struct {
+		ID       int64  `json:"customer_id"`
+		FullName string `json:"full_name" crud:"jsonalias:name jsonalias:fullname"`
+		Visits   int64  `json:"visits"`
+	}
+	c := NewController(nil, "")
+	for _, ser := range []Serializer{JSONSerializer{}, MsgpackSerializer{}} {
+		body, _ := ser.Marshal(map[string]interface{}{"name": "John", "visits": int64(9007199254740993)})
+		obj := &Customer{}
+		err := ser.Unmarshal(c.replaceJSONAliases(obj, ser, body), obj)
+		if err != nil || obj.FullName != "John" || obj.Visits != 9007199254740993 {
+			t.Fatalf("replaceJSONAliases returned invalid body for %s: %v", ser.ContentType(), obj)
+		}
+	}
+
+	obj := &Customer{}
+	json.Unmarshal(c.replaceJSONAliases(obj, JSONSerializer{}, []byte(`{"name":"Old","full_name":"New"}`)), obj)
+	if obj.FullName != "New" {
+		t.Fatalf("replaceJSONAliases should keep value under JSON name, got %s", obj.FullName)
+	}
+}
+
+// TestJSONTagOptions tests if fields with `json:"-"` are never written and
+// fields with omitempty are omitted, also when they have formatters
+func TestJSONTagOptions(t *testing.T) {
+	type Account struct {
+		ID     int64  `json:"account_id"`
+		Secret string `json:"-"`
+		Note   string `json:"note,omitempty"`
+		Dash   string `json:"-,"`
+	}
+	c := NewController(nil, "")
+	upper := func(v interface{}, locale string) interface{} {
+		return strings.ToUpper(v.(string))
+	}
+	for _, f := range []string{"Secret", "Note", "Dash"} {
+		c.SetFieldFormatter(&Account{}, f, upper)
+	}
+	r := httptest.NewRequest("GET", "/accounts/", nil)
+	xobj, err := c.getResponseItems(r, []interface{}{&Account{ID: 1, Secret: "s", Dash: "d"}}, nil)
+	if err != nil {
+		t.Fatalf("getResponseItems failed: %s", err.Op)
+	}
+	m := xobj[0].(map[string]interface{})
+	_, hasNote := m["note"]
+	if len(m) != 2 || hasNote || m["-"] != "D" {
+		t.Fatalf("getResponseItems returned invalid item: %v", m)
+	}
+
+	src, err := c.GenerateTSClient([]Endpoint{{Path: "/accounts/", Model: func() interface{} { return &Account{} }}})
+	if err != nil {
+		t.Fatalf("GenerateTSClient failed: %s", err.Op)
+	}
+	if strings.Contains(src, "Secret") || strings.Contains(src, "secret") || !strings.Contains(src, `"note"?: string;`) || !strings.Contains(src, `"-": string;`) {
+		t.Fatalf("GenerateTSClient returned invalid interface:\n%s", src)
+	}
+}
+
+type testTemperature struct {
+	ID      int64
+	Celsius int
+}
+
+func (t testTemperature) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"id": t.ID, "fahrenheit": t.Celsius*9/5 + 32})
+}
+
+func (t *testTemperature) UnmarshalJSON(b []byte) error {
+	m := map[string]int{}
+	err := json.Unmarshal(b, &m)
+	t.Celsius = (m["fahrenheit"] - 32) * 5 / 9
+	return err
+}
+
+// TestCustomJSONMarshaler tests if models implementing json.Marshaler and
+// json.Unmarshaler are encoded and decoded with them in all formats
+func TestCustomJSONMarshaler(t *testing.T) {
+	c := NewController(nil, "")
+	r := httptest.NewRequest("GET", "/temperatures/", nil)
+	r.Header.Set("Accept", "application/msgpack")
+	xobj, err := c.withResponseSerializer(r).getResponseItems(r, []interface{}{&testTemperature{ID: 1, Celsius: 100}}, nil)
+	if err != nil {
+		t.Fatalf("getResponseItems failed: %s", err.Op)
+	}
+	m := xobj[0].(map[string]interface{})
+	if m["fahrenheit"] != int64(212) {
+		t.Fatalf("getResponseItems returned item without custom JSON encoding: %v", m)
+	}
+
+	body, _ := MsgpackSerializer{}.Marshal(map[string]interface{}{"fahrenheit": 212})
+	obj := &testTemperature{}
+	err2 := c.unmarshalRequestBody(MsgpackSerializer{}, body, obj)
+	if err2 != nil || obj.Celsius != 100 {
+		t.Fatalf("unmarshalRequestBody failed to use custom JSON decoding: %v", obj)
+	}
+}
+
+// TestMetrics tests if metrics of operations are collected and returned by
+// the HTTP handler
+func TestMetrics(t *testing.T) {
+	c := NewController(nil, "")
+	hdl := c.GetMetricsHTTPHandler()
+	w := httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Metrics handler returned wrong status code when disabled, want %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	c.EnableMetrics()
+	hdl = c.GetMetricsHTTPHandler()
+	h, _ := c.getHelper(testStructNewFunc())
+	for i := 1; i <= 20; i++ {
+		c.metrics.record(h.dbTbl, OpList, time.Duration(i)*time.Millisecond, nil)
+	}
+	c.metrics.record(h.dbTbl, OpCreate, time.Millisecond, fmt.Errorf("failed"))
+
+	m := c.GetMetrics()[h.dbTbl]
+	if m["list"].Count != 20 || m["list"].P50 != 10 || m["list"].P95 != 19 {
+		t.Fatalf("GetMetrics returned invalid list metrics: %v", m["list"])
+	}
+	if m["create"].Count != 1 || m["create"].Errors != 1 {
+		t.Fatalf("GetMetrics returned invalid create metrics: %v", m["create"])
+	}
+
+	w = httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"p95_ms":19`) {
+		t.Fatalf("Metrics handler returned invalid response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+// TestPoolWarning tests if waits for connections are reported with the
+// right reason
+func TestPoolWarning(t *testing.T) {
+	m := &poolMonitor{threshold: 100 * time.Millisecond}
+	if w := m.check(sql.DBStats{}); w != nil {
+		t.Fatalf("check returned warning when there were no waits")
+	}
+	w := m.check(sql.DBStats{MaxOpenConnections: 2, InUse: 2, WaitCount: 4, WaitDuration: 40 * time.Millisecond})
+	if w == nil || w.Reason != PoolExhausted || w.Waits != 4 || w.AvgWait != 10*time.Millisecond || w.Stats.InUse != 2 || w.Stats.WaitDuration != 40 {
+		t.Fatalf("check returned invalid warning: %v", w)
+	}
+	if w := m.check(sql.DBStats{WaitCount: 4, WaitDuration: 40 * time.Millisecond}); w != nil {
+		t.Fatalf("check returned warning when there were no new waits")
+	}
+	w = m.check(sql.DBStats{WaitCount: 5, WaitDuration: 240 * time.Millisecond})
+	if w == nil || w.Reason != PoolLongWait || w.Waits != 1 || w.AvgWait != 200*time.Millisecond {
+		t.Fatalf("check returned invalid warning: %v", w)
+	}
+
+	if NewController(nil, "").GetPoolStats() != nil {
+		t.Fatalf("GetPoolStats returned stats of controller without connection")
+	}
+}
+
+// TestIdentityFields tests if fields with "createdby" and "updatedby" tags are
+// set to the identity attached to the request
+func TestIdentityFields(t *testing.T) {
+	type Audited struct {
+		ID        int64
+		Name      string
+		CreatedBy int64 `crud:"createdby"`
+		UpdatedBy int64 `crud:"updatedby"`
+	}
+	type AuditedInvalid struct {
+		ID        int64
+		CreatedBy string `crud:"createdby"`
+	}
+	c := NewController(nil, "")
+	_, err := c.getHelper(&AuditedInvalid{})
+	if err == nil {
+		t.Fatalf("getHelper should fail on createdby field that is not an int64")
+	}
+
+	r := WithIdentity(httptest.NewRequest("PUT", "/audited/", nil), 7)
+	if GetIdentity(r) != 7 {
+		t.Fatalf("GetIdentity returned wrong value, want 7, got %d", GetIdentity(r))
+	}
+
+	obj := &Audited{CreatedBy: 3, UpdatedBy: 3}
+	c.setIdentityFields(obj, OpCreate, GetIdentity(r), nil)
+	if obj.CreatedBy != 7 || obj.UpdatedBy != 7 {
+		t.Fatalf("setIdentityFields set wrong values on create: %v", obj)
+	}
+	obj.CreatedBy = 9
+	c.setIdentityFields(obj, OpUpdate, 8, map[string]interface{}{"CreatedBy": int64(7)})
+	if obj.CreatedBy != 7 || obj.UpdatedBy != 8 {
+		t.Fatalf("setIdentityFields set wrong values on update: %v", obj)
+	}
+	obj.UpdatedBy = 9
+	c.setIdentityFields(obj, OpUpdate, 0, map[string]interface{}{"CreatedBy": int64(7), "UpdatedBy": int64(8)})
+	if obj.CreatedBy != 7 || obj.UpdatedBy != 8 {
+		t.Fatalf("setIdentityFields changed updatedby field on update without identity: %v", obj)
+	}
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c testClock) Now() time.Time {
+	return c.now
+}
+
+// TestClock tests if timestamps are taken from the clock set on controller
+func TestClock(t *testing.T) {
+	type Session struct {
+		ID        int64
+		CreatedAt int64 `crud:"createdat"`
+		UpdatedAt int64 `crud:"updatedat"`
+		ExpiresAt int64 `crud:"expires"`
+	}
+	c := NewController(nil, "")
+	c.SetClock(testClock{now: time.Unix(1000, 0)})
+	h, err := c.getHelper(&Session{})
+	if err != nil {
+		t.Fatalf("getHelper failed: %s", err.Op)
+	}
+
+	obj := &Session{}
+	c.setTimestampFields(h, obj, OpCreate)
+	if obj.CreatedAt != 1000 || obj.UpdatedAt != 1000 {
+		t.Fatalf("setTimestampFields set wrong values on create: %v", obj)
+	}
+	c.SetClock(testClock{now: time.Unix(2000, 0)})
+	c.setTimestampFields(h, obj, OpUpdate)
+	if obj.CreatedAt != 1000 || obj.UpdatedAt != 2000 {
+		t.Fatalf("setTimestampFields set wrong values on update: %v", obj)
+	}
+	args := c.getExpiresArgs(h)
+	if len(args) != 1 || args[0] != int64(2000) {
+		t.Fatalf("getExpiresArgs returned wrong args: %v", args)
+	}
+}
+
+// TestDescribe tests if model description contains fields with validation
+// rules, relations and endpoints
+func TestDescribe(t *testing.T) {
+	c := NewController(nil, "gen64_")
+	c.AddRelation(&TestStruct{}, "created_by", "CreatedByUserID", testStructNewFunc)
+	c.MountEndpoints([]Endpoint{{Path: "/describe/", Model: testStructNewFunc, Ops: OpRead}}, http.NewServeMux())
+
+	d, err := c.Describe(&TestStruct{})
+	if err != nil {
+		t.Fatalf("Describe failed: %s", err.Op)
+	}
+	if d.Name != "TestStruct" || d.Tbl != "gen64_test_structs" || len(d.Fields) == 0 || d.Fields[0].Name != "ID" {
+		t.Fatalf("Describe returned invalid model: %v", d)
+	}
+	var age *FieldDescription
+	for i := range d.Fields {
+		if d.Fields[i].Name == "Age" {
+			age = &d.Fields[i]
+		}
+	}
+	if age == nil || age.Column != "age" || age.Type != "int" || !age.Required || age.ValMax == nil || *age.ValMax != 120 || age.ValMin != nil {
+		t.Fatalf("Describe returned invalid field: %v", age)
+	}
+	if len(d.Relations) != 1 || d.Relations[0].Name != "created_by" || d.Relations[0].Tbl != "gen64_test_structs" {
+		t.Fatalf("Describe returned invalid relations: %v", d.Relations)
+	}
+	if len(d.Endpoints) != 1 || d.Endpoints[0].Path != "/describe/" || d.Endpoints[0].Ops != OpRead {
+		t.Fatalf("Describe returned invalid endpoints: %v", d.Endpoints)
+	}
+}
+
+// TestFlagNames tests if named flags can be set and checked in flags fields
+// and are present in model description
+func TestFlagNames(t *testing.T) {
+	type Account struct {
+		ID          int64
+		Flags       int64
+		Permissions int64 `crud:"flags"`
+		Age         int64
+	}
+	c := NewController(nil, "")
+	err := c.SetFlagNames(&Account{}, "Flags", map[string]int64{"verified": 1, "banned": 4})
+	if err != nil {
+		t.Fatalf("SetFlagNames failed: %s", err.Error())
+	}
+	err = c.SetFlagNames(&Account{}, "Permissions", map[string]int64{"admin": 1, "editor": 2})
+	if err != nil {
+		t.Fatalf("SetFlagNames failed: %s", err.Error())
+	}
+	err = c.SetFlagNames(&Account{}, "Age", map[string]int64{"adult": 1})
+	if err == nil || err.Op != "InvalidField" {
+		t.Fatalf("SetFlagNames failed to return error for field that is not a flags field")
+	}
+	err = c.SetFlagNames(&Account{}, "Permissions", map[string]int64{"viewer": 3})
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("SetFlagNames failed to return error for value that is not a power of two")
+	}
+	err = c.SetFlagNames(&Account{}, "Permissions", map[string]int64{"verified": 4})
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("SetFlagNames failed to return error for name of flag of another field")
+	}
+
+	a := &Account{Flags: 2}
+	c.SetFlag(a, "verified", true)
+	c.SetFlag(a, "admin", true)
+	c.SetFlag(a, "editor", true)
+	c.SetFlag(a, "editor", false)
+	if a.Flags != 3 || a.Permissions != 1 {
+		t.Fatalf("SetFlag failed to set flags: %d %d", a.Flags, a.Permissions)
+	}
+	has, err := c.HasFlag(a, "verified")
+	if err != nil || !has {
+		t.Fatalf("HasFlag returned invalid value for flag that is set")
+	}
+	has, err = c.HasFlag(a, "banned")
+	if err != nil || has {
+		t.Fatalf("HasFlag returned invalid value for flag that is not set")
+	}
+	_, err = c.HasFlag(a, "unknown")
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("HasFlag failed to return error for unknown flag")
+	}
+
+	d, err := c.Describe(&Account{})
+	if err != nil {
+		t.Fatalf("Describe failed: %s", err.Op)
+	}
+	for _, f := range d.Fields {
+		if f.Name == "Permissions" && (len(f.Flags) != 2 || f.Flags["editor"] != 2) {
+			t.Fatalf("Describe returned invalid flags: %v", f.Flags)
+		}
+		if f.Name == "Age" && f.Flags != nil {
+			t.Fatalf("Describe returned flags for field that is not a flags field: %v", f.Flags)
+		}
+	}
+}
+
+// TestGenerateClient tests if generated clients have methods only for allowed
+// operations and Go client source is valid
+func TestGenerateClient(t *testing.T) {
+	c := NewController(nil, "gen64_")
+	endpoints := []Endpoint{{Path: "/test_structs/", Model: testStructNewFunc, Ops: OpRead | OpList}}
+
+	src, err := c.GenerateGoClient("client", endpoints)
+	if err != nil {
+		t.Fatalf("GenerateGoClient failed: %s", err.Error())
+	}
+	_, err2 := parser.ParseFile(token.NewFileSet(), "client.go", src, 0)
+	if err2 != nil {
+		t.Fatalf("GenerateGoClient returned invalid source: %s", err2.Error())
+	}
+	if !strings.Contains(src, "func (c *Client) GetTestStruct(id int64) (*TestStruct, error)") || !strings.Contains(src, "Age ") || strings.Contains(src, "DeleteTestStruct") {
+		t.Fatalf("GenerateGoClient returned source with invalid methods:\n%s", src)
+	}
+
+	src, err = c.GenerateTSClient(endpoints)
+	if err != nil {
+		t.Fatalf("GenerateTSClient failed: %s", err.Error())
+	}
+	if !strings.Contains(src, "listTestStruct(") || !strings.Contains(src, `"age": number;`) || strings.Contains(src, "createTestStruct") {
+		t.Fatalf("GenerateTSClient returned source with invalid methods:\n%s", src)
+	}
+
+	_, err = c.GenerateGoClient("client", append(endpoints, Endpoint{Path: "/test_structs2/", Model: testStructNewFunc}))
+	if err == nil {
+		t.Fatalf("GenerateGoClient failed to return error for duplicated operations")
+	}
+}
+
+type testSerializer struct {
+	JSONSerializer
+}
+
+func (testSerializer) ContentType() string {
+	return "application/x-test"
+}
+
+func (testSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.MarshalIndent(v, "", "\t")
+}
+
+// TestGetObjectMap tests if numbers in objects converted to maps are not
+// rounded and are written as numbers by other serializers
+func TestGetObjectMap(t *testing.T) {
+	type TestBigID struct {
+		ID    int64   `json:"id"`
+		Price float64 `json:"price"`
+	}
+	c := NewController(nil, "")
+	m, err := c.getObjectMap(&TestBigID{ID: 9007199254740993, Price: 1.5})
+	if err != nil || m["id"] != int64(9007199254740993) || m["price"] != 1.5 {
+		t.Fatalf("getObjectMap returned invalid map: %v", m)
+	}
+	b, _ := MsgpackSerializer{}.Marshal(m)
+	obj := &TestBigID{}
+	err2 := MsgpackSerializer{}.Unmarshal(b, obj)
+	if err2 != nil || obj.ID != 9007199254740993 {
+		t.Fatalf("Map was not marshaled with numbers: %v", err2)
+	}
+}
+
+// TestSerializer tests if responses are marshaled with serializer set on
+// controller
+func TestSerializer(t *testing.T) {
+	c := NewController(nil, "")
+	c.SetSerializer(testSerializer{})
+	hdl := c.GetHTTPHandler("/serialized/", testStructNewFunc, nil, nil, nil, nil, testStructListNewFunc)
+
+	w := httptest.NewRecorder()
+	hdl.ServeHTTP(w, httptest.NewRequest("GET", "/serialized/?include=user", nil))
+	if w.Header().Get("Content-Type") != "application/x-test" {
+		t.Fatalf("GET method returned wrong Content-Type: %s", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "\n\t\"err_text\": \"invalid_include\"") {
+		t.Fatalf("GET method returned body that was not marshaled with serializer: %s", w.Body.String())
+	}
+}
+
+// TestHTTPHandlerContentNegotiation tests if request bodies are unmarshaled
+// and responses marshaled with serializers matching Content-Type and Accept
+func TestHTTPHandlerContentNegotiation(t *testing.T) {
+	c := NewController(nil, "")
+	hdl := c.GetHTTPHandler("/negotiated/", testStructNewFunc, nil, nil, nil, nil, testStructListNewFunc)
+
+	for _, s := range []Serializer{MsgpackSerializer{}, CBORSerializer{}} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/negotiated/?include=user", nil)
+		r.Header.Set("Accept", "text/html, "+s.ContentType())
+		hdl.ServeHTTP(w, r)
+		if w.Header().Get("Content-Type") != s.ContentType() {
+			t.Fatalf("GET method returned wrong Content-Type, want %s, got %s", s.ContentType(), w.Header().Get("Content-Type"))
+		}
+		resp := HTTPResponse{}
+		err := s.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil || resp.ErrText != "invalid_include" {
+			t.Fatalf("GET method returned invalid %s body: %v", s.ContentType(), err)
+		}
+
+		b, _ := s.Marshal(map[string]interface{}{"email": "test@example.com", "age": 30})
+		obj := &TestStruct{}
+		err = c.getRequestSerializer(httptest.NewRequest("PUT", "/negotiated/", nil)).Unmarshal(b, obj)
+		if err == nil {
+			t.Fatalf("Default serializer unmarshaled %s body", s.ContentType())
+		}
+		r = httptest.NewRequest("PUT", "/negotiated/", nil)
+		r.Header.Set("Content-Type", s.ContentType())
+		err = c.getRequestSerializer(r).Unmarshal(b, obj)
+		if err != nil || obj.PrimaryEmail != "test@example.com" || obj.Age != 30 {
+			t.Fatalf("Failed to unmarshal %s body: %v", s.ContentType(), err)
+		}
+	}
+
+	b, _ := CBORSerializer{}.Marshal(map[string]interface{}{"address": map[string]interface{}{"city": "Warsaw"}})
+	var v struct {
+		Data interface{} `json:"data"`
+	}
+	err := CBORSerializer{}.Unmarshal(b, &v.Data)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal CBOR map: %v", err)
+	}
+	j, err := json.Marshal(v)
+	if err != nil || string(j) != `{"data":{"address":{"city":"Warsaw"}}}` {
+		t.Fatalf("CBOR map was not decoded with string keys: %s %v", string(j), err)
+	}
+}
+
+// TestQueryBuilder tests if QueryBuilder builds queries with columns of the
+// fields and values in arguments, and rejects invalid fields and operators
+func TestQueryBuilder(t *testing.T) {
+	c := NewController(nil, "gen64_")
+	query, args, err := c.Select(testStructNewFunc).Where("Age", ">=", 18).Where("PrimaryEmail", "ilike", "%@gen64.net").Where("Price", "IN", []interface{}{1, 2}).OrderBy("Age", "desc").Limit(10).SQL()
+	if err != nil {
+		t.Fatalf("SQL failed: %s", err.Op)
+	}
+	want := "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM gen64_test_structs WHERE age >= $1 AND primary_email ILIKE $2 AND price IN ($3,$4) ORDER BY age DESC,test_struct_id ASC LIMIT 10"
+	if query != want || len(args) != 4 || args[1] != "%@gen64.net" {
+		t.Fatalf("SQL returned invalid query %s with args %v", query, args)
+	}
+
+	_, _, err = c.Select(testStructNewFunc).Where("Age; DROP TABLE x", "=", 1).SQL()
+	if err == nil || err.Op != "InvalidField" {
+		t.Fatalf("SQL failed to return error for invalid field")
+	}
+	_, _, err = c.Select(testStructNewFunc).Where("Age", "= 1 OR 1 =", 1).SQL()
+	if err == nil || err.Op != "InvalidValue" {
+		t.Fatalf("SQL failed to return error for invalid operator")
+	}
+	_, err = c.Select(testStructNewFunc).OrderBy("NonExisting", "asc").Get()
+	if err == nil || err.Op != "InvalidOrder" {
+		t.Fatalf("Get failed to return error for invalid order")
+	}
+}
+
+// TestQueryBuilderExists tests if EXISTS subqueries reference the outer table
+// and have arguments numbered after the other conditions
+func TestQueryBuilderExists(t *testing.T) {
+	type Session struct {
+		ID        int64
+		UserID    int64
+		Status    string
+		ExpiresAt int64 `crud:"expires"`
+	}
+	c := NewController(nil, "gen64_")
+	c.SetClock(testClock{now: time.Unix(1000, 0)})
+	query, args, err := c.Select(testStructNewFunc).Where("Age", ">", 18).WhereExists(func() interface{} { return &Session{} }, "UserID", map[string]interface{}{"Status": "active"}).SQL()
+	if err != nil {
+		t.Fatalf("SQL failed: %s", err.Op)
+	}
+	want := " WHERE age > $1 AND EXISTS (SELECT 1 FROM gen64_sessions WHERE user_id = gen64_test_structs.test_struct_id AND status=$2 AND (expires_at = 0 OR expires_at > $3))"
+	if !strings.HasSuffix(query, want) || len(args) != 3 || args[1] != "active" || args[2] != int64(1000) {
+		t.Fatalf("SQL returned invalid query %s with args %v", query, args)
+	}
+
+	_, _, err = c.Select(testStructNewFunc).WhereNotExists(func() interface{} { return &Session{} }, "NonExisting", nil).SQL()
+	if err == nil || err.Op != "InvalidField" {
+		t.Fatalf("SQL failed to return error for invalid field")
+	}
+}
+
+// TestQueryBuilderTopPerGroup tests if QueryBuilder generates query returning
+// first objects of each group
+func TestQueryBuilderTopPerGroup(t *testing.T) {
+	type Session struct {
+		ID        int64
+		UserID    int64
+		CreatedAt int64
+	}
+	c := NewController(nil, "")
+	newSession := func() interface{} { return &Session{} }
+	query, args, err := c.Select(newSession).Where("CreatedAt", ">", 100).OrderBy("CreatedAt", "desc").TopPerGroup(2, "UserID").Limit(10).SQL()
+	if err != nil {
+		t.Fatalf("SQL failed: %s", err.Op)
+	}
+	want := "SELECT session_id,user_id,created_at FROM (SELECT session_id,user_id,created_at,ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at DESC,session_id ASC) AS crud_rank FROM sessions WHERE created_at > $1) ranked WHERE crud_rank <= 2 ORDER BY user_id,crud_rank ASC LIMIT 10"
+	if query != want || len(args) != 1 {
+		t.Fatalf("SQL returned invalid query %s with args %v", query, args)
+	}
+
+	_, _, err = c.Select(newSession).TopPerGroup(1, "NonExisting").SQL()
+	if err == nil || err.Op != "InvalidField" {
+		t.Fatalf("SQL failed to return error for invalid field")
+	}
+}
+
+// TestQueryBuilderWithin tests if QueryBuilder generates condition on
+// distance from a point
+func TestQueryBuilderWithin(t *testing.T) {
+	type Shop struct {
+		ID       int64
+		Name     string
+		Location Point
+	}
+	c := NewController(nil, "")
+	newShop := func() interface{} { return &Shop{} }
+	query, args, err := c.Select(newShop).Where("Name", "=", "a").WhereWithin("Location", Point{Lat: 52.2, Lng: 21}, 500).SQL()
+	if err != nil {
+		t.Fatalf("SQL failed: %s", err.Op)
+	}
+	want := " WHERE name = $1 AND 6371000 * 2 * ASIN(SQRT(POWER(SIN(RADIANS(location[1] - $2) / 2), 2) + COS(RADIANS($2)) * COS(RADIANS(location[1])) * POWER(SIN(RADIANS(location[0] - $3) / 2), 2))) <= $4"
+	if !strings.HasSuffix(query, want) || len(args) != 4 || args[1] != 52.2 || args[3] != float64(500) {
+		t.Fatalf("SQL returned invalid query %s with args %v", query, args)
+	}
+
+	_, _, err = c.Select(newShop).WhereWithin("Name", Point{}, 500).SQL()
+	if err == nil || err.Op != "InvalidField" {
+		t.Fatalf("SQL failed to return error for field that is not a Point")
+	}
 }
 
 // TestDropDBTables tests if DropDBTables successfully drops tables from the
@@ -0,0 +1,36 @@
+package crud
+
+// DDLOptions changes the "CREATE TABLE" and "DROP TABLE" queries executed by
+// CreateDBTableWithOptions and DropDBTableWithOptions
+type DDLOptions struct {
+	// IfNotExists adds "IF NOT EXISTS" to "CREATE TABLE" so that existing
+	// table is not an error
+	IfNotExists bool
+	// Cascade adds "CASCADE" to "DROP TABLE" so that objects depending on the
+	// table are dropped as well
+	Cascade bool
+	// Sorted makes columns in "CREATE TABLE" sorted by name (see SetSortedDDL)
+	Sorted bool
+	// RLS enables row-level security on table of model that has field with
+	// "tenant" or "createdby" tag, with policy that allows only rows where
+	// these fields are equal to values of TenantSetting and UserSetting
+	// session settings (see WithSessionSettings)
+	RLS bool
+	// RLSForce makes the policy apply to the table owner as well
+	RLSForce bool
+	// TenantSetting is name of the setting with ID of the current tenant;
+	// "app.tenant_id" when empty
+	TenantSetting string
+	// UserSetting is name of the setting with ID of the current user;
+	// "app.user_id" when empty
+	UserSetting string
+	// Grants are privileges granted to database roles on the table
+	Grants []Grant
+}
+
+// Grant gives database role privileges needed for operations (OpRead |
+// OpList etc.) on a table, eg. read-only role for reporting
+type Grant struct {
+	Role string
+	Ops  int
+}
@@ -0,0 +1,189 @@
+package crud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldDiff is a difference of value of field between two objects
+type FieldDiff struct {
+	Name string      `json:"name"`
+	JSON string      `json:"json"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// Diff returns fields of two objects of the same struct that have different
+// values, in the order of fields, with values of a as old and b as new. ID
+// field is not compared
+func (c Controller) Diff(a interface{}, b interface{}) ([]FieldDiff, *ErrController) {
+	h, err := c.getHelper(a)
+	if err != nil {
+		return nil, err
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return nil, &ErrController{
+			Op:  "InvalidValue",
+			Err: errors.New("Objects must be of the same struct"),
+		}
+	}
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	diffs := []FieldDiff{}
+	for _, k := range h.fields {
+		if k == "ID" {
+			continue
+		}
+		oldVal, newVal := va.FieldByName(k).Interface(), vb.FieldByName(k).Interface()
+		if !reflect.DeepEqual(oldVal, newVal) {
+			diffs = append(diffs, FieldDiff{
+				Name: k,
+				JSON: h.fieldsJSONName[k],
+				Old:  oldVal,
+				New:  newVal,
+			})
+		}
+	}
+	return diffs, nil
+}
+
+// DiffVersions returns differences between version with fromVersionID of
+// object with ID set (see EnableVersions) and version with toVersionID, or
+// object itself when toVersionID is 0, eg. to review changes made since
+// a version
+func (c Controller) DiffVersions(obj interface{}, fromVersionID int64, toVersionID int64) ([]FieldDiff, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	objs := []interface{}{nil, obj}
+	for i, versionID := range []int64{fromVersionID, toVersionID} {
+		if i == 1 && versionID == 0 {
+			break
+		}
+		versions, err := c.getVersionsFromDB(h, obj, versionID, 1, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, &ErrController{
+				Op:  "InvalidValue",
+				Err: fmt.Errorf("Version %d does not exist", versionID),
+			}
+		}
+		objs[i] = versions[0].Obj
+	}
+	return c.Diff(objs[0], objs[1])
+}
+
+// getDiffFromURI returns IDs of objects from "id/diff/other_id" path, or ID
+// of object and version from "id/versions/version_id/diff" path of model with
+// versions enabled
+func (c Controller) getDiffFromURI(uri string, h *Helper) (string, string, string, bool) {
+	if h == nil {
+		return "", "", "", false
+	}
+	xs := strings.Split(strings.SplitN(uri, "?", 2)[0], "/")
+	if len(xs) == 3 && xs[1] == "diff" && idRegExp.MatchString(xs[0]) && idRegExp.MatchString(xs[2]) {
+		return xs[0], xs[2], "", true
+	}
+	if len(xs) == 4 && xs[1] == "versions" && xs[3] == "diff" && c.versioned[h.dbTbl] && idRegExp.MatchString(xs[0]) && idRegExp.MatchString(xs[2]) {
+		return xs[0], "", xs[2], true
+	}
+	return "", "", "", false
+}
+
+// getOtherDiffRequest returns copy of request for differences between two
+// objects, with path of the other object, eg. "/pages/2" for "/pages/1/diff/2",
+// so that reading it can be authorized as well. It returns nil for other
+// requests
+func (c Controller) getOtherDiffRequest(uri string, r *http.Request) *http.Request {
+	path, ok := c.getRelativePath(uri, r.URL.EscapedPath())
+	if !ok {
+		return nil
+	}
+	xs := strings.Split(path, "/")
+	if len(xs) != 3 || xs[1] != "diff" || !strings.HasSuffix(r.URL.Path, path) {
+		return nil
+	}
+	u := *r.URL
+	u.Path = strings.TrimSuffix(r.URL.Path, path) + xs[2]
+	u.RawPath = ""
+	r = r.WithContext(r.Context())
+	r.URL = &u
+	return r
+}
+
+// handleHTTPDiff writes differences between two objects, or between version
+// of object and the object or another version from "to" query parameter, as
+// items of ListResponse. Fields hidden in JSON are not included
+func (c Controller) handleHTTPDiff(w http.ResponseWriter, r *http.Request, newObjFunc func() interface{}, id string, otherID string, versionID string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	objs := []interface{}{}
+	for _, objID := range []string{id, otherID} {
+		if objID == "" {
+			continue
+		}
+		obj := newObjFunc()
+		err := c.SetFromDB(obj, objID)
+		if err != nil {
+			c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+			return
+		}
+		if c.GetModelIDValue(obj) == 0 {
+			c.writeErrText(w, http.StatusNotFound, "not_found_in_db")
+			return
+		}
+		objs = append(objs, obj)
+	}
+
+	var diffs []FieldDiff
+	var err *ErrController
+	if otherID != "" {
+		diffs, err = c.Diff(objs[0], objs[1])
+	} else {
+		vid, _ := strconv.ParseInt(versionID, 10, 64)
+		to := int64(0)
+		if r.URL.Query().Get("to") != "" {
+			var err2 error
+			to, err2 = strconv.ParseInt(r.URL.Query().Get("to"), 10, 64)
+			if err2 != nil || to < 1 {
+				c.writeErrText(w, http.StatusBadRequest, "invalid_version")
+				return
+			}
+		}
+		diffs, err = c.DiffVersions(objs[0], vid, to)
+	}
+	if err != nil && err.Op == "InvalidValue" {
+		c.writeErrText(w, http.StatusNotFound, "version_not_found")
+		return
+	}
+	if err != nil {
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+		return
+	}
+
+	h, err := c.getHelper(objs[0])
+	if err != nil {
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "get_helper")
+		return
+	}
+	visible := []interface{}{}
+	for _, d := range diffs {
+		if h.fieldsJSONHidden[d.Name] {
+			continue
+		}
+		if c.jsonNaming == JSONNamingCamelCase {
+			d.JSON = getCamelCaseName(d.JSON)
+		}
+		visible = append(visible, d)
+	}
+	c.writeResponse(w, http.StatusOK, NewListResponse(visible, nil))
+}
@@ -0,0 +1,378 @@
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Values of Divergence Reason
+const (
+	DivergenceWriteFailed = "write_failed"
+	DivergenceMissing     = "missing"
+	DivergenceExtra       = "extra"
+	DivergenceDifferent   = "different"
+)
+
+// Divergence is a difference between the database and the secondary one set
+// with SetSecondaryDB, found when a write is mirrored or by VerifySecondaryDB
+type Divergence struct {
+	Tbl string
+	ID  int64
+	// Op is operation of the mirrored write, or 0 when divergence was found
+	// by VerifySecondaryDB
+	Op int
+	// Reason is one of Divergence* values: write to the secondary database
+	// failed, row is missing or extra in it, or it has different values
+	Reason string
+	Err    error
+}
+
+// defaultMirrorTimeout is the default time limit of writes to the secondary
+// database, see SetSecondaryDBTimeout
+const defaultMirrorTimeout = 5 * time.Second
+
+// secondaryDB is the database that writes are mirrored to
+type secondaryDB struct {
+	db      *sql.DB
+	logger  func(d *Divergence)
+	timeout time.Duration
+}
+
+// mirrorWrite is a query mirrored to the secondary database
+type mirrorWrite struct {
+	tbl   string
+	id    int64
+	op    int
+	query string
+	args  []interface{}
+}
+
+// SetSecondaryDB enables dual-write mode, in which objects created, updated
+// and deleted with the controller, eg. with SaveToDB, SaveManyToDB,
+// UpdateWhere, UpdateFromDB, DeleteFromDB, PurgeFromDB or RefreshSummary,
+// are written to the secondary database as well, eg. during a migration to
+// a new cluster.
+// Rows are written with the same IDs. In a transaction (see Begin), writes
+// are mirrored in a single transaction of the secondary database after
+// commit, and they are dropped on rollback. Failed writes do not fail the
+// operation, they are passed to logger as divergences instead. Writes run
+// after the ones in the database, within the time limit set with
+// SetSecondaryDBTimeout (5 seconds by default), so that a slow secondary
+// database does not hold the operation for long. Writes made outside the
+// controller are not mirrored, and VerifySecondaryDB finds rows that differ
+func (c *Controller) SetSecondaryDB(db *sql.DB, logger func(d *Divergence)) {
+	if db == nil {
+		c.secondary = nil
+		return
+	}
+	c.secondary = &secondaryDB{
+		db:      db,
+		logger:  logger,
+		timeout: defaultMirrorTimeout,
+	}
+}
+
+// SetSecondaryDBTimeout sets time limit of mirroring writes of a single
+// operation, or of a transaction, to the secondary database set with
+// SetSecondaryDB. Writes that time out are passed to logger as divergences
+func (c *Controller) SetSecondaryDBTimeout(timeout time.Duration) {
+	if c.secondary != nil {
+		c.secondary.timeout = timeout
+	}
+}
+
+// VerifySecondaryDB compares all the rows of model's table in the database
+// with the secondary database set with SetSecondaryDB, in batches of
+// batchSize rows, and returns divergences, which are passed to logger as
+// well. It is meant to be run before switching to the secondary database,
+// eg. in a command or with NewVerifySecondaryDBTask. Rows are mirrored with
+// their IDs, so the ID sequence of the secondary table is not used, and it is
+// set after the greatest ID here (see ResetSecondaryDBSequence), so that
+// inserts do not fail after the switch
+func (c Controller) VerifySecondaryDB(newObjFunc func() interface{}, batchSize int) ([]*Divergence, *ErrController) {
+	if c.secondary == nil {
+		return nil, &ErrController{
+			Op:  "SecondaryDB",
+			Err: fmt.Errorf("Secondary database is not set"),
+		}
+	}
+	h, err := c.getHelper(newObjFunc())
+	if err != nil {
+		return nil, err
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	divs := []*Divergence{}
+	afterID := int64(0)
+	for {
+		objs, err := c.queryObjects(c.getQuerier(), newObjFunc, h.GetQuerySelectAfterID(), afterID, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		// Last batch is compared with all the remaining rows of the secondary
+		// database, so that rows that are only there are found
+		lastID := int64(1<<63 - 1)
+		if len(objs) == batchSize {
+			lastID = c.GetModelIDValue(objs[len(objs)-1])
+		}
+		secObjs, err := c.queryObjects(c.withContextQuerier(c.secondary.db), newObjFunc, h.GetQuerySelectBetweenIDs(), afterID, lastID)
+		if err != nil {
+			return nil, err
+		}
+		divs = append(divs, c.getDivergences(h, objs, secObjs)...)
+		if len(objs) < batchSize {
+			break
+		}
+		afterID = lastID
+	}
+	for _, d := range divs {
+		c.logDivergence(d)
+	}
+	err = c.ResetSecondaryDBSequence(newObjFunc())
+	if err != nil {
+		return nil, err
+	}
+	return divs, nil
+}
+
+// ResetSecondaryDBSequence sets ID sequence of model's table in the secondary
+// database set with SetSecondaryDB so that next inserted row gets ID greater
+// than any existing one. It should be run as the last step before switching
+// to the secondary database, when writes are stopped
+func (c Controller) ResetSecondaryDBSequence(obj interface{}) *ErrController {
+	if c.secondary == nil {
+		return &ErrController{
+			Op:  "SecondaryDB",
+			Err: fmt.Errorf("Secondary database is not set"),
+		}
+	}
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	_, err2 := c.withContextQuerier(c.secondary.db).Exec(h.GetQueryResetIDSequence())
+	if err2 != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	return nil
+}
+
+// NewVerifySecondaryDBTask returns MaintenanceTask that compares model's
+// table in the database and the secondary one with VerifySecondaryDB
+func NewVerifySecondaryDBTask(name string, newObjFunc func() interface{}, batchSize int, interval time.Duration) *MaintenanceTask {
+	return &MaintenanceTask{
+		Name:     name,
+		Interval: interval,
+		Run: func(c *Controller) error {
+			_, err := c.VerifySecondaryDB(newObjFunc, batchSize)
+			if err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// getDivergences returns differences between objects from the database and
+// the secondary one, which are both sorted by ID
+func (c Controller) getDivergences(h *Helper, objs []interface{}, secObjs []interface{}) []*Divergence {
+	divs := []*Divergence{}
+	i, j := 0, 0
+	for i < len(objs) || j < len(secObjs) {
+		switch {
+		case j == len(secObjs) || (i < len(objs) && c.GetModelIDValue(objs[i]) < c.GetModelIDValue(secObjs[j])):
+			divs = append(divs, &Divergence{Tbl: h.dbTbl, ID: c.GetModelIDValue(objs[i]), Reason: DivergenceMissing})
+			i++
+		case i == len(objs) || c.GetModelIDValue(objs[i]) > c.GetModelIDValue(secObjs[j]):
+			divs = append(divs, &Divergence{Tbl: h.dbTbl, ID: c.GetModelIDValue(secObjs[j]), Reason: DivergenceExtra})
+			j++
+		default:
+			if !reflect.DeepEqual(objs[i], secObjs[j]) {
+				divs = append(divs, &Divergence{Tbl: h.dbTbl, ID: c.GetModelIDValue(objs[i]), Reason: DivergenceDifferent})
+			}
+			i++
+			j++
+		}
+	}
+	return divs
+}
+
+// queryObjects returns objects from rows of query, which selects all the
+// columns of model
+func (c Controller) queryObjects(q dbQuerier, newObjFunc func() interface{}, query string, args ...interface{}) ([]interface{}, *ErrController) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	defer rows.Close()
+
+	objs := []interface{}{}
+	for rows.Next() {
+		obj := newObjFunc()
+		err = rows.Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+		if err != nil {
+			return nil, &ErrController{
+				Op:  "DBQueryRowsScan",
+				Err: fmt.Errorf("Error scanning DB query row: %w", err),
+			}
+		}
+		objs = append(objs, obj)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQueryRowsScan",
+			Err: fmt.Errorf("Error scanning DB query row: %w", err),
+		}
+	}
+	return objs, nil
+}
+
+// mirrorObject writes object, as it is after a successful write, to the
+// secondary database, or removes its row when it was deleted
+func (c Controller) mirrorObject(h *Helper, op int, obj interface{}) {
+	if c.secondary == nil {
+		return
+	}
+	c.mirror([]mirrorWrite{c.getMirrorWrite(h, op, obj)})
+}
+
+// getMirrorWrite returns write of object, as it is after a successful write,
+// to the secondary database
+func (c Controller) getMirrorWrite(h *Helper, op int, obj interface{}) mirrorWrite {
+	if op == OpDelete && h.fieldSoftDel == "" {
+		return c.getMirrorRemoval(h, c.GetModelIDValue(obj))
+	}
+	// Arguments point to fields of a copy, as the object can change before
+	// writes of a transaction are mirrored
+	cp := reflect.New(reflect.TypeOf(obj).Elem())
+	cp.Elem().Set(reflect.ValueOf(obj).Elem())
+	return mirrorWrite{
+		tbl:   h.dbTbl,
+		id:    c.GetModelIDValue(obj),
+		op:    op,
+		query: h.GetQueryUpsertWithID(),
+		args:  append([]interface{}{c.GetModelIDValue(obj)}, c.GetModelFieldInterfaces(cp.Interface())...),
+	}
+}
+
+// getMirrorRemoval returns write that removes row with id from the secondary
+// database. Rows of models with "softdel" field are removed as well, eg. when
+// they are purged
+func (c Controller) getMirrorRemoval(h *Helper, id int64) mirrorWrite {
+	return mirrorWrite{
+		tbl:   h.dbTbl,
+		id:    id,
+		op:    OpDelete,
+		query: h.GetQueryDeleteById(),
+		args:  []interface{}{id},
+	}
+}
+
+// mirror applies writes to the secondary database, or queues them until
+// commit when controller is in a transaction (see Begin)
+func (c Controller) mirror(ws []mirrorWrite) {
+	if c.secondary == nil || len(ws) == 0 {
+		return
+	}
+	if c.mirrorQueue != nil {
+		*c.mirrorQueue = append(*c.mirrorQueue, ws...)
+		return
+	}
+	c.applyMirrorWrites(ws)
+}
+
+// queryIDs runs query that returns IDs of rows, eg. a delete query with
+// "RETURNING", and returns them
+func (c Controller) queryIDs(q dbQuerier, query string, args []interface{}) ([]int64, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// applyMirrorWrites runs writes in the secondary database, in a transaction
+// when there are many of them, and logs the ones that fail. Writes are
+// cancelled when they take longer than the time limit
+func (c Controller) applyMirrorWrites(ws []mirrorWrite) {
+	if c.secondary == nil || len(ws) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.getContext(), c.secondary.timeout)
+	defer cancel()
+	c.ctx = ctx
+	if len(ws) == 1 {
+		c.applyMirrorWrite(c.withContextQuerier(c.secondary.db), ws[0])
+		return
+	}
+	tx, err := c.secondary.db.BeginTx(ctx, nil)
+	if err != nil {
+		for _, w := range ws {
+			c.logDivergence(&Divergence{Tbl: w.tbl, ID: w.id, Op: w.op, Reason: DivergenceWriteFailed, Err: err})
+		}
+		return
+	}
+	for i, w := range ws {
+		if !c.applyMirrorWrite(c.withContextQuerier(tx), w) {
+			tx.Rollback()
+			// Writes are rolled back, so the other ones are lost as well
+			for _, w2 := range ws[i+1:] {
+				c.logDivergence(&Divergence{Tbl: w2.tbl, ID: w2.id, Op: w2.op, Reason: DivergenceWriteFailed, Err: fmt.Errorf("Transaction rolled back")})
+			}
+			for _, w2 := range ws[:i] {
+				c.logDivergence(&Divergence{Tbl: w2.tbl, ID: w2.id, Op: w2.op, Reason: DivergenceWriteFailed, Err: fmt.Errorf("Transaction rolled back")})
+			}
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		for _, w := range ws {
+			c.logDivergence(&Divergence{Tbl: w.tbl, ID: w.id, Op: w.op, Reason: DivergenceWriteFailed, Err: err})
+		}
+	}
+}
+
+// applyMirrorWrite runs write in the secondary database and returns false
+// when it fails. Row that is missing when it is deleted is logged, but it is
+// not a failure
+func (c Controller) applyMirrorWrite(q dbQuerier, w mirrorWrite) bool {
+	res, err := q.Exec(w.query, w.args...)
+	if err != nil {
+		c.logDivergence(&Divergence{Tbl: w.tbl, ID: w.id, Op: w.op, Reason: DivergenceWriteFailed, Err: err})
+		return false
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		c.logDivergence(&Divergence{Tbl: w.tbl, ID: w.id, Op: w.op, Reason: DivergenceMissing})
+	}
+	return true
+}
+
+// logDivergence passes divergence to logger set with SetSecondaryDB
+func (c Controller) logDivergence(d *Divergence) {
+	if c.secondary != nil && c.secondary.logger != nil {
+		c.secondary.logger(d)
+	}
+}
@@ -0,0 +1,261 @@
+package crud
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// dumpFormat is the format name in DumpHeader
+const dumpFormat = "go-crud-dump"
+
+// dumpBatchSize is number of rows that DumpModel gets with one query
+const dumpBatchSize = 1000
+
+// DumpHeader is the first line of a dump written by DumpModel. It describes
+// table and columns of the rows in the following lines
+type DumpHeader struct {
+	Format  string   `json:"format"`
+	Version int      `json:"version"`
+	Tbl     string   `json:"table"`
+	Columns []string `json:"columns"`
+	// Types are database types of the columns, eg. "VARCHAR(255)", so that
+	// LoadModel can tell when the struct has changed
+	Types []string `json:"types,omitempty"`
+	// Anonymized is true when values of sensitive fields were replaced
+	// with fakes
+	Anonymized bool `json:"anonymized,omitempty"`
+}
+
+// DumpOptions contains options of DumpModelWithOptions
+type DumpOptions struct {
+	// Anonymize replaces values of fields with "sensitive" tag with fakes,
+	// just like Anonymize
+	Anonymize bool
+}
+
+// DumpModel writes all objects of a model (including expired ones) to w as
+// NDJSON: a line with DumpHeader and then one line per object, with values
+// keyed by column names, in the order of ID. Fields hidden from JSON are
+// dumped as well. It returns number of dumped objects
+func (c Controller) DumpModel(newObjFunc func() interface{}, w io.Writer) (int64, *ErrController) {
+	return c.DumpModelWithOptions(newObjFunc, w, DumpOptions{})
+}
+
+// DumpModelWithOptions writes dump of a model just like DumpModel, with
+// additional options, eg. for anonymizing the objects
+func (c Controller) DumpModelWithOptions(newObjFunc func() interface{}, w io.Writer, opts DumpOptions) (int64, *ErrController) {
+	h, err := c.getHelper(newObjFunc())
+	if err != nil {
+		return 0, err
+	}
+
+	header := h.getDumpHeader()
+	header.Anonymized = opts.Anonymize
+	enc := json.NewEncoder(w)
+	err2 := enc.Encode(header)
+	if err2 != nil {
+		return 0, &ErrController{
+			Op:  "DumpWrite",
+			Err: fmt.Errorf("Error writing dump: %w", err2),
+		}
+	}
+
+	var cnt int64
+	var afterID int64
+	for {
+		objs, err := c.getAfterIDFromDB(h, newObjFunc, afterID, dumpBatchSize)
+		if err != nil {
+			return cnt, err
+		}
+		for _, obj := range objs {
+			afterID = c.GetModelIDValue(obj)
+			if opts.Anonymize {
+				h.anonymize(obj)
+			}
+			err2 = enc.Encode(h.getDumpRow(obj))
+			if err2 != nil {
+				return cnt, &ErrController{
+					Op:  "DumpWrite",
+					Err: fmt.Errorf("Error writing dump: %w", err2),
+				}
+			}
+			cnt++
+		}
+		if len(objs) < dumpBatchSize {
+			return cnt, nil
+		}
+	}
+}
+
+// LoadModel reads dump written by DumpModel from r and inserts the objects
+// with their IDs, in one transaction. Table in the header must be the same
+// as the model's, and all its columns must exist in the struct, with the
+// same types (when the dump has them). Sequence of
+// the ID column is moved past the highest ID afterwards. Hooks and
+// validation are not run. It returns number of inserted objects
+func (c Controller) LoadModel(newObjFunc func() interface{}, r io.Reader) (int64, *ErrController) {
+	h, err := c.getHelper(newObjFunc())
+	if err != nil {
+		return 0, err
+	}
+
+	dec := json.NewDecoder(r)
+	header := &DumpHeader{}
+	err2 := dec.Decode(header)
+	if err2 != nil {
+		return 0, &ErrController{
+			Op:  "InvalidDump",
+			Err: fmt.Errorf("Error reading dump header: %w", err2),
+		}
+	}
+	if header.Format != dumpFormat || header.Version != 1 || header.Tbl != h.dbTbl {
+		return 0, &ErrController{
+			Op:  "InvalidDump",
+			Err: fmt.Errorf("Dump is not of table %s", h.dbTbl),
+		}
+	}
+	if len(header.Types) > 0 && len(header.Types) != len(header.Columns) {
+		return 0, &ErrController{
+			Op:  "InvalidDump",
+			Err: fmt.Errorf("Dump has %d types of %d columns", len(header.Types), len(header.Columns)),
+		}
+	}
+	cols := map[string]bool{}
+	for i, col := range header.Columns {
+		if h.dbCols[col] == "" {
+			return 0, &ErrController{
+				Op:  "InvalidDump",
+				Err: fmt.Errorf("Column %s does not exist in struct", col),
+			}
+		}
+		// ID column holds integers, whatever sequence it has
+		if len(header.Types) > 0 && h.dbCols[col] != "ID" && header.Types[i] != h.getDBColType(h.dbCols[col]) {
+			return 0, &ErrController{
+				Op:  "InvalidDump",
+				Err: fmt.Errorf("Column %s is %s in dump and %s in struct", col, header.Types[i], h.getDBColType(h.dbCols[col])),
+			}
+		}
+		cols[col] = true
+	}
+
+	var cnt int64
+	var errDump *ErrController
+	err2 = c.runInTx(h, OpCreate, func(q dbQuerier) error {
+		for dec.More() {
+			obj := newObjFunc()
+			errDump = h.setFromDumpRow(dec, cols, obj)
+			if errDump != nil {
+				return errDump
+			}
+			_, err := q.Exec(h.GetQueryInsertWithID(), append([]interface{}{c.GetModelIDInterface(obj)}, c.GetModelFieldInterfaces(obj)...)...)
+			if err != nil {
+				return err
+			}
+			cnt++
+		}
+		_, err := q.Exec(h.GetQueryResetIDSequence())
+		return err
+	})
+	if errDump != nil {
+		return 0, errDump
+	}
+	if err2 != nil {
+		return 0, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	return cnt, nil
+}
+
+// getAfterIDFromDB returns up to limit objects with ID greater than afterID
+func (c Controller) getAfterIDFromDB(h *Helper, newObjFunc func() interface{}, afterID int64, limit int) ([]interface{}, *ErrController) {
+	rows, err := c.getQuerier().Query(h.GetQuerySelectAfterID(), afterID, limit)
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	defer rows.Close()
+
+	objs := []interface{}{}
+	for rows.Next() {
+		obj := newObjFunc()
+		err = rows.Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+		if err != nil {
+			return nil, &ErrController{
+				Op:  "DBQueryRowsScan",
+				Err: fmt.Errorf("Error scanning DB query row: %w", err),
+			}
+		}
+		objs = append(objs, obj)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQueryRowsScan",
+			Err: fmt.Errorf("Error scanning DB query row: %w", err),
+		}
+	}
+	return objs, nil
+}
+
+// getDumpHeader returns header of model's dump
+func (h *Helper) getDumpHeader() *DumpHeader {
+	cols := []string{}
+	types := []string{}
+	for _, f := range h.fields {
+		cols = append(cols, h.dbFieldCols[f])
+		types = append(types, h.getDBColType(f))
+	}
+	return &DumpHeader{
+		Format:  dumpFormat,
+		Version: 1,
+		Tbl:     h.dbTbl,
+		Columns: cols,
+		Types:   types,
+	}
+}
+
+// getDumpRow returns object's field values keyed by column names
+func (h *Helper) getDumpRow(obj interface{}) map[string]interface{} {
+	val := reflect.ValueOf(obj).Elem()
+	row := map[string]interface{}{}
+	for _, f := range h.fields {
+		row[h.dbFieldCols[f]] = val.FieldByName(f).Interface()
+	}
+	return row
+}
+
+// setFromDumpRow decodes next row of a dump into object's fields. Only
+// columns from the dump header are allowed
+func (h *Helper) setFromDumpRow(dec *json.Decoder, cols map[string]bool, obj interface{}) *ErrController {
+	row := map[string]json.RawMessage{}
+	err := dec.Decode(&row)
+	if err != nil {
+		return &ErrController{
+			Op:  "InvalidDump",
+			Err: fmt.Errorf("Error reading dump row: %w", err),
+		}
+	}
+	val := reflect.ValueOf(obj).Elem()
+	for col, v := range row {
+		if !cols[col] {
+			return &ErrController{
+				Op:  "InvalidDump",
+				Err: fmt.Errorf("Column %s is not in dump header", col),
+			}
+		}
+		err = json.Unmarshal(v, val.FieldByName(h.dbCols[col]).Addr().Interface())
+		if err != nil {
+			return &ErrController{
+				Op:  "InvalidDump",
+				Err: fmt.Errorf("Error reading value of column %s: %w", col, err),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package crud
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"time"
+)
+
+var fieldNameRegExp = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+// dynamicFieldTypes maps type names used in ModelField to Go types
+var dynamicFieldTypes = map[string]reflect.Type{
+	"string": reflect.TypeOf(""),
+	"int":    reflect.TypeOf(int(0)),
+	"int8":   reflect.TypeOf(int8(0)),
+	"int16":  reflect.TypeOf(int16(0)),
+	"int32":  reflect.TypeOf(int32(0)),
+	"int64":  reflect.TypeOf(int64(0)),
+	"uint":   reflect.TypeOf(uint(0)),
+	"uint8":  reflect.TypeOf(uint8(0)),
+	"uint16": reflect.TypeOf(uint16(0)),
+	"uint32": reflect.TypeOf(uint32(0)),
+	"uint64": reflect.TypeOf(uint64(0)),
+	"time":   reflect.TypeOf(time.Time{}),
+}
+
+// ModelSchema describes a model that is defined at runtime, without
+// a compiled struct
+type ModelSchema struct {
+	// Name is used just like struct name, eg. "ProductCategory" gets
+	// "product_categories" table
+	Name   string
+	Fields []ModelField
+}
+
+// ModelField describes a field of model defined at runtime. ID field is added
+// automatically
+type ModelField struct {
+	// Name is the field name, eg. "FirstName"
+	Name string
+	// Type is one of: string, int, int8, int16, int32, int64, uint, uint8,
+	// uint16, uint32, uint64, time
+	Type string
+	// JSON is the name of the field in JSON; when empty, Name is used
+	JSON string
+	// Crud is value of the "crud" tag, eg. "req lenmin:2 lenmax:50"
+	Crud string
+}
+
+// DynamicModel is a model defined at runtime with DefineModel. Its objects
+// can be used with all Controller methods and HTTP handler, just like
+// pointers to structs
+type DynamicModel struct {
+	name string
+	typ  reflect.Type
+}
+
+// Name returns name of the model
+func (m *DynamicModel) Name() string {
+	return m.name
+}
+
+// New returns new object of the model. It can be used as newObjFunc in
+// GetFromDB and GetHTTPHandler
+func (m *DynamicModel) New() interface{} {
+	return reflect.New(m.typ).Interface()
+}
+
+// NewRecord returns Record wrapping new object of the model
+func (m *DynamicModel) NewRecord() *Record {
+	return &Record{obj: m.New()}
+}
+
+// Record returns Record wrapping object of the model, eg. one returned by
+// GetFromDB
+func (m *DynamicModel) Record(obj interface{}) *Record {
+	return &Record{obj: obj}
+}
+
+// Record gives access to the fields of dynamic model's object by their names
+type Record struct {
+	obj interface{}
+}
+
+// Obj returns the object that can be passed to Controller methods
+func (r *Record) Obj() interface{} {
+	return r.obj
+}
+
+// Get returns value of a field or nil when there is no such field
+func (r *Record) Get(fieldName string) interface{} {
+	f := reflect.ValueOf(r.obj).Elem().FieldByName(fieldName)
+	if !f.IsValid() {
+		return nil
+	}
+	return f.Interface()
+}
+
+// Set sets value of a field. Value must be of the field type
+func (r *Record) Set(fieldName string, value interface{}) error {
+	f := reflect.ValueOf(r.obj).Elem().FieldByName(fieldName)
+	if !f.IsValid() {
+		return fmt.Errorf("invalid field %s", fieldName)
+	}
+	v := reflect.ValueOf(value)
+	if !v.IsValid() || v.Type() != f.Type() {
+		return fmt.Errorf("invalid value type for field %s", fieldName)
+	}
+	f.Set(v)
+	return nil
+}
+
+// Map returns values of all fields
+func (r *Record) Map() map[string]interface{} {
+	val := reflect.ValueOf(r.obj).Elem()
+	m := make(map[string]interface{}, val.NumField())
+	for i := 0; i < val.NumField(); i++ {
+		m[val.Type().Field(i).Name] = val.Field(i).Interface()
+	}
+	return m
+}
+
+// getDynamicModelType returns struct type for schema
+func getDynamicModelType(schema ModelSchema) (reflect.Type, error) {
+	if !fieldNameRegExp.MatchString(schema.Name) {
+		return nil, fmt.Errorf("invalid model name %s", schema.Name)
+	}
+	h := &Helper{}
+	// Model name in the tag makes the type different from other models with
+	// the same fields
+	fields := []reflect.StructField{
+		{
+			Name: "ID",
+			Type: reflect.TypeOf(int64(0)),
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s_id" crud_model:"%s"`, h.getUnderscoredName(schema.Name), schema.Name)),
+		},
+	}
+	names := map[string]bool{"ID": true}
+	for _, f := range schema.Fields {
+		if !fieldNameRegExp.MatchString(f.Name) || names[f.Name] {
+			return nil, fmt.Errorf("invalid field name %s", f.Name)
+		}
+		names[f.Name] = true
+		t, ok := dynamicFieldTypes[f.Type]
+		if !ok {
+			return nil, fmt.Errorf("invalid type %s of field %s", f.Type, f.Name)
+		}
+		jsonName := f.JSON
+		if jsonName == "" {
+			jsonName = f.Name
+		}
+		fields = append(fields, reflect.StructField{
+			Name: f.Name,
+			Type: t,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:%q crud:%q`, jsonName, f.Crud)),
+		})
+	}
+	return reflect.StructOf(fields), nil
+}
@@ -0,0 +1,58 @@
+package crud
+
+import "net/http"
+
+// Endpoint describes HTTP endpoint of a model that is mounted with
+// MountEndpoints
+type Endpoint struct {
+	// Path is the URI that handler is registered with, eg. "/v1/users/"
+	Path string
+	// Model returns new instance of the model struct
+	Model func() interface{}
+	// Ops are operations (OpRead | OpList etc.) that are allowed; 0 allows
+	// all of them. Requests for other operations get "405 Method Not Allowed"
+	Ops int
+	// DTOs are structs used for specific operations instead of the Model
+	DTOs EndpointDTOs
+	// Auth, if set, is called for every request and when it returns false,
+	// request gets "401 Unauthorized"
+	Auth func(r *http.Request, op int) bool
+	// Share allows reading an object without Auth when request has valid
+	// token from GetShareToken in "share_token" query parameter
+	Share bool
+	// Identity, if set, is called after Auth and returns ID of the
+	// authenticated user that fields with "createdby" and "updatedby" tags
+	// are set to (see WithIdentity)
+	Identity func(r *http.Request) int64
+	// SessionSettings, if set, is called after Identity and returns
+	// database session settings that queries of the request are run with
+	// (see WithSessionSettings), eg. role for row-level security
+	SessionSettings func(r *http.Request) map[string]string
+	// Approval, if set, is called for create, update and delete requests
+	// after Identity and when it returns true, the write is stored as
+	// a change request to be reviewed instead of being applied (see
+	// WithApprovalRequired)
+	Approval func(r *http.Request, op int) bool
+	// RateLimit, if set, is called for every request and when it returns
+	// false, request gets "429 Too Many Requests"
+	RateLimit func(r *http.Request, op int) bool
+	// Hooks wrap the handler, in the order they are defined (first one is
+	// the outermost), eg. to add logging
+	Hooks []func(http.Handler) http.Handler
+}
+
+// EndpointDTOs contains funcs returning new instances of structs used for
+// specific operations. Model is used for the ones that are nil
+type EndpointDTOs struct {
+	Create func() interface{}
+	Read   func() interface{}
+	Update func() interface{}
+	Delete func() interface{}
+	List   func() interface{}
+}
+
+// HTTPMux is implemented by http.ServeMux and other routers that endpoints
+// can be mounted on
+type HTTPMux interface {
+	Handle(pattern string, handler http.Handler)
+}
@@ -1,11 +1,13 @@
 package crud
 
 // ErrHelper wraps original error with operation/step where the error occured
-// and optionally with a tag when parsing "crud" failed
+// and optionally with a tag when parsing "crud" failed, or with fields that
+// caused the error
 type ErrHelper struct {
-	Op  string
-	Tag string
-	Err error
+	Op     string
+	Tag    string
+	Fields []string
+	Err    error
 }
 
 func (e ErrHelper) Error() string {
@@ -0,0 +1,17 @@
+package crud
+
+import (
+	"net/http"
+	"strings"
+)
+
+// FieldFormatter returns value of a field as it is written in HTTP responses,
+// eg. Unix timestamp as a date string. locale is the first language from the
+// Accept-Language request header, eg. "en-GB", or empty when there is none
+type FieldFormatter func(value interface{}, locale string) interface{}
+
+// getLocale returns the first language from the Accept-Language header
+func getLocale(r *http.Request) string {
+	l := strings.Split(r.Header.Get("Accept-Language"), ",")[0]
+	return strings.TrimSpace(strings.Split(l, ";")[0])
+}
@@ -0,0 +1,96 @@
+package crud
+
+import "strings"
+
+// FilterCondition is a value of filter that compares field with an operator
+// other than "=", eg. {Operator: ">", Value: 100}. Operator can be one of
+// "=", "<>", "<", "<=", ">", ">=", "LIKE" and "IN", for which Value must be
+// []interface{}. Filter can also be []FilterCondition, with conditions joined
+// with AND, eg. for a range of values. Validate rejects other operators, and
+// they are never put in queries, where such condition matches no rows
+type FilterCondition struct {
+	Operator string
+	Value    interface{}
+}
+
+// filterOperators are operators that can be used in FilterCondition
+var filterOperators = map[string]bool{
+	"=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+	"LIKE": true, "IN": true,
+}
+
+// filterOperatorSuffixes maps suffixes of filter names in HTTP list requests,
+// eg. "filter_price_gt", to operators
+var filterOperatorSuffixes = map[string]string{
+	"ne":   "<>",
+	"lt":   "<",
+	"lte":  "<=",
+	"gt":   ">",
+	"gte":  ">=",
+	"like": "LIKE",
+	"in":   "IN",
+}
+
+// getFilterConditions returns conditions of filter value, which can be
+// a plain value, []interface{} (matching any of the values), FilterCondition
+// or []FilterCondition
+func getFilterConditions(v interface{}) []FilterCondition {
+	switch fv := v.(type) {
+	case FilterCondition:
+		return []FilterCondition{fv}
+	case []FilterCondition:
+		return fv
+	case []interface{}:
+		return []FilterCondition{{Operator: "IN", Value: fv}}
+	}
+	return []FilterCondition{{Operator: "=", Value: v}}
+}
+
+// mapFilterValue returns copy of filter value with fn applied to each of the
+// values in it, keeping its structure
+func mapFilterValue(v interface{}, fn func(interface{}) (interface{}, error)) (interface{}, error) {
+	switch fv := v.(type) {
+	case FilterCondition:
+		nv, err := mapFilterValue(fv.Value, fn)
+		return FilterCondition{Operator: fv.Operator, Value: nv}, err
+	case []FilterCondition:
+		conds := make([]FilterCondition, len(fv))
+		for i, cond := range fv {
+			nv, err := mapFilterValue(cond.Value, fn)
+			if err != nil {
+				return nil, err
+			}
+			conds[i] = FilterCondition{Operator: cond.Operator, Value: nv}
+		}
+		return conds, nil
+	case []interface{}:
+		xv := make([]interface{}, len(fv))
+		for i, iv := range fv {
+			nv, err := fn(iv)
+			if err != nil {
+				return nil, err
+			}
+			xv[i] = nv
+		}
+		return xv, nil
+	}
+	return fn(v)
+}
+
+// getFilterNameOperator returns column name and operator from name of filter
+// in HTTP list request, eg. "price" and ">" for "price_gt". Name that is
+// a column is not split, so columns can end with the suffixes
+func (h *Helper) getFilterNameOperator(filterName string) (string, string) {
+	if h.dbCols[filterName] != "" {
+		return filterName, ""
+	}
+	i := strings.LastIndex(filterName, "_")
+	if i < 1 {
+		return filterName, ""
+	}
+	op, ok := filterOperatorSuffixes[filterName[i+1:]]
+	if !ok || h.dbCols[filterName[:i]] == "" {
+		return filterName, ""
+	}
+	return filterName[:i], op
+}
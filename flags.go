@@ -0,0 +1,108 @@
+package crud
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// flagBit is a named bit of a field with flags
+type flagBit struct {
+	Field string
+	Value int64
+}
+
+// SetFlagNames names bits of int64 field with "flags" tag (or field named
+// Flags), eg. {"verified": 1, "admin": 2}, so that code can refer to them with
+// SetFlag and HasFlag, and Describe documents them. Values must be powers of
+// two and names must be unique in the model. Like formatters, names are
+// shared between the model and all its structs used in HTTP handler
+func (c *Controller) SetFlagNames(obj interface{}, fieldName string, names map[string]int64) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	if !h.isFlagsField(fieldName) {
+		return &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Field %s is not a flags field", fieldName),
+		}
+	}
+	for name, v := range names {
+		if v <= 0 || v&(v-1) != 0 {
+			return &ErrController{
+				Op:  "InvalidValue",
+				Err: fmt.Errorf("Value of flag %s is not a power of two", name),
+			}
+		}
+		if b, ok := c.flagNames[h.dbTbl][name]; ok && b.Field != fieldName {
+			return &ErrController{
+				Op:  "InvalidValue",
+				Err: fmt.Errorf("Flag %s is already a flag of field %s", name, b.Field),
+			}
+		}
+	}
+	if c.flagNames[h.dbTbl] == nil {
+		c.flagNames[h.dbTbl] = make(map[string]flagBit)
+	}
+	for name, v := range names {
+		c.flagNames[h.dbTbl][name] = flagBit{Field: fieldName, Value: v}
+	}
+	return nil
+}
+
+// SetFlag sets or clears named flag (see SetFlagNames) in the field of
+// object. Object is not saved in the database
+func (c Controller) SetFlag(obj interface{}, name string, on bool) *ErrController {
+	b, err := c.getFlagBit(obj, name)
+	if err != nil {
+		return err
+	}
+	valueField := reflect.ValueOf(obj).Elem().FieldByName(b.Field)
+	if on {
+		valueField.SetInt(valueField.Int() | b.Value)
+	} else {
+		valueField.SetInt(valueField.Int() &^ b.Value)
+	}
+	return nil
+}
+
+// HasFlag checks if named flag (see SetFlagNames) is set in the field of
+// object
+func (c Controller) HasFlag(obj interface{}, name string) (bool, *ErrController) {
+	b, err := c.getFlagBit(obj, name)
+	if err != nil {
+		return false, err
+	}
+	return reflect.ValueOf(obj).Elem().FieldByName(b.Field).Int()&b.Value != 0, nil
+}
+
+// getFlagBit returns named flag of object's model, when struct has its field
+func (c Controller) getFlagBit(obj interface{}, name string) (flagBit, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return flagBit{}, err
+	}
+	b, ok := c.flagNames[h.dbTbl][name]
+	if !ok || h.dbFieldCols[b.Field] == "" {
+		return flagBit{}, &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Invalid flag %s", name),
+		}
+	}
+	return b, nil
+}
+
+// getFlagNames returns names of flags of field of model's table
+func (c Controller) getFlagNames(h *Helper, fieldName string) map[string]int64 {
+	var names map[string]int64
+	for name, b := range c.flagNames[h.dbTbl] {
+		if b.Field != fieldName {
+			continue
+		}
+		if names == nil {
+			names = make(map[string]int64)
+		}
+		names[name] = b.Value
+	}
+	return names
+}
@@ -0,0 +1,75 @@
+package crud
+
+import (
+	"fmt"
+	"time"
+)
+
+// forEachAttempts is the number of attempts of getting a batch of objects in
+// ForEachInDB, and forEachBackoff is the delay after the first failed one,
+// which doubles after each next failure
+const forEachAttempts = 3
+const forEachBackoff = 100 * time.Millisecond
+
+// ForEachInDB calls fn for every object matching filters, eg. in maintenance
+// scripts that process millions of rows. Objects are got in batches of
+// batchSize (1000 when it is 0 or less) ordered by ID, so that each batch
+// starts after the last ID of the previous one and rows added or removed in
+// the meantime do not shift the pages. Getting a batch is retried when the
+// query fails or reading its rows is interrupted, unless controller is in
+// a transaction. Iteration stops when fn returns an error, which is returned
+// with "ForEach" Op
+func (c Controller) ForEachInDB(newObjFunc func() interface{}, filters map[string]interface{}, batchSize int, fn func(obj interface{}) error) *ErrController {
+	obj := newObjFunc()
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	errHook := c.runHooks(HookBefore, OpList, obj)
+	if errHook != nil {
+		return errHook
+	}
+	filters, dbFilters, err1 := c.prepareFilters(h, obj, filters)
+	if err1 != nil {
+		return err1
+	}
+
+	query := h.GetQuerySelectAfterIDWhere(filters, batchSize)
+	afterID := int64(0)
+	for {
+		args := append(append(h.GetFilterArgs(dbFilters), afterID), c.getExpiresArgs(h)...)
+		objs, err := c.getBatchFromDB(h, newObjFunc, query, args)
+		if err != nil {
+			return err
+		}
+		for _, o := range objs {
+			errFn := fn(o)
+			if errFn != nil {
+				return &ErrController{
+					Op:  "ForEach",
+					Err: fmt.Errorf("Error processing object: %w", errFn),
+				}
+			}
+		}
+		if len(objs) < batchSize {
+			return nil
+		}
+		afterID = c.GetModelIDValue(objs[len(objs)-1])
+	}
+}
+
+// getBatchFromDB runs select query of a batch, retrying it when it fails
+func (c Controller) getBatchFromDB(h *Helper, newObjFunc func() interface{}, query string, args []interface{}) ([]interface{}, *ErrController) {
+	backoff := forEachBackoff
+	for attempt := 1; ; attempt++ {
+		objs, err := c.getFromDBWithQuery(h, newObjFunc, query, args)
+		if err == nil || err.Op != "DBQuery" || c.tx != nil || attempt == forEachAttempts {
+			return objs, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,125 @@
+package crud
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var idPrefixRegExp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+const maxIDPad = 19
+
+// FormatModelID returns ID of object formatted with "idprefix" and "idpad"
+// tags of the ID field, eg. "INV-000123" for `crud:"idprefix:INV- idpad:6"`.
+// When they are not set, it is just the number
+func (c Controller) FormatModelID(obj interface{}) (string, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return "", err
+	}
+	return h.formatID(c.GetModelIDValue(obj)), nil
+}
+
+// ParseModelID returns ID from string that is formatted like FormatModelID
+// does, or that is just the number. The second value is false when s is not
+// a valid ID of the object
+func (c Controller) ParseModelID(obj interface{}, s string) (int64, bool) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return 0, false
+	}
+	s, ok := h.parseFormattedID(s)
+	if !ok && !idRegExp.MatchString(s) {
+		return 0, false
+	}
+	id, err2 := strconv.ParseInt(s, 10, 64)
+	if err2 != nil || id < 1 {
+		return 0, false
+	}
+	return id, true
+}
+
+// getPathWithParsedIDs returns relative path with IDs in the formatted form
+// replaced with numbers, so that "INV-000123/versions" becomes
+// "123/versions". Formatted IDs take precedence over slugs
+func (c Controller) getPathWithParsedIDs(path string, h *Helper) string {
+	if h == nil || h.idPrefix == "" {
+		return path
+	}
+	xp := strings.SplitN(path, "?", 2)
+	xs := strings.Split(xp[0], "/")
+	for i, x := range xs {
+		if id, ok := h.parseFormattedID(x); ok {
+			xs[i] = id
+		}
+	}
+	xp[0] = strings.Join(xs, "/")
+	return strings.Join(xp, "?")
+}
+
+// setIDFormatFromTagOpt sets sequence and format of the ID field from "seq",
+// "idprefix" and "idpad" tags
+func (h *Helper) setIDFormatFromTagOpt(opt string, fieldName string) *ErrHelper {
+	xs := strings.SplitN(opt, ":", 2)
+	if fieldName != "ID" {
+		return &ErrHelper{
+			Op:  "ParseTag",
+			Tag: xs[0],
+			Err: fmt.Errorf("field %s with %s must be ID", fieldName, xs[0]),
+		}
+	}
+	switch xs[0] {
+	case "seq":
+		if !dbColNameRegExp.MatchString(xs[1]) {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "seq",
+				Err: fmt.Errorf("invalid sequence name %s", xs[1]),
+			}
+		}
+		h.idSeqName = xs[1]
+	case "idprefix":
+		if !idPrefixRegExp.MatchString(xs[1]) {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "idprefix",
+				Err: fmt.Errorf("invalid prefix %s", xs[1]),
+			}
+		}
+		h.idPrefix = xs[1]
+	case "idpad":
+		i, err := strconv.Atoi(xs[1])
+		if err != nil || i < 1 || i > maxIDPad {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "idpad",
+				Err: fmt.Errorf("invalid padding %s", xs[1]),
+			}
+		}
+		h.idPad = i
+	}
+	return nil
+}
+
+// formatID returns ID with prefix and padded with zeros
+func (h *Helper) formatID(id int64) string {
+	return fmt.Sprintf("%s%0*d", h.idPrefix, h.idPad, id)
+}
+
+// parseFormattedID returns number from ID in the formatted form. Padding is
+// not required
+func (h *Helper) parseFormattedID(s string) (string, bool) {
+	if h.idPrefix == "" || !strings.HasPrefix(s, h.idPrefix) {
+		return s, false
+	}
+	num := strings.TrimLeft(strings.TrimPrefix(s, h.idPrefix), "0")
+	if num == "" {
+		num = "0"
+	}
+	if !idRegExp.MatchString(num) {
+		return s, false
+	}
+	return num, true
+}
@@ -3,6 +3,8 @@ module github.com/gen64/go-crud
 go 1.15
 
 require (
+	github.com/fxamacker/cbor/v2 v2.2.0
 	github.com/lib/pq v1.9.0
 	github.com/ory/dockertest/v3 v3.6.3
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 )
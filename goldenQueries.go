@@ -0,0 +1,100 @@
+package crud
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// NamedQuery is a query generated by Helper with name of the method that
+// returns it, without "GetQuery" prefix
+type NamedQuery struct {
+	Name  string
+	Query string
+}
+
+// GetQueries returns queries that Helper generates for the struct, in a fixed
+// order, so that tests can check that changes of the model produce expected
+// SQL. Select and count queries are generated without filters, and select
+// query with order by ID, limit 10 and offset 10. Queries are for PostgreSQL,
+// which is the only database supported
+func (h *Helper) GetQueries() []NamedQuery {
+	qs := []NamedQuery{
+		{"CreateTable", h.GetQueryCreateTable()},
+		{"DropTable", h.GetQueryDropTable()},
+		{"Insert", h.GetQueryInsert()},
+		{"InsertWithID", h.GetQueryInsertWithID()},
+		{"UpdateByIdReturning", h.GetQueryUpdateByIdReturning()},
+		{"SelectById", h.GetQuerySelectById()},
+		{"Select", h.GetQuerySelect([]string{"ID", "asc"}, 10, 10, nil, nil, nil)},
+		{"Count", h.GetQueryCount(nil, nil)},
+		{"SelectAfterID", h.GetQuerySelectAfterID()},
+		{"DeleteByIdReturning", h.GetQueryDeleteByIdReturning()},
+	}
+	if h.fieldSoftDel != "" {
+		qs = append(qs, NamedQuery{"SoftDeleteByIdReturning", h.GetQuerySoftDeleteByIdReturning()})
+	}
+	renames := h.GetQueriesRenameColumns()
+	oldCols := []string{}
+	for oldCol := range renames {
+		oldCols = append(oldCols, oldCol)
+	}
+	sort.Strings(oldCols)
+	for _, oldCol := range oldCols {
+		qs = append(qs, NamedQuery{"RenameColumn " + oldCol, renames[oldCol]})
+	}
+	return qs
+}
+
+// GetQueriesText returns queries from GetQueries as text, each one preceded
+// by a comment with its name, that can be stored in a golden file
+func (h *Helper) GetQueriesText() string {
+	s := ""
+	for _, q := range h.GetQueries() {
+		s += fmt.Sprintf("-- %s\n%s;\n\n", q.Name, q.Query)
+	}
+	return s
+}
+
+// CheckGoldenQueries compares queries generated for the struct with the ones
+// in golden file at path, and returns error with the first line that differs.
+// When update is true, file is written with current queries instead, eg.
+// after an intended change of the model. It is meant to be used in tests:
+//
+//	err := crud.CheckGoldenQueries(crud.NewHelper(&User{}, "", "", nil), "testdata/users.postgres.sql", *update)
+func CheckGoldenQueries(h *Helper, path string, update bool) error {
+	if h.Err() != nil {
+		return h.Err()
+	}
+	got := h.GetQueriesText()
+	if update {
+		return ioutil.WriteFile(path, []byte(got), 0644)
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("Golden file %s does not exist, write it with update", path)
+	}
+	if err != nil {
+		return fmt.Errorf("Error reading golden file: %w", err)
+	}
+	want := string(b)
+	if got == want {
+		return nil
+	}
+	gotLines, wantLines := strings.Split(got, "\n"), strings.Split(want, "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		g, w := "", ""
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			return fmt.Errorf("Queries differ from golden file %s at line %d, want %q, got %q", path, i+1, w, g)
+		}
+	}
+	return nil
+}
@@ -1,12 +1,19 @@
 package crud
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -18,15 +25,18 @@ import (
 // Field validation is parsed out from the "crud" tag.
 // Helper is created within Controller and there is no need to instantiate it
 type Helper struct {
-	queryDropTable    string
-	queryCreateTable  string
-	queryInsert       string
-	queryUpdateById   string
-	querySelectById   string
-	queryDeleteById   string
-	querySelectPrefix string
+	queryDropTable         string
+	queryCreateTable       string
+	queryCreateTableSorted string
+	queryInsert            string
+	queryUpdateById        string
+	querySelectById        string
+	queryDeleteById        string
+	querySelectPrefix      string
+	queryReturning         string
 
 	dbTbl       string
+	modelName   string
 	dbColPrefix string
 	dbFieldCols map[string]string
 	dbCols      map[string]string
@@ -34,6 +44,7 @@ type Helper struct {
 	fields      []string
 
 	fieldsRequired     map[string]bool
+	fieldsRequiredOps  map[string]int
 	fieldsLength       map[string][2]int
 	fieldsEmail        map[string]bool
 	fieldsValue        map[string][2]int
@@ -42,26 +53,211 @@ type Helper struct {
 	fieldsDefaultValue map[string]string
 	fieldsUniq         map[string]bool
 	fieldsTags         map[string]map[string]string
+	fieldsJSONB        map[string]bool
+	fieldsTransforms   map[string][]string
+	fieldsSlug         map[string]string
+	fieldsLookup       map[string]bool
+	fieldsNested       map[string]*Helper
+	fieldsJSONName     map[string]string
+	fieldsJSONHidden   map[string]bool
+	fieldsJSONOmit     map[string]bool
+	fieldsValuerDBType map[string]string
+	fieldsType         map[string]reflect.Type
+	fieldsOrder        map[string]int
+	fieldsWas          map[string]string
+	fieldsCol          map[string]string
+	// fieldsDBText and fieldsDBLen contain string fields with "dbtype:text"
+	// and sizes of the ones with "dblen" tag, and fieldsDBLenMax the ones
+	// with "dblen:lenmax" tag
+	fieldsDBText     map[string]bool
+	fieldsDBLen      map[string]int
+	fieldsDBLenMax   map[string]bool
+	fieldsCurrency   map[string]string
+	jsonAliases      map[string]string
+	fieldsFilterable map[string]bool
+	fieldsSearchable map[string]bool
+	fieldsIndex      map[string]bool
+	// indexes contains names of fields of indexes from "index" tag of fields
+	// and of blank fields, eg. `_ struct{} crud:"index:LastName,FirstName"`
+	indexes         [][]string
+	fieldsSensitive map[string]string
+	// fieldsFK contains names of models that fields with "fk" tag link to,
+	// and fieldsFKRef their tables and ID columns
+	fieldsFK       map[string]string
+	fieldsFKRef    map[string][2]string
+	fieldsOnDelete map[string]string
+	fieldsBitFlags map[string]bool
+	// idSeqName is name of sequence from "seq" tag of ID field, without the
+	// table prefix, and idSeq is the name of the sequence in the database.
+	// idPrefix and idPad are used to format IDs, eg. "INV-000123"
+	idSeqName string
+	idSeq     string
+	idPrefix  string
+	idPad     int
+	// fieldsRel contains names of fields with ID of related object for fields
+	// with "rel" tag, which are pointers to related structs
+	fieldsRel         map[string]string
+	fieldsRelJSONName map[string]string
+	fieldExpires      string
+	fieldSoftDel      string
+	fieldCreatedBy    string
+	fieldTenant       string
+	fieldUpdatedBy    string
+	fieldCreatedAt    string
+	fieldUpdatedAt    string
+
+	unmappedFields []string
+
+	// includeDeleted makes queries return soft-deleted rows, and
+	// helperWithDeleted is a Helper of the same struct with it set
+	includeDeleted    bool
+	helperWithDeleted *Helper
+	typeConverters    map[reflect.Type]*TypeConverter
+	// fkHelper returns Helper of model that field with "fk" tag links to,
+	// or nil when it is not known
+	fkHelper func(model string) *Helper
 
 	fieldsFlags map[string]int
 
 	flags int
 
 	defaultFieldsTags map[string]map[string]string
+	// sourceFieldsFlags are flags of fields of the model that the struct is
+	// a DTO of. Fields the model does not have are not selected
+	sourceFieldsFlags map[string]int
+	// sourceDBTbl is table of the model, which can be set with TableName
+	sourceDBTbl string
+	// sourceFieldsCol are column names of fields of the model set with the
+	// "col" tag
+	sourceFieldsCol map[string]string
 
 	err *ErrHelper
 }
 
+var emailRegExp = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+var pluralYRegExp = regexp.MustCompile(`y$`)
+var pluralSRegExp = regexp.MustCompile(`s$`)
+var slugRegExp = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+var dbColNameRegExp = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+var slugInvalidCharsRegExp = regexp.MustCompile(`[^a-z0-9]+`)
+
+// opNames maps operation names used in tags to operation values
+var opNames = map[string]int{
+	"read":   OpRead,
+	"update": OpUpdate,
+	"create": OpCreate,
+	"delete": OpDelete,
+	"list":   OpList,
+}
+
 const TypeInt64 = 64
 const TypeInt = 128
 const TypeString = 256
+const TypeJSONB = 512
+const TypeInt32 = 1024
+const TypeInt8 = 2048
+const TypeInt16 = 4096
+const TypeUint = 8192
+const TypeUint8 = 16384
+const TypeUint16 = 32768
+const TypeUint32 = 65536
+const TypeUint64 = 131072
+const TypeValuer = 262144
+const TypeConverted = 524288
+const TypeTime = 1048576
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+var timeType = reflect.TypeOf(time.Time{})
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+var nullInt64Type = reflect.TypeOf(sql.NullInt64{})
+var nullStringType = reflect.TypeOf(sql.NullString{})
+var moneyType = reflect.TypeOf(Money{})
+
+// maxVarcharLen is the maximum size of VARCHAR column in PostgreSQL
+const maxVarcharLen = 10485760
+
+// onDeleteActions maps values of "ondelete" tag to actions of foreign keys
+var onDeleteActions = map[string]string{
+	"cascade":  "CASCADE",
+	"restrict": "RESTRICT",
+	"setnull":  "SET NULL",
+	"noaction": "NO ACTION",
+}
+
+// valuerDBTypes maps known types implementing driver.Valuer to column types
+var valuerDBTypes = map[reflect.Type]string{
+	reflect.TypeOf(sql.NullString{}):  "VARCHAR(255)",
+	reflect.TypeOf(sql.NullInt64{}):   "BIGINT",
+	reflect.TypeOf(sql.NullInt32{}):   "INTEGER",
+	reflect.TypeOf(sql.NullFloat64{}): "DOUBLE PRECISION",
+	reflect.TypeOf(sql.NullBool{}):    "BOOLEAN",
+	reflect.TypeOf(sql.NullTime{}):    "TIMESTAMP WITH TIME ZONE",
+	reflect.TypeOf(Point{}):           "POINT",
+	reflect.TypeOf(Money{}):           "BIGINT",
+}
+
+// kindTypes maps kinds of struct fields to Type* values
+var kindTypes = map[reflect.Kind]int{
+	reflect.Int64:  TypeInt64,
+	reflect.Int:    TypeInt,
+	reflect.String: TypeString,
+	reflect.Int32:  TypeInt32,
+	reflect.Int8:   TypeInt8,
+	reflect.Int16:  TypeInt16,
+	reflect.Uint:   TypeUint,
+	reflect.Uint8:  TypeUint8,
+	reflect.Uint16: TypeUint16,
+	reflect.Uint32: TypeUint32,
+	reflect.Uint64: TypeUint64,
+}
+
+// helperOptions contains Controller settings that change how struct is
+// reflected
+type helperOptions struct {
+	strict         bool
+	typeConverters map[reflect.Type]*TypeConverter
+	includeDeleted bool
+	fkHelper       func(model string) *Helper
+}
+
+// TableNamer is implemented by structs that are stored in a table with name
+// other than the generated one, eg. an existing table. Table prefix is not
+// added to the name
+type TableNamer interface {
+	TableName() string
+}
 
 // NewHelper takes object and database table name prefix as arguments and
 // returns Helper instance
 func NewHelper(obj interface{}, dbTblPrefix string, forceName string, sourceHelper *Helper) *Helper {
+	return newHelperWithOptions(obj, dbTblPrefix, forceName, sourceHelper, helperOptions{})
+}
+
+// NewStrictHelper works like NewHelper but Helper gets an error when the struct
+// has exported fields of types that cannot be mapped to database columns,
+// instead of silently skipping them
+func NewStrictHelper(obj interface{}, dbTblPrefix string, forceName string, sourceHelper *Helper) *Helper {
+	return newHelperWithOptions(obj, dbTblPrefix, forceName, sourceHelper, helperOptions{strict: true})
+}
+
+func newHelperWithOptions(obj interface{}, dbTblPrefix string, forceName string, sourceHelper *Helper, opts helperOptions) *Helper {
 	h := &Helper{}
+	h.typeConverters = opts.typeConverters
+	h.includeDeleted = opts.includeDeleted
+	h.fkHelper = opts.fkHelper
 	h.setDefaultTags(sourceHelper)
 	h.reflectStruct(obj, dbTblPrefix, forceName)
+	if opts.strict && h.err == nil && len(h.unmappedFields) > 0 {
+		h.err = &ErrHelper{
+			Op:     "ReflectStruct",
+			Fields: h.unmappedFields,
+			Err:    fmt.Errorf("fields with unsupported types: %s", strings.Join(h.unmappedFields, ", ")),
+		}
+	}
+	if h.err == nil && h.fieldSoftDel != "" && !opts.includeDeleted {
+		opts.includeDeleted = true
+		h.helperWithDeleted = newHelperWithOptions(obj, dbTblPrefix, forceName, sourceHelper, opts)
+	}
 	return h
 }
 
@@ -85,29 +281,789 @@ func (h Helper) GetQueryCreateTable() string {
 	return h.queryCreateTable
 }
 
+// GetQueryCreateTableWithOptions returns create table query changed according
+// to opts
+func (h Helper) GetQueryCreateTableWithOptions(opts DDLOptions) string {
+	q := h.queryCreateTable
+	if opts.Sorted {
+		q = h.queryCreateTableSorted
+	}
+	if opts.IfNotExists {
+		q = strings.Replace(q, "CREATE TABLE ", "CREATE TABLE IF NOT EXISTS ", 1)
+	}
+	return q
+}
+
+// GetQueriesCreateTableWithOptions returns create table query changed
+// according to opts, followed by queries enabling row-level security and
+// granting privileges when they are set in opts. It is preceded by query
+// creating sequence of the ID column when it is set with "seq" tag
+func (h Helper) GetQueriesCreateTableWithOptions(opts DDLOptions) []string {
+	qs := []string{}
+	if h.idSeq != "" {
+		qs = append(qs, fmt.Sprintf("CREATE SEQUENCE IF NOT EXISTS %s", h.idSeq))
+	}
+	qs = append(qs, h.GetQueryCreateTableWithOptions(opts))
+	qs = append(qs, h.GetQueriesCreateIndexes()...)
+	if opts.RLS {
+		qs = append(qs, h.GetQueriesRLS(opts)...)
+	}
+	return append(qs, h.GetQueriesGrant(opts.Grants)...)
+}
+
+// maxIdentifierLen is the maximum length of names in PostgreSQL, longer ones
+// are truncated
+const maxIdentifierLen = 63
+
+// GetQueriesCreateIndexes returns "CREATE INDEX" queries of indexes declared
+// with "index" tags. Indexes are named after the table and their columns
+// (see getIndexNames) and are not created when they exist
+func (h Helper) GetQueriesCreateIndexes() []string {
+	return h.getQueriesCreateIndexes("")
+}
+
+// GetQueriesCreateIndexesConcurrently returns queries like
+// GetQueriesCreateIndexes that build indexes without blocking writes to the
+// table. They cannot be run in a transaction
+func (h Helper) GetQueriesCreateIndexesConcurrently() []string {
+	return h.getQueriesCreateIndexes("CONCURRENTLY ")
+}
+
+// getQueriesCreateIndexes returns "CREATE INDEX" queries with option, eg.
+// "CONCURRENTLY "
+func (h Helper) getQueriesCreateIndexes(option string) []string {
+	qs := []string{}
+	names := h.getIndexNames()
+	for i, fields := range h.indexes {
+		cols := make([]string, len(fields))
+		for j, f := range fields {
+			cols[j] = h.dbFieldCols[f]
+		}
+		qs = append(qs, fmt.Sprintf("CREATE INDEX %sIF NOT EXISTS %s ON %s (%s)", option, names[i], h.dbTbl, strings.Join(cols, ",")))
+	}
+	return qs
+}
+
+// getIndexNames returns names of indexes declared with "index" tags, made of
+// the table and the columns. Names longer than the database allows are cut
+// and end with a hash of the full name, so that they stay different
+func (h Helper) getIndexNames() []string {
+	names := []string{}
+	for _, fields := range h.indexes {
+		cols := make([]string, len(fields))
+		for i, f := range fields {
+			cols[i] = h.dbFieldCols[f]
+		}
+		name := fmt.Sprintf("%s_%s_idx", h.dbTbl, strings.Join(cols, "_"))
+		if len(name) > maxIdentifierLen {
+			sum := sha256.Sum256([]byte(name))
+			name = fmt.Sprintf("%s_%s_idx", name[:maxIdentifierLen-13], hex.EncodeToString(sum[:4]))
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// GetQueriesGrant returns "GRANT" queries giving roles privileges on the
+// table, that are needed for their operations. SELECT is granted with write
+// privileges as well, as writes return the rows and filter them in WHERE.
+// Roles that create objects get access to the sequence of the primary key as
+// well
+func (h Helper) GetQueriesGrant(grants []Grant) []string {
+	qs := []string{}
+	for _, g := range grants {
+		privs := ""
+		for _, p := range []struct {
+			ops  int
+			priv string
+		}{{OpRead | OpList | OpCreate | OpUpdate | OpDelete, "SELECT"}, {OpCreate, "INSERT"}, {OpUpdate, "UPDATE"}, {OpDelete, "DELETE"}} {
+			if g.Ops&p.ops != 0 {
+				privs = h.addWithComma(privs, p.priv)
+			}
+		}
+		if privs == "" {
+			continue
+		}
+		role := `"` + strings.Replace(g.Role, `"`, `""`, -1) + `"`
+		qs = append(qs, fmt.Sprintf("GRANT %s ON %s TO %s", privs, h.dbTbl, role))
+		if g.Ops&OpCreate != 0 {
+			qs = append(qs, fmt.Sprintf("GRANT USAGE ON SEQUENCE %s TO %s", h.getIDSequence(), role))
+		}
+	}
+	return qs
+}
+
+// GetQueryDropTableWithOptions returns drop table query changed according to
+// opts
+func (h Helper) GetQueryDropTableWithOptions(opts DDLOptions) string {
+	if opts.Cascade {
+		return h.queryDropTable + " CASCADE"
+	}
+	return h.queryDropTable
+}
+
+// GetQueriesRLS returns queries that enable row-level security on the table
+// and create policy allowing only rows of the current tenant and user, when
+// struct has fields with "tenant" or "createdby" tag. Values are taken from
+// session settings named in opts, and rows are not visible when they are not
+// set
+func (h Helper) GetQueriesRLS(opts DDLOptions) []string {
+	cond := ""
+	for _, f := range [][2]string{{h.fieldTenant, opts.TenantSetting}, {h.fieldCreatedBy, opts.UserSetting}} {
+		if f[0] == "" {
+			continue
+		}
+		setting := f[1]
+		if setting == "" && f[0] == h.fieldTenant {
+			setting = "app.tenant_id"
+		} else if setting == "" {
+			setting = "app.user_id"
+		}
+		cond = h.addWithAnd(cond, fmt.Sprintf("%s = NULLIF(current_setting('%s', true), '')::bigint", h.dbFieldCols[f[0]], strings.Replace(setting, "'", "''", -1)))
+	}
+	if cond == "" {
+		return nil
+	}
+
+	policy := h.dbTbl + "_scope"
+	qs := []string{fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY", h.dbTbl)}
+	if opts.RLSForce {
+		qs = append(qs, fmt.Sprintf("ALTER TABLE %s FORCE ROW LEVEL SECURITY", h.dbTbl))
+	}
+	return append(qs,
+		fmt.Sprintf("DROP POLICY IF EXISTS %s ON %s", policy, h.dbTbl),
+		fmt.Sprintf("CREATE POLICY %s ON %s USING (%s) WITH CHECK (%s)", policy, h.dbTbl, cond, cond),
+	)
+}
+
+// GetQueriesRenameColumns returns "ALTER TABLE ... RENAME COLUMN" queries for
+// fields that have previous column name set with the "was" tag. Keys of the
+// returned map are previous column names
+func (h *Helper) GetQueriesRenameColumns() map[string]string {
+	qs := map[string]string{}
+	for oldCol, newCol := range h.getRenamedCols() {
+		qs[oldCol] = fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", h.dbTbl, oldCol, newCol)
+	}
+	return qs
+}
+
+// getRenamedCols returns map of previous column names set with the "was" tag
+// to current column names
+func (h *Helper) getRenamedCols() map[string]string {
+	cols := map[string]string{}
+	for _, k := range h.fields {
+		if h.fieldsWas[k] == "" || h.fieldsWas[k] == h.dbFieldCols[k] {
+			continue
+		}
+		cols[h.fieldsWas[k]] = h.dbFieldCols[k]
+	}
+	return cols
+}
+
+// GetQueryCreateTableSorted returns create table query with columns sorted
+// by name (primary key column goes first), so it does not change when fields
+// are moved around in the struct
+func (h Helper) GetQueryCreateTableSorted() string {
+	return h.queryCreateTableSorted
+}
+
+// GetQueryInsertMany returns insert query that inserts n rows at once and
+// returns all the columns of each of them. The database does not guarantee
+// that returned rows are in the order of inserted ones, see
+// GetQueryInsertManyWithID
+func (h *Helper) GetQueryInsertMany(n int) string {
+	cols := ""
+	for _, f := range h.fields {
+		if f != "ID" {
+			cols = h.addWithComma(cols, h.dbFieldCols[f])
+		}
+	}
+	vals := ""
+	i := 1
+	for r := 0; r < n; r++ {
+		row := ""
+		for j := 1; j < len(h.fields); j++ {
+			row = h.addWithComma(row, "$"+strconv.Itoa(i))
+			i++
+		}
+		vals = h.addWithComma(vals, "("+row+")")
+	}
+	return fmt.Sprintf("INSERT INTO %s(%s) VALUES %s%s", h.dbTbl, cols, vals, h.queryReturning)
+}
+
+// GetQueryInsertManyWithID returns insert query that inserts n rows at once,
+// with IDs, eg. from GetQueryNextIDs, so that returned rows can be matched
+// with inserted ones
+func (h *Helper) GetQueryInsertManyWithID(n int) string {
+	cols := h.dbFieldCols["ID"]
+	for _, f := range h.fields {
+		if f != "ID" {
+			cols = h.addWithComma(cols, h.dbFieldCols[f])
+		}
+	}
+	vals := ""
+	i := 1
+	for r := 0; r < n; r++ {
+		row := ""
+		for j := 0; j < len(h.fields); j++ {
+			row = h.addWithComma(row, "$"+strconv.Itoa(i))
+			i++
+		}
+		vals = h.addWithComma(vals, "("+row+")")
+	}
+	return fmt.Sprintf("INSERT INTO %s(%s) VALUES %s%s", h.dbTbl, cols, vals, h.queryReturning)
+}
+
+// GetQueryNextIDs returns query that takes IDs for as many rows as the first
+// argument from the sequence of the ID column
+func (h *Helper) GetQueryNextIDs() string {
+	if h.idSeq != "" {
+		return fmt.Sprintf("SELECT nextval('%s') FROM generate_series(1, $1)", h.idSeq)
+	}
+	return fmt.Sprintf("SELECT nextval(pg_get_serial_sequence('%s', '%s')) FROM generate_series(1, $1)", h.dbTbl, h.dbFieldCols["ID"])
+}
+
 // GetQueryInsert returns insert query
 func (h *Helper) GetQueryInsert() string {
 	return h.queryInsert
 }
 
+// GetQueryInsertWithID returns insert query that sets the ID column as well,
+// which is the first argument
+func (h *Helper) GetQueryInsertWithID() string {
+	cols := h.dbFieldCols["ID"]
+	vals := "$1"
+	i := 2
+	for _, f := range h.fields {
+		if f != "ID" {
+			cols = h.addWithComma(cols, h.dbFieldCols[f])
+			vals = h.addWithComma(vals, "$"+strconv.Itoa(i))
+			i++
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %s(%s) VALUES (%s)", h.dbTbl, cols, vals)
+}
+
+// GetQueryUpsertWithID returns query that inserts row with ID, which is the
+// first argument, or updates all the columns of existing row with the ID
+func (h *Helper) GetQueryUpsertWithID() string {
+	sets := ""
+	for _, f := range h.fields {
+		if f != "ID" {
+			sets = h.addWithComma(sets, h.dbFieldCols[f]+"=EXCLUDED."+h.dbFieldCols[f])
+		}
+	}
+	return fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", h.GetQueryInsertWithID(), h.dbFieldCols["ID"], sets)
+}
+
+// GetQueryResetIDSequence returns query that sets sequence of the ID column
+// so that next inserted row gets ID greater than any existing one
+func (h *Helper) GetQueryResetIDSequence() string {
+	idCol := h.dbFieldCols["ID"]
+	if h.idSeq != "" {
+		return fmt.Sprintf("SELECT setval('%s', COALESCE(MAX(%s), 0) + 1, false) FROM %s", h.idSeq, idCol, h.dbTbl)
+	}
+	return fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 0) + 1, false) FROM %s", h.dbTbl, idCol, idCol, h.dbTbl)
+}
+
+// GetQueryDropIDSequence returns query dropping sequence of the ID column set
+// with "seq" tag, or empty string when there is none. As sequence can be
+// shared by many tables, the query fails while it is still used by any of them
+func (h *Helper) GetQueryDropIDSequence() string {
+	if h.idSeq == "" {
+		return ""
+	}
+	return fmt.Sprintf("DROP SEQUENCE IF EXISTS %s", h.idSeq)
+}
+
+// getIDSequence returns name of sequence of the ID column, which is the one
+// from "seq" tag or the one created for the SERIAL column
+func (h *Helper) getIDSequence() string {
+	if h.idSeq != "" {
+		return h.idSeq
+	}
+	return fmt.Sprintf("%s_%s_seq", h.dbTbl, h.dbFieldCols["ID"])
+}
+
 // GetQueryUpdateById returns update query
 func (h *Helper) GetQueryUpdateById() string {
 	return h.queryUpdateById
 }
 
+// GetQueryUpdateByIdReturning returns update query that also returns all the
+// columns of the updated row, eg. ones modified by triggers
+func (h *Helper) GetQueryUpdateByIdReturning() string {
+	return h.queryUpdateById + h.queryReturning
+}
+
+// GetQuerySearch returns select query that gets up to limit objects with any
+// of the fields with "searchable" tag matching ILIKE pattern in $1
+func (h *Helper) GetQuerySearch(limit int) string {
+	cond := ""
+	for _, k := range h.fields {
+		if h.fieldsSearchable[k] {
+			if cond != "" {
+				cond += " OR "
+			}
+			cond += h.dbFieldCols[k] + " ILIKE $1"
+		}
+	}
+	return fmt.Sprintf("%s WHERE (%s)%s%s ORDER BY %s ASC LIMIT %d", h.querySelectPrefix, cond, h.getExpiresCondition(2, " AND "), h.getSoftDelCondition(" AND "), h.getFieldDBCol("ID"), limit)
+}
+
+// GetQuerySelectByField returns select query that gets object by value of
+// a specific field, eg. slug
+func (h *Helper) GetQuerySelectByField(fieldName string) string {
+	return fmt.Sprintf("%s WHERE %s = $1%s%s", h.querySelectPrefix, h.getFieldDBCol(fieldName), h.getExpiresCondition(2, " AND "), h.getSoftDelCondition(" AND "))
+}
+
+// getExpiresCondition returns condition excluding expired rows, with current
+// Unix timestamp in $n, when struct has field with "expires" tag. Value of 0
+// means that row never expires
+func (h *Helper) getExpiresCondition(n int, prefix string) string {
+	return h.getExpiresConditionWithAlias(n, prefix, "")
+}
+
+// getExpiresConditionWithAlias works like getExpiresCondition but with column
+// qualified with table alias
+func (h *Helper) getExpiresConditionWithAlias(n int, prefix string, alias string) string {
+	if h.fieldExpires == "" {
+		return ""
+	}
+	col := h.getColWithAlias(h.getFieldDBCol(h.fieldExpires), alias)
+	return fmt.Sprintf("%s(%s = 0 OR %s > $%d)", prefix, col, col, n)
+}
+
+// getSoftDelCondition returns condition excluding soft-deleted rows when
+// struct has field with "softdel" tag, unless Helper includes them
+func (h *Helper) getSoftDelCondition(prefix string) string {
+	return h.getSoftDelConditionWithAlias(prefix, "")
+}
+
+// getSoftDelConditionWithAlias works like getSoftDelCondition but with column
+// qualified with table alias
+func (h *Helper) getSoftDelConditionWithAlias(prefix string, alias string) string {
+	if !h.excludesDeleted() {
+		return ""
+	}
+	return fmt.Sprintf("%s%s = 0", prefix, h.getColWithAlias(h.getFieldDBCol(h.fieldSoftDel), alias))
+}
+
+// excludesDeleted checks if struct has field with "softdel" tag and
+// soft-deleted rows are excluded from queries
+func (h *Helper) excludesDeleted() bool {
+	return h.fieldSoftDel != "" && !h.includeDeleted
+}
+
+// hasExpires checks if struct has field with "expires" tag
+func (h *Helper) hasExpires() bool {
+	return h.fieldExpires != ""
+}
+
+// getQuerySelectSlugs returns query that gets values of slug field that are
+// equal to $1 or start with $2, eg. "post" and "post-%"
+func (h *Helper) getQuerySelectSlugs(fieldName string) string {
+	col := h.getFieldDBCol(fieldName)
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 OR %s LIKE $2", col, h.dbTbl, col, col)
+}
+
+// GetQueryCountByFieldExcludingID returns query that counts rows with
+// specific value of a field in $1 and ID other than $2
+func (h *Helper) GetQueryCountByFieldExcludingID(fieldName string) string {
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = $1 AND %s <> $2", h.dbTbl, h.getFieldDBCol(fieldName), h.getFieldDBCol("ID"))
+}
+
 // GetQuerySelectById returns select query
 func (h *Helper) GetQuerySelectById() string {
 	return h.querySelectById
 }
 
+// GetQueryUpdateByIdWhere returns update query just like
+// GetQueryUpdateByIdReturning does but with additional conditions on values
+// of fields from filters, so that row is updated only when they are met
+func (h *Helper) GetQueryUpdateByIdWhere(filters map[string]interface{}) string {
+	return h.getQueryUpdateByIdWhere(filters) + h.queryReturning
+}
+
+// getQueryUpdateByIdWhere returns query from GetQueryUpdateByIdWhere without
+// the RETURNING clause
+func (h *Helper) getQueryUpdateByIdWhere(filters map[string]interface{}) string {
+	qWhere, _ := h.getFiltersCondition(filters, nil, len(h.fields)+1)
+	if qWhere == "" {
+		return h.queryUpdateById
+	}
+	return h.queryUpdateById + " AND " + qWhere
+}
+
+// GetQueryUpdateFieldsById returns update query that sets only columns of
+// specified fields, in the same order
+func (h *Helper) GetQueryUpdateFieldsById(fields []string) string {
+	colVals := ""
+	for i, f := range fields {
+		colVals = h.addWithComma(colVals, h.getFieldDBCol(f)+"=$"+strconv.Itoa(i+1))
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s = $%d", h.dbTbl, colVals, h.getFieldDBCol("ID"), len(fields)+1)
+}
+
+// GetQueryUpdateWhere returns update query that sets columns of specified
+// fields, in the same order, in all rows matching filters, with values of
+// filters numbered after them and current time for field with "expires" tag
+// as the last argument
+func (h *Helper) GetQueryUpdateWhere(fields []string, filters map[string]interface{}) string {
+	colVals := ""
+	for i, f := range fields {
+		colVals = h.addWithComma(colVals, h.getFieldDBCol(f)+"=$"+strconv.Itoa(i+1))
+	}
+	s := fmt.Sprintf("UPDATE %s SET %s", h.dbTbl, colVals)
+	if qWhere := h.getWhereCondition(filters, len(fields)+1); qWhere != "" {
+		s += " WHERE " + qWhere
+	}
+	return s
+}
+
+// GetQueryDeleteWhere returns delete query that removes all rows matching
+// filters, with arguments just like in GetQueryCount
+func (h *Helper) GetQueryDeleteWhere(filters map[string]interface{}) string {
+	s := fmt.Sprintf("DELETE FROM %s", h.dbTbl)
+	if qWhere := h.getWhereCondition(filters, 1); qWhere != "" {
+		s += " WHERE " + qWhere
+	}
+	return s
+}
+
+// GetQuerySoftDeleteWhere returns query that sets field with "softdel" tag to
+// $1 in all rows matching filters that are not soft-deleted yet, with values
+// of filters numbered after it
+func (h *Helper) GetQuerySoftDeleteWhere(filters map[string]interface{}) string {
+	col := h.getFieldDBCol(h.fieldSoftDel)
+	qWhere := h.getWhereCondition(filters, 2)
+	if !h.excludesDeleted() {
+		qWhere = h.addWithAnd(qWhere, col+" = 0")
+	}
+	return fmt.Sprintf("UPDATE %s SET %s = $1 WHERE %s", h.dbTbl, col, qWhere)
+}
+
+// getWhereCondition returns conditions on filters, with query arguments
+// numbered from i, and conditions excluding expired and soft-deleted rows
+func (h *Helper) getWhereCondition(filters map[string]interface{}, i int) string {
+	qWhere, i := h.getFiltersCondition(filters, nil, i)
+	if h.hasExpires() {
+		qWhere = h.addWithAnd(qWhere, h.getExpiresCondition(i, ""))
+	}
+	if h.excludesDeleted() {
+		qWhere = h.addWithAnd(qWhere, h.getSoftDelCondition(""))
+	}
+	return qWhere
+}
+
 // GetQueryDeleteById returns delete query
 func (h *Helper) GetQueryDeleteById() string {
 	return h.queryDeleteById
 }
 
+// GetQueryDeleteByIdReturning returns delete query that also returns all the
+// columns of the deleted row
+func (h *Helper) GetQueryDeleteByIdReturning() string {
+	return h.queryDeleteById + h.queryReturning
+}
+
+// GetQuerySoftDeleteByIdReturning returns query that sets field with "softdel"
+// tag to $2, when row is not soft-deleted yet, and returns all the columns
+// of the row
+func (h *Helper) GetQuerySoftDeleteByIdReturning() string {
+	return h.getQuerySoftDeleteById() + h.queryReturning
+}
+
+// getQuerySoftDeleteById returns query from GetQuerySoftDeleteByIdReturning
+// without the RETURNING clause
+func (h *Helper) getQuerySoftDeleteById() string {
+	col := h.getFieldDBCol(h.fieldSoftDel)
+	return fmt.Sprintf("UPDATE %s SET %s = $2 WHERE %s = $1 AND %s = 0", h.dbTbl, col, h.getFieldDBCol("ID"), col)
+}
+
+// GetQueryDeleteOlderThan returns delete query that removes rows where value of
+// a field is greater than 0 and lower than $1, eg. expired ones
+func (h *Helper) GetQueryDeleteOlderThan(fieldName string) string {
+	col := h.getFieldDBCol(fieldName)
+	return fmt.Sprintf("DELETE FROM %s WHERE %s > 0 AND %s < $1", h.dbTbl, col, col)
+}
+
+// GetQueryDeleteByField returns delete query that removes rows with value
+// of a field equal to $1
+func (h *Helper) GetQueryDeleteByField(fieldName string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s = $1", h.dbTbl, h.getFieldDBCol(fieldName))
+}
+
+// getQuerySelectIDsByField returns query that gets IDs of all rows, including
+// expired and soft deleted ones, with value of a field in array $1
+func (h *Helper) getQuerySelectIDsByField(fieldName string) string {
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s = ANY($1) ORDER BY %s ASC", h.getFieldDBCol("ID"), h.dbTbl, h.getFieldDBCol(fieldName), h.getFieldDBCol("ID"))
+}
+
+// getQueryDeleteByIDs returns query that removes rows with IDs in array $1
+func (h *Helper) getQueryDeleteByIDs() string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s = ANY($1)", h.dbTbl, h.getFieldDBCol("ID"))
+}
+
+// GetQuerySelectAllByField returns select query that gets all objects with
+// value of a field equal to $1, including expired ones, in the order of ID
+func (h *Helper) GetQuerySelectAllByField(fieldName string) string {
+	return fmt.Sprintf("%s WHERE %s = $1 ORDER BY %s ASC", h.querySelectPrefix, h.getFieldDBCol(fieldName), h.getFieldDBCol("ID"))
+}
+
+// GetQueryDeleteAll returns query that removes all the rows from the table
+func (h *Helper) GetQueryDeleteAll() string {
+	return fmt.Sprintf("DELETE FROM %s", h.dbTbl)
+}
+
+// GetQueryInsertSummary returns query that inserts number of rows of sh's
+// table, grouped by groupBy fields, into the table with the count in column of
+// countField. Arguments are values of filters and then current time when sh's
+// struct has field with "expires" tag
+func (h *Helper) GetQueryInsertSummary(sh *Helper, groupBy []string, countField string, filters map[string]interface{}) string {
+	cols := ""
+	srcCols := ""
+	for _, f := range groupBy {
+		cols = h.addWithComma(cols, h.dbFieldCols[f])
+		srcCols = h.addWithComma(srcCols, sh.dbFieldCols[f])
+	}
+	qWhere, i := sh.getFiltersCondition(filters, nil, 1)
+	if sh.hasExpires() {
+		qWhere = h.addWithAnd(qWhere, sh.getExpiresCondition(i, ""))
+	}
+	if sh.excludesDeleted() {
+		qWhere = h.addWithAnd(qWhere, sh.getSoftDelCondition(""))
+	}
+	if qWhere != "" {
+		qWhere = " WHERE " + qWhere
+	}
+	return fmt.Sprintf("INSERT INTO %s(%s,%s) SELECT %s,COUNT(*) FROM %s%s GROUP BY %s", h.dbTbl, cols, h.dbFieldCols[countField], srcCols, sh.dbTbl, qWhere, srcCols)
+}
+
+// GetQuerySelectAfterID returns select query that gets $2 rows with ID greater
+// than $1, in the order of ID, for going through the whole table in batches
+func (h *Helper) GetQuerySelectAfterID() string {
+	col := h.getFieldDBCol("ID")
+	return fmt.Sprintf("%s WHERE %s > $1 ORDER BY %s ASC LIMIT $2", h.querySelectPrefix, col, col)
+}
+
+// GetQuerySelectBetweenIDs returns select query that gets rows with ID
+// greater than $1 and not greater than $2, in the order of ID
+func (h *Helper) GetQuerySelectBetweenIDs() string {
+	col := h.getFieldDBCol("ID")
+	return fmt.Sprintf("%s WHERE %s > $1 AND %s <= $2 ORDER BY %s ASC", h.querySelectPrefix, col, col, col)
+}
+
+// GetQuerySelectAfterIDWhere returns select query that gets up to limit rows
+// matching filters with ID greater than afterID, in the order of ID.
+// Arguments are values of filters, then afterID and then current time when
+// struct has field with "expires" tag
+func (h *Helper) GetQuerySelectAfterIDWhere(filters map[string]interface{}, limit int) string {
+	qWhere, i := h.getFiltersCondition(filters, nil, 1)
+	qWhere = h.addWithAnd(qWhere, fmt.Sprintf("%s > $%d", h.getFieldDBCol("ID"), i))
+	return h.getQuerySelect(qWhere, i+1, []string{"ID", "asc"}, limit, 0, nil, QueryHints{})
+}
+
+// GetQueryStats returns query that gets number of rows, sizes of table and its
+// indexes, and estimated number of dead tuples
+func (h *Helper) GetQueryStats() string {
+	return fmt.Sprintf("SELECT (SELECT COUNT(*) FROM %s), pg_table_size($1::regclass), pg_indexes_size($1::regclass), pg_total_relation_size($1::regclass), COALESCE((SELECT n_dead_tup FROM pg_stat_user_tables WHERE relid = $1::regclass), 0)", h.dbTbl)
+}
+
+// GetQueryExplain returns query prefixed with "EXPLAIN (ANALYZE, FORMAT JSON)"
+func (h *Helper) GetQueryExplain(q string) string {
+	return "EXPLAIN (ANALYZE, FORMAT JSON) " + q
+}
+
+// ValidatorFor returns a func that checks if value is valid for specific field,
+// using the rules that were parsed out from the field tags. It returns nil when
+// there is no such field
+func (h *Helper) ValidatorFor(fieldName string) func(interface{}) bool {
+	if h.dbFieldCols[fieldName] == "" {
+		return nil
+	}
+	return func(v interface{}) bool {
+		valueField := reflect.ValueOf(v)
+		if !valueField.IsValid() || valueField.Kind() != h.getFieldKind(fieldName) {
+			return false
+		}
+		return h.validateValue(fieldName, valueField, true, 0)
+	}
+}
+
+// GetQuerySelect returns select query with specified order, limit, offset and
+// filters
 func (h *Helper) GetQuerySelect(order []string, limit int, offset int, filters map[string]interface{}, orderFieldsToInclude map[string]bool, filterFieldsToInclude map[string]bool) string {
+	return h.GetQuerySelectWithHints(order, limit, offset, filters, orderFieldsToInclude, filterFieldsToInclude, QueryHints{})
+}
+
+// GetQuerySelectWithHints returns select query just like GetQuerySelect does
+// but with static SQL fragments from hints added to it
+func (h *Helper) GetQuerySelectWithHints(order []string, limit int, offset int, filters map[string]interface{}, orderFieldsToInclude map[string]bool, filterFieldsToInclude map[string]bool, hints QueryHints) string {
+	qWhere, i := h.getFiltersCondition(filters, filterFieldsToInclude, 1)
+	return h.getQuerySelect(qWhere, i, order, limit, offset, orderFieldsToInclude, hints)
+}
+
+// GetQueryCount returns query that gets number of objects matching filters,
+// that GetQuerySelect with the same filters would return without limit and
+// offset
+func (h *Helper) GetQueryCount(filters map[string]interface{}, filterFieldsToInclude map[string]bool) string {
+	qWhere, i := h.getFiltersCondition(filters, filterFieldsToInclude, 1)
+	if h.hasExpires() {
+		qWhere = h.addWithAnd(qWhere, h.getExpiresCondition(i, ""))
+	}
+	if h.excludesDeleted() {
+		qWhere = h.addWithAnd(qWhere, h.getSoftDelCondition(""))
+	}
+	s := fmt.Sprintf("SELECT COUNT(*) FROM %s", h.dbTbl)
+	if qWhere != "" {
+		s += " WHERE " + qWhere
+	}
+	return s
+}
+
+// getQuerySelect returns select query with conditions in qWhere, that use
+// query arguments numbered below i. Condition excluding expired objects is
+// added with argument $i
+func (h *Helper) getQuerySelect(qWhere string, i int, order []string, limit int, offset int, orderFieldsToInclude map[string]bool, hints QueryHints) string {
 	s := h.querySelectPrefix
+	qOrder := h.getOrderClause(order, orderFieldsToInclude, hints)
+
+	qLimitOffset := ""
+	if limit > 0 {
+		if offset > 0 {
+			qLimitOffset = fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+		} else {
+			qLimitOffset = fmt.Sprintf("LIMIT %d", limit)
+		}
+	}
+
+	if h.hasExpires() {
+		qWhere = h.addWithAnd(qWhere, h.getExpiresCondition(i, ""))
+	}
+	if h.excludesDeleted() {
+		qWhere = h.addWithAnd(qWhere, h.getSoftDelCondition(""))
+	}
+
+	if qWhere != "" {
+		s += " WHERE " + qWhere
+	}
+	if qOrder != "" {
+		s += " ORDER BY " + qOrder
+	}
+	if qLimitOffset != "" {
+		s += " " + qLimitOffset
+	}
+	return s
+}
+
+// GetQuerySelectJoined returns select query that joins rows of rh's table
+// (aliased "r") having ID stored in refField of rows of the table (aliased
+// "o"). Columns of both tables are selected, these of the table first.
+// Filters and order apply to the table and relatedFilters to the joined one.
+// Arguments are values of filters, then values of relatedFilters and then
+// current time for each of the tables that has field with "expires" tag
+func (h *Helper) GetQuerySelectJoined(rh *Helper, refField string, order []string, limit int, offset int, filters map[string]interface{}, relatedFilters map[string]interface{}) string {
+	cols := ""
+	for _, f := range h.fields {
+		cols = h.addWithComma(cols, h.getColWithAlias(h.dbFieldCols[f], "o"))
+	}
+	for _, f := range rh.fields {
+		cols = h.addWithComma(cols, h.getColWithAlias(rh.dbFieldCols[f], "r"))
+	}
+	s := fmt.Sprintf("SELECT %s FROM %s o JOIN %s r ON r.%s = o.%s", cols, h.dbTbl, rh.dbTbl, rh.dbFieldCols["ID"], h.dbFieldCols[refField])
+
+	qWhere, i := h.getFiltersConditionWithAlias(filters, nil, 1, "o")
+	if cond, j := rh.getFiltersConditionWithAlias(relatedFilters, nil, i, "r"); cond != "" {
+		qWhere = h.addWithAnd(qWhere, cond)
+		i = j
+	}
+	if h.hasExpires() {
+		qWhere = h.addWithAnd(qWhere, h.getExpiresConditionWithAlias(i, "", "o"))
+		i++
+	}
+	if rh.hasExpires() {
+		qWhere = h.addWithAnd(qWhere, rh.getExpiresConditionWithAlias(i, "", "r"))
+	}
+	if h.excludesDeleted() {
+		qWhere = h.addWithAnd(qWhere, h.getSoftDelConditionWithAlias("", "o"))
+	}
+	if rh.excludesDeleted() {
+		qWhere = h.addWithAnd(qWhere, rh.getSoftDelConditionWithAlias("", "r"))
+	}
+
+	qOrder := ""
+	for j := 0; j+1 < len(order); j = j + 2 {
+		if h.dbFieldCols[order[j]] == "" {
+			continue
+		}
+		d := "ASC"
+		if strings.ToLower(order[j+1]) == "desc" {
+			d = "DESC"
+		}
+		qOrder = h.addWithComma(qOrder, h.getColWithAlias(h.dbFieldCols[order[j]], "o")+" "+d)
+	}
+	if qOrder != "" {
+		qOrder = h.getOrderWithIDLast(h.getColWithAlias(h.dbFieldCols["ID"], "o"), qOrder)
+	}
+
+	if qWhere != "" {
+		s += " WHERE " + qWhere
+	}
+	if qOrder != "" {
+		s += " ORDER BY " + qOrder
+	}
+	if limit > 0 {
+		s += fmt.Sprintf(" LIMIT %d", limit)
+		if offset > 0 {
+			s += fmt.Sprintf(" OFFSET %d", offset)
+		}
+	}
+	return s
+}
+
+// getQuerySelectTopPerGroup returns select query just like getQuerySelect
+// does but only with first n rows, in order, of each group of rows having the
+// same values of partitionBy fields. Rows are ranked with ROW_NUMBER window
+// function and returned sorted by the partitionBy fields and then the rank
+func (h *Helper) getQuerySelectTopPerGroup(qWhere string, i int, partitionBy []string, n int, order []string, limit int, offset int, hints QueryHints) string {
+	cols := ""
+	for _, f := range h.fields {
+		cols = h.addWithComma(cols, h.dbFieldCols[f])
+	}
+	qPartition := ""
+	for _, f := range partitionBy {
+		qPartition = h.addWithComma(qPartition, h.dbFieldCols[f])
+	}
+	qOrder := h.getOrderClause(order, nil, hints)
+	if qOrder == "" {
+		qOrder = h.dbFieldCols["ID"] + " ASC"
+	}
+
+	if h.hasExpires() {
+		qWhere = h.addWithAnd(qWhere, h.getExpiresCondition(i, ""))
+	}
+	if h.excludesDeleted() {
+		qWhere = h.addWithAnd(qWhere, h.getSoftDelCondition(""))
+	}
+	if qWhere != "" {
+		qWhere = " WHERE " + qWhere
+	}
 
+	s := fmt.Sprintf("SELECT %s FROM (SELECT %s,ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) AS crud_rank FROM %s%s) ranked WHERE crud_rank <= %d ORDER BY %s,crud_rank ASC", cols, cols, qPartition, qOrder, h.dbTbl, qWhere, n, qPartition)
+	if limit > 0 {
+		if offset > 0 {
+			s += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+		} else {
+			s += fmt.Sprintf(" LIMIT %d", limit)
+		}
+	}
+	return s
+}
+
+// getOrderClause returns columns with directions for ORDER BY clause, with
+// primary key added as the last one. It is empty when there is no order
+func (h *Helper) getOrderClause(order []string, orderFieldsToInclude map[string]bool, hints QueryHints) string {
 	qOrder := ""
 	if len(order) > 0 {
 		for i := 0; i < len(order); i = i + 2 {
@@ -134,51 +1090,136 @@ func (h *Helper) GetQuerySelect(order []string, limit int, offset int, filters m
 		}
 	}
 
-	qLimitOffset := ""
-	if limit > 0 {
-		if offset > 0 {
-			qLimitOffset = fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
-		} else {
-			qLimitOffset = fmt.Sprintf("LIMIT %d", limit)
-		}
+	if hints.OrderBy != "" {
+		qOrder = h.addWithComma(qOrder, hints.OrderBy)
 	}
 
+	// Primary key is the last column so that rows with the same values in
+	// ordered columns are always returned in the same order, and pages do not
+	// overlap
+	if qOrder != "" && h.dbFieldCols["ID"] != "" {
+		qOrder = h.getOrderWithIDLast(h.dbFieldCols["ID"], qOrder)
+	}
+	return qOrder
+}
+
+// getFiltersCondition returns conditions on values of fields from filters,
+// joined with AND, with query arguments numbered from i. It also returns
+// number of the next argument
+func (h *Helper) getFiltersCondition(filters map[string]interface{}, filterFieldsToInclude map[string]bool, i int) (string, int) {
+	return h.getFiltersConditionWithAlias(filters, filterFieldsToInclude, i, "")
+}
+
+// getFiltersConditionWithAlias works like getFiltersCondition but with
+// columns qualified with table alias
+func (h *Helper) getFiltersConditionWithAlias(filters map[string]interface{}, filterFieldsToInclude map[string]bool, i int, alias string) (string, int) {
 	qWhere := ""
-	i := 1
-	if len(filters) > 0 {
-		sorted := []string{}
-		for k := range filters {
-			if h.dbFieldCols[k] == "" {
+	for _, k := range h.getSortedFilterFields(filters, filterFieldsToInclude) {
+		col := h.getColWithAlias(h.dbFieldCols[k], alias)
+		for _, cond := range getFilterConditions(filters[k]) {
+			if xv, ok := cond.Value.([]interface{}); ok {
+				vals := ""
+				for range xv {
+					vals = h.addWithComma(vals, fmt.Sprintf("$%d", i))
+					i++
+				}
+				qWhere = h.addWithAnd(qWhere, col+" IN ("+vals+")")
 				continue
 			}
-			if len(filterFieldsToInclude) > 0 && !filterFieldsToInclude[k] {
-				continue
+			if cond.Operator == "=" {
+				qWhere = h.addWithAnd(qWhere, fmt.Sprintf(col+"=$%d", i))
+			} else if !filterOperators[cond.Operator] || cond.Operator == "IN" {
+				// Operator is never put in the query when it is not one of
+				// the allowed ones, and the condition matches no rows
+				qWhere = h.addWithAnd(qWhere, fmt.Sprintf("(%s=$%d AND FALSE)", col, i))
+			} else {
+				qWhere = h.addWithAnd(qWhere, fmt.Sprintf("%s %s $%d", col, cond.Operator, i))
 			}
-			sorted = append(sorted, h.dbFieldCols[k])
-		}
-		sort.Strings(sorted)
-		for _, col := range sorted {
-			qWhere = h.addWithAnd(qWhere, fmt.Sprintf(col+"=$%d", i))
 			i++
 		}
 	}
+	return qWhere, i
+}
 
-	if qWhere != "" {
-		s += " WHERE " + qWhere
+// getSortedFilterFields returns names of fields from filters, sorted by their
+// column names, which is the order in which they appear in the WHERE clause
+func (h *Helper) getSortedFilterFields(filters map[string]interface{}, filterFieldsToInclude map[string]bool) []string {
+	sorted := []string{}
+	for k := range filters {
+		if h.dbFieldCols[k] == "" {
+			continue
+		}
+		if len(filterFieldsToInclude) > 0 && !filterFieldsToInclude[k] {
+			continue
+		}
+		sorted = append(sorted, k)
 	}
-	if qOrder != "" {
-		s += " ORDER BY " + qOrder
+	sort.Slice(sorted, func(a, b int) bool {
+		return h.dbFieldCols[sorted[a]] < h.dbFieldCols[sorted[b]]
+	})
+	return sorted
+}
+
+// GetFilterArgs returns values of filters in the order matching placeholders
+// in the query returned by GetQuerySelect. Values of filters that are
+// []interface{} (used with IN) are flattened
+func (h *Helper) GetFilterArgs(filters map[string]interface{}) []interface{} {
+	var xi []interface{}
+	for _, k := range h.getSortedFilterFields(filters, nil) {
+		for _, cond := range getFilterConditions(filters[k]) {
+			if xv, ok := cond.Value.([]interface{}); ok {
+				xi = append(xi, xv...)
+				continue
+			}
+			xi = append(xi, cond.Value)
+		}
 	}
-	if qLimitOffset != "" {
-		s += " " + qLimitOffset
+	return xi
+}
+
+// hasFilterableFields checks if any of the fields has "filterable" tag, which
+// means that HTTP endpoint accepts filters only on such fields
+func (h *Helper) hasFilterableFields() bool {
+	return len(h.fieldsFilterable) > 0
+}
+
+// isFilterable checks if field can be used to filter objects in the HTTP
+// endpoint. When none of the fields has "filterable" tag, all of them can
+func (h *Helper) isFilterable(fieldName string) bool {
+	if h.dbFieldCols[fieldName] == "" {
+		return false
 	}
-	return s
+	if !h.hasFilterableFields() {
+		return true
+	}
+	return h.fieldsFilterable[fieldName]
+}
+
+// getOrderWithIDLast returns ORDER BY clause with ID column as the last one.
+// When it is already there, columns after it are removed as they do not
+// change the order anyway, and otherwise it is added in ascending order
+func (h *Helper) getOrderWithIDLast(idCol string, order string) string {
+	xs := strings.Split(order, ",")
+	for i, o := range xs {
+		f := strings.Fields(o)
+		if len(f) > 0 && f[0] == idCol {
+			return strings.Join(xs[:i+1], ",")
+		}
+	}
+	return h.addWithComma(order, idCol+" ASC")
 }
 
 func (h *Helper) setDefaultTags(src *Helper) {
 	if src != nil {
 		h.defaultFieldsTags = make(map[string]map[string]string)
 		h.defaultFieldsTags = src.getFieldsTags()
+		// Struct used in HTTP handler may not have the field but expired
+		// objects should be excluded anyway
+		h.fieldExpires = src.fieldExpires
+		h.fieldSoftDel = src.fieldSoftDel
+		h.sourceFieldsFlags = src.fieldsFlags
+		h.sourceDBTbl = src.dbTbl
+		h.sourceFieldsCol = src.fieldsCol
 	}
 }
 
@@ -214,52 +1255,68 @@ func (h *Helper) reflectStructForDBQueries(u interface{}, dbTablePrefix string,
 	i := reflect.Indirect(v)
 	s := i.Type()
 
-	usName := h.getUnderscoredName(s.Name())
+	h.modelName = s.Name()
 	if forceName != "" {
-		usName = h.getUnderscoredName(forceName)
+		h.modelName = forceName
 	}
+	usName := h.getUnderscoredName(h.modelName)
 	usPluName := h.getPluralName(usName)
 	h.dbTbl = dbTablePrefix + usPluName
+	if h.sourceDBTbl != "" {
+		h.dbTbl = h.sourceDBTbl
+	} else if tbl := h.getTableName(u, s); tbl != "" {
+		if !dbColNameRegExp.MatchString(tbl) {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "table",
+				Err: fmt.Errorf("invalid table name %s", tbl),
+			}
+			return
+		}
+		h.dbTbl = tbl
+	}
 	h.dbColPrefix = usName
 	h.url = usPluName
+	if h.idSeqName != "" {
+		h.idSeq = dbTablePrefix + h.idSeqName + "_seq"
+	}
 
 	h.dbFieldCols = make(map[string]string)
 	h.dbCols = make(map[string]string)
+	h.fieldsFKRef = make(map[string][2]string)
+	for k, model := range h.fieldsFK {
+		h.fieldsFKRef[k] = h.getFKRef(model, dbTablePrefix)
+	}
 
 	colsWithTypes := ""
 	cols := ""
 	valsWithoutID := ""
 	colsWithoutID := ""
 	colVals := ""
-	idCol := h.dbColPrefix + "_id"
+	idCol := h.getDBCol("ID")
+	colDefs := map[string]string{}
 
 	valCnt := 1
-	for j := 0; j < s.NumField(); j++ {
-		field := s.Field(j)
-		if field.Type.Kind() != reflect.Int64 && field.Type.Kind() != reflect.String && field.Type.Kind() != reflect.Int {
-			continue
-		}
-
-		if field.Type.Kind() == reflect.Int64 {
-			h.fieldsFlags[field.Name] += TypeInt64
-		}
-		if field.Type.Kind() == reflect.Int {
-			h.fieldsFlags[field.Name] += TypeInt
-		}
-		if field.Type.Kind() == reflect.String {
-			h.fieldsFlags[field.Name] += TypeString
-		}
-
+	for _, field := range h.getOrderedFields(s) {
 		dbCol := h.getDBCol(field.Name)
+		if h.dbCols[dbCol] != "" {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "col",
+				Err: fmt.Errorf("fields %s and %s have the same column %s", h.dbCols[dbCol], field.Name, dbCol),
+			}
+			return
+		}
 		h.dbFieldCols[field.Name] = dbCol
 		h.dbCols[dbCol] = field.Name
 		uniq := false
 		if h.fieldsUniq[field.Name] {
 			uniq = true
 		}
-		dbColParams := h.getDBColParams(field.Name, field.Type.String(), uniq)
+		dbColParams := h.getDBColParams(field.Name, uniq)
 
 		colsWithTypes = h.addWithComma(colsWithTypes, dbCol+" "+dbColParams)
+		colDefs[dbCol] = dbCol + " " + dbColParams
 		cols = h.addWithComma(cols, dbCol)
 
 		if field.Name != "ID" {
@@ -270,15 +1327,100 @@ func (h *Helper) reflectStructForDBQueries(u interface{}, dbTablePrefix string,
 		}
 
 		h.fields = append(h.fields, field.Name)
+		if h.fieldsIndex[field.Name] {
+			h.indexes = append(h.indexes, []string{field.Name})
+		}
+	}
+
+	for _, fields := range h.getStructIndexes(s) {
+		for _, f := range fields {
+			if h.dbFieldCols[f] == "" {
+				h.err = &ErrHelper{
+					Op:  "ParseTag",
+					Tag: "index",
+					Err: fmt.Errorf("index field %s is not a column", f),
+				}
+				return
+			}
+		}
+		h.indexes = append(h.indexes, fields)
+	}
+
+	sortedCols := []string{}
+	for dbCol := range colDefs {
+		if dbCol != idCol {
+			sortedCols = append(sortedCols, dbCol)
+		}
+	}
+	sort.Strings(sortedCols)
+	colsWithTypesSorted := colDefs[idCol]
+	for _, dbCol := range sortedCols {
+		colsWithTypesSorted = h.addWithComma(colsWithTypesSorted, colDefs[dbCol])
 	}
 
 	h.queryDropTable = fmt.Sprintf("DROP TABLE IF EXISTS %s", h.dbTbl)
 	h.queryCreateTable = fmt.Sprintf("CREATE TABLE %s (%s)", h.dbTbl, colsWithTypes)
+	h.queryCreateTableSorted = fmt.Sprintf("CREATE TABLE %s (%s)", h.dbTbl, colsWithTypesSorted)
 	h.queryDeleteById = fmt.Sprintf("DELETE FROM %s WHERE %s = $1", h.dbTbl, idCol)
-	h.querySelectById = fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1", cols, h.dbTbl, idCol)
+	h.querySelectById = fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1%s%s", cols, h.dbTbl, idCol, h.getExpiresCondition(2, " AND "), h.getSoftDelCondition(" AND "))
 	h.queryInsert = fmt.Sprintf("INSERT INTO %s(%s) VALUES (%s) RETURNING %s", h.dbTbl, colsWithoutID, valsWithoutID, idCol)
 	h.queryUpdateById = fmt.Sprintf("UPDATE %s SET %s WHERE %s = $%d", h.dbTbl, colVals, idCol, valCnt)
 	h.querySelectPrefix = fmt.Sprintf("SELECT %s FROM %s", cols, h.dbTbl)
+	h.queryReturning = fmt.Sprintf(" RETURNING %s", cols)
+}
+
+// getTableName returns name of the table set with TableName method of the
+// struct or with "table" in the "crud" tag of its blank field, eg.
+// `_ struct{} crud:"table:accounts"`, or empty string when there is none
+func (h *Helper) getTableName(u interface{}, s reflect.Type) string {
+	if tn, ok := u.(TableNamer); ok {
+		return tn.TableName()
+	}
+	for j := 0; j < s.NumField(); j++ {
+		if s.Field(j).Name == "_" {
+			if tbl := h.getTagOptVal(s.Field(j).Tag.Get("crud"), "table"); tbl != "" {
+				return tbl
+			}
+		}
+	}
+	return ""
+}
+
+// getStructIndexes returns names of fields of composite indexes set with
+// "index" in the "crud" tag of blank fields, eg.
+// `_ struct{} crud:"index:LastName,FirstName"`
+func (h *Helper) getStructIndexes(s reflect.Type) [][]string {
+	indexes := [][]string{}
+	for j := 0; j < s.NumField(); j++ {
+		if s.Field(j).Name != "_" {
+			continue
+		}
+		if val := h.getTagOptVal(s.Field(j).Tag.Get("crud"), "index"); val != "" {
+			indexes = append(indexes, strings.Split(val, ","))
+		}
+	}
+	return indexes
+}
+
+// getOrderedFields returns struct fields that are mapped to database columns,
+// sorted by value of the "order" tag (0 when not set). ID field always goes
+// first and fields with the same value keep their declaration order
+func (h *Helper) getOrderedFields(s reflect.Type) []reflect.StructField {
+	fields := []reflect.StructField{}
+	for j := 0; j < s.NumField(); j++ {
+		field := s.Field(j)
+		if h.fieldsFlags[field.Name] == 0 {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	sort.SliceStable(fields, func(a, b int) bool {
+		if fields[a].Name == "ID" || fields[b].Name == "ID" {
+			return fields[a].Name == "ID" && fields[b].Name != "ID"
+		}
+		return h.fieldsOrder[fields[a].Name] < h.fieldsOrder[fields[b].Name]
+	})
+	return fields
 }
 
 func (h *Helper) reflectStructForValidation(u interface{}) {
@@ -287,6 +1429,7 @@ func (h *Helper) reflectStructForValidation(u interface{}) {
 	s := i.Type()
 
 	h.fieldsRequired = make(map[string]bool)
+	h.fieldsRequiredOps = make(map[string]int)
 	h.fieldsLength = make(map[string][2]int)
 	h.fieldsValue = make(map[string][2]int)
 	h.fieldsValueNotNil = make(map[string][2]bool)
@@ -296,19 +1439,42 @@ func (h *Helper) reflectStructForValidation(u interface{}) {
 	h.fieldsDefaultValue = make(map[string]string)
 	h.fieldsUniq = make(map[string]bool)
 	h.fieldsTags = make(map[string]map[string]string)
+	h.fieldsJSONB = make(map[string]bool)
+	h.fieldsTransforms = make(map[string][]string)
+	h.fieldsSlug = make(map[string]string)
+	h.fieldsLookup = make(map[string]bool)
+	h.fieldsNested = make(map[string]*Helper)
+	h.fieldsJSONName = make(map[string]string)
+	h.fieldsJSONHidden = make(map[string]bool)
+	h.fieldsJSONOmit = make(map[string]bool)
+	h.fieldsValuerDBType = make(map[string]string)
+	h.fieldsType = make(map[string]reflect.Type)
+	h.fieldsOrder = make(map[string]int)
+	h.fieldsWas = make(map[string]string)
+	h.fieldsCol = make(map[string]string)
+	h.fieldsDBText = make(map[string]bool)
+	h.fieldsDBLen = make(map[string]int)
+	h.fieldsDBLenMax = make(map[string]bool)
+	h.fieldsCurrency = make(map[string]string)
+	h.jsonAliases = make(map[string]string)
+	h.fieldsFilterable = make(map[string]bool)
+	h.fieldsSearchable = make(map[string]bool)
+	h.fieldsIndex = make(map[string]bool)
+	h.fieldsSensitive = make(map[string]string)
+	h.fieldsFK = make(map[string]string)
+	h.fieldsOnDelete = make(map[string]string)
+	h.fieldsBitFlags = make(map[string]bool)
+	h.fieldsRel = make(map[string]string)
+	h.fieldsRelJSONName = make(map[string]string)
 
 	for j := 0; j < s.NumField(); j++ {
 		field := s.Field(j)
-		if field.Type.Kind() != reflect.Int64 && field.Type.Kind() != reflect.String && field.Type.Kind() != reflect.Int {
+		// Skip unexported fields and internal fields of protobuf generated
+		// structs
+		if field.PkgPath != "" || strings.HasPrefix(field.Name, "XXX_") {
 			continue
 		}
 
-		h.setFieldFromName(field.Name)
-
-		h.fieldsLength[field.Name] = [2]int{-1, -1}
-		h.fieldsValue[field.Name] = [2]int{0, 0}
-		h.fieldsValueNotNil[field.Name] = [2]bool{false, false}
-
 		crudTag := field.Tag.Get("crud")
 		crudRegexpTag := field.Tag.Get("crud_regexp")
 		crudValTag := field.Tag.Get("crud_val")
@@ -324,13 +1490,182 @@ func (h *Helper) reflectStructForValidation(u interface{}) {
 			}
 		}
 
-		h.setFieldFromTag(crudTag, j, field.Name)
-		if h.err != nil {
-			return
+		if relField := h.getTagOptVal(crudTag, "rel"); relField != "" {
+			if field.Type.Kind() != reflect.Ptr || field.Type.Elem().Kind() != reflect.Struct {
+				h.err = &ErrHelper{
+					Op:  "ParseTag",
+					Tag: "rel",
+					Err: fmt.Errorf("field %s with rel must be a pointer to struct", field.Name),
+				}
+				return
+			}
+			h.fieldsRel[field.Name] = relField
+			h.fieldsRelJSONName[field.Name] = h.getJSONName(field)
+			continue
+		}
+
+		fieldType := h.getFieldType(field.Type, crudTag)
+		if fieldType == 0 {
+			h.unmappedFields = append(h.unmappedFields, field.Name)
+			continue
+		}
+		// DTO can have fields that are set by hooks, eg. computed values,
+		// and there are no columns for them in model's table
+		if h.sourceFieldsFlags != nil && h.sourceFieldsFlags[field.Name] == 0 {
+			continue
+		}
+		h.fieldsFlags[field.Name] += fieldType
+		h.fieldsType[field.Name] = field.Type
+		if fieldType == TypeValuer {
+			h.fieldsValuerDBType[field.Name] = h.getValuerDBType(field.Type)
+		}
+		h.fieldsJSONName[field.Name] = h.getJSONName(field)
+		// Same rules as in encoding/json, where "-," is the name "-"
+		h.fieldsJSONHidden[field.Name] = field.Tag.Get("json") == "-"
+		h.fieldsJSONOmit[field.Name] = h.hasJSONTagOpt(field, "omitempty")
+
+		h.setFieldFromName(field.Name)
+
+		h.fieldsLength[field.Name] = [2]int{-1, -1}
+		h.fieldsValue[field.Name] = [2]int{0, 0}
+		h.fieldsValueNotNil[field.Name] = [2]bool{false, false}
+
+		h.setFieldFromTag(crudTag, j, field.Name)
+		if h.err != nil {
+			return
+		}
+		if h.fieldSoftDel == field.Name && fieldType != TypeInt64 {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "softdel",
+				Err: fmt.Errorf("field %s with softdel must be int64", field.Name),
+			}
+			return
+		}
+		if h.fieldsFK[field.Name] != "" && fieldType != TypeInt64 && field.Type != nullInt64Type {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "fk",
+				Err: fmt.Errorf("field %s with fk must be int64 or sql.NullInt64", field.Name),
+			}
+			return
+		}
+		if (h.fieldsOnDelete[field.Name] != "" && h.fieldsFK[field.Name] == "") || (h.fieldsOnDelete[field.Name] == "SET NULL" && field.Type != nullInt64Type) {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "ondelete",
+				Err: fmt.Errorf("field %s with ondelete must have fk, and be sql.NullInt64 for setnull", field.Name),
+			}
+			return
+		}
+		if h.fieldsSearchable[field.Name] && fieldType != TypeString && field.Type != nullStringType {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "searchable",
+				Err: fmt.Errorf("field %s with searchable must be string or sql.NullString", field.Name),
+			}
+			return
+		}
+		if (h.fieldsDBText[field.Name] || h.fieldsDBLen[field.Name] > 0 || h.fieldsDBLenMax[field.Name]) && fieldType != TypeString && field.Type != nullStringType {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "dbtype",
+				Err: fmt.Errorf("field %s with dbtype or dblen must be string or sql.NullString", field.Name),
+			}
+			return
+		}
+		if h.fieldsDBLen[field.Name] > 0 && h.fieldsDBLen[field.Name] < h.fieldsLength[field.Name][1] {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "dblen",
+				Err: fmt.Errorf("field %s has dblen smaller than lenmax", field.Name),
+			}
+			return
+		}
+		if h.fieldsDBLenMax[field.Name] && h.fieldsLength[field.Name][1] < 1 {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "dblen",
+				Err: fmt.Errorf("field %s with dblen:lenmax must have lenmax", field.Name),
+			}
+			return
+		}
+		if (h.fieldsCurrency[field.Name] != "") != (field.Type == moneyType) {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "currency",
+				Err: fmt.Errorf("field %s must be Money with currency", field.Name),
+			}
+			return
+		}
+		if h.fieldsBitFlags[field.Name] && fieldType != TypeInt64 {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "flags",
+				Err: fmt.Errorf("field %s with flags must be int64", field.Name),
+			}
+			return
+		}
+		if h.fieldExpires == field.Name && fieldType != TypeInt64 {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "expires",
+				Err: fmt.Errorf("field %s with expires must be int64", field.Name),
+			}
+			return
+		}
+		for tag, f := range map[string]string{"createdat": h.fieldCreatedAt, "updatedat": h.fieldUpdatedAt} {
+			if f == field.Name && fieldType != TypeInt64 && fieldType != TypeTime {
+				h.err = &ErrHelper{
+					Op:  "ParseTag",
+					Tag: tag,
+					Err: fmt.Errorf("field %s with %s must be int64 or time.Time", field.Name, tag),
+				}
+				return
+			}
+		}
+		for tag, f := range map[string]string{"tenant": h.fieldTenant, "createdby": h.fieldCreatedBy, "updatedby": h.fieldUpdatedBy} {
+			if f == field.Name && fieldType != TypeInt64 {
+				h.err = &ErrHelper{
+					Op:  "ParseTag",
+					Tag: tag,
+					Err: fmt.Errorf("field %s with %s must be int64", field.Name, tag),
+				}
+				return
+			}
+		}
+		if h.fieldsSensitive[field.Name] != "" && fieldType != TypeString {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "sensitive",
+				Err: fmt.Errorf("field %s with sensitive must be string", field.Name),
+			}
+			return
+		}
+		if h.fieldsSensitive[field.Name] == "text" && h.fieldsEmail[field.Name] {
+			h.fieldsSensitive[field.Name] = "email"
+		}
+		if h.fieldsLookup[field.Name] && !h.fieldsUniq[field.Name] {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "lookup",
+				Err: fmt.Errorf("field %s with lookup must be uniq", field.Name),
+			}
+			return
+		}
+
+		if fieldType == TypeJSONB {
+			h.setFieldNested(field)
+			if h.err != nil {
+				return
+			}
 		}
 
 		if crudRegexpTag != "" {
-			h.fieldsRegExp[field.Name] = regexp.MustCompile(crudRegexpTag)
+			h.err = h.setFieldRegExp(field.Name, "crud_regexp", crudRegexpTag)
+			if h.err != nil {
+				return
+			}
 		}
 		if crudValTag != "" {
 			h.fieldsDefaultValue[field.Name] = crudValTag
@@ -341,6 +1676,152 @@ func (h *Helper) reflectStructForValidation(u interface{}) {
 		h.fieldsTags[field.Name]["crud_regexp"] = field.Tag.Get("crud_regexp")
 		h.fieldsTags[field.Name]["crud_val"] = field.Tag.Get("crud_val")
 	}
+
+	for k, relField := range h.fieldsRel {
+		if h.fieldsFlags[relField]&(TypeInt64|TypeInt) == 0 && h.fieldsType[relField] != nullInt64Type {
+			h.err = &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "rel",
+				Err: fmt.Errorf("field %s of rel in field %s must be int64 or sql.NullInt64", relField, k),
+			}
+			return
+		}
+	}
+}
+
+// getFieldType returns one of the Type* values for a struct field type or 0
+// when the type is not supported. Some types are supported only when they are
+// enabled in the "crud" tag, hence it is an argument
+func (h *Helper) getFieldType(t reflect.Type, crudTag string) int {
+	if h.typeConverters[t] != nil {
+		return TypeConverted
+	}
+	if t == timeType {
+		return TypeTime
+	}
+	if reflect.PtrTo(t).Implements(scannerType) && reflect.PtrTo(t).Implements(valuerType) {
+		return TypeValuer
+	}
+	if fieldType, ok := kindTypes[t.Kind()]; ok {
+		return fieldType
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Ptr, reflect.Map, reflect.Slice:
+		if h.hasTagOpt(crudTag, "jsonb") {
+			return TypeJSONB
+		}
+	}
+	return 0
+}
+
+// getValuerDBType returns column type for a type implementing driver.Valuer.
+// For types other than sql.Null*, it is guessed from the value returned by
+// Value() on a zero value of the type
+func (h *Helper) getValuerDBType(t reflect.Type) string {
+	if valuerDBTypes[t] != "" {
+		return valuerDBTypes[t]
+	}
+	v, err := reflect.New(t).Interface().(driver.Valuer).Value()
+	if err != nil {
+		return "TEXT"
+	}
+	switch v.(type) {
+	case int64:
+		return "BIGINT"
+	case float64:
+		return "DOUBLE PRECISION"
+	case bool:
+		return "BOOLEAN"
+	case []byte:
+		return "BYTEA"
+	case time.Time:
+		return "TIMESTAMP WITH TIME ZONE"
+	}
+	return "TEXT"
+}
+
+// getTypeConverter returns TypeConverter registered for type of a field
+func (h *Helper) getTypeConverter(k string) *TypeConverter {
+	return h.typeConverters[h.fieldsType[k]]
+}
+
+// getJSONName returns name of the field in JSON, taken from "json" tag
+// without options such as "omitempty". It returns "-" for fields that are
+// omitted in JSON
+func (h *Helper) getJSONName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// hasJSONTagOpt checks if "json" tag of the field contains an option, eg.
+// "omitempty"
+func (h *Helper) hasJSONTagOpt(field reflect.StructField, opt string) bool {
+	for _, o := range strings.Split(field.Tag.Get("json"), ",")[1:] {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// getEventPayload returns object in JSON for outbox events and webhook
+// deliveries, without fields with "sensitive" tag
+func (h *Helper) getEventPayload(obj interface{}) ([]byte, error) {
+	payload, err := json.Marshal(obj)
+	if err != nil || len(h.fieldsSensitive) == 0 {
+		return payload, err
+	}
+	m := map[string]json.RawMessage{}
+	err = json.Unmarshal(payload, &m)
+	if err != nil {
+		return nil, err
+	}
+	for fieldName := range h.fieldsSensitive {
+		delete(m, h.fieldsJSONName[fieldName])
+	}
+	return json.Marshal(m)
+}
+
+// hasTagOpt checks if "crud" tag contains an option
+func (h *Helper) hasTagOpt(tag string, opt string) bool {
+	for _, o := range strings.Split(tag, " ") {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// getTagOptVal returns value of option in the tag, eg. "UserID" for "rel" in
+// "rel:UserID", or empty string when tag does not have the option
+func (h *Helper) getTagOptVal(tag string, opt string) string {
+	for _, o := range strings.Split(tag, " ") {
+		if strings.HasPrefix(o, opt+":") {
+			return o[len(opt)+1:]
+		}
+	}
+	return ""
+}
+
+// setFieldNested creates Helper for a struct that is stored in a JSONB field
+// so that its fields can be validated as well
+func (h *Helper) setFieldNested(field reflect.StructField) {
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	nh := NewHelper(reflect.New(t).Interface(), "", "", nil)
+	if nh.Err() != nil {
+		h.err = nh.Err()
+		return
+	}
+	h.fieldsNested[field.Name] = nh
 }
 
 func (h *Helper) setFieldFromName(fieldName string) {
@@ -359,6 +1840,7 @@ func (h *Helper) setFieldFromTag(tag string, fieldIdx int, fieldName string) {
 		h.setFieldFromTagOptWithoutVal(opt, fieldIdx, fieldName)
 		errHelper = h.setFieldFromTagOptWithVal(opt, fieldIdx, fieldName)
 		if errHelper != nil {
+			h.err = errHelper
 			return
 		}
 	}
@@ -374,14 +1856,196 @@ func (h *Helper) setFieldFromTagOptWithoutVal(opt string, fieldIdx int, fieldNam
 	if opt == "uniq" {
 		h.fieldsUniq[fieldName] = true
 	}
+	if opt == "jsonb" {
+		h.fieldsJSONB[fieldName] = true
+	}
+	if opt == "lookup" {
+		h.fieldsLookup[fieldName] = true
+	}
+	if opt == "index" {
+		h.fieldsIndex[fieldName] = true
+	}
+	if opt == "searchable" {
+		h.fieldsSearchable[fieldName] = true
+	}
+	if opt == "filterable" {
+		h.fieldsFilterable[fieldName] = true
+	}
+	if opt == "sensitive" {
+		h.fieldsSensitive[fieldName] = "text"
+	}
+	if opt == "expires" {
+		h.fieldExpires = fieldName
+	}
+	if opt == "flags" {
+		h.fieldsBitFlags[fieldName] = true
+	}
+	if opt == "softdel" {
+		h.fieldSoftDel = fieldName
+	}
+	if opt == "createdby" {
+		h.fieldCreatedBy = fieldName
+	}
+	if opt == "tenant" {
+		h.fieldTenant = fieldName
+	}
+	if opt == "updatedby" {
+		h.fieldUpdatedBy = fieldName
+	}
+	if opt == "createdat" {
+		h.fieldCreatedAt = fieldName
+	}
+	if opt == "updatedat" {
+		h.fieldUpdatedAt = fieldName
+	}
+	if opt == "trim" || opt == "lower" || opt == "upper" || opt == "titlecase" {
+		h.fieldsTransforms[fieldName] = append(h.fieldsTransforms[fieldName], opt)
+	}
 }
 
 func (h *Helper) setFieldFromTagOptWithVal(opt string, fieldIdx int, fieldName string) *ErrHelper {
-	for _, valOpt := range []string{"lenmin", "lenmax", "valmin", "valmax", "regexp"} {
+	if strings.HasPrefix(opt, "was:") {
+		val := strings.Replace(opt, "was:", "", 1)
+		if !dbColNameRegExp.MatchString(val) {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "was",
+				Err: fmt.Errorf("invalid column name %s", val),
+			}
+		}
+		h.fieldsWas[fieldName] = val
+		return nil
+	}
+	if strings.HasPrefix(opt, "dbtype:") {
+		val := strings.Replace(opt, "dbtype:", "", 1)
+		if val != "text" && val != "varchar" {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "dbtype",
+				Err: fmt.Errorf("invalid column type %s", val),
+			}
+		}
+		h.fieldsDBText[fieldName] = val == "text"
+		return nil
+	}
+	if opt == "dblen:lenmax" {
+		h.fieldsDBLenMax[fieldName] = true
+		return nil
+	}
+	if strings.HasPrefix(opt, "dblen:") {
+		i, err := strconv.Atoi(strings.Replace(opt, "dblen:", "", 1))
+		if err != nil || i < 1 || i > maxVarcharLen {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "dblen",
+				Err: fmt.Errorf("invalid column size %s", opt),
+			}
+		}
+		h.fieldsDBLen[fieldName] = i
+		return nil
+	}
+	if strings.HasPrefix(opt, "currency:") {
+		val := strings.Replace(opt, "currency:", "", 1)
+		if !currencyRegExp.MatchString(val) {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "currency",
+				Err: fmt.Errorf("invalid currency %s", val),
+			}
+		}
+		h.fieldsCurrency[fieldName] = val
+		return nil
+	}
+	if strings.HasPrefix(opt, "col:") {
+		val := strings.Replace(opt, "col:", "", 1)
+		if !dbColNameRegExp.MatchString(val) {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "col",
+				Err: fmt.Errorf("invalid column name %s", val),
+			}
+		}
+		h.fieldsCol[fieldName] = val
+		return nil
+	}
+	if strings.HasPrefix(opt, "jsonalias:") {
+		val := strings.Replace(opt, "jsonalias:", "", 1)
+		if val == "" || strings.Contains(val, ",") {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "jsonalias",
+				Err: fmt.Errorf("invalid JSON name %s", val),
+			}
+		}
+		h.jsonAliases[val] = fieldName
+		return nil
+	}
+	if strings.HasPrefix(opt, "sensitive:") {
+		val := strings.Replace(opt, "sensitive:", "", 1)
+		if sensitiveFakers[val] == nil {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "sensitive",
+				Err: fmt.Errorf("invalid kind %s", val),
+			}
+		}
+		h.fieldsSensitive[fieldName] = val
+		return nil
+	}
+	if strings.HasPrefix(opt, "fk:") {
+		val := strings.Replace(opt, "fk:", "", 1)
+		if val == "" {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "fk",
+				Err: fmt.Errorf("empty model name"),
+			}
+		}
+		h.fieldsFK[fieldName] = val
+		return nil
+	}
+	if strings.HasPrefix(opt, "ondelete:") {
+		val := strings.Replace(opt, "ondelete:", "", 1)
+		if onDeleteActions[val] == "" {
+			return &ErrHelper{
+				Op:  "ParseTag",
+				Tag: "ondelete",
+				Err: fmt.Errorf("invalid action %s", val),
+			}
+		}
+		h.fieldsOnDelete[fieldName] = onDeleteActions[val]
+		return nil
+	}
+	if strings.HasPrefix(opt, "seq:") || strings.HasPrefix(opt, "idprefix:") || strings.HasPrefix(opt, "idpad:") {
+		return h.setIDFormatFromTagOpt(opt, fieldName)
+	}
+	if strings.HasPrefix(opt, "slug:") {
+		h.fieldsSlug[fieldName] = strings.Replace(opt, "slug:", "", 1)
+		// Unique constraint is what keeps generated slugs from clashing
+		h.fieldsUniq[fieldName] = true
+		return nil
+	}
+	if strings.HasPrefix(opt, "req:") {
+		for _, opName := range strings.Split(strings.Replace(opt, "req:", "", 1), ",") {
+			if opNames[opName] == 0 {
+				return &ErrHelper{
+					Op:  "ParseTag",
+					Tag: "req",
+					Err: fmt.Errorf("invalid operation %s", opName),
+				}
+			}
+			h.fieldsRequiredOps[fieldName] |= opNames[opName]
+		}
+		return nil
+	}
+	for _, valOpt := range []string{"lenmin", "lenmax", "valmin", "valmax", "regexp", "order"} {
 		if strings.HasPrefix(opt, valOpt+":") {
 			val := strings.Replace(opt, valOpt+":", "", 1)
 			if valOpt == "regexp" {
-				h.fieldsRegExp[fieldName] = regexp.MustCompile(val)
+				errHelper := h.setFieldRegExp(fieldName, valOpt, val)
+				if errHelper != nil {
+					return errHelper
+				}
 				continue
 			}
 			i, err := strconv.Atoi(val)
@@ -407,17 +2071,42 @@ func (h *Helper) setFieldFromTagOptWithVal(opt string, fieldIdx int, fieldName s
 				if i == 0 {
 					h.fieldsValueNotNil[fieldName] = [2]bool{h.fieldsValueNotNil[fieldName][0], true}
 				}
+			case "order":
+				h.fieldsOrder[fieldName] = i
 			}
 		}
 	}
 	return nil
 }
 
+// setFieldRegExp sets regular expression that value of field must match, from
+// a tag. Invalid expression is returned as an error with the field and tag
+func (h *Helper) setFieldRegExp(fieldName string, tag string, expr string) *ErrHelper {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return &ErrHelper{
+			Op:     "ParseTag",
+			Tag:    tag,
+			Fields: []string{fieldName},
+			Err:    fmt.Errorf("invalid regular expression %q of field %s: %w", expr, fieldName, err),
+		}
+	}
+	h.fieldsRegExp[fieldName] = re
+	return nil
+}
+
 func (h *Helper) getDBCol(n string) string {
+	if h.fieldsCol[n] != "" {
+		return h.fieldsCol[n]
+	}
+	if h.sourceFieldsCol[n] != "" {
+		return h.sourceFieldsCol[n]
+	}
 	dbCol := ""
 	if n == "ID" {
 		dbCol = h.dbColPrefix + "_id"
-	} else if n == "Flags" {
+	} else if n == "Flags" && h.isFlagsField(n) {
+		// Column of the conventional flags field is prefixed like the ID one
 		dbCol = h.dbColPrefix + "_flags"
 	} else {
 		dbCol = h.getUnderscoredName(n)
@@ -425,30 +2114,152 @@ func (h *Helper) getDBCol(n string) string {
 	return dbCol
 }
 
-func (h *Helper) getDBColParams(n string, t string, uniq bool) string {
+// isFlagsField checks if field is an int64 field with bits that can be named
+// with SetFlagNames, which is the field with "flags" tag or the one named
+// Flags. For DTOs, the field of the source model is checked when DTO does not
+// have it
+func (h *Helper) isFlagsField(fieldName string) bool {
+	if h.fieldsBitFlags[fieldName] {
+		return true
+	}
+	if _, ok := h.fieldsFlags[fieldName]; !ok && h.sourceFieldsFlags != nil {
+		return fieldName == "Flags" && h.sourceFieldsFlags[fieldName] == TypeInt64
+	}
+	return fieldName == "Flags" && h.fieldsFlags[fieldName] == TypeInt64
+}
+
+// getFieldDBCol returns column name for a field, even if the field is not
+// present in the struct (eg. it is used for HTTP endpoint and has only some
+// of the fields)
+func (h *Helper) getFieldDBCol(fieldName string) string {
+	if h.dbFieldCols[fieldName] != "" {
+		return h.dbFieldCols[fieldName]
+	}
+	return h.getDBCol(fieldName)
+}
+
+// getSlugField returns name of the field that has "slug" tag
+func (h *Helper) getSlugField() string {
+	for _, k := range h.fields {
+		if h.fieldsSlug[k] != "" {
+			return k
+		}
+	}
+	return ""
+}
+
+// getSlug returns URL-safe slug generated from a string
+func (h *Helper) getSlug(s string) string {
+	return strings.Trim(slugInvalidCharsRegExp.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// getFreeSlug returns base or base with the lowest number suffix that is not
+// in taken. Slugs made of digits only are skipped as well, because they would
+// be taken for IDs in the read endpoint
+func (h *Helper) getFreeSlug(base string, taken map[string]bool) string {
+	slug := base
+	for i := 2; taken[slug] || idRegExp.MatchString(slug); i++ {
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+	return slug
+}
+
+func (h *Helper) getDBColParams(n string, uniq bool) string {
 	dbColParams := ""
-	if n == "ID" {
+	if n == "ID" && h.idSeq != "" {
+		dbColParams = fmt.Sprintf("BIGINT DEFAULT nextval('%s') PRIMARY KEY", h.idSeq)
+	} else if n == "ID" {
 		dbColParams = "SERIAL PRIMARY KEY"
-	} else if n == "Flags" {
+	} else if h.isFlagsField(n) {
 		dbColParams = "BIGINT DEFAULT 0"
 	} else {
-		switch t {
-		case "string":
-			dbColParams = "VARCHAR(255) DEFAULT ''"
-		case "int64":
-			dbColParams = "BIGINT DEFAULT 0"
-		case "int":
+		switch h.fieldsFlags[n] {
+		case TypeConverted:
+			dbColParams = h.getTypeConverter(n).DBType
+		case TypeValuer:
+			dbColParams = h.fieldsValuerDBType[n]
+			if h.fieldsType[n] == nullStringType {
+				dbColParams = h.getStringDBType(n)
+			}
+		case TypeJSONB:
+			dbColParams = "JSONB"
+		case TypeTime:
+			// Zero time is stored just like zero values of other types, so
+			// that rows of added columns can be scanned
+			dbColParams = "TIMESTAMP WITH TIME ZONE DEFAULT '0001-01-01 00:00:00+00' NOT NULL"
+		case TypeInt64, TypeInt:
 			dbColParams = "BIGINT DEFAULT 0"
+		case TypeInt32:
+			dbColParams = "INTEGER DEFAULT 0"
+		case TypeInt8, TypeInt16:
+			dbColParams = "SMALLINT DEFAULT 0"
+		case TypeUint8:
+			dbColParams = "SMALLINT DEFAULT 0 CHECK (" + h.getDBCol(n) + " >= 0)"
+		case TypeUint16:
+			dbColParams = "INTEGER DEFAULT 0 CHECK (" + h.getDBCol(n) + " >= 0)"
+		case TypeUint32, TypeUint64, TypeUint:
+			dbColParams = "BIGINT DEFAULT 0 CHECK (" + h.getDBCol(n) + " >= 0)"
 		default:
-			dbColParams = "VARCHAR(255) DEFAULT ''"
+			dbColParams = h.getStringDBType(n) + " DEFAULT ''"
 		}
 	}
 	if uniq {
 		dbColParams += " UNIQUE"
 	}
+	if ref, ok := h.fieldsFKRef[n]; ok {
+		dbColParams += fmt.Sprintf(" REFERENCES %s(%s)", ref[0], ref[1])
+		if h.fieldsOnDelete[n] != "" {
+			dbColParams += " ON DELETE " + h.fieldsOnDelete[n]
+		}
+	}
 	return dbColParams
 }
 
+// getStringDBType returns column type of string field, which is TEXT for
+// field with "dbtype:text" tag and VARCHAR otherwise. Size of VARCHAR is taken
+// from "dblen" tag or, when it is "dblen:lenmax", from "lenmax" tag so that
+// column fits values that pass validation. Default size is 255
+func (h *Helper) getStringDBType(n string) string {
+	if h.fieldsDBText[n] {
+		return "TEXT"
+	}
+	size := h.fieldsDBLen[n]
+	if h.fieldsDBLenMax[n] {
+		size = h.fieldsLength[n][1]
+		if size > maxVarcharLen {
+			return "TEXT"
+		}
+	}
+	if size == 0 {
+		size = 255
+	}
+	return fmt.Sprintf("VARCHAR(%d)", size)
+}
+
+// getFKRef returns table and ID column of model that field with "fk" tag
+// links to. They are taken from Helper of the model, so that its TableName,
+// "table" and "col" tags are used, and are generated from the name of the
+// model when it is not known, eg. it has not been used by the controller
+func (h *Helper) getFKRef(model string, dbTablePrefix string) [2]string {
+	if model == h.modelName {
+		return [2]string{h.dbTbl, h.getDBCol("ID")}
+	}
+	if h.fkHelper != nil {
+		if ref := h.fkHelper(model); ref != nil {
+			return [2]string{ref.dbTbl, ref.dbFieldCols["ID"]}
+		}
+	}
+	usModel := h.getUnderscoredName(model)
+	return [2]string{dbTablePrefix + h.getPluralName(usModel), usModel + "_id"}
+}
+
+// GetQueryCountReferenced returns query that counts rows of the table that
+// field with "fk" tag links to, with ID equal to $1
+func (h *Helper) GetQueryCountReferenced(fieldName string) string {
+	ref := h.fieldsFKRef[fieldName]
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = $1", ref[0], ref[1])
+}
+
 func (h *Helper) addWithComma(s string, v string) string {
 	if s != "" {
 		s += ","
@@ -457,6 +2268,15 @@ func (h *Helper) addWithComma(s string, v string) string {
 	return s
 }
 
+// getColWithAlias returns column qualified with table alias, or the column
+// when alias is empty
+func (h *Helper) getColWithAlias(col string, alias string) string {
+	if alias == "" {
+		return col
+	}
+	return alias + "." + col
+}
+
 func (h *Helper) addWithAnd(s string, v string) string {
 	if s != "" {
 		s += " AND "
@@ -465,6 +2285,10 @@ func (h *Helper) addWithAnd(s string, v string) string {
 	return s
 }
 
+// getUnderscoredName returns lowercase name with underscore before every
+// uppercase letter but "D" after "I", eg. "user_id" for "UserID". Acronyms are
+// not detected, so "UUID" becomes "u_u_id", and it is kept this way so that
+// names of existing tables and columns do not change
 func (h *Helper) getUnderscoredName(s string) string {
 	o := ""
 
@@ -489,13 +2313,320 @@ func (h *Helper) getUnderscoredName(s string) string {
 }
 
 func (h *Helper) getPluralName(s string) string {
-	re := regexp.MustCompile(`y$`)
-	if re.MatchString(s) {
-		return string(re.ReplaceAll([]byte(s), []byte(`ies`)))
+	if pluralYRegExp.MatchString(s) {
+		return string(pluralYRegExp.ReplaceAll([]byte(s), []byte(`ies`)))
 	}
-	re = regexp.MustCompile(`s$`)
-	if re.MatchString(s) {
+	if pluralSRegExp.MatchString(s) {
 		return s + "es"
 	}
 	return s + "s"
 }
+
+// validateField checks single field of an object (or its value in filters)
+// against all the rules defined for it. Fields required only for specific
+// operations are checked when op matches
+func (h *Helper) validateField(val reflect.Value, k string, filters map[string]interface{}, op int) bool {
+	// Check required fields only when we are not validating filters
+	if filters == nil {
+		return h.validateValue(k, val.FieldByName(k), true, op)
+	}
+	if _, ok := filters[k]; !ok {
+		return true
+	}
+	for _, cond := range getFilterConditions(filters[k]) {
+		xv, ok := cond.Value.([]interface{})
+		if !filterOperators[cond.Operator] || ok != (cond.Operator == "IN") {
+			return false
+		}
+		if !ok {
+			xv = []interface{}{cond.Value}
+		}
+		if len(xv) == 0 {
+			return false
+		}
+		if cond.Operator == "LIKE" && val.FieldByName(k).Kind() != reflect.String {
+			return false
+		}
+		for _, v := range xv {
+			if reflect.ValueOf(v).Type().Name() != val.FieldByName(k).Type().Name() {
+				return false
+			}
+			// Values compared with other operators, eg. bounds of a range,
+			// do not have to be valid values of the field
+			if (cond.Operator == "=" || cond.Operator == "IN") && !h.validateValue(k, reflect.ValueOf(v), false, op) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateNestedField checks fields of a struct stored in a JSONB field and
+// returns dotted paths of the invalid ones, eg. "Address.PostCode"
+func (h *Helper) validateNestedField(valueField reflect.Value, k string, op int) []string {
+	nh := h.fieldsNested[k]
+	if nh == nil {
+		return nil
+	}
+	if valueField.Kind() == reflect.Ptr {
+		if valueField.IsNil() {
+			return nil
+		}
+		valueField = valueField.Elem()
+	}
+
+	failedFields := []string{}
+	for _, nk := range nh.fields {
+		if !nh.validateField(valueField, nk, nil, op) {
+			failedFields = append(failedFields, k+"."+nk)
+			continue
+		}
+		for _, p := range nh.validateNestedField(valueField.FieldByName(nk), nk, op) {
+			failedFields = append(failedFields, k+"."+p)
+		}
+	}
+	return failedFields
+}
+
+// transformFields applies transformations such as "trim" or "lower" to
+// string fields of an object, in the order they are defined in the tag
+func (h *Helper) transformFields(val reflect.Value) {
+	for k := range h.fieldsTransforms {
+		valueField := val.FieldByName(k)
+		if valueField.Kind() != reflect.String {
+			continue
+		}
+		valueField.SetString(h.transformValue(k, valueField.String()))
+	}
+}
+
+// transformValue applies transformations defined for a field to a string
+func (h *Helper) transformValue(k string, v string) string {
+	for _, t := range h.fieldsTransforms[k] {
+		switch t {
+		case "trim":
+			v = strings.TrimSpace(v)
+		case "lower":
+			v = strings.ToLower(v)
+		case "upper":
+			v = strings.ToUpper(v)
+		case "titlecase":
+			v = h.getTitleCase(v)
+		}
+	}
+	return v
+}
+
+// getTitleCase returns string with first letter of each word in uppercase
+func (h *Helper) getTitleCase(s string) string {
+	o := ""
+	prev := ' '
+	for _, ch := range s {
+		if unicode.IsSpace(prev) {
+			o += string(unicode.ToUpper(ch))
+		} else {
+			o += string(ch)
+		}
+		prev = ch
+	}
+	return o
+}
+
+// getFieldInterface returns an interface{} to object's field that can be
+// passed to the database driver
+func (h *Helper) getFieldInterface(valueField reflect.Value, k string) interface{} {
+	if h.fieldsFlags[k]&TypeConverted > 0 {
+		return &convertedValue{field: valueField, conv: h.getTypeConverter(k)}
+	}
+	if h.fieldsFlags[k]&TypeJSONB > 0 {
+		return &jsonbValue{ptr: valueField.Addr().Interface()}
+	}
+	if h.fieldsType[k] == moneyType {
+		return &moneyValue{field: valueField, currency: h.fieldsCurrency[k]}
+	}
+	return valueField.Addr().Interface()
+}
+
+// validateValue checks value against the rules defined for a field. It stops
+// on first failed rule
+func (h *Helper) validateValue(k string, valueField reflect.Value, checkRequired bool, op int) bool {
+	if h.fieldsFlags[k]&TypeConverted > 0 {
+		return h.validateConvertedValue(k, valueField, checkRequired, op)
+	}
+	if checkRequired && (h.fieldsRequired[k] || h.fieldsRequiredOps[k]&op > 0) {
+		canBeZero := false
+		if len(h.fieldsValueNotNil[k]) == 2 && (h.fieldsValueNotNil[k][0] || h.fieldsValueNotNil[k][1]) {
+			canBeZero = true
+		}
+		if !h.validateFieldRequired(valueField, canBeZero) {
+			return false
+		}
+	}
+	if v, ok := h.fieldsLength[k]; ok && !h.validateFieldLength(valueField, v) {
+		return false
+	}
+	if v, ok := h.fieldsValue[k]; ok {
+		minIsZero := false
+		maxIsZero := false
+		if len(h.fieldsValueNotNil[k]) == 2 {
+			minIsZero = h.fieldsValueNotNil[k][0]
+			maxIsZero = h.fieldsValueNotNil[k][1]
+		}
+		if !h.validateFieldValue(valueField, v, minIsZero, maxIsZero) {
+			return false
+		}
+	}
+	if h.fieldsEmail[k] && !h.validateFieldEmail(valueField) {
+		return false
+	}
+	if re, ok := h.fieldsRegExp[k]; ok && !h.validateFieldRegExp(valueField, re) {
+		return false
+	}
+	if h.fieldsType[k] == reflect.TypeOf(Point{}) && !valueField.Interface().(Point).IsValid() {
+		return false
+	}
+	if h.fieldsType[k] == moneyType && !valueField.Interface().(Money).IsValidIn(h.fieldsCurrency[k]) {
+		return false
+	}
+	return true
+}
+
+// validateConvertedValue checks value of a field which type has
+// a TypeConverter. Value is valid when it can be converted to database value
+// and, if field is required, it is not a zero value
+func (h *Helper) validateConvertedValue(k string, valueField reflect.Value, checkRequired bool, op int) bool {
+	if checkRequired && (h.fieldsRequired[k] || h.fieldsRequiredOps[k]&op > 0) && valueField.IsZero() {
+		return false
+	}
+	_, err := h.getTypeConverter(k).ToDB(valueField.Interface())
+	return err == nil
+}
+
+// convertFiltersToDB returns copy of filters with values of fields which
+// types have a TypeConverter converted to database values
+func (h *Helper) convertFiltersToDB(filters map[string]interface{}) (map[string]interface{}, error) {
+	o := make(map[string]interface{}, len(filters))
+	for k, v := range filters {
+		if h.fieldsFlags[k]&TypeConverted == 0 {
+			o[k] = v
+			continue
+		}
+		tc := h.getTypeConverter(k)
+		dbv, err := mapFilterValue(v, func(iv interface{}) (interface{}, error) {
+			return tc.ToDB(iv)
+		})
+		if err != nil {
+			return nil, err
+		}
+		o[k] = dbv
+	}
+	return o, nil
+}
+
+// getFieldKind returns kind of the field type
+func (h *Helper) getFieldKind(k string) reflect.Kind {
+	for kind, fieldType := range kindTypes {
+		if h.fieldsFlags[k]&fieldType > 0 {
+			return kind
+		}
+	}
+	return reflect.Invalid
+}
+
+// isKindInt checks if kind is one of the signed integers
+func (h *Helper) isKindInt(k reflect.Kind) bool {
+	return k == reflect.Int || k == reflect.Int8 || k == reflect.Int16 || k == reflect.Int32 || k == reflect.Int64
+}
+
+// isKindUint checks if kind is one of the unsigned integers
+func (h *Helper) isKindUint(k reflect.Kind) bool {
+	return k == reflect.Uint || k == reflect.Uint8 || k == reflect.Uint16 || k == reflect.Uint32 || k == reflect.Uint64
+}
+
+// getIntValue returns value of an integer field as int64. It returns false
+// when value does not fit into int64 (and therefore into BIGINT column)
+func (h *Helper) getIntValue(valueField reflect.Value) (int64, bool) {
+	if h.isKindUint(valueField.Kind()) {
+		if valueField.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(valueField.Uint()), true
+	}
+	return valueField.Int(), true
+}
+
+// validateFieldRequired checks if field that is required has a value
+func (h *Helper) validateFieldRequired(valueField reflect.Value, canBeZero bool) bool {
+	if valueField.CanAddr() && valueField.Addr().Type().Implements(valuerType) {
+		v, err := valueField.Addr().Interface().(driver.Valuer).Value()
+		return err == nil && v != nil
+	}
+	if (valueField.Kind() == reflect.Ptr || valueField.Kind() == reflect.Map || valueField.Kind() == reflect.Slice) && valueField.IsNil() {
+		return false
+	}
+	if valueField.Kind() == reflect.String && valueField.String() == "" {
+		return false
+	}
+	if valueField.Type() == timeType && valueField.Interface().(time.Time).IsZero() {
+		return false
+	}
+	if (h.isKindInt(valueField.Kind()) || h.isKindUint(valueField.Kind())) && valueField.IsZero() && !canBeZero {
+		return false
+	}
+	return true
+}
+
+// validateFieldLength checks string field's length
+func (h *Helper) validateFieldLength(valueField reflect.Value, length [2]int) bool {
+	if valueField.Kind() != reflect.String {
+		return true
+	}
+	if length[0] > -1 && len(valueField.String()) < length[0] {
+		return false
+	}
+	if length[1] > -1 && len(valueField.String()) > length[1] {
+		return false
+	}
+	return true
+}
+
+// validateFieldValue checks int field's value. Unsigned values that do not
+// fit into a database column are invalid
+func (h *Helper) validateFieldValue(valueField reflect.Value, value [2]int, minIsZero bool, maxIsZero bool) bool {
+	if !h.isKindInt(valueField.Kind()) && !h.isKindUint(valueField.Kind()) {
+		return true
+	}
+	i, ok := h.getIntValue(valueField)
+	if !ok {
+		return false
+	}
+	// Minimal value is 0 only when canBeZero is true; otherwise it's not defined
+	if ((minIsZero && value[0] == 0) || value[0] != 0) && i < int64(value[0]) {
+		return false
+	}
+	// Maximal value is 0 only when canBeZero is true; otherwise it's not defined
+	if ((maxIsZero && value[1] == 0) || value[1] != 0) && i > int64(value[1]) {
+		return false
+	}
+	return true
+}
+
+// validateFieldEmail checks if email field has a valid value
+func (h *Helper) validateFieldEmail(valueField reflect.Value) bool {
+	if valueField.Kind() != reflect.String {
+		return true
+	}
+	return emailRegExp.MatchString(valueField.String())
+}
+
+// validateFieldRegExp checks if string field's value matches the regular
+// expression
+func (h *Helper) validateFieldRegExp(valueField reflect.Value, re *regexp.Regexp) bool {
+	if valueField.Kind() != reflect.String {
+		return true
+	}
+	if !re.MatchString(valueField.String()) {
+		return false
+	}
+	return true
+}
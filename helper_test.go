@@ -1,7 +1,17 @@
 package crud
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSQLQueries(t *testing.T) {
@@ -66,19 +76,26 @@ func TestSQLSelectQueries(t *testing.T) {
 	}
 
 	got = h.GetQuerySelect([]string{"EmailSecondary", "desc", "Age", "asc"}, 67, 13, map[string]interface{}{"Price": 4444, "PostCode2": "11-111"}, nil, nil)
-	want = "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs WHERE post_code2=$1 AND price=$2 ORDER BY email_secondary DESC,age ASC LIMIT 67 OFFSET 13"
+	want = "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs WHERE post_code2=$1 AND price=$2 ORDER BY email_secondary DESC,age ASC,test_struct_id ASC LIMIT 67 OFFSET 13"
 	if got != want {
 		t.Fatalf("want %v, got %v", want, got)
 	}
 
 	got = h.GetQuerySelect([]string{"EmailSecondary", "desc", "Age", "asc"}, 67, 13, map[string]interface{}{"Price": 4444, "PostCode2": "11-111"}, map[string]bool{"EmailSecondary": true}, nil)
-	want = "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs WHERE post_code2=$1 AND price=$2 ORDER BY email_secondary DESC LIMIT 67 OFFSET 13"
+	want = "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs WHERE post_code2=$1 AND price=$2 ORDER BY email_secondary DESC,test_struct_id ASC LIMIT 67 OFFSET 13"
 	if got != want {
 		t.Fatalf("want %v, got %v", want, got)
 	}
 
 	got = h.GetQuerySelect([]string{"EmailSecondary", "desc", "Age", "asc"}, 67, 13, map[string]interface{}{"Price": 4444, "PostCode2": "11-111"}, map[string]bool{"EmailSecondary": true}, map[string]bool{"Price": true})
-	want = "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs WHERE price=$1 ORDER BY email_secondary DESC LIMIT 67 OFFSET 13"
+	want = "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs WHERE price=$1 ORDER BY email_secondary DESC,test_struct_id ASC LIMIT 67 OFFSET 13"
+	if got != want {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	// ID column is always the last one in order, columns after it are removed
+	got = h.GetQuerySelect([]string{"Age", "asc", "ID", "desc", "EmailSecondary", "asc"}, 10, 0, nil, nil, nil)
+	want = "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs ORDER BY age ASC,test_struct_id DESC LIMIT 10"
 	if got != want {
 		t.Fatalf("want %v, got %v", want, got)
 	}
@@ -197,3 +214,1669 @@ func TestValidationFields(t *testing.T) {
 		t.Fatalf("Want ^[0-9]{2}\\-[0-9]{3}$, got %v", h.fieldsRegExp["PostCode2"].String())
 	}
 }
+
+func TestSQLExplainQueries(t *testing.T) {
+	h := NewHelper(testStructObj, "", "", nil)
+
+	got := h.GetQueryExplain(h.GetQuerySelect(nil, 10, 0, map[string]interface{}{"Price": 444}, nil, nil))
+	want := "EXPLAIN (ANALYZE, FORMAT JSON) SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs WHERE price=$1 LIMIT 10"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLSelectQueriesWithHints(t *testing.T) {
+	h := NewHelper(testStructObj, "", "", nil)
+
+	got := h.GetQuerySelectWithHints([]string{"Age", "desc"}, 10, 0, nil, nil, nil, QueryHints{OrderBy: "test_struct_id ASC"})
+	want := "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs ORDER BY age DESC,test_struct_id ASC LIMIT 10"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLSelectQueriesWithIn(t *testing.T) {
+	h := NewHelper(testStructObj, "", "", nil)
+
+	filters := map[string]interface{}{"Price": []interface{}{100, 200}, "Age": 30, "ID": []interface{}{int64(1), int64(2), int64(3)}}
+	got := h.GetQuerySelect(nil, 10, 0, filters, nil, nil)
+	want := "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs WHERE age=$1 AND price IN ($2,$3) AND test_struct_id IN ($4,$5,$6) LIMIT 10"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	gotArgs := h.GetFilterArgs(filters)
+	wantArgs := []interface{}{30, 100, 200, int64(1), int64(2), int64(3)}
+	if !reflect.DeepEqual(gotArgs, wantArgs) {
+		t.Fatalf("Want %v, got %v", wantArgs, gotArgs)
+	}
+}
+
+func TestSQLCountQuery(t *testing.T) {
+	type Session struct {
+		ID        int64
+		Status    string
+		ExpiresAt int64 `crud:"expires"`
+	}
+	h := NewHelper(&Session{}, "", "", nil)
+
+	got := h.GetQueryCount(map[string]interface{}{"Status": "active"}, nil)
+	want := "SELECT COUNT(*) FROM sessions WHERE status=$1 AND (expires_at = 0 OR expires_at > $2)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	h = NewHelper(testStructObj, "", "", nil)
+	got = h.GetQueryCount(nil, nil)
+	want = "SELECT COUNT(*) FROM test_structs"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLDeleteOlderThanQueries(t *testing.T) {
+	type Session struct {
+		ID        int64
+		ExpiresAt int64
+	}
+	h := NewHelper(&Session{}, "", "", nil)
+
+	got := h.GetQueryDeleteOlderThan("ExpiresAt")
+	want := "DELETE FROM sessions WHERE expires_at > 0 AND expires_at < $1"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLUpdateFieldsQuery(t *testing.T) {
+	type Session struct {
+		ID        int64
+		Token     string
+		Flags     int64
+		ExpiresAt int64
+	}
+	h := NewHelper(&Session{}, "", "", nil)
+
+	got := h.GetQueryUpdateFieldsById([]string{"ExpiresAt", "Token"})
+	want := "UPDATE sessions SET expires_at=$1,token=$2 WHERE session_id = $3"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLUpdateWhereQuery(t *testing.T) {
+	type Order struct {
+		ID     int64
+		Status string
+		Price  int
+	}
+	h := NewHelper(&Order{}, "", "", nil)
+
+	got := h.GetQueryUpdateByIdWhere(map[string]interface{}{"Status": "pending", "Price": []interface{}{1, 2}})
+	want := "UPDATE orders SET status=$1,price=$2 WHERE order_id = $3 AND price IN ($4,$5) AND status=$6 RETURNING order_id,status,price"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLReturningQueries(t *testing.T) {
+	type Order struct {
+		ID     int64
+		Status string
+	}
+	h := NewHelper(&Order{}, "", "", nil)
+
+	got := h.GetQueryUpdateByIdReturning()
+	want := "UPDATE orders SET status=$1 WHERE order_id = $2 RETURNING order_id,status"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = h.GetQueryDeleteByIdReturning()
+	want = "DELETE FROM orders WHERE order_id = $1 RETURNING order_id,status"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLInsertManyQuery(t *testing.T) {
+	type Order struct {
+		ID     int64
+		Status string
+		Price  int
+	}
+	h := NewHelper(&Order{}, "", "", nil)
+
+	got := h.GetQueryInsertMany(2)
+	want := "INSERT INTO orders(status,price) VALUES ($1,$2),($3,$4) RETURNING order_id,status,price"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	got = h.GetQueryInsertManyWithID(2)
+	want = "INSERT INTO orders(order_id,status,price) VALUES ($1,$2,$3),($4,$5,$6) RETURNING order_id,status,price"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	got = h.GetQueryNextIDs()
+	want = "SELECT nextval(pg_get_serial_sequence('orders', 'order_id')) FROM generate_series(1, $1)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLSelectJoinedQuery(t *testing.T) {
+	type User struct {
+		ID   int64
+		Name string
+	}
+	type Session struct {
+		ID        int64
+		UserID    int64
+		Token     string
+		ExpiresAt int64 `crud:"expires"`
+	}
+	h := NewHelper(&Session{}, "", "", nil)
+	rh := NewHelper(&User{}, "", "", nil)
+
+	got := h.GetQuerySelectJoined(rh, "UserID", []string{"Token", "desc"}, 10, 20, map[string]interface{}{"Token": "abc"}, map[string]interface{}{"Name": []interface{}{"a", "b"}})
+	want := "SELECT o.session_id,o.user_id,o.token,o.expires_at,r.user_id,r.name FROM sessions o JOIN users r ON r.user_id = o.user_id WHERE o.token=$1 AND r.name IN ($2,$3) AND (o.expires_at = 0 OR o.expires_at > $4) ORDER BY o.token DESC,o.session_id ASC LIMIT 10 OFFSET 20"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLInsertSummaryQuery(t *testing.T) {
+	type Product struct {
+		ID         int64
+		Category   string
+		Status     string
+		ArchivedAt int64 `crud:"expires"`
+	}
+	type CategoryCount struct {
+		ID       int64
+		Category string
+		Count    int64
+	}
+	h := NewHelper(&CategoryCount{}, "", "", nil)
+	sh := NewHelper(&Product{}, "", "", nil)
+
+	got := h.GetQueryInsertSummary(sh, []string{"Category"}, "Count", map[string]interface{}{"Status": "active"})
+	want := "INSERT INTO category_counts(category,count) SELECT category,COUNT(*) FROM products WHERE status=$1 AND (archived_at = 0 OR archived_at > $2) GROUP BY category"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLSelectAfterIDQuery(t *testing.T) {
+	type Session struct {
+		ID    int64
+		Token string
+	}
+	h := NewHelper(&Session{}, "", "", nil)
+
+	got := h.GetQuerySelectAfterID()
+	want := "SELECT session_id,token FROM sessions WHERE session_id > $1 ORDER BY session_id ASC LIMIT $2"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type Token struct {
+		ID        int64
+		Kind      string
+		ExpiresAt int64 `crud:"expires"`
+	}
+	h = NewHelper(&Token{}, "", "", nil)
+	got = h.GetQuerySelectAfterIDWhere(map[string]interface{}{"Kind": "api"}, 500)
+	want = "SELECT token_id,kind,expires_at FROM tokens WHERE kind=$1 AND token_id > $2 AND (expires_at = 0 OR expires_at > $3) ORDER BY token_id ASC LIMIT 500"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLExpiresQueries(t *testing.T) {
+	type Session struct {
+		ID        int64
+		Token     string
+		ExpiresAt int64 `crud:"expires"`
+	}
+	type Session_List struct {
+		ID    int64
+		Token string
+	}
+	h := NewHelper(&Session{}, "", "", nil)
+
+	got := h.GetQuerySelectById()
+	want := "SELECT session_id,token,expires_at FROM sessions WHERE session_id = $1 AND (expires_at = 0 OR expires_at > $2)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	h2 := NewHelper(&Session_List{}, "", "Session", h)
+	got = h2.GetQuerySelect(nil, 10, 0, map[string]interface{}{"Token": "abc"}, nil, nil)
+	want = "SELECT session_id,token FROM sessions WHERE token=$1 AND (expires_at = 0 OR expires_at > $2) LIMIT 10"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type Invalid struct {
+		ID        int64
+		ExpiresAt string `crud:"expires"`
+	}
+	h = NewHelper(&Invalid{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "expires" {
+		t.Fatalf("Want error for expires tag on non-int64 field")
+	}
+}
+
+func TestSQLColumnOrder(t *testing.T) {
+	type Ordered struct {
+		Name  string `crud:"order:2"`
+		Code  string
+		ID    int64
+		Age   int    `crud:"order:1"`
+		Email string `crud:"order:-1"`
+	}
+	h := NewHelper(&Ordered{}, "", "", nil)
+
+	got := h.GetQueryCreateTable()
+	want := "CREATE TABLE ordereds (ordered_id SERIAL PRIMARY KEY,email VARCHAR(255) DEFAULT '',code VARCHAR(255) DEFAULT '',age BIGINT DEFAULT 0,name VARCHAR(255) DEFAULT '')"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	got = h.GetQuerySelectById()
+	want = "SELECT ordered_id,email,code,age,name FROM ordereds WHERE ordered_id = $1"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	got = h.GetQueryCreateTableSorted()
+	want = "CREATE TABLE ordereds (ordered_id SERIAL PRIMARY KEY,age BIGINT DEFAULT 0,code VARCHAR(255) DEFAULT '',email VARCHAR(255) DEFAULT '',name VARCHAR(255) DEFAULT '')"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLDDLOptions(t *testing.T) {
+	h := NewHelper(testStructObj, "", "", nil)
+
+	got := h.GetQueryDropTableWithOptions(DDLOptions{Cascade: true})
+	want := "DROP TABLE IF EXISTS test_structs CASCADE"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	got = h.GetQueryCreateTableWithOptions(DDLOptions{IfNotExists: true})
+	want = "CREATE TABLE IF NOT EXISTS test_structs (test_struct_id SERIAL PRIMARY KEY,test_struct_flags BIGINT DEFAULT 0,primary_email VARCHAR(255) DEFAULT '',email_secondary VARCHAR(255) DEFAULT '',first_name VARCHAR(255) DEFAULT '',last_name VARCHAR(255) DEFAULT '',age BIGINT DEFAULT 0,price BIGINT DEFAULT 0,post_code VARCHAR(255) DEFAULT '',post_code2 VARCHAR(255) DEFAULT '',password VARCHAR(255) DEFAULT '',created_by_user_id BIGINT DEFAULT 0,key VARCHAR(255) DEFAULT '' UNIQUE)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLRLSQueries(t *testing.T) {
+	type Document struct {
+		ID        int64
+		TenantID  int64 `crud:"tenant"`
+		CreatedBy int64 `crud:"createdby"`
+		Title     string
+	}
+	h := NewHelper(&Document{}, "", "", nil)
+
+	got := h.GetQueriesRLS(DDLOptions{RLS: true, UserSetting: "app.uid"})
+	cond := "tenant_id = NULLIF(current_setting('app.tenant_id', true), '')::bigint AND created_by = NULLIF(current_setting('app.uid', true), '')::bigint"
+	want := []string{
+		"ALTER TABLE documents ENABLE ROW LEVEL SECURITY",
+		"DROP POLICY IF EXISTS documents_scope ON documents",
+		"CREATE POLICY documents_scope ON documents USING (" + cond + ") WITH CHECK (" + cond + ")",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	h2 := NewHelper(testStructObj, "", "", nil)
+	if got := h2.GetQueriesRLS(DDLOptions{RLS: true}); got != nil {
+		t.Fatalf("Want nil, got %v", got)
+	}
+}
+
+func TestSQLFlagsColumns(t *testing.T) {
+	type Account struct {
+		ID          int64
+		Flags       int64
+		Permissions int64 `crud:"flags"`
+	}
+	type Label struct {
+		ID    int64
+		Flags string
+	}
+	for obj, want := range map[interface{}]string{
+		&Account{}: "CREATE TABLE accounts (account_id SERIAL PRIMARY KEY,account_flags BIGINT DEFAULT 0,permissions BIGINT DEFAULT 0)",
+		&Label{}:   "CREATE TABLE labels (label_id SERIAL PRIMARY KEY,flags VARCHAR(255) DEFAULT '')",
+	} {
+		got := NewHelper(obj, "", "", nil).GetQueryCreateTable()
+		if got != want {
+			t.Fatalf("Want %v, got %v", want, got)
+		}
+	}
+}
+
+func TestSQLGrantQueries(t *testing.T) {
+	type Order struct {
+		ID     int64
+		Status string
+	}
+	h := NewHelper(&Order{}, "", "", nil)
+
+	got := h.GetQueriesCreateTableWithOptions(DDLOptions{Grants: []Grant{{Role: "reporting", Ops: OpRead | OpList}, {Role: "app", Ops: OpCreate | OpRead | OpUpdate}}})
+	want := []string{
+		"CREATE TABLE orders (order_id SERIAL PRIMARY KEY,status VARCHAR(255) DEFAULT '')",
+		`GRANT SELECT ON orders TO "reporting"`,
+		`GRANT SELECT,INSERT,UPDATE ON orders TO "app"`,
+		`GRANT USAGE ON SEQUENCE orders_order_id_seq TO "app"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLRenameColumns(t *testing.T) {
+	type Renamed struct {
+		ID       int64
+		FullName string `crud:"was:name"`
+		Age      int    `crud:"was:age"`
+	}
+	h := NewHelper(&Renamed{}, "", "", nil)
+
+	got := h.GetQueriesRenameColumns()
+	want := map[string]string{"name": "ALTER TABLE renameds RENAME COLUMN name TO full_name"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type Invalid struct {
+		ID   int64
+		Name string `crud:"was:Old-Name"`
+	}
+	h = NewHelper(&Invalid{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "was" {
+		t.Fatalf("Want error for invalid column name in was tag")
+	}
+}
+
+func TestHelperFilterableFields(t *testing.T) {
+	type Filtered struct {
+		ID    int64
+		Name  string `crud:"filterable"`
+		Email string
+	}
+	h := NewHelper(&Filtered{}, "", "", nil)
+	if !h.isFilterable("Name") || h.isFilterable("Email") || h.isFilterable("NonExisting") {
+		t.Fatalf("isFilterable failed to allow only fields with filterable tag")
+	}
+
+	h = NewHelper(testStructObj, "", "", nil)
+	if !h.isFilterable("Price") || h.isFilterable("NonExisting") {
+		t.Fatalf("isFilterable failed to allow all fields when none has filterable tag")
+	}
+}
+
+func TestValidatorFor(t *testing.T) {
+	h := NewHelper(testStructObj, "", "", nil)
+
+	if h.ValidatorFor("NonExisting") != nil {
+		t.Fatalf("ValidatorFor returned validator for non-existing field")
+	}
+
+	v := h.ValidatorFor("FirstName")
+	if !v("John") {
+		t.Fatalf("ValidatorFor returned validator that failed on valid value")
+	}
+	if v("J") || v("") || v(12) {
+		t.Fatalf("ValidatorFor returned validator that passed invalid value")
+	}
+
+	v = h.ValidatorFor("EmailSecondary")
+	if !v("test@example.com") || v("invalid") {
+		t.Fatalf("ValidatorFor returned invalid email validator")
+	}
+}
+
+func TestValidationFieldsRequiredForOperation(t *testing.T) {
+	type User struct {
+		ID       int64  `json:"user_id"`
+		Email    string `json:"email" crud:"req"`
+		Password string `json:"password" crud:"req:create"`
+	}
+	h := NewHelper(&User{}, "", "", nil)
+	if h.Err() != nil {
+		t.Fatalf("NewHelper failed: %s", h.Err().Error())
+	}
+
+	u := &User{Email: "test@example.com"}
+	val := reflect.ValueOf(u).Elem()
+	if h.validateField(val, "Password", nil, OpCreate) {
+		t.Fatalf("Field required on create passed validation when empty")
+	}
+	if !h.validateField(val, "Password", nil, OpUpdate) {
+		t.Fatalf("Field required on create failed validation on update")
+	}
+
+	type Invalid struct {
+		ID   int64  `json:"invalid_id"`
+		Name string `json:"name" crud:"req:nonexisting"`
+	}
+	h = NewHelper(&Invalid{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "req" {
+		t.Fatalf("NewHelper failed to return error on invalid operation in req tag")
+	}
+}
+
+func TestJSONBFields(t *testing.T) {
+	type Address struct {
+		Street   string `json:"street" crud:"req"`
+		PostCode string `json:"post_code" crud:"regexp:^[0-9]{2}\\-[0-9]{3}$"`
+	}
+	type Customer struct {
+		ID      int64    `json:"customer_id"`
+		Name    string   `json:"name" crud:"req"`
+		Address *Address `json:"address" crud:"jsonb"`
+		Ignored *Address `json:"ignored"`
+	}
+	h := NewHelper(&Customer{}, "", "", nil)
+
+	got := h.GetQueryCreateTable()
+	want := "CREATE TABLE customers (customer_id SERIAL PRIMARY KEY,name VARCHAR(255) DEFAULT '',address JSONB)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	c := &Customer{Name: "John", Address: &Address{PostCode: "invalid"}}
+	got2 := h.validateNestedField(reflect.ValueOf(c).Elem().FieldByName("Address"), "Address", 0)
+	want2 := []string{"Address.Street", "Address.PostCode"}
+	if len(got2) != len(want2) || got2[0] != want2[0] || got2[1] != want2[1] {
+		t.Fatalf("Want %v, got %v", want2, got2)
+	}
+}
+
+func TestPointFields(t *testing.T) {
+	type Shop struct {
+		ID       int64 `json:"shop_id"`
+		Location Point `json:"location"`
+	}
+	h := NewHelper(&Shop{}, "", "", nil)
+
+	got := h.GetQueryCreateTable()
+	want := "CREATE TABLE shops (shop_id SERIAL PRIMARY KEY,location POINT)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	v, err := Point{Lat: 52.2297, Lng: 21.0122}.Value()
+	if err != nil || v != "(21.0122,52.2297)" {
+		t.Fatalf("Want (21.0122,52.2297), got %v", v)
+	}
+	p := Point{}
+	err = p.Scan([]byte("(21.0122,52.2297)"))
+	if err != nil || p.Lat != 52.2297 || p.Lng != 21.0122 {
+		t.Fatalf("Want 52.2297,21.0122, got %v,%v", p.Lat, p.Lng)
+	}
+
+	if h.validateValue("Location", reflect.ValueOf(Point{Lat: 91}), false, 0) {
+		t.Fatalf("Validate failed to check latitude")
+	}
+}
+
+func TestMoneyFields(t *testing.T) {
+	type Invoice struct {
+		ID    int64 `json:"invoice_id"`
+		Total Money `json:"total" crud:"req currency:USD"`
+	}
+	h := NewHelper(&Invoice{}, "", "", nil)
+
+	got := h.GetQueryCreateTable()
+	want := "CREATE TABLE invoices (invoice_id SERIAL PRIMARY KEY,total BIGINT)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	type InvalidInvoice struct {
+		ID    int64
+		Total Money
+	}
+	h2 := NewHelper(&InvalidInvoice{}, "", "", nil)
+	if h2.Err() == nil || h2.Err().Tag != "currency" {
+		t.Fatalf("NewHelper failed to return error for money without currency")
+	}
+
+	m, err := ParseMoney("-12.3", "USD")
+	if err != nil || m.Amount != -1230 || m.String() != "-12.30 USD" {
+		t.Fatalf("Want -12.30 USD, got %v", m)
+	}
+	_, err = ParseMoney("12.345", "USD")
+	if err == nil {
+		t.Fatalf("ParseMoney failed to reject amount with too many decimal places")
+	}
+	if d := NewMoney(5, "KWD").Decimal(); d != "0.005" {
+		t.Fatalf("Want 0.005, got %v", d)
+	}
+
+	inv := &Invoice{Total: m}
+	mv := h.getFieldInterface(reflect.ValueOf(inv).Elem().FieldByName("Total"), "Total").(*moneyValue)
+	v, _ := mv.Value()
+	inv.Total = Money{}
+	err = mv.Scan([]byte(strconv.FormatInt(v.(int64), 10)))
+	if err != nil || inv.Total != m {
+		t.Fatalf("Want %v, got %v", m, inv.Total)
+	}
+	inv.Total = NewMoney(100, "EUR")
+	_, err = mv.Value()
+	if err == nil {
+		t.Fatalf("Value failed to reject money in another currency")
+	}
+	m2 := Money{}
+	b, _ := json.Marshal(m)
+	if string(b) != `{"amount":"-12.30","currency":"USD"}` {
+		t.Fatalf("Want {\"amount\":\"-12.30\",\"currency\":\"USD\"}, got %v", string(b))
+	}
+	err = json.Unmarshal([]byte(`{"amount":"1000","currency":"JPY"}`), &m2)
+	if err != nil || m2.Amount != 1000 {
+		t.Fatalf("Want 1000 JPY, got %v", m2)
+	}
+
+	for _, s := range []Serializer{MsgpackSerializer{}, CBORSerializer{}} {
+		b, _ = s.Marshal(m)
+		m2 = Money{}
+		err = s.Unmarshal(b, &m2)
+		if err != nil || m2 != m {
+			t.Fatalf("Want %v from %s, got %v", m, s.ContentType(), m2)
+		}
+	}
+
+	if tax, _ := NewMoney(1050, "USD").MulFrac(23, 100); tax.Amount != 242 {
+		t.Fatalf("Want 242, got %v", tax.Amount)
+	}
+	if tax, _ := NewMoney(-250, "USD").MulFrac(1, 100); tax.Amount != -3 {
+		t.Fatalf("Want -3, got %v", tax.Amount)
+	}
+	if big, err := NewMoney(math.MaxInt64/2, "USD").MulFrac(3, 2); err != nil || big.Amount != math.MaxInt64/2*3/2+1 {
+		t.Fatalf("MulFrac failed to multiply amount without overflow: %v", err)
+	}
+	_, err = NewMoney(math.MaxInt64/2, "USD").MulFrac(3, 1)
+	if err == nil {
+		t.Fatalf("MulFrac failed to return error on overflow")
+	}
+	_, err = NewMoney(math.MaxInt64, "USD").Add(NewMoney(1, "USD"))
+	if err == nil {
+		t.Fatalf("Add failed to return error on overflow")
+	}
+	parts := NewMoney(100, "USD").Split(3)
+	if len(parts) != 3 || parts[0].Amount != 34 || parts[1].Amount != 33 || parts[2].Amount != 33 {
+		t.Fatalf("Want 34, 33, 33, got %v", parts)
+	}
+
+	if h.validateValue("Total", reflect.ValueOf(Money{Amount: 1, Currency: "EUR"}), false, 0) {
+		t.Fatalf("validateValue failed to check currency")
+	}
+	if h.validateValue("Total", reflect.ValueOf(&Invoice{}).Elem().FieldByName("Total"), true, OpCreate) {
+		t.Fatalf("validateValue failed to check required money")
+	}
+}
+
+func TestTransformFields(t *testing.T) {
+	type Person struct {
+		ID    int64  `json:"person_id"`
+		Email string `json:"email" crud:"trim lower"`
+		Name  string `json:"name" crud:"trim titlecase"`
+	}
+	h := NewHelper(&Person{}, "", "", nil)
+
+	p := &Person{Email: "  John.Smith@Example.COM ", Name: " john smith"}
+	h.transformFields(reflect.ValueOf(p).Elem())
+	if p.Email != "john.smith@example.com" {
+		t.Fatalf("Want john.smith@example.com, got %v", p.Email)
+	}
+	if p.Name != "John Smith" {
+		t.Fatalf("Want John Smith, got %v", p.Name)
+	}
+}
+
+func TestSlugFields(t *testing.T) {
+	type Post struct {
+		ID    int64  `json:"post_id"`
+		Title string `json:"title"`
+		Slug  string `json:"slug" crud:"slug:Title"`
+	}
+	h := NewHelper(&Post{}, "", "", nil)
+
+	if h.getSlugField() != "Slug" {
+		t.Fatalf("Want Slug, got %v", h.getSlugField())
+	}
+
+	got := h.getSlug("  My First Post! (Żółw) ")
+	want := "my-first-post-w"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	got = h.GetQuerySelectByField("Slug")
+	want = "SELECT post_id,title,slug FROM posts WHERE slug = $1"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	got = h.getQuerySelectSlugs("Slug")
+	want = "SELECT slug FROM posts WHERE slug = $1 OR slug LIKE $2"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	got = h.GetQueryCreateTable()
+	want = "CREATE TABLE posts (post_id SERIAL PRIMARY KEY,title VARCHAR(255) DEFAULT '',slug VARCHAR(255) DEFAULT '' UNIQUE)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	taken := map[string]bool{"post": true, "post-2": true}
+	for base, want := range map[string]string{"post": "post-3", "title": "title", "2024": "2024-2"} {
+		got = h.getFreeSlug(base, taken)
+		if got != want {
+			t.Fatalf("Want %v, got %v", want, got)
+		}
+	}
+}
+
+func TestLookupFields(t *testing.T) {
+	type Account struct {
+		ID    int64  `json:"account_id"`
+		Email string `json:"email" crud:"uniq lookup"`
+		Name  string `json:"name" crud:"lookup"`
+	}
+	h := NewHelper(&Account{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "lookup" {
+		t.Fatalf("NewHelper failed to return error on lookup field that is not uniq")
+	}
+}
+
+func TestProtobufStructs(t *testing.T) {
+	type Status int32
+	type Message struct {
+		state                int64
+		ID                   int64  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+		Name                 string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+		Status               Status `protobuf:"varint,3,opt,name=status,proto3,enum=Status" json:"status,omitempty" crud:"valmax:3"`
+		XXX_NoUnkeyedLiteral struct{}
+		XXX_unrecognized     []byte
+		XXX_sizecache        int32
+	}
+	h := NewHelper(&Message{}, "", "", nil)
+
+	got := h.GetQueryCreateTable()
+	want := "CREATE TABLE messages (message_id SERIAL PRIMARY KEY,name VARCHAR(255) DEFAULT '',status INTEGER DEFAULT 0)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	if h.fieldsJSONName["Name"] != "name" {
+		t.Fatalf("Want name, got %v", h.fieldsJSONName["Name"])
+	}
+
+	v := h.ValidatorFor("Status")
+	if !v(Status(2)) || v(Status(4)) {
+		t.Fatalf("ValidatorFor returned invalid validator for enum field")
+	}
+}
+
+func TestIntegerFields(t *testing.T) {
+	type Counter struct {
+		ID     int64  `json:"counter_id"`
+		Small  int8   `json:"small"`
+		Medium int16  `json:"medium"`
+		Byte   uint8  `json:"byte" crud:"valmax:100"`
+		Port   uint16 `json:"port"`
+		Big    uint64 `json:"big"`
+	}
+	h := NewHelper(&Counter{}, "", "", nil)
+
+	got := h.GetQueryCreateTable()
+	want := "CREATE TABLE counters (counter_id SERIAL PRIMARY KEY,small SMALLINT DEFAULT 0,medium SMALLINT DEFAULT 0,byte SMALLINT DEFAULT 0 CHECK (byte >= 0),port INTEGER DEFAULT 0 CHECK (port >= 0),big BIGINT DEFAULT 0 CHECK (big >= 0))"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	if !h.ValidatorFor("Byte")(uint8(100)) || h.ValidatorFor("Byte")(uint8(101)) {
+		t.Fatalf("ValidatorFor returned invalid validator for uint8 field")
+	}
+	if !h.ValidatorFor("Big")(uint64(1)) || h.ValidatorFor("Big")(uint64(math.MaxUint64)) {
+		t.Fatalf("ValidatorFor returned validator that does not check uint64 range")
+	}
+}
+
+func TestStrictHelper(t *testing.T) {
+	type Item struct {
+		ID      int64             `json:"item_id"`
+		Name    string            `json:"name"`
+		Price   float64           `json:"price"`
+		Tags    []string          `json:"tags"`
+		Details map[string]string `json:"details" crud:"jsonb"`
+	}
+
+	h := NewHelper(&Item{}, "", "", nil)
+	if h.Err() != nil {
+		t.Fatalf("NewHelper returned an error for struct with unsupported fields")
+	}
+
+	h = NewStrictHelper(&Item{}, "", "", nil)
+	if h.Err() == nil {
+		t.Fatalf("NewStrictHelper failed to return error for struct with unsupported fields")
+	}
+	if len(h.Err().Fields) != 2 || h.Err().Fields[0] != "Price" || h.Err().Fields[1] != "Tags" {
+		t.Fatalf("Want [Price Tags], got %v", h.Err().Fields)
+	}
+}
+
+func TestHelperInvalidRegExp(t *testing.T) {
+	type Item struct {
+		ID   int64
+		Code string `crud:"regexp:^[a-z+$"`
+	}
+	h := NewHelper(&Item{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "regexp" || len(h.Err().Fields) != 1 || h.Err().Fields[0] != "Code" || !strings.Contains(h.Err().Error(), "^[a-z+$") {
+		t.Fatalf("NewHelper failed to return error for invalid regexp tag: %v", h.Err())
+	}
+
+	type Item2 struct {
+		ID   int64
+		Code string `crud_regexp:"(abc"`
+	}
+	h = NewHelper(&Item2{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "crud_regexp" || h.Err().Fields[0] != "Code" {
+		t.Fatalf("NewHelper failed to return error for invalid crud_regexp tag: %v", h.Err())
+	}
+
+	_, _, err := NewController(nil, "").Validate(&Item2{}, nil)
+	if err == nil {
+		t.Fatalf("Validate failed to return error for struct with invalid regexp tag")
+	}
+}
+
+// TestHelperFlagsTag tests if "flags" tag marks int64 fields as flags fields
+// and it returns error for fields of other types
+func TestHelperFlagsTag(t *testing.T) {
+	type Item struct {
+		ID          int64
+		Flags       int64
+		Permissions int64 `crud:"flags"`
+		Age         int64
+	}
+	h := NewHelper(&Item{}, "", "", nil)
+	if h.Err() != nil {
+		t.Fatalf("NewHelper failed: %s", h.Err().Error())
+	}
+	if !h.isFlagsField("Flags") || !h.isFlagsField("Permissions") || h.isFlagsField("Age") {
+		t.Fatalf("NewHelper failed to set flags fields")
+	}
+	if !strings.Contains(h.GetQueryCreateTable(), "permissions BIGINT DEFAULT 0") {
+		t.Fatalf("GetQueryCreateTable returned invalid column of flags field: %s", h.GetQueryCreateTable())
+	}
+
+	type Item2 struct {
+		ID          int64
+		Permissions string `crud:"flags"`
+	}
+	h = NewHelper(&Item2{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "flags" {
+		t.Fatalf("NewHelper failed to return error for flags tag on string field: %v", h.Err())
+	}
+}
+
+// TestHelperRelTag tests if fields with "rel" tag are not mapped to columns
+// and tag is checked
+func TestHelperRelTag(t *testing.T) {
+	type Author struct {
+		ID   int64
+		Name string
+	}
+	type Book struct {
+		ID       int64
+		AuthorID int64
+		Author   *Author `json:"author" crud:"rel:AuthorID"`
+	}
+	h := NewStrictHelper(&Book{}, "", "", nil)
+	if h.Err() != nil {
+		t.Fatalf("NewStrictHelper failed: %s", h.Err().Error())
+	}
+	if h.fieldsRel["Author"] != "AuthorID" || h.fieldsRelJSONName["Author"] != "author" || h.dbFieldCols["Author"] != "" {
+		t.Fatalf("NewStrictHelper failed to set field with rel tag")
+	}
+
+	type Book2 struct {
+		ID     int64
+		Author *Author `crud:"rel:Title"`
+		Title  string
+	}
+	h = NewHelper(&Book2{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "rel" {
+		t.Fatalf("NewHelper failed to return error for rel tag with field that is not int64: %v", h.Err())
+	}
+
+	type Book3 struct {
+		ID       int64
+		AuthorID int64
+		Author   Author `crud:"rel:AuthorID"`
+	}
+	h = NewHelper(&Book3{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "rel" {
+		t.Fatalf("NewHelper failed to return error for rel tag on field that is not a pointer: %v", h.Err())
+	}
+}
+
+// TestSQLSecondaryDBQueries tests queries used to mirror writes to the
+// secondary database and to verify it
+func TestSQLSecondaryDBQueries(t *testing.T) {
+	type Note struct {
+		ID    int64
+		Title string
+		Views int64
+	}
+	h := NewHelper(&Note{}, "", "", nil)
+	want := "INSERT INTO notes(note_id,title,views) VALUES ($1,$2,$3) ON CONFLICT (note_id) DO UPDATE SET title=EXCLUDED.title,views=EXCLUDED.views"
+	got := h.GetQueryUpsertWithID()
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	want = "SELECT note_id,title,views FROM notes WHERE note_id > $1 AND note_id <= $2 ORDER BY note_id ASC"
+	got = h.GetQuerySelectBetweenIDs()
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+type testLegacyUser struct {
+	ID   int64
+	Name string
+}
+
+func (u *testLegacyUser) TableName() string {
+	return "accounts"
+}
+
+// TestSQLTableName tests if table name can be set with TableName method and
+// with "table" tag of blank field
+func TestSQLTableName(t *testing.T) {
+	h := NewHelper(&testLegacyUser{}, "gen64_", "", nil)
+	want := "SELECT test_legacy_user_id,name FROM accounts WHERE test_legacy_user_id = $1"
+	got := h.GetQuerySelectById()
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type testLegacyUserRead struct {
+		ID int64
+	}
+	dh := NewHelper(&testLegacyUserRead{}, "gen64_", "testLegacyUser", h)
+	want = "SELECT test_legacy_user_id FROM accounts WHERE test_legacy_user_id = $1"
+	got = dh.GetQuerySelectById()
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type Person struct {
+		_    struct{} `crud:"table:people"`
+		ID   int64
+		Name string
+	}
+	h = NewHelper(&Person{}, "gen64_", "", nil)
+	want = "DROP TABLE IF EXISTS people"
+	got = h.GetQueryDropTable()
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type Invalid struct {
+		_  struct{} `crud:"table:in-valid"`
+		ID int64
+	}
+	h = NewHelper(&Invalid{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "table" {
+		t.Fatalf("NewHelper failed to return error for invalid table name")
+	}
+}
+
+func TestSQLColTag(t *testing.T) {
+	type Customer struct {
+		ID    int64  `crud:"col:customer_no"`
+		Email string `crud:"col:email_address"`
+		Name  string
+	}
+	h := NewHelper(&Customer{}, "gen64_", "", nil)
+	want := "SELECT customer_no,email_address,name FROM gen64_customers WHERE customer_no = $1"
+	got := h.GetQuerySelectById()
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type CustomerEmail struct {
+		ID    int64
+		Email string `crud:"req"`
+	}
+	dh := NewHelper(&CustomerEmail{}, "gen64_", "Customer", h)
+	want = "UPDATE gen64_customers SET email_address=$1 WHERE customer_no = $2"
+	got = dh.GetQueryUpdateById()
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type Duplicate struct {
+		ID   int64
+		Name string
+		Nick string `crud:"col:name"`
+	}
+	h = NewHelper(&Duplicate{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "col" {
+		t.Fatalf("NewHelper failed to return error for duplicate column")
+	}
+	type Invalid struct {
+		ID   int64
+		Name string `crud:"col:Name"`
+	}
+	h = NewHelper(&Invalid{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "col" {
+		t.Fatalf("NewHelper failed to return error for invalid column name")
+	}
+}
+
+func TestSQLDBTypeTags(t *testing.T) {
+	type Article struct {
+		ID      int64
+		Title   string         `crud:"dblen:lenmax lenmax:120"`
+		Slug    string         `crud:"dblen:80 lenmax:60"`
+		Body    string         `crud:"dbtype:text"`
+		Note    sql.NullString `crud:"dblen:1000"`
+		Summary string         `crud:"lenmax:100"`
+		Content string         `crud:"lenmax:20000000 dblen:lenmax"`
+	}
+	h := NewHelper(&Article{}, "", "", nil)
+	want := "CREATE TABLE articles (article_id SERIAL PRIMARY KEY,title VARCHAR(120) DEFAULT '',slug VARCHAR(80) DEFAULT '',body TEXT DEFAULT '',note VARCHAR(1000),summary VARCHAR(255) DEFAULT '',content TEXT DEFAULT '')"
+	got := h.GetQueryCreateTable()
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type InvalidType struct {
+		ID   int64
+		Body string `crud:"dbtype:blob"`
+	}
+	type InvalidLen struct {
+		ID   int64
+		Body string `crud:"dblen:0"`
+	}
+	type InvalidField struct {
+		ID    int64
+		Views int64 `crud:"dbtype:text"`
+	}
+	type ShorterThanMax struct {
+		ID   int64
+		Slug string `crud:"dblen:40 lenmax:60"`
+	}
+	type NoLenMax struct {
+		ID   int64
+		Slug string `crud:"dblen:lenmax"`
+	}
+	for _, obj := range []interface{}{&InvalidType{}, &InvalidLen{}, &InvalidField{}, &ShorterThanMax{}, &NoLenMax{}} {
+		h = NewHelper(obj, "", "", nil)
+		if h.Err() == nil || (h.Err().Tag != "dbtype" && h.Err().Tag != "dblen") {
+			t.Fatalf("NewHelper failed to return error for invalid dbtype or dblen tag of %T", obj)
+		}
+	}
+}
+
+func TestSQLSearch(t *testing.T) {
+	type Product struct {
+		ID      int64
+		Name    string `crud:"searchable"`
+		Code    string `crud:"searchable"`
+		Price   int64
+		Deleted int64 `crud:"softdel"`
+	}
+	h := NewHelper(&Product{}, "", "", nil)
+	want := "SELECT product_id,name,code,price,deleted FROM products WHERE (name ILIKE $1 OR code ILIKE $1) AND deleted = 0 ORDER BY product_id ASC LIMIT 5"
+	got := h.GetQuerySearch(5)
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	if got := getLikeEscaped(`50%_a\b`); got != `50\%\_a\\b` {
+		t.Fatalf("getLikeEscaped returned invalid string: %s", got)
+	}
+
+	type Invalid struct {
+		ID    int64
+		Price int64 `crud:"searchable"`
+	}
+	h = NewHelper(&Invalid{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "searchable" {
+		t.Fatalf("NewHelper failed to return error for searchable int64 field")
+	}
+}
+
+func TestSQLIndexes(t *testing.T) {
+	type Person struct {
+		_         struct{} `crud:"index:LastName,FirstName"`
+		ID        int64
+		FirstName string
+		LastName  string
+		Email     string `crud:"index"`
+	}
+	h := NewHelper(&Person{}, "", "", nil)
+	want := []string{
+		"CREATE TABLE persons (person_id SERIAL PRIMARY KEY,first_name VARCHAR(255) DEFAULT '',last_name VARCHAR(255) DEFAULT '',email VARCHAR(255) DEFAULT '')",
+		"CREATE INDEX IF NOT EXISTS persons_email_idx ON persons (email)",
+		"CREATE INDEX IF NOT EXISTS persons_last_name_first_name_idx ON persons (last_name,first_name)",
+	}
+	got := h.GetQueriesCreateTableWithOptions(DDLOptions{})
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = h.GetQueriesCreateIndexesConcurrently()
+	if len(got) != 2 || got[0] != "CREATE INDEX CONCURRENTLY IF NOT EXISTS persons_email_idx ON persons (email)" {
+		t.Fatalf("Invalid concurrent index queries: %v", got)
+	}
+
+	type VeryLongNameOfInventoryItem struct {
+		_                 struct{} `crud:"index:WarehouseLocation,ShelfNumberCode"`
+		_                 struct{} `crud:"index:WarehouseLocation,ShelfNumberCodes"`
+		ID                int64
+		WarehouseLocation string
+		ShelfNumberCode   string
+		ShelfNumberCodes  string
+	}
+	names := NewHelper(&VeryLongNameOfInventoryItem{}, "", "", nil).getIndexNames()
+	if len(names) != 2 || len(names[0]) != 63 || len(names[1]) != 63 || names[0] == names[1] || !strings.HasSuffix(names[0], "_idx") {
+		t.Fatalf("Invalid names of indexes with long names: %v", names)
+	}
+
+	type Invalid struct {
+		_    struct{} `crud:"index:Name,Missing"`
+		ID   int64
+		Name string
+	}
+	h = NewHelper(&Invalid{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "index" {
+		t.Fatalf("NewHelper failed to return error for index of field that does not exist")
+	}
+}
+
+func TestSQLIDSequence(t *testing.T) {
+	type Invoice struct {
+		ID     int64 `crud:"seq:invoice_no idprefix:INV- idpad:6"`
+		Amount int64
+	}
+	h := NewHelper(&Invoice{}, "gen64_", "", nil)
+	want := []string{
+		"CREATE SEQUENCE IF NOT EXISTS gen64_invoice_no_seq",
+		"CREATE TABLE gen64_invoices (invoice_id BIGINT DEFAULT nextval('gen64_invoice_no_seq') PRIMARY KEY,amount BIGINT DEFAULT 0)",
+		`GRANT SELECT,INSERT ON gen64_invoices TO "app"`,
+		`GRANT USAGE ON SEQUENCE gen64_invoice_no_seq TO "app"`,
+	}
+	got := h.GetQueriesCreateTableWithOptions(DDLOptions{Grants: []Grant{{Role: "app", Ops: OpCreate}}})
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	wantReset := "SELECT setval('gen64_invoice_no_seq', COALESCE(MAX(invoice_id), 0) + 1, false) FROM gen64_invoices"
+	if h.GetQueryResetIDSequence() != wantReset {
+		t.Fatalf("Want %v, got %v", wantReset, h.GetQueryResetIDSequence())
+	}
+	if h.GetQueryDropIDSequence() != "DROP SEQUENCE IF EXISTS gen64_invoice_no_seq" {
+		t.Fatalf("Want DROP SEQUENCE IF EXISTS gen64_invoice_no_seq, got %v", h.GetQueryDropIDSequence())
+	}
+	if h.formatID(123) != "INV-000123" || h.formatID(1234567) != "INV-1234567" {
+		t.Fatalf("formatID returned invalid ID: %s", h.formatID(123))
+	}
+	for s, want := range map[string]string{"INV-000123": "123", "INV-123": "123", "INV-12a": "", "inv-000123": "", "123": ""} {
+		got, ok := h.parseFormattedID(s)
+		if (want == "" && ok) || (want != "" && got != want) {
+			t.Fatalf("parseFormattedID(%s) want %v, got %v", s, want, got)
+		}
+	}
+
+	type Invalid struct {
+		ID   int64
+		Name string `crud:"idprefix:N-"`
+	}
+	h = NewHelper(&Invalid{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "idprefix" {
+		t.Fatalf("NewHelper failed to return error for idprefix on field other than ID")
+	}
+	type InvalidPad struct {
+		ID int64 `crud:"idpad:x"`
+	}
+	h = NewHelper(&InvalidPad{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "idpad" {
+		t.Fatalf("NewHelper failed to return error for invalid idpad")
+	}
+}
+
+func TestSQLCountByFieldExcludingID(t *testing.T) {
+	h := NewHelper(&TestStruct{}, "", "", nil)
+	want := "SELECT COUNT(*) FROM test_structs WHERE key = $1 AND test_struct_id <> $2"
+	got := h.GetQueryCountByFieldExcludingID("Key")
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+type testUUID [16]byte
+
+func (u testUUID) Value() (driver.Value, error) {
+	return fmt.Sprintf("%x", u[:]), nil
+}
+
+func (u *testUUID) Scan(src interface{}) error {
+	return nil
+}
+
+func TestValuerFields(t *testing.T) {
+	type Product struct {
+		ID          int64          `json:"product_id"`
+		Token       testUUID       `json:"token"`
+		Description sql.NullString `json:"description" crud:"req"`
+		Weight      sql.NullInt64  `json:"weight"`
+	}
+	h := NewHelper(&Product{}, "", "", nil)
+
+	got := h.GetQueryCreateTable()
+	want := "CREATE TABLE products (product_id SERIAL PRIMARY KEY,token TEXT,description VARCHAR(255),weight BIGINT)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	p := &Product{}
+	if h.validateField(reflect.ValueOf(p).Elem(), "Description", nil, 0) {
+		t.Fatalf("Required field with null value passed validation")
+	}
+	p.Description = sql.NullString{String: "", Valid: true}
+	if !h.validateField(reflect.ValueOf(p).Elem(), "Description", nil, 0) {
+		t.Fatalf("Required field with non-null value failed validation")
+	}
+}
+
+func TestSQLMigrateTableQueries(t *testing.T) {
+	type Product struct {
+		ID       int64
+		Name     string `crud:"was:title"`
+		Price    int64
+		Code     string `crud:"uniq"`
+		Quantity int32
+	}
+	h := NewHelper(&Product{}, "", "", nil)
+
+	got := strings.Join(h.GetQueriesMigrateTable(map[string]string{
+		"product_id": "INTEGER",
+		"title":      "VARCHAR(255)",
+		"price":      "CHARACTER VARYING(255)",
+		"quantity":   "INTEGER",
+		"legacy":     "TEXT",
+	}), ";")
+	want := "ALTER TABLE products RENAME COLUMN title TO name;" +
+		"ALTER TABLE products ALTER COLUMN price DROP DEFAULT, ALTER COLUMN price TYPE BIGINT USING price::BIGINT, ALTER COLUMN price SET DEFAULT 0;" +
+		"ALTER TABLE products ADD COLUMN code VARCHAR(255) DEFAULT '' UNIQUE"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	if normalizeColType("decimal(12, 2)") != "NUMERIC(12,2)" || normalizeColType("timestamptz") != "TIMESTAMP WITH TIME ZONE" {
+		t.Fatalf("normalizeColType failed to normalize types")
+	}
+}
+
+func TestSQLSoftDeleteQueries(t *testing.T) {
+	type Note struct {
+		ID        int64  `json:"note_id"`
+		Text      string `json:"text"`
+		DeletedAt int64  `json:"deleted_at" crud:"softdel"`
+	}
+	h := NewHelper(&Note{}, "", "", nil)
+
+	got := h.GetQuerySelectById()
+	want := "SELECT note_id,text,deleted_at FROM notes WHERE note_id = $1 AND deleted_at = 0"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = h.GetQueryCount(map[string]interface{}{"Text": "a"}, nil)
+	want = "SELECT COUNT(*) FROM notes WHERE text=$1 AND deleted_at = 0"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = h.GetQuerySoftDeleteByIdReturning()
+	want = "UPDATE notes SET deleted_at = $2 WHERE note_id = $1 AND deleted_at = 0 RETURNING note_id,text,deleted_at"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = h.helperWithDeleted.GetQuerySelectById()
+	want = "SELECT note_id,text,deleted_at FROM notes WHERE note_id = $1"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type InvalidNote struct {
+		ID        int64
+		DeletedAt string `crud:"softdel"`
+	}
+	h = NewHelper(&InvalidNote{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "softdel" {
+		t.Fatalf("Helper failed to return error for softdel field of invalid type")
+	}
+}
+
+func TestSQLDTOProjection(t *testing.T) {
+	type Article struct {
+		ID      int64  `json:"article_id"`
+		Title   string `json:"title" crud:"req"`
+		Body    string `json:"body"`
+		Authors string `json:"authors"`
+	}
+	type Article_List struct {
+		ID       int64  `json:"article_id"`
+		Title    string `json:"title"`
+		WordsCnt int    `json:"words_cnt"`
+	}
+	h := NewHelper(&Article{}, "", "", nil)
+	hl := NewStrictHelper(&Article_List{}, "", "Article", h)
+	if hl.Err() != nil {
+		t.Fatalf("Helper returned error for DTO with field that model does not have: %s", hl.Err().Op)
+	}
+
+	got := hl.GetQuerySelect([]string{"Title", "asc"}, 10, 0, nil, nil, nil)
+	want := "SELECT article_id,title FROM articles ORDER BY title ASC,article_id ASC LIMIT 10"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = hl.GetQuerySelectById()
+	want = "SELECT article_id,title FROM articles WHERE article_id = $1"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	if !hl.fieldsRequired["Title"] {
+		t.Fatalf("DTO Helper failed to get tags from model")
+	}
+}
+
+func TestSQLUpdateDeleteWhereQueries(t *testing.T) {
+	type Session struct {
+		ID        int64
+		UserID    int64
+		Status    string
+		ExpiresAt int64 `crud:"expires"`
+	}
+	h := NewHelper(&Session{}, "", "", nil)
+	filters := map[string]interface{}{"UserID": int64(1), "Status": []interface{}{"a", "b"}}
+
+	got := h.GetQueryUpdateWhere([]string{"Status"}, filters)
+	want := "UPDATE sessions SET status=$1 WHERE status IN ($2,$3) AND user_id=$4 AND (expires_at = 0 OR expires_at > $5)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = h.GetQueryDeleteWhere(filters)
+	want = "DELETE FROM sessions WHERE status IN ($1,$2) AND user_id=$3 AND (expires_at = 0 OR expires_at > $4)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	type Note struct {
+		ID        int64
+		Text      string
+		DeletedAt int64 `crud:"softdel"`
+	}
+	h = NewHelper(&Note{}, "", "", nil)
+	want = "UPDATE notes SET deleted_at = $1 WHERE text=$2 AND deleted_at = 0"
+	got = h.GetQuerySoftDeleteWhere(map[string]interface{}{"Text": "a"})
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = h.helperWithDeleted.GetQuerySoftDeleteWhere(map[string]interface{}{"Text": "a"})
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSQLFilterOperators(t *testing.T) {
+	h := NewHelper(&TestStruct{}, "", "", nil)
+	filters := map[string]interface{}{
+		"Age":       []FilterCondition{{Operator: ">", Value: 30}, {Operator: "<=", Value: 40}},
+		"Price":     FilterCondition{Operator: "IN", Value: []interface{}{1, 2}},
+		"FirstName": FilterCondition{Operator: "LIKE", Value: "J%"},
+		"LastName":  "Smith",
+	}
+	got := h.GetQuerySelect(nil, 0, 0, filters, nil, nil)
+	want := "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs WHERE age > $1 AND age <= $2 AND first_name LIKE $3 AND last_name=$4 AND price IN ($5,$6)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	args := h.GetFilterArgs(filters)
+	if !reflect.DeepEqual(args, []interface{}{30, 40, "J%", "Smith", 1, 2}) {
+		t.Fatalf("GetFilterArgs returned invalid args: %v", args)
+	}
+
+	got = h.GetQuerySelect(nil, 0, 0, map[string]interface{}{"Age": FilterCondition{Operator: "= 1 OR 1 =", Value: 30}}, nil, nil)
+	want = "SELECT test_struct_id,test_struct_flags,primary_email,email_secondary,first_name,last_name,age,price,post_code,post_code2,password,created_by_user_id,key FROM test_structs WHERE (age=$1 AND FALSE)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	c := NewController(nil, "")
+	for _, f := range []map[string]interface{}{
+		{"Age": FilterCondition{Operator: "~", Value: 30}},
+		{"Age": FilterCondition{Operator: "LIKE", Value: 30}},
+		{"Age": FilterCondition{Operator: "IN", Value: 30}},
+		{"Age": FilterCondition{Operator: ">", Value: "30"}},
+		{"Age": 150},
+	} {
+		b, _, _ := c.Validate(&TestStruct{}, f)
+		if b {
+			t.Fatalf("Validate failed to return error for invalid filter %v", f)
+		}
+	}
+	b, _, _ := c.Validate(&TestStruct{}, map[string]interface{}{"Age": FilterCondition{Operator: "<", Value: 150}})
+	if !b {
+		t.Fatalf("Validate returned error for bound of range that is not valid value of field")
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func TestSQLGoldenQueries(t *testing.T) {
+	err := CheckGoldenQueries(NewHelper(&TestStruct{}, "", "", nil), "testdata/test_structs.postgres.sql", *updateGolden)
+	if err != nil {
+		t.Fatalf("CheckGoldenQueries failed: %s", err.Error())
+	}
+
+	type Note struct {
+		ID   int64
+		Text string
+	}
+	path := t.TempDir() + "/notes.postgres.sql"
+	h := NewHelper(&Note{}, "", "", nil)
+	if CheckGoldenQueries(h, path, false) == nil {
+		t.Fatalf("CheckGoldenQueries failed to return error when golden file does not exist")
+	}
+	if CheckGoldenQueries(h, path, true) != nil || CheckGoldenQueries(h, path, false) != nil {
+		t.Fatalf("CheckGoldenQueries failed to write golden file")
+	}
+	type Note2 struct {
+		ID   int64
+		Text int64
+	}
+	err = CheckGoldenQueries(NewHelper(&Note2{}, "", "Note", nil), path, false)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("CheckGoldenQueries failed to return error with line that differs: %v", err)
+	}
+}
+
+func TestSQLForeignKeys(t *testing.T) {
+	type Book struct {
+		ID         int64
+		AuthorID   int64         `crud:"fk:Author ondelete:cascade"`
+		EditorID   sql.NullInt64 `crud:"fk:Editor ondelete:setnull"`
+		CategoryID int64         `crud:"fk:Category"`
+	}
+	h := NewHelper(&Book{}, "app_", "", nil)
+	got := h.GetQueryCreateTable()
+	want := "CREATE TABLE app_books (book_id SERIAL PRIMARY KEY,author_id BIGINT DEFAULT 0 REFERENCES app_authors(author_id) ON DELETE CASCADE,editor_id BIGINT REFERENCES app_editors(editor_id) ON DELETE SET NULL,category_id BIGINT DEFAULT 0 REFERENCES app_categories(category_id))"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = h.GetQueryCountReferenced("AuthorID")
+	want = "SELECT COUNT(*) FROM app_authors WHERE author_id = $1"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = strings.Join(h.GetQueriesMigrateTable(map[string]string{"book_id": "INTEGER", "author_id": "BIGINT"}), ";")
+	want = "ALTER TABLE app_books ADD COLUMN editor_id BIGINT REFERENCES app_editors(editor_id) ON DELETE SET NULL;ALTER TABLE app_books ADD COLUMN category_id BIGINT DEFAULT 0 REFERENCES app_categories(category_id)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	// Table and ID column are taken from Helper of the linked model
+	type Writer struct {
+		_  struct{} `crud:"table:people"`
+		ID int64    `crud:"col:person_no"`
+	}
+	type Post struct {
+		_        struct{}      `crud:"table:blog_posts"`
+		ID       int64         `crud:"col:post_no"`
+		WriterID int64         `crud:"fk:Writer"`
+		ParentID sql.NullInt64 `crud:"fk:Post"`
+	}
+	c := NewController(nil, "app_")
+	c.getHelper(&Writer{})
+	hp, _ := c.getHelper(&Post{})
+	got = hp.GetQueryCreateTable()
+	want = "CREATE TABLE blog_posts (post_no SERIAL PRIMARY KEY,writer_id BIGINT DEFAULT 0 REFERENCES people(person_no),parent_id BIGINT REFERENCES blog_posts(post_no))"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	for _, tc := range []struct {
+		obj interface{}
+		tag string
+	}{
+		{&struct {
+			AuthorID string `crud:"fk:Author"`
+		}{}, "fk"},
+		{&struct {
+			AuthorID int64 `crud:"ondelete:cascade"`
+		}{}, "ondelete"},
+		{&struct {
+			AuthorID int64 `crud:"fk:Author ondelete:setnull"`
+		}{}, "ondelete"},
+		{&struct {
+			AuthorID int64 `crud:"fk:Author ondelete:drop"`
+		}{}, "ondelete"},
+	} {
+		h = NewHelper(tc.obj, "", "Book", nil)
+		if h.Err() == nil || h.Err().Tag != tc.tag {
+			t.Fatalf("Helper failed to return %s error for %v", tc.tag, tc.obj)
+		}
+	}
+}
+
+func TestTimeFields(t *testing.T) {
+	type Report struct {
+		ID          int64     `json:"report_id"`
+		PublishedAt time.Time `json:"published_at" crud:"req"`
+	}
+	h := NewHelper(&Report{}, "", "", nil)
+
+	got := h.GetQueryCreateTable()
+	want := "CREATE TABLE reports (report_id SERIAL PRIMARY KEY,published_at TIMESTAMP WITH TIME ZONE DEFAULT '0001-01-01 00:00:00+00' NOT NULL)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	r := &Report{}
+	if h.validateField(reflect.ValueOf(r).Elem(), "PublishedAt", nil, 0) {
+		t.Fatalf("Required field with zero time passed validation")
+	}
+	err := json.Unmarshal([]byte(`{"published_at":"2021-03-04T05:06:07+02:00"}`), r)
+	if err != nil || r.PublishedAt.Unix() != 1614827167 {
+		t.Fatalf("Field failed to get RFC3339 value from JSON: %v", r.PublishedAt)
+	}
+	if !h.validateField(reflect.ValueOf(r).Elem(), "PublishedAt", nil, 0) {
+		t.Fatalf("Required field with time failed validation")
+	}
+
+	c := NewController(nil, "")
+	col, v, errC := c.uriFilterToFilter(&Report{}, "published_at", "2021-03-04T05:06:07Z")
+	if errC != nil || col != "PublishedAt" || v.(time.Time).Unix() != 1614834367 {
+		t.Fatalf("uriFilterToFilter returned invalid time filter %s %v", col, v)
+	}
+	_, _, errC = c.uriFilterToFilter(&Report{}, "published_at", "yesterday")
+	if errC == nil || errC.Op != "InvalidValue" {
+		t.Fatalf("uriFilterToFilter accepted invalid time")
+	}
+
+	type Post struct {
+		ID        int64     `json:"post_id"`
+		CreatedAt time.Time `json:"created_at" crud:"createdat"`
+		UpdatedAt int64     `json:"updated_at" crud:"updatedat"`
+	}
+	h = NewHelper(&Post{}, "", "", nil)
+	if h.Err() != nil {
+		t.Fatalf("NewHelper returned error for createdat of time.Time: %s", h.Err().Err)
+	}
+	p := &Post{}
+	c.setTimestampFields(h, p, OpCreate)
+	if p.CreatedAt.IsZero() || p.UpdatedAt != p.CreatedAt.Unix() {
+		t.Fatalf("setTimestampFields failed to set time fields: %v", p)
+	}
+}
+
+type testDecimal struct {
+	units int64
+}
+
+func TestTypeConverters(t *testing.T) {
+	type Invoice struct {
+		ID     int64       `json:"invoice_id"`
+		Amount testDecimal `json:"amount" crud:"req"`
+	}
+	conv := &TypeConverter{
+		DBType: "NUMERIC(12,2)",
+		ToDB: func(v interface{}) (driver.Value, error) {
+			d := v.(testDecimal)
+			return fmt.Sprintf("%d.%02d", d.units/100, d.units%100), nil
+		},
+		FromDB: func(v interface{}) (interface{}, error) {
+			return testDecimal{}, nil
+		},
+	}
+	h := newHelperWithOptions(&Invoice{}, "", "", nil, helperOptions{
+		typeConverters: map[reflect.Type]*TypeConverter{reflect.TypeOf(testDecimal{}): conv},
+	})
+
+	got := h.GetQueryCreateTable()
+	want := "CREATE TABLE invoices (invoice_id SERIAL PRIMARY KEY,amount NUMERIC(12,2))"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+
+	inv := &Invoice{Amount: testDecimal{units: 1234}}
+	v, err := h.getFieldInterface(reflect.ValueOf(inv).Elem().FieldByName("Amount"), "Amount").(driver.Valuer).Value()
+	if err != nil || v != "12.34" {
+		t.Fatalf("Want 12.34, got %v", v)
+	}
+
+	if h.validateField(reflect.ValueOf(&Invoice{}).Elem(), "Amount", nil, 0) {
+		t.Fatalf("Required field with zero value passed validation")
+	}
+}
+
+func TestSQLInsertWithIDQuery(t *testing.T) {
+	type Session struct {
+		Token string
+		ID    int64
+		Name  string
+	}
+	h := NewHelper(&Session{}, "", "", nil)
+
+	got := h.GetQueryInsertWithID()
+	want := "INSERT INTO sessions(session_id,token,name) VALUES ($1,$2,$3)"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = h.GetQueryResetIDSequence()
+	want = "SELECT setval(pg_get_serial_sequence('sessions', 'session_id'), COALESCE(MAX(session_id), 0) + 1, false) FROM sessions"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
+
+func TestSensitiveFields(t *testing.T) {
+	type Customer struct {
+		ID       int64
+		Name     string `crud:"sensitive:name"`
+		Email    string `crud:"sensitive"`
+		Phone    string `crud:"sensitive:phone lenmax:8"`
+		Password string `crud:"sensitive:password"`
+		Notes    string `crud:"sensitive"`
+		Country  string
+	}
+	h := NewHelper(&Customer{}, "", "", nil)
+	if h.Err() != nil {
+		t.Fatalf("NewHelper failed to parse sensitive tags")
+	}
+	if h.fieldsSensitive["Email"] != "email" || h.fieldsSensitive["Notes"] != "text" || h.fieldsSensitive["Country"] != "" {
+		t.Fatalf("NewHelper failed to set kinds of sensitive fields")
+	}
+
+	o := &Customer{ID: 7, Name: "Alice Doe", Email: "alice@doe.com", Phone: "+48123", Password: "secret", Country: "PL"}
+	h.anonymize(o)
+	first := strings.Split(o.Name, " ")[0]
+	if o.Name == "Alice Doe" || !strings.HasPrefix(o.Email, strings.ToLower(first)+".") || !strings.HasSuffix(o.Email, "7@example.com") {
+		t.Fatalf("anonymize failed to set fake name and email: %s, %s", o.Name, o.Email)
+	}
+	if len(o.Phone) != 8 || len(o.Password) != 64 || o.Notes != "" || o.Country != "PL" {
+		t.Fatalf("anonymize failed to set other fields: %+v", o)
+	}
+	o2 := &Customer{ID: 7, Name: "Bob", Email: "bob@doe.com"}
+	h.anonymize(o2)
+	if o2.Name != o.Name || o2.Email != o.Email {
+		t.Fatalf("anonymize failed to set the same values for the same ID")
+	}
+
+	payload, err := h.getEventPayload(&Customer{ID: 7, Name: "Alice Doe", Email: "alice@doe.com", Country: "PL"})
+	if err != nil || string(payload) != `{"Country":"PL","ID":7}` {
+		t.Fatalf("getEventPayload failed to leave out sensitive fields: %s", string(payload))
+	}
+
+	type ShortCustomer struct {
+		ID    int64
+		Name  string `crud:"sensitive:name lenmax:7"`
+		Email string `crud:"sensitive email lenmax:16"`
+	}
+	hs := NewHelper(&ShortCustomer{}, "", "", nil)
+	emails := map[string]bool{}
+	for _, id := range []int64{7, 123456, 1234567} {
+		so := &ShortCustomer{ID: id, Name: "Alice Doe", Email: "alice@doe.com"}
+		hs.anonymize(so)
+		if len(so.Name) > 7 || len(so.Email) > 16 || !hs.validateValue("Email", reflect.ValueOf(so.Email), false, 0) || emails[so.Email] {
+			t.Fatalf("anonymize failed to set fakes that fit the fields: %s, %s", so.Name, so.Email)
+		}
+		emails[so.Email] = true
+	}
+
+	type Invalid struct {
+		ID  int64
+		Age int `crud:"sensitive"`
+	}
+	h = NewHelper(&Invalid{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "sensitive" {
+		t.Fatalf("NewHelper failed to reject sensitive int field")
+	}
+	type InvalidKind struct {
+		ID   int64
+		Name string `crud:"sensitive:address"`
+	}
+	h = NewHelper(&InvalidKind{}, "", "", nil)
+	if h.Err() == nil || h.Err().Tag != "sensitive" {
+		t.Fatalf("NewHelper failed to reject invalid kind")
+	}
+}
+
+func TestSQLSubjectQueries(t *testing.T) {
+	type Order struct {
+		ID        int64
+		Total     int
+		CreatedBy int64 `crud:"createdby"`
+	}
+	h := NewHelper(&Order{}, "", "", nil)
+
+	got := h.GetQueryDeleteByField("CreatedBy")
+	want := "DELETE FROM orders WHERE created_by = $1"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+	got = h.GetQuerySelectAllByField("CreatedBy")
+	want = "SELECT order_id,total,created_by FROM orders WHERE created_by = $1 ORDER BY order_id ASC"
+	if got != want {
+		t.Fatalf("Want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,19 @@
+package crud
+
+import (
+	"context"
+)
+
+// HookFunc is called for every model before or after an operation (OpCreate,
+// OpRead etc.) on an object. When a hook that is run before the operation
+// returns an error, the operation is aborted
+type HookFunc func(op int, obj interface{}) error
+
+// ContextHookFunc is HookFunc that gets context of the operation, eg. of the
+// HTTP request, and OperationInfo, so that it can be tied to tracing or stop
+// when the context is cancelled
+type ContextHookFunc func(ctx context.Context, info OperationInfo, obj interface{}) error
+
+// Values for when hooks are run
+const HookBefore = 1
+const HookAfter = 2
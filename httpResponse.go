@@ -15,3 +15,70 @@ func NewHTTPResponse(ok int8, errText string) HTTPResponse {
 		ErrText: errText,
 	}
 }
+
+// ItemResponse is HTTP response with a single object, eg. to read request
+type ItemResponse struct {
+	OK      int8             `json:"ok"`
+	ErrText string           `json:"err_text"`
+	Data    ItemResponseData `json:"data"`
+}
+
+// ItemResponseData is data of ItemResponse
+type ItemResponseData struct {
+	Item interface{} `json:"item"`
+}
+
+// NewItemResponse returns new successful ItemResponse
+func NewItemResponse(item interface{}) ItemResponse {
+	return ItemResponse{
+		OK:   1,
+		Data: ItemResponseData{Item: item},
+	}
+}
+
+// ListResponse is HTTP response with list of objects
+type ListResponse struct {
+	OK      int8             `json:"ok"`
+	ErrText string           `json:"err_text"`
+	Data    ListResponseData `json:"data"`
+}
+
+// ListResponseData is data of ListResponse
+type ListResponseData struct {
+	Items []interface{} `json:"items"`
+	// TotalItems is number of all objects matching filters. It is set only
+	// when it is requested with "count" query parameter
+	TotalItems *int64 `json:"total_items,omitempty"`
+}
+
+// NewListResponse returns new successful ListResponse. totalItems can be nil
+func NewListResponse(items []interface{}, totalItems *int64) ListResponse {
+	return ListResponse{
+		OK: 1,
+		Data: ListResponseData{
+			Items:      items,
+			TotalItems: totalItems,
+		},
+	}
+}
+
+// IDResponse is HTTP response with ID of object that was created, updated or
+// deleted
+type IDResponse struct {
+	OK      int8           `json:"ok"`
+	ErrText string         `json:"err_text"`
+	Data    IDResponseData `json:"data"`
+}
+
+// IDResponseData is data of IDResponse
+type IDResponseData struct {
+	ID int64 `json:"id"`
+}
+
+// NewIDResponse returns new successful IDResponse
+func NewIDResponse(id int64) IDResponse {
+	return IDResponse{
+		OK:   1,
+		Data: IDResponseData{ID: id},
+	}
+}
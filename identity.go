@@ -0,0 +1,28 @@
+package crud
+
+import (
+	"context"
+	"net/http"
+)
+
+type identityCtxKey struct{}
+
+// WithIdentity returns shallow copy of the request with ID of the
+// authenticated user (or other actor) attached to its context. HTTP handler
+// sets fields with "createdby" and "updatedby" tags to it
+func WithIdentity(r *http.Request, id int64) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityCtxKey{}, id))
+}
+
+// GetIdentity returns ID attached to the request with WithIdentity or 0 when
+// there is none
+func GetIdentity(r *http.Request) int64 {
+	return getContextIdentity(r.Context())
+}
+
+// getContextIdentity returns ID attached to the context with WithIdentity or
+// WithActor, or 0 when there is none
+func getContextIdentity(ctx context.Context) int64 {
+	id, _ := ctx.Value(identityCtxKey{}).(int64)
+	return id
+}
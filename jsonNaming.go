@@ -0,0 +1,160 @@
+package crud
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Naming of object keys in HTTP requests and responses
+const JSONNamingTags = 0
+const JSONNamingCamelCase = 1
+
+// getCamelCaseName returns JSON name in camelCase, eg. "firstName" for
+// "first_name" or "FirstName", and "id" for "ID"
+func getCamelCaseName(s string) string {
+	if strings.Contains(s, "_") {
+		o := ""
+		for _, p := range strings.Split(s, "_") {
+			if p == "" {
+				continue
+			}
+			if o == "" {
+				o = strings.ToLower(p)
+				continue
+			}
+			o += strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		}
+		return o
+	}
+
+	r := []rune(s)
+	for i := 0; i < len(r) && unicode.IsUpper(r[i]); i++ {
+		// In a run of capitals, the last one starts the next word, eg. "URLPath"
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+// getStructJSONFields returns types of fields of struct, including promoted
+// ones, by their names in JSON
+func getStructJSONFields(t reflect.Type) map[string]reflect.Type {
+	o := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for k, v := range getStructJSONFields(ft) {
+				if _, ok := o[k]; !ok {
+					o[k] = v
+				}
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		o[name] = f.Type
+	}
+	return o
+}
+
+// renameJSONKeys returns value of type t decoded from JSON with keys of
+// objects that are struct fields renamed to camelCase when toCamelCase is
+// true, and from camelCase back to JSON names of the fields otherwise. Values
+// of fields are renamed the same way, so that nested structs, eg. in JSONB
+// fields, are named like the object. Other keys, eg. of maps, are kept
+func renameJSONKeys(t reflect.Type, v interface{}, toCamelCase bool) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		xv, ok := v.([]interface{})
+		if !ok {
+			return v
+		}
+		o := make([]interface{}, len(xv))
+		for i := range xv {
+			o[i] = renameNestedJSONKeys(t.Elem(), xv[i], toCamelCase)
+		}
+		return o
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		o := make(map[string]interface{}, len(m))
+		for k := range m {
+			o[k] = renameNestedJSONKeys(t.Elem(), m[k], toCamelCase)
+		}
+		return o
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		fields := getStructJSONFields(t)
+		o := make(map[string]interface{}, len(m))
+		for k := range m {
+			ft, ok := fields[k]
+			if !ok {
+				continue
+			}
+			name := k
+			if toCamelCase {
+				name = getCamelCaseName(k)
+			}
+			o[name] = renameNestedJSONKeys(ft, m[k], toCamelCase)
+		}
+		// Keys that are not JSON names of fields are renamed when decoding,
+		// unless the field is already set under its JSON name
+		names := map[string]string{}
+		if !toCamelCase {
+			for name := range fields {
+				names[getCamelCaseName(name)] = name
+			}
+		}
+		for k := range m {
+			if _, ok := fields[k]; ok {
+				continue
+			}
+			name, ok := names[k]
+			if !ok {
+				if _, ok := o[k]; !ok {
+					o[k] = m[k]
+				}
+				continue
+			}
+			if _, ok := o[name]; !ok {
+				o[name] = renameNestedJSONKeys(fields[name], m[k], toCamelCase)
+			}
+		}
+		return o
+	}
+	return v
+}
+
+// renameNestedJSONKeys calls renameJSONKeys for values of types that do not
+// implement their own JSON encoding, eg. time.Time
+func renameNestedJSONKeys(t reflect.Type, v interface{}, toCamelCase bool) interface{} {
+	jsonMarshalerType := reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return v
+	}
+	return renameJSONKeys(t, v, toCamelCase)
+}
@@ -0,0 +1,36 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonbValue wraps pointer to a struct field that is stored in a JSONB column,
+// so that it can be passed to the database driver as a query argument or as
+// a scan destination
+type jsonbValue struct {
+	ptr interface{}
+}
+
+// Value marshals the field to JSON
+func (j *jsonbValue) Value() (driver.Value, error) {
+	b, err := json.Marshal(j.ptr)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan unmarshals JSON from the database into the field
+func (j *jsonbValue) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, j.ptr)
+	case string:
+		return json.Unmarshal([]byte(v), j.ptr)
+	}
+	return fmt.Errorf("cannot scan %T into JSONB field", src)
+}
@@ -0,0 +1,26 @@
+package crud
+
+// ListParams contains parameters of HTTP list request parsed out from its
+// query string
+type ListParams struct {
+	Limit  int
+	Offset int
+	// Order contains pairs of field (or column) name and direction, just like
+	// order argument of GetFromDB
+	Order []string
+	// Filters contains values of fields to filter by. When query parameter is
+	// repeated, eg. "filter_age=30&filter_age=40", value is []interface{} and
+	// objects matching any of the values are returned. Filters with operator
+	// suffixes, eg. "filter_price_gt=100", have []FilterCondition values
+	Filters map[string]interface{}
+	// Include contains names of relations to embed in the objects (see
+	// AddRelation)
+	Include []string
+	// Join contains JSON names of fields with "rel" tag to set with related
+	// objects (see LoadRelations)
+	Join []string
+	// Count is true when "count" query parameter is set to "1" or "true" and
+	// response should contain number of all objects matching filters in
+	// "total_items"
+	Count bool
+}
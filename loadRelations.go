@@ -0,0 +1,169 @@
+package crud
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// LoadRelations sets fields of objects with "rel" tag, which are pointers to
+// related structs, eg. User field with `crud:"rel:UserID"`, to objects with
+// IDs from fields named in the tags. Related objects are got with a single
+// query for each field. Fields are set to nil when ID is 0 or there is no
+// object with it. fieldNames are names of fields to set, and all of them are
+// set when it is empty. Objects must be of the same struct
+func (c Controller) LoadRelations(xobj []interface{}, fieldNames []string) *ErrController {
+	if len(xobj) == 0 {
+		return nil
+	}
+	h, err := c.getHelper(xobj[0])
+	if err != nil {
+		return err
+	}
+	if len(fieldNames) == 0 {
+		for k := range h.fieldsRel {
+			fieldNames = append(fieldNames, k)
+		}
+		sort.Strings(fieldNames)
+	}
+
+	for _, k := range fieldNames {
+		relField, ok := h.fieldsRel[k]
+		if !ok {
+			return &ErrController{
+				Op:  "InvalidField",
+				Err: fmt.Errorf("Field %s does not have rel tag", k),
+			}
+		}
+		ids := []interface{}{}
+		for _, obj := range xobj {
+			if id := getRelationID(obj, relField); id > 0 {
+				ids = append(ids, id)
+			}
+		}
+		related := map[int64]reflect.Value{}
+		if len(ids) > 0 {
+			relType := reflect.ValueOf(xobj[0]).Elem().FieldByName(k).Type().Elem()
+			xrel, err := c.GetFromDB(func() interface{} {
+				return reflect.New(relType).Interface()
+			}, nil, 0, 0, map[string]interface{}{"ID": ids})
+			if err != nil {
+				return err
+			}
+			for _, relObj := range xrel {
+				related[c.GetModelIDValue(relObj)] = reflect.ValueOf(relObj)
+			}
+		}
+		for _, obj := range xobj {
+			f := reflect.ValueOf(obj).Elem().FieldByName(k)
+			if relObj, ok := related[getRelationID(obj, relField)]; ok {
+				f.Set(relObj)
+			} else {
+				f.Set(reflect.Zero(f.Type()))
+			}
+		}
+	}
+	return nil
+}
+
+// SetFromDBWithRelations works like SetFromDB and then sets fields with "rel"
+// tag with LoadRelations, when object exists
+func (c Controller) SetFromDBWithRelations(obj interface{}, id string) *ErrController {
+	err := c.SetFromDB(obj, id)
+	if err != nil || c.GetModelIDValue(obj) == 0 {
+		return err
+	}
+	return c.LoadRelations([]interface{}{obj}, nil)
+}
+
+// GetFromDBWithRelations works like GetFromDB and then sets fields with "rel"
+// tag of objects with LoadRelations
+func (c Controller) GetFromDBWithRelations(newObjFunc func() interface{}, order []string, limit int, offset int, filters map[string]interface{}) ([]interface{}, *ErrController) {
+	xobj, err := c.GetFromDB(newObjFunc, order, limit, offset, filters)
+	if err != nil {
+		return nil, err
+	}
+	err = c.LoadRelations(xobj, nil)
+	if err != nil {
+		return nil, err
+	}
+	return xobj, nil
+}
+
+// getRelationID returns ID of related object from int64 or sql.NullInt64
+// field, which is 0 for NULL
+func getRelationID(obj interface{}, fieldName string) int64 {
+	f := reflect.ValueOf(obj).Elem().FieldByName(fieldName)
+	if n, ok := f.Interface().(sql.NullInt64); ok {
+		if !n.Valid {
+			return 0
+		}
+		return n.Int64
+	}
+	return f.Int()
+}
+
+// getJoinFields returns names of fields with "rel" tag from JSON names in
+// "join" query parameter, and the first name that is not such field
+func (c Controller) getJoinFields(h *Helper, join []string) ([]string, string) {
+	fieldNames := []string{}
+JOIN:
+	for _, name := range join {
+		for k, jsonName := range h.fieldsRelJSONName {
+			if jsonName == name || (c.jsonNaming == JSONNamingCamelCase && getCamelCaseName(jsonName) == name) {
+				fieldNames = append(fieldNames, k)
+				continue JOIN
+			}
+		}
+		return nil, name
+	}
+	return fieldNames, ""
+}
+
+// checkJoinParam returns names of fields with "rel" tag from "join" query
+// parameter, eg. "?join=user". It writes "400 Bad Request" response and
+// returns false when any of the names is not a JSON name of such field
+func (c Controller) checkJoinParam(w http.ResponseWriter, obj interface{}, join []string) ([]string, bool) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "get_helper")
+		return nil, false
+	}
+	fieldNames, invalid := c.getJoinFields(h, join)
+	if invalid != "" {
+		c.writeErrTextWithData(w, http.StatusBadRequest, "invalid_join", map[string]interface{}{
+			"join": invalid,
+		})
+		return nil, false
+	}
+	return fieldNames, true
+}
+
+// loadJoinFields sets fields from checkJoinParam of objects. It writes
+// "500 Internal Server Error" response and returns false when it fails
+func (c Controller) loadJoinFields(w http.ResponseWriter, xobj []interface{}, fieldNames []string) bool {
+	if len(fieldNames) == 0 {
+		return true
+	}
+	err := c.LoadRelations(xobj, fieldNames)
+	if err != nil {
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+		return false
+	}
+	return true
+}
+
+// getQueryParamList returns values from comma separated query parameter
+func getQueryParamList(r *http.Request, name string) []string {
+	l := []string{}
+	for _, v := range strings.Split(r.URL.Query().Get(name), ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
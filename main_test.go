@@ -64,7 +64,7 @@ type TestStruct struct {
 
 	// Test HTTP endpoint tags
 	Password        string `json:"password"`
-	CreatedByUserID int64  `json:"created_by_user_id" crud_val:55`
+	CreatedByUserID int64  `json:"created_by_user_id" crud_val:"55"`
 
 	// Test unique tag
 	Key string `json:"key" crud:"req uniq lenmin:30 lenmax:255"`
@@ -0,0 +1,123 @@
+package crud
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MaintenanceTask is a job that MaintenanceRunner runs periodically, eg. to
+// remove expired sessions
+type MaintenanceTask struct {
+	Name     string
+	Interval time.Duration
+	Run      func(c *Controller) error
+}
+
+// NewPurgeTask returns MaintenanceTask that deletes objects with int64 field
+// containing Unix timestamp (eg. ExpiresAt) that is set and older than age.
+// Use 0 age to delete objects as soon as the timestamp passes
+func NewPurgeTask(name string, obj interface{}, fieldName string, age time.Duration, interval time.Duration) *MaintenanceTask {
+	return &MaintenanceTask{
+		Name:     name,
+		Interval: interval,
+		Run: func(c *Controller) error {
+			_, err := c.PurgeFromDB(obj, fieldName, c.clock.Now().Add(-age).Unix())
+			if err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// NewPurgeExpiredTask returns MaintenanceTask that deletes expired objects,
+// based on the field with "expires" tag
+func NewPurgeExpiredTask(name string, obj interface{}, interval time.Duration) *MaintenanceTask {
+	return &MaintenanceTask{
+		Name:     name,
+		Interval: interval,
+		Run: func(c *Controller) error {
+			_, err := c.PurgeExpiredFromDB(obj)
+			if err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// NewRefreshSummaryTask returns MaintenanceTask that refreshes objects of
+// summary model registered with AddSummary
+func NewRefreshSummaryTask(name string, obj interface{}, interval time.Duration) *MaintenanceTask {
+	return &MaintenanceTask{
+		Name:     name,
+		Interval: interval,
+		Run: func(c *Controller) error {
+			_, err := c.RefreshSummary(obj)
+			if err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// MaintenanceRunner runs registered maintenance tasks at their intervals
+type MaintenanceRunner struct {
+	c     *Controller
+	tasks []*MaintenanceTask
+}
+
+// NewMaintenanceRunner returns new MaintenanceRunner for Controller
+func NewMaintenanceRunner(c *Controller) *MaintenanceRunner {
+	return &MaintenanceRunner{
+		c: c,
+	}
+}
+
+// AddTask registers a task. Tasks must be added before Run is called
+func (r *MaintenanceRunner) AddTask(t *MaintenanceTask) {
+	r.tasks = append(r.tasks, t)
+}
+
+// RunOnce runs all the tasks one after another and returns the first error
+func (r *MaintenanceRunner) RunOnce() error {
+	for _, t := range r.tasks {
+		err := t.Run(r.c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run runs every task at its interval, each in its own goroutine, until ctx is
+// done, and waits for the tasks to finish. Errors are passed to onErr with
+// name of the task, and onErr can be nil
+func (r *MaintenanceRunner) Run(ctx context.Context, onErr func(name string, err error)) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, t := range r.tasks {
+		wg.Add(1)
+		go func(t *MaintenanceTask) {
+			defer wg.Done()
+			ticker := time.NewTicker(t.Interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				err := t.Run(r.c)
+				if err != nil && onErr != nil {
+					mu.Lock()
+					onErr(t.Name, err)
+					mu.Unlock()
+				}
+			}
+		}(t)
+	}
+	wg.Wait()
+}
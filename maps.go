@@ -0,0 +1,68 @@
+package crud
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// GetMapsFromDB works like GetFromDB but returns objects as maps keyed by JSON
+// names of fields, eg. for ad-hoc reporting endpoints. Rows are scanned into
+// a single object, so no struct is created per row. Fields hidden in JSON are
+// omitted. Limit, Offset, Order and Filters of opts are used just like
+// arguments of GetFromDB. Hooks are not run
+func (c Controller) GetMapsFromDB(newObjFunc func() interface{}, opts ListParams) ([]map[string]interface{}, *ErrController) {
+	obj := newObjFunc()
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	filters, dbFilters, err1 := c.prepareFilters(h, obj, opts.Filters)
+	if err1 != nil {
+		return nil, err1
+	}
+	query, args, errI := c.interceptQuery(h, OpList, h.GetQuerySelectWithHints(c.getOrder(h, opts.Order), opts.Limit, opts.Offset, filters, nil, nil, c.getQueryHints(h, OpList)), append(h.GetFilterArgs(dbFilters), c.getExpiresArgs(h)...))
+	if errI != nil {
+		return nil, errI
+	}
+
+	val := reflect.ValueOf(obj).Elem()
+	dest := append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)
+	v := []map[string]interface{}{}
+	var errScan error
+	err2 := c.runWithHints(h, OpList, func(q dbQuerier) error {
+		rows, err := q.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			c.ResetFields(obj)
+			errScan = rows.Scan(dest...)
+			if errScan != nil {
+				return errScan
+			}
+			m := make(map[string]interface{}, len(h.fields))
+			for _, k := range h.fields {
+				if !h.fieldsJSONHidden[k] {
+					m[h.fieldsJSONName[k]] = val.FieldByName(k).Interface()
+				}
+			}
+			v = append(v, m)
+		}
+		return rows.Err()
+	})
+	if errScan != nil {
+		return nil, &ErrController{
+			Op:  "DBQueryRowsScan",
+			Err: fmt.Errorf("Error scanning DB query row: %w", errScan),
+		}
+	}
+	if err2 != nil {
+		return nil, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,110 @@
+package crud
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// metricsWindow is the number of latest latencies that percentiles are
+// calculated from
+const metricsWindow = 1024
+
+// OpMetrics contains statistics of database queries of a model's operation
+type OpMetrics struct {
+	Count  int64   `json:"count"`
+	Errors int64   `json:"errors"`
+	P50    float64 `json:"p50_ms"`
+	P95    float64 `json:"p95_ms"`
+}
+
+// opLatencies contains counters and latest latencies of an operation
+type opLatencies struct {
+	count     int64
+	errors    int64
+	latencies []time.Duration
+	next      int
+}
+
+// metrics is an in-process registry of statistics of database queries, per
+// model table and operation
+type metrics struct {
+	mu  sync.Mutex
+	ops map[string]map[int]*opLatencies
+}
+
+// newMetrics returns new empty metrics
+func newMetrics() *metrics {
+	return &metrics{
+		ops: make(map[string]map[int]*opLatencies),
+	}
+}
+
+// record adds a query that took d and failed when err is not nil
+func (m *metrics) record(tbl string, op int, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ops[tbl] == nil {
+		m.ops[tbl] = make(map[int]*opLatencies)
+	}
+	l := m.ops[tbl][op]
+	if l == nil {
+		l = &opLatencies{}
+		m.ops[tbl][op] = l
+	}
+	l.count++
+	if err != nil {
+		l.errors++
+	}
+	if len(l.latencies) < metricsWindow {
+		l.latencies = append(l.latencies, d)
+		return
+	}
+	l.latencies[l.next] = d
+	l.next = (l.next + 1) % metricsWindow
+}
+
+// snapshot returns statistics per table and operation name
+func (m *metrics) snapshot() map[string]map[string]*OpMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o := make(map[string]map[string]*OpMetrics)
+	for tbl, ops := range m.ops {
+		o[tbl] = make(map[string]*OpMetrics)
+		for op, l := range ops {
+			sorted := append([]time.Duration{}, l.latencies...)
+			sort.Slice(sorted, func(a, b int) bool {
+				return sorted[a] < sorted[b]
+			})
+			o[tbl][getOpName(op)] = &OpMetrics{
+				Count:  l.count,
+				Errors: l.errors,
+				P50:    getPercentile(sorted, 50),
+				P95:    getPercentile(sorted, 95),
+			}
+		}
+	}
+	return o
+}
+
+// getPercentile returns p-th percentile of sorted latencies in milliseconds
+func getPercentile(sorted []time.Duration, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
+
+// getOpName returns name of operation used in tags, eg. "create"
+func getOpName(op int) string {
+	for name, v := range opNames {
+		if v == op {
+			return name
+		}
+	}
+	return ""
+}
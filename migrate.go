@@ -0,0 +1,220 @@
+package crud
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var colDefaultRegExp = regexp.MustCompile(` DEFAULT ('[^']*'|[^ ]+)`)
+
+// colTypeAliases maps column type names to the ones reported by
+// information_schema, so that types written differently can be compared
+var colTypeAliases = map[string]string{
+	"INT":         "INTEGER",
+	"INT4":        "INTEGER",
+	"SERIAL":      "INTEGER",
+	"INT8":        "BIGINT",
+	"BIGSERIAL":   "BIGINT",
+	"INT2":        "SMALLINT",
+	"BOOL":        "BOOLEAN",
+	"FLOAT8":      "DOUBLE PRECISION",
+	"FLOAT4":      "REAL",
+	"TIMESTAMPTZ": "TIMESTAMP WITH TIME ZONE",
+	"TIMESTAMP":   "TIMESTAMP WITHOUT TIME ZONE",
+	"CHARACTER":   "CHAR",
+}
+
+// MigrateDBTable changes database table of specified type of objects to match
+// the struct, so that models can evolve without dropping the table and losing
+// data. Columns of fields with "was" tag are renamed, columns of new fields
+// are added and types of columns that changed are altered with a cast of
+// existing values. Columns of removed fields are kept, as well as constraints
+// of existing columns. Table is created when it does not exist. Queries are
+// executed in one transaction
+func (c Controller) MigrateDBTable(obj interface{}) *ErrController {
+	qs, err := c.GetMigrationDDL(obj)
+	if err != nil {
+		return err
+	}
+	if len(qs) == 0 {
+		return nil
+	}
+	tx, err2 := c.dbConn.Begin()
+	if err2 != nil {
+		return &ErrController{
+			Op:  "DBTx",
+			Err: fmt.Errorf("Error starting transaction: %w", err2),
+		}
+	}
+	for _, q := range qs {
+		_, err2 = tx.Exec(q)
+		if err2 != nil {
+			tx.Rollback()
+			return c.getDDLError(err2)
+		}
+	}
+	err2 = tx.Commit()
+	if err2 != nil {
+		return &ErrController{
+			Op:  "DBTx",
+			Err: fmt.Errorf("Error committing transaction: %w", err2),
+		}
+	}
+	return nil
+}
+
+// GetMigrationDDL returns queries that MigrateDBTable would execute, eg. to
+// review them or save them in a migration file
+func (c Controller) GetMigrationDDL(obj interface{}) ([]string, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := c.getDBTableColumns(h)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		return c.GetDDL(obj, DDLOptions{})
+	}
+	return h.GetQueriesMigrateTable(existing), nil
+}
+
+// getDBTableColumns returns types of columns of model's table, keyed by
+// column names
+func (c Controller) getDBTableColumns(h *Helper) (map[string]string, *ErrController) {
+	rows, err := c.dbConn.Query("SELECT column_name, data_type, udt_name, character_maximum_length, numeric_precision, numeric_scale FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1", h.dbTbl)
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	defer rows.Close()
+	cols := map[string]string{}
+	for rows.Next() {
+		var col, dataType, udtName string
+		var charLen, precision, scale sql.NullInt64
+		err = rows.Scan(&col, &dataType, &udtName, &charLen, &precision, &scale)
+		if err != nil {
+			return nil, &ErrController{
+				Op:  "DBQueryRowsScan",
+				Err: fmt.Errorf("Error scanning DB query row: %w", err),
+			}
+		}
+		cols[col] = getInfoSchemaColType(dataType, udtName, charLen, precision, scale)
+	}
+	return cols, nil
+}
+
+// GetQueriesMigrateTable returns queries that change table with existing
+// columns, which are keyed by names and have types as reported by
+// information_schema, to match the struct. Columns are renamed first (see
+// GetQueriesRenameColumns), then columns are added or their types are altered
+// in the order of fields
+func (h *Helper) GetQueriesMigrateTable(existing map[string]string) []string {
+	qs := []string{}
+	cols := map[string]string{}
+	for col, t := range existing {
+		cols[col] = t
+	}
+	renames := h.GetQueriesRenameColumns()
+	oldCols := []string{}
+	for oldCol := range renames {
+		oldCols = append(oldCols, oldCol)
+	}
+	sort.Strings(oldCols)
+	renamedCols := h.getRenamedCols()
+	for _, oldCol := range oldCols {
+		if _, ok := cols[oldCol]; !ok {
+			continue
+		}
+		if _, ok := cols[renamedCols[oldCol]]; ok {
+			continue
+		}
+		qs = append(qs, renames[oldCol])
+		cols[renamedCols[oldCol]] = cols[oldCol]
+		delete(cols, oldCol)
+	}
+
+	for _, k := range h.fields {
+		if k == "ID" {
+			continue
+		}
+		col := h.dbFieldCols[k]
+		params := h.getDBColParams(k, h.fieldsUniq[k])
+		t, ok := cols[col]
+		if !ok {
+			qs = append(qs, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", h.dbTbl, col, params))
+			continue
+		}
+		newType := h.getDBColType(k)
+		if normalizeColType(newType) == normalizeColType(t) {
+			continue
+		}
+		q := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s", h.dbTbl, col, newType, col, newType)
+		if m := colDefaultRegExp.FindStringSubmatch(params); m != nil {
+			q = fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT, ALTER COLUMN %s TYPE %s USING %s::%s, ALTER COLUMN %s SET DEFAULT %s", h.dbTbl, col, col, newType, col, newType, col, m[1])
+		}
+		qs = append(qs, q)
+	}
+	return qs
+}
+
+// getDBColType returns type of field's column, without default value and
+// constraints
+func (h *Helper) getDBColType(n string) string {
+	t := h.getDBColParams(n, false)
+	for _, s := range []string{" DEFAULT ", " CHECK ", " PRIMARY KEY", " UNIQUE", " REFERENCES "} {
+		if i := strings.Index(t, s); i > -1 {
+			t = t[:i]
+		}
+	}
+	return t
+}
+
+// getInfoSchemaColType returns column type from information_schema in the
+// form used in "CREATE TABLE"
+func getInfoSchemaColType(dataType string, udtName string, charLen sql.NullInt64, precision sql.NullInt64, scale sql.NullInt64) string {
+	t := strings.ToUpper(dataType)
+	switch t {
+	case "CHARACTER VARYING":
+		if charLen.Valid {
+			return fmt.Sprintf("VARCHAR(%d)", charLen.Int64)
+		}
+		return "VARCHAR"
+	case "CHARACTER":
+		if charLen.Valid {
+			return fmt.Sprintf("CHAR(%d)", charLen.Int64)
+		}
+		return "CHAR"
+	case "NUMERIC":
+		if precision.Valid {
+			return fmt.Sprintf("NUMERIC(%d,%d)", precision.Int64, scale.Int64)
+		}
+		return "NUMERIC"
+	case "USER-DEFINED", "ARRAY":
+		return strings.ToUpper(udtName)
+	}
+	return t
+}
+
+// normalizeColType returns column type in upper case, with aliases replaced,
+// so that it can be compared with other one
+func normalizeColType(t string) string {
+	t = strings.ToUpper(strings.TrimSpace(t))
+	t = strings.ReplaceAll(t, ", ", ",")
+	if strings.HasPrefix(t, "DECIMAL") {
+		t = "NUMERIC" + strings.TrimPrefix(t, "DECIMAL")
+	}
+	if strings.HasPrefix(t, "CHARACTER VARYING") {
+		t = "VARCHAR" + strings.TrimPrefix(t, "CHARACTER VARYING")
+	}
+	if a, ok := colTypeAliases[t]; ok {
+		return a
+	}
+	return t
+}
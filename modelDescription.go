@@ -0,0 +1,59 @@
+package crud
+
+// ModelDescription describes model, its database table, fields with
+// validation rules, relations and mounted HTTP endpoints. It is returned by
+// Describe, eg. for building admin UIs or generating client SDKs
+type ModelDescription struct {
+	Name      string                `json:"name"`
+	Tbl       string                `json:"table"`
+	Fields    []FieldDescription    `json:"fields"`
+	Relations []RelationDescription `json:"relations"`
+	Endpoints []EndpointDescription `json:"endpoints"`
+}
+
+// FieldDescription describes a field of a model. Validation rules that are
+// not set are nil
+type FieldDescription struct {
+	Name   string `json:"name"`
+	Column string `json:"column"`
+	JSON   string `json:"json"`
+	// JSONHidden is true for fields with `json:"-"` tag, that are never
+	// in requests and responses
+	JSONHidden bool `json:"json_hidden,omitempty"`
+	// OmitEmpty is true when field is omitted in JSON when it is empty
+	OmitEmpty bool `json:"omit_empty,omitempty"`
+	// Type is the Go type, eg. "int64"
+	Type       string   `json:"type"`
+	DBType     string   `json:"db_type"`
+	Required   bool     `json:"required"`
+	RequiredOn []string `json:"required_on,omitempty"`
+	LenMin     *int     `json:"len_min,omitempty"`
+	LenMax     *int     `json:"len_max,omitempty"`
+	ValMin     *int     `json:"val_min,omitempty"`
+	ValMax     *int     `json:"val_max,omitempty"`
+	Email      bool     `json:"email,omitempty"`
+	RegExp     string   `json:"regexp,omitempty"`
+	Uniq       bool     `json:"uniq,omitempty"`
+	Lookup     bool     `json:"lookup,omitempty"`
+	Filterable bool     `json:"filterable,omitempty"`
+	Searchable bool     `json:"searchable,omitempty"`
+	// Sensitive is the kind of fake value that the field gets when object is
+	// anonymized, eg. "email"
+	Sensitive string `json:"sensitive,omitempty"`
+	// Flags are names of bits of field with flags, set with SetFlagNames
+	Flags map[string]int64 `json:"flags,omitempty"`
+}
+
+// RelationDescription describes relation added with AddRelation
+type RelationDescription struct {
+	Name  string `json:"name"`
+	Field string `json:"field"`
+	Tbl   string `json:"table"`
+}
+
+// EndpointDescription describes HTTP endpoint mounted with MountEndpoints
+type EndpointDescription struct {
+	Path string `json:"path"`
+	// Ops are the allowed operations; 0 means all
+	Ops int `json:"ops"`
+}
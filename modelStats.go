@@ -0,0 +1,13 @@
+package crud
+
+// ModelStats contains statistics of model's database table
+type ModelStats struct {
+	Tbl  string `json:"table"`
+	Rows int64  `json:"rows"`
+	// TableSize, IndexesSize and TotalSize are in bytes
+	TableSize   int64 `json:"table_size"`
+	IndexesSize int64 `json:"indexes_size"`
+	TotalSize   int64 `json:"total_size"`
+	// DeadTuples is an estimate taken from pg_stat_user_tables
+	DeadTuples int64 `json:"dead_tuples"`
+}
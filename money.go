@@ -0,0 +1,333 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// currencyRegExp matches ISO 4217 currency codes
+var currencyRegExp = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// decimalRegExp matches decimal amounts
+var decimalRegExp = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// currencyMinorUnits contains number of digits after the decimal point of
+// currencies that do not have 2 of them
+var currencyMinorUnits = map[string]int{
+	"BHD": 3, "BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "IQD": 3, "ISK": 0,
+	"JOD": 3, "JPY": 0, "KMF": 0, "KRW": 0, "KWD": 3, "LYD": 3, "OMR": 3,
+	"PYG": 0, "RWF": 0, "TND": 3, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0,
+	"XOF": 0, "XPF": 0,
+}
+
+// Money is an amount in minor units of a currency (eg. cents) so that it is
+// never rounded when stored. Fields of this type must have the currency of
+// the column set with "currency" tag, eg. `crud:"currency:USD"`, and they are
+// stored in BIGINT columns containing the amount, eg. 1234. In JSON,
+// MessagePack and CBOR the amount is a decimal string, eg.
+// {"amount":"12.34","currency":"USD"}. Zero Money is stored as NULL
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// NewMoney returns Money with amount in minor units of the currency
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses decimal amount, eg. "12.34", in the currency. Amount
+// with more digits after the decimal point than the currency has is invalid
+func ParseMoney(s string, currency string) (Money, error) {
+	if !currencyRegExp.MatchString(currency) {
+		return Money{}, fmt.Errorf("invalid currency %s", currency)
+	}
+	digits := CurrencyMinorUnits(currency)
+	if !decimalRegExp.MatchString(s) {
+		return Money{}, fmt.Errorf("invalid amount %s", s)
+	}
+	neg := strings.HasPrefix(s, "-")
+	whole := strings.TrimPrefix(s, "-")
+	frac := ""
+	if i := strings.Index(whole, "."); i > -1 {
+		whole, frac = whole[:i], whole[i+1:]
+	}
+	if len(frac) > digits {
+		return Money{}, fmt.Errorf("amount %s has too many decimal places", s)
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %s: %w", s, err)
+	}
+	if neg {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// CurrencyMinorUnits returns number of digits after the decimal point in
+// amounts of the currency
+func CurrencyMinorUnits(currency string) int {
+	if d, ok := currencyMinorUnits[currency]; ok {
+		return d
+	}
+	return 2
+}
+
+// IsZero checks if m has neither amount nor currency
+func (m Money) IsZero() bool {
+	return m.Amount == 0 && m.Currency == ""
+}
+
+// IsValid checks if m is zero or has a valid currency code
+func (m Money) IsValid() bool {
+	return m.IsZero() || currencyRegExp.MatchString(m.Currency)
+}
+
+// IsValidIn checks if m is zero or it is in the currency
+func (m Money) IsValidIn(currency string) bool {
+	return m.IsZero() || m.Currency == currency
+}
+
+// Decimal returns the amount as decimal string, eg. "12.34"
+func (m Money) Decimal() string {
+	digits := CurrencyMinorUnits(m.Currency)
+	sign := ""
+	if m.Amount < 0 {
+		sign = "-"
+	}
+	s := strconv.FormatUint(absAmount(m.Amount), 10)
+	if digits == 0 {
+		return sign + s
+	}
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// String returns the amount with the currency, eg. "12.34 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Add returns sum of m and o, which must be in the same currency
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("currency mismatch %s and %s", m.Currency, o.Currency)
+	}
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, fmt.Errorf("amount overflow")
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns difference of m and o, which must be in the same currency
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, fmt.Errorf("amount overflow")
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// MulFrac returns m multiplied by num/den, rounded half away from zero, eg.
+// MulFrac(23, 100) for 23% tax. den must be positive. Product is calculated
+// without overflow and an error is returned when the result does not fit in
+// int64
+func (m Money) MulFrac(num int64, den int64) (Money, error) {
+	if den <= 0 {
+		return Money{}, fmt.Errorf("invalid denominator %d", den)
+	}
+	hi, lo := bits.Mul64(absAmount(m.Amount), absAmount(num))
+	if hi >= uint64(den) {
+		return Money{}, fmt.Errorf("amount overflow")
+	}
+	q, r := bits.Div64(hi, lo, uint64(den))
+	if 2*r >= uint64(den) {
+		q++
+	}
+	if q > math.MaxInt64 {
+		return Money{}, fmt.Errorf("amount overflow")
+	}
+	amount := int64(q)
+	if (m.Amount < 0) != (num < 0) {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+// absAmount returns absolute value of amount, which fits in uint64 for
+// math.MinInt64 as well
+func absAmount(amount int64) uint64 {
+	if amount < 0 {
+		return uint64(-amount)
+	}
+	return uint64(amount)
+}
+
+// Split divides m into n parts that differ by at most one minor unit and add
+// up to m, with larger parts first
+func (m Money) Split(n int) []Money {
+	if n < 1 {
+		return nil
+	}
+	parts := make([]Money, n)
+	q := m.Amount / int64(n)
+	r := m.Amount % int64(n)
+	for i := range parts {
+		parts[i] = Money{Amount: q, Currency: m.Currency}
+		if int64(i) < r {
+			parts[i].Amount++
+		} else if int64(i) < -r {
+			parts[i].Amount--
+		}
+	}
+	return parts
+}
+
+// Value returns amount of m in minor units, which is stored in the column
+func (m Money) Value() (driver.Value, error) {
+	if m.IsZero() {
+		return nil, nil
+	}
+	if !m.IsValid() {
+		return nil, fmt.Errorf("invalid currency %s", m.Currency)
+	}
+	return m.Amount, nil
+}
+
+// Scan sets amount of m to value of the column and leaves its currency
+// unchanged. NULL is scanned as zero Money
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case int64:
+		m.Amount = v
+		return nil
+	case []byte, string:
+		amount, err := strconv.ParseInt(fmt.Sprintf("%s", v), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid money %s: %w", v, err)
+		}
+		m.Amount = amount
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into Money", src)
+}
+
+// moneyValue wraps pointer to a Money struct field, so that it is stored in
+// the currency of the column and scanned with it
+type moneyValue struct {
+	field    reflect.Value
+	currency string
+}
+
+// Value returns amount of the field, which must be in the currency of the
+// column
+func (v *moneyValue) Value() (driver.Value, error) {
+	m := v.field.Interface().(Money)
+	if !m.IsValidIn(v.currency) {
+		return nil, fmt.Errorf("currency mismatch %s and %s", m.Currency, v.currency)
+	}
+	return m.Value()
+}
+
+// Scan sets the field to amount from the database in the currency of the
+// column
+func (v *moneyValue) Scan(src interface{}) error {
+	m := Money{}
+	err := m.Scan(src)
+	if err != nil {
+		return err
+	}
+	if src != nil {
+		m.Currency = v.currency
+	}
+	v.field.Set(reflect.ValueOf(m))
+	return nil
+}
+
+// moneyJSON is JSON, MessagePack and CBOR representation of Money
+type moneyJSON struct {
+	Amount   string `json:"amount" msgpack:"amount"`
+	Currency string `json:"currency" msgpack:"currency"`
+}
+
+// toMoneyJSON returns m with decimal amount
+func (m Money) toMoneyJSON() moneyJSON {
+	return moneyJSON{Amount: m.Decimal(), Currency: m.Currency}
+}
+
+// setFromMoneyJSON sets m to the parsed decimal amount
+func (m *Money) setFromMoneyJSON(j moneyJSON) error {
+	if j.Currency == "" && (j.Amount == "" || j.Amount == "0") {
+		*m = Money{}
+		return nil
+	}
+	v, err := ParseMoney(j.Amount, j.Currency)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// MarshalJSON returns m with decimal amount, eg.
+// {"amount":"12.34","currency":"USD"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.toMoneyJSON())
+}
+
+// UnmarshalJSON parses m from JSON with decimal amount
+func (m *Money) UnmarshalJSON(b []byte) error {
+	j := moneyJSON{}
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	return m.setFromMoneyJSON(j)
+}
+
+// EncodeMsgpack writes m with decimal amount, just like in JSON
+func (m Money) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.Encode(m.toMoneyJSON())
+}
+
+// DecodeMsgpack parses m with decimal amount
+func (m *Money) DecodeMsgpack(dec *msgpack.Decoder) error {
+	j := moneyJSON{}
+	err := dec.Decode(&j)
+	if err != nil {
+		return err
+	}
+	return m.setFromMoneyJSON(j)
+}
+
+// MarshalCBOR returns m with decimal amount, just like in JSON
+func (m Money) MarshalCBOR() ([]byte, error) {
+	return cbor.Marshal(m.toMoneyJSON())
+}
+
+// UnmarshalCBOR parses m from CBOR with decimal amount
+func (m *Money) UnmarshalCBOR(b []byte) error {
+	j := moneyJSON{}
+	err := cbor.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	return m.setFromMoneyJSON(j)
+}
@@ -0,0 +1,99 @@
+package crud
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// orderedObject is object converted to map, eg. with included relations,
+// that is marshaled to JSON with keys in the order of struct fields followed
+// by other keys, so that responses have the same key order as when object
+// is marshaled directly
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// MarshalJSON writes keys in the order
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	b := &bytes.Buffer{}
+	b.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		jk, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(jk)
+		b.WriteByte(':')
+		jv, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(jv)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// getOrderedItems returns response items (see getResponseItems) of objects
+// with the ones converted to maps wrapped in orderedObject, when response is
+// in JSON. Keys of fields are in the order of declaration, then included
+// relations in the order of include, then any other keys sorted
+func (c Controller) getOrderedItems(xobj []interface{}, items []interface{}, include []string) []interface{} {
+	if !isJSONSerializer(c.serializer) || items == nil {
+		return items
+	}
+	o := make([]interface{}, len(items))
+	for i, item := range items {
+		o[i] = item
+		if m, ok := item.(map[string]interface{}); ok {
+			o[i] = c.getOrderedObject(xobj[i], m, include)
+		}
+	}
+	return o
+}
+
+// getOrderedObject returns map of object wrapped in orderedObject
+func (c Controller) getOrderedObject(obj interface{}, m map[string]interface{}, include []string) orderedObject {
+	o := orderedObject{
+		keys:   make([]string, 0, len(m)),
+		values: m,
+	}
+	done := map[string]bool{}
+	add := func(k string) {
+		if c.jsonNaming == JSONNamingCamelCase {
+			k = getCamelCaseName(k)
+		}
+		if _, ok := m[k]; ok && !done[k] {
+			o.keys = append(o.keys, k)
+			done[k] = true
+		}
+	}
+
+	h, err := c.getHelper(obj)
+	if err == nil {
+		t := reflect.TypeOf(obj).Elem()
+		for j := 0; j < t.NumField(); j++ {
+			if t.Field(j).PkgPath == "" {
+				add(h.getJSONName(t.Field(j)))
+			}
+		}
+	}
+	for _, name := range include {
+		add(name)
+	}
+	rest := []string{}
+	for k := range m {
+		if !done[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	o.keys = append(o.keys, rest...)
+	return o
+}
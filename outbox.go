@@ -0,0 +1,145 @@
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is a change of an object recorded in the outbox table in the same
+// transaction as the change itself
+type Event struct {
+	ID int64
+	// Tbl is name of model's database table
+	Tbl string
+	// Op is OpCreate, OpUpdate or OpDelete
+	Op    int
+	ObjID int64
+	// Payload is the object in JSON, without fields with "sensitive" tag
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// EventPublisher publishes events from the outbox, eg. to a message broker.
+// Event can be published more than once so consumers should be idempotent
+type EventPublisher interface {
+	Publish(e *Event) error
+}
+
+// ContextEventPublisher is EventPublisher that gets context of the dispatch
+// and OperationInfo of the event. When publisher implements it, PublishContext
+// is called instead of Publish
+type ContextEventPublisher interface {
+	EventPublisher
+	PublishContext(ctx context.Context, info OperationInfo, e *Event) error
+}
+
+// OutboxDispatcher publishes events recorded in the outbox table (see
+// SetOutbox) with EventPublisher and marks them as dispatched
+type OutboxDispatcher struct {
+	c         *Controller
+	pub       EventPublisher
+	batchSize int
+}
+
+// NewOutboxDispatcher returns new OutboxDispatcher that publishes events from
+// the outbox table of Controller
+func NewOutboxDispatcher(c *Controller, pub EventPublisher) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		c:         c,
+		pub:       pub,
+		batchSize: 100,
+	}
+}
+
+// SetBatchSize sets maximum number of events published by a single
+// DispatchOnce call
+func (d *OutboxDispatcher) SetBatchSize(n int) {
+	d.batchSize = n
+}
+
+// DispatchOnce publishes events that have not been dispatched yet, in the
+// order they were recorded, and returns number of published events. It stops
+// on the first event that fails to be published and that event is retried on
+// the next call. Rows are locked so that many dispatchers can run at the same
+// time
+func (d *OutboxDispatcher) DispatchOnce() (int, error) {
+	return d.DispatchOnceContext(context.Background())
+}
+
+// DispatchOnceContext is DispatchOnce with context that is passed to
+// ContextEventPublisher and cancels the database queries
+func (d *OutboxDispatcher) DispatchOnceContext(ctx context.Context) (int, error) {
+	tbl := d.c.getOutboxTbl()
+	tx, err := d.c.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT event_id, event_tbl, event_op, event_obj_id, event_payload, event_created_at FROM %s WHERE event_dispatched_at IS NULL ORDER BY event_id LIMIT $1 FOR UPDATE SKIP LOCKED", tbl), d.batchSize)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	events := []*Event{}
+	for rows.Next() {
+		e := &Event{}
+		var payload []byte
+		err = rows.Scan(&e.ID, &e.Tbl, &e.Op, &e.ObjID, &payload, &e.CreatedAt)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+		e.Payload = json.RawMessage(payload)
+		events = append(events, e)
+	}
+	rows.Close()
+
+	cnt := 0
+	var errPub error
+	for _, e := range events {
+		errPub = d.publish(ctx, e)
+		if errPub != nil {
+			break
+		}
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET event_dispatched_at = NOW() WHERE event_id = $1", tbl), e.ID)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		cnt++
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return cnt, errPub
+}
+
+// publish publishes event with context when publisher supports it
+func (d *OutboxDispatcher) publish(ctx context.Context, e *Event) error {
+	if pub, ok := d.pub.(ContextEventPublisher); ok {
+		return pub.PublishContext(ctx, OperationInfo{Tbl: e.Tbl, Op: e.Op}, e)
+	}
+	return d.pub.Publish(e)
+}
+
+// Run calls DispatchOnceContext every interval until ctx is done. Errors are passed
+// to onErr, which can be nil
+func (d *OutboxDispatcher) Run(ctx context.Context, interval time.Duration, onErr func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := d.DispatchOnceContext(ctx)
+		if err != nil && onErr != nil {
+			onErr(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// earthRadius is the mean Earth radius in meters, used for distances between
+// points
+const earthRadius = 6371000
+
+// Point is a location with latitude and longitude in degrees. Fields of this
+// type are stored in POINT columns, with longitude as x and latitude as y,
+// and they can be used in QueryBuilder.WhereWithin
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// IsValid checks if latitude and longitude are within their ranges
+func (p Point) IsValid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// Value returns the point in the format of POINT column
+func (p Point) Value() (driver.Value, error) {
+	if !p.IsValid() {
+		return nil, fmt.Errorf("invalid point %v,%v", p.Lat, p.Lng)
+	}
+	return fmt.Sprintf("(%s,%s)", strconv.FormatFloat(p.Lng, 'f', -1, 64), strconv.FormatFloat(p.Lat, 'f', -1, 64)), nil
+}
+
+// Scan parses value of POINT column. NULL is scanned as zero Point
+func (p *Point) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*p = Point{}
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("cannot scan %T into Point", src)
+	}
+	xy := strings.Split(strings.Trim(s, "()"), ",")
+	if len(xy) != 2 {
+		return fmt.Errorf("invalid point %s", s)
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(xy[0]), 64)
+	if err != nil {
+		return fmt.Errorf("invalid point %s: %w", s, err)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(xy[1]), 64)
+	if err != nil {
+		return fmt.Errorf("invalid point %s: %w", s, err)
+	}
+	p.Lat, p.Lng = lat, lng
+	return nil
+}
@@ -0,0 +1,131 @@
+package crud
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// PoolStats contains statistics of the database connection pool
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	// WaitDuration is the total time blocked waiting for a connection, in
+	// milliseconds
+	WaitDuration      float64 `json:"wait_duration_ms"`
+	MaxIdleClosed     int64   `json:"max_idle_closed"`
+	MaxLifetimeClosed int64   `json:"max_lifetime_closed"`
+}
+
+// Reasons of pool warnings
+const (
+	// PoolExhausted means that an operation had to wait for a connection
+	// because all of them were in use
+	PoolExhausted = "exhausted"
+	// PoolLongWait means that an operation waited for a connection longer
+	// than the threshold on average
+	PoolLongWait = "long_wait"
+)
+
+// PoolWarning is passed to func set with SetPoolWarning when pool exhaustion
+// is detected during an operation
+type PoolWarning struct {
+	Reason string
+	// Tbl and Op are table and operation during which waits were detected
+	Tbl string
+	Op  int
+	// Waits is number of new waits for a connection and AvgWait is their
+	// average duration
+	Waits   int64
+	AvgWait time.Duration
+	Stats   PoolStats
+}
+
+// poolMonitor compares pool statistics after each operation with the
+// previous ones and reports new waits for connections. It is shared by
+// copies of Controller
+type poolMonitor struct {
+	mu            sync.Mutex
+	threshold     time.Duration
+	fn            func(w PoolWarning)
+	lastWaitCount int64
+	lastWaitDur   time.Duration
+}
+
+// GetPoolStats returns statistics of the database connection pool, or nil
+// when controller has no connection
+func (c Controller) GetPoolStats() *PoolStats {
+	if c.dbConn == nil {
+		return nil
+	}
+	return getPoolStats(c.dbConn.Stats())
+}
+
+// SetPoolWarning sets func that is called when an operation had to wait for
+// a database connection, with PoolLongWait reason when the waits took at
+// least threshold on average and PoolExhausted otherwise. It helps to tune
+// SetMaxOpenConns of the connection. fn is called synchronously, so it should
+// be quick, eg. log the warning
+func (c *Controller) SetPoolWarning(threshold time.Duration, fn func(w PoolWarning)) {
+	c.pool = &poolMonitor{
+		threshold: threshold,
+		fn:        fn,
+	}
+	if c.dbConn != nil {
+		st := c.dbConn.Stats()
+		c.pool.lastWaitCount = st.WaitCount
+		c.pool.lastWaitDur = st.WaitDuration
+	}
+}
+
+// checkPool reports new waits for connections when pool warning is set
+func (c *Controller) checkPool(h *Helper, op int) {
+	if c.pool == nil || c.dbConn == nil {
+		return
+	}
+	if w := c.pool.check(c.dbConn.Stats()); w != nil {
+		w.Tbl = h.dbTbl
+		w.Op = op
+		c.pool.fn(*w)
+	}
+}
+
+// check returns warning when there are new waits since the previous check
+func (m *poolMonitor) check(st sql.DBStats) *PoolWarning {
+	m.mu.Lock()
+	waits := st.WaitCount - m.lastWaitCount
+	dur := st.WaitDuration - m.lastWaitDur
+	m.lastWaitCount = st.WaitCount
+	m.lastWaitDur = st.WaitDuration
+	m.mu.Unlock()
+	if waits <= 0 {
+		return nil
+	}
+	w := &PoolWarning{
+		Reason:  PoolExhausted,
+		Waits:   waits,
+		AvgWait: dur / time.Duration(waits),
+		Stats:   *getPoolStats(st),
+	}
+	if w.AvgWait >= m.threshold {
+		w.Reason = PoolLongWait
+	}
+	return w
+}
+
+// getPoolStats returns PoolStats from statistics of sql.DB
+func getPoolStats(st sql.DBStats) *PoolStats {
+	return &PoolStats{
+		MaxOpenConnections: st.MaxOpenConnections,
+		OpenConnections:    st.OpenConnections,
+		InUse:              st.InUse,
+		Idle:               st.Idle,
+		WaitCount:          st.WaitCount,
+		WaitDuration:       float64(st.WaitDuration) / float64(time.Millisecond),
+		MaxIdleClosed:      st.MaxIdleClosed,
+		MaxLifetimeClosed:  st.MaxLifetimeClosed,
+	}
+}
@@ -0,0 +1,277 @@
+package crud
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// queryBuilderOperators are operators that can be used in QueryBuilder.Where
+var queryBuilderOperators = map[string]bool{
+	"=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+	"LIKE": true, "ILIKE": true, "IN": true, "NOT IN": true,
+}
+
+// QueryBuilder builds select queries of a model for cases that GetFromDB does
+// not cover. Columns are taken from fields and values are always passed as
+// query arguments, so the queries are safe, and the rows are scanned into
+// the model structs. Errors are returned by SQL and Get
+type QueryBuilder struct {
+	c          Controller
+	h          *Helper
+	newObjFunc func() interface{}
+	where      []string
+	args       []interface{}
+	order      []string
+	limit      int
+	offset     int
+	topN       int
+	partition  []string
+	err        *ErrController
+}
+
+// Select returns QueryBuilder that selects objects created with newObjFunc
+func (c Controller) Select(newObjFunc func() interface{}) *QueryBuilder {
+	b := &QueryBuilder{
+		c:          c,
+		newObjFunc: newObjFunc,
+	}
+	b.h, b.err = c.getHelper(newObjFunc())
+	return b
+}
+
+// Where adds condition on value of a field, eg. Where("Age", ">=", 18).
+// Operator can be one of "=", "<>", "<", "<=", ">", ">=", "LIKE", "ILIKE",
+// "IN" and "NOT IN". Value of the last two must be []interface{}. Conditions
+// are joined with AND
+func (b *QueryBuilder) Where(fieldName string, operator string, value interface{}) *QueryBuilder {
+	if b.err != nil {
+		return b
+	}
+	col := b.h.dbFieldCols[fieldName]
+	operator = strings.ToUpper(operator)
+	if col == "" {
+		b.err = &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Invalid field %s", fieldName),
+		}
+		return b
+	}
+	if !queryBuilderOperators[operator] {
+		b.err = &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Invalid operator %s", operator),
+		}
+		return b
+	}
+	xv, isSlice := value.([]interface{})
+	if (operator == "IN" || operator == "NOT IN") != isSlice || (isSlice && len(xv) == 0) {
+		b.err = &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Invalid value for operator %s", operator),
+		}
+		return b
+	}
+
+	dbFilters, err := b.h.convertFiltersToDB(map[string]interface{}{fieldName: value})
+	if err != nil {
+		b.err = &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Error when trying to convert value: %w", err),
+		}
+		return b
+	}
+	if isSlice {
+		vals := ""
+		for _, v := range dbFilters[fieldName].([]interface{}) {
+			b.args = append(b.args, v)
+			vals = b.h.addWithComma(vals, "$"+strconv.Itoa(len(b.args)))
+		}
+		b.where = append(b.where, col+" "+operator+" ("+vals+")")
+		return b
+	}
+	b.args = append(b.args, dbFilters[fieldName])
+	b.where = append(b.where, col+" "+operator+" $"+strconv.Itoa(len(b.args)))
+	return b
+}
+
+// WhereExists adds condition that there is at least one object created with
+// newObjFunc (of another model), that has ID of the object in refField and
+// matches filters, eg. users having an active session:
+//
+//	c.Select(newUser).WhereExists(newSession, "UserID", map[string]interface{}{"Status": "active"})
+func (b *QueryBuilder) WhereExists(newObjFunc func() interface{}, refField string, filters map[string]interface{}) *QueryBuilder {
+	return b.whereExists("EXISTS", newObjFunc, refField, filters)
+}
+
+// WhereNotExists adds condition that there is no object matching the
+// arguments, just like in WhereExists
+func (b *QueryBuilder) WhereNotExists(newObjFunc func() interface{}, refField string, filters map[string]interface{}) *QueryBuilder {
+	return b.whereExists("NOT EXISTS", newObjFunc, refField, filters)
+}
+
+func (b *QueryBuilder) whereExists(operator string, newObjFunc func() interface{}, refField string, filters map[string]interface{}) *QueryBuilder {
+	if b.err != nil {
+		return b
+	}
+	obj := newObjFunc()
+	h, err := b.c.getHelper(obj)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	if h.dbFieldCols[refField] == "" {
+		b.err = &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Invalid field %s", refField),
+		}
+		return b
+	}
+	for k := range filters {
+		if h.dbFieldCols[k] == "" {
+			b.err = &ErrController{
+				Op:  "InvalidField",
+				Err: fmt.Errorf("Invalid field %s", k),
+			}
+			return b
+		}
+	}
+	filters, dbFilters, err := b.c.prepareFilters(h, obj, filters)
+	if err != nil {
+		b.err = err
+		return b
+	}
+
+	qWhere := fmt.Sprintf("%s = %s.%s", h.dbFieldCols[refField], b.h.dbTbl, b.h.dbFieldCols["ID"])
+	cond, i := h.getFiltersCondition(filters, nil, len(b.args)+1)
+	qWhere = h.addWithAnd(qWhere, cond)
+	b.args = append(b.args, h.GetFilterArgs(dbFilters)...)
+	if h.hasExpires() {
+		qWhere = h.addWithAnd(qWhere, h.getExpiresCondition(i, ""))
+		b.args = append(b.args, b.c.getExpiresArgs(h)...)
+	}
+	if h.excludesDeleted() {
+		qWhere = h.addWithAnd(qWhere, h.getSoftDelCondition(""))
+	}
+	b.where = append(b.where, fmt.Sprintf("%s (SELECT 1 FROM %s WHERE %s)", operator, h.dbTbl, qWhere))
+	return b
+}
+
+// WhereWithin adds condition that Point field is within radius (in meters)
+// from center. Distance is calculated with haversine formula
+func (b *QueryBuilder) WhereWithin(fieldName string, center Point, radius float64) *QueryBuilder {
+	if b.err != nil {
+		return b
+	}
+	if b.h.dbFieldCols[fieldName] == "" || b.h.fieldsType[fieldName] != reflect.TypeOf(Point{}) {
+		b.err = &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Invalid field %s", fieldName),
+		}
+		return b
+	}
+	if !center.IsValid() || radius < 0 {
+		b.err = &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Invalid center or radius"),
+		}
+		return b
+	}
+	b.args = append(b.args, center.Lat, center.Lng, radius)
+	n := len(b.args)
+	col := b.h.dbFieldCols[fieldName]
+	b.where = append(b.where, fmt.Sprintf("%d * 2 * ASIN(SQRT(POWER(SIN(RADIANS(%s[1] - $%d) / 2), 2) + COS(RADIANS($%d)) * COS(RADIANS(%s[1])) * POWER(SIN(RADIANS(%s[0] - $%d) / 2), 2))) <= $%d", earthRadius, col, n-2, n-2, col, col, n-1, n))
+	return b
+}
+
+// OrderBy adds field to sort by, with "asc" or "desc" direction
+func (b *QueryBuilder) OrderBy(fieldName string, direction string) *QueryBuilder {
+	if b.err != nil {
+		return b
+	}
+	if b.h.dbFieldCols[fieldName] == "" {
+		b.err = &ErrController{
+			Op:  "InvalidOrder",
+			Err: fmt.Errorf("Invalid field %s", fieldName),
+		}
+		return b
+	}
+	b.order = append(b.order, fieldName, strings.ToLower(direction))
+	return b
+}
+
+// TopPerGroup limits objects to first n of each group of objects having the
+// same values of fields, in order set with OrderBy, eg. latest session of each
+// user:
+//
+//	c.Select(newSession).OrderBy("CreatedAt", "desc").TopPerGroup(1, "UserID")
+//
+// Returned objects are sorted by the fields and then by their position in
+// the group, and Limit and Offset apply to all of them
+func (b *QueryBuilder) TopPerGroup(n int, fieldNames ...string) *QueryBuilder {
+	if b.err != nil {
+		return b
+	}
+	if n < 1 || len(fieldNames) == 0 {
+		b.err = &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Invalid number of objects per group or no fields"),
+		}
+		return b
+	}
+	for _, f := range fieldNames {
+		if b.h.dbFieldCols[f] == "" {
+			b.err = &ErrController{
+				Op:  "InvalidField",
+				Err: fmt.Errorf("Invalid field %s", f),
+			}
+			return b
+		}
+	}
+	b.topN = n
+	b.partition = fieldNames
+	return b
+}
+
+// Limit sets maximum number of returned objects; 0 means no limit
+func (b *QueryBuilder) Limit(limit int) *QueryBuilder {
+	b.limit = limit
+	return b
+}
+
+// Offset sets number of objects to skip
+func (b *QueryBuilder) Offset(offset int) *QueryBuilder {
+	b.offset = offset
+	return b
+}
+
+// SQL returns the select query and its arguments. Objects that expired are
+// excluded, just like in GetFromDB
+func (b *QueryBuilder) SQL() (string, []interface{}, *ErrController) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	qWhere := strings.Join(b.where, " AND ")
+	var query string
+	if b.topN > 0 {
+		query = b.h.getQuerySelectTopPerGroup(qWhere, len(b.args)+1, b.partition, b.topN, b.c.getOrder(b.h, b.order), b.limit, b.offset, b.c.getQueryHints(b.h, OpList))
+	} else {
+		query = b.h.getQuerySelect(qWhere, len(b.args)+1, b.c.getOrder(b.h, b.order), b.limit, b.offset, nil, b.c.getQueryHints(b.h, OpList))
+	}
+	return query, append(append([]interface{}{}, b.args...), b.c.getExpiresArgs(b.h)...), nil
+}
+
+// Get runs the query and returns the objects, with hooks run just like in
+// GetFromDB
+func (b *QueryBuilder) Get() ([]interface{}, *ErrController) {
+	query, args, err := b.SQL()
+	if err != nil {
+		return nil, err
+	}
+	errHook := b.c.runHooks(HookBefore, OpList, b.newObjFunc())
+	if errHook != nil {
+		return nil, errHook
+	}
+	return b.c.getFromDBWithQuery(b.h, b.newObjFunc, query, args)
+}
@@ -0,0 +1,12 @@
+package crud
+
+// QueryHints contains static SQL fragments that are added to queries generated
+// for a specific model and operation
+type QueryHints struct {
+	// OrderBy is appended to the ORDER BY clause of a list query, eg. "id ASC"
+	// to force stable order for keyset pagination
+	OrderBy string
+	// Settings are statements executed in a transaction wrapping the
+	// generated query, eg. "SET LOCAL enable_seqscan = off"
+	Settings []string
+}
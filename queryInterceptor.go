@@ -0,0 +1,17 @@
+package crud
+
+import (
+	"context"
+)
+
+// QueryInterceptor is called with name of model's database table, operation
+// (OpRead, OpList etc.), generated query and its arguments before the query is
+// executed. It returns the query and arguments that are executed instead, so
+// it can add comments, hints or extra predicates. When it returns an error,
+// the query is not executed
+type QueryInterceptor func(tbl string, op int, query string, args []interface{}) (string, []interface{}, error)
+
+// ContextQueryInterceptor is QueryInterceptor that gets context of the
+// operation and OperationInfo instead of the table and operation, eg. to add
+// trace ID of the request to the query in a comment
+type ContextQueryInterceptor func(ctx context.Context, info OperationInfo, query string, args []interface{}) (string, []interface{}, error)
@@ -0,0 +1,16 @@
+package crud
+
+// Relation links objects of a model to objects of another model, by a field
+// containing ID of the other object, eg. CreatedByUserID
+type Relation struct {
+	// Field contains ID of the related object
+	Field string
+	// NewObjFunc returns new instance of the related struct
+	NewObjFunc func() interface{}
+}
+
+// JoinedObject contains object and its related object, returned by ListJoined
+type JoinedObject struct {
+	Obj     interface{}
+	Related interface{}
+}
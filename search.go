@@ -0,0 +1,153 @@
+package crud
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SearchResults are objects of a model found by SearchAll
+type SearchResults struct {
+	// Model is the name used in URL of the model, eg. "users"
+	Model string        `json:"model"`
+	Items []interface{} `json:"items"`
+}
+
+// SearchAll searches objects of models (newObjFuncs return new instances of
+// their structs) that contain query in any of the fields with "searchable"
+// tag, ignoring case, eg. for a global search box. It returns up to limit
+// objects of each model, in the order of models. Models must have at least
+// one searchable field
+func (c Controller) SearchAll(query string, limit int, newObjFuncs ...func() interface{}) ([]*SearchResults, *ErrController) {
+	if limit <= 0 {
+		limit = 10
+	}
+	query = strings.TrimSpace(query)
+	pattern := "%" + getLikeEscaped(query) + "%"
+
+	results := []*SearchResults{}
+	for _, newObjFunc := range newObjFuncs {
+		obj := newObjFunc()
+		h, err := c.getHelper(obj)
+		if err != nil {
+			return nil, err
+		}
+		if len(h.fieldsSearchable) == 0 {
+			return nil, &ErrController{
+				Op:  "InvalidModel",
+				Err: fmt.Errorf("Model %s has no searchable fields", h.modelName),
+			}
+		}
+		res := &SearchResults{
+			Model: h.url,
+			Items: []interface{}{},
+		}
+		results = append(results, res)
+		if query == "" {
+			continue
+		}
+
+		errHook := c.runHooks(HookBefore, OpList, obj)
+		if errHook != nil {
+			return nil, errHook
+		}
+		xobj, err := c.getFromDBWithQuery(h, newObjFunc, h.GetQuerySearch(limit), append([]interface{}{pattern}, c.getExpiresArgs(h)...))
+		if err != nil {
+			return nil, err
+		}
+		res.Items = append(res.Items, xobj...)
+	}
+	return results, nil
+}
+
+// GetSearchHTTPHandler returns HTTP handler that responds with results of
+// SearchAll for the "q" query parameter, eg. to be attached to "/search".
+// Objects are formatted just like in the list response of their models
+func (c Controller) GetSearchHTTPHandler(limit int, newObjFuncs ...func() interface{}) http.Handler {
+	return c.GetSearchHTTPHandlerWithListDTOs(limit, newObjFuncs, nil)
+}
+
+// GetSearchHTTPHandlerWithListDTOs works like GetSearchHTTPHandler, but
+// objects found by SearchAll are returned as list DTOs of their models, ie.
+// structs returned by newObjListFuncs (the same ones that are passed to
+// GetHTTPHandler), in the order of newObjFuncs. List DTO of a model can be
+// nil, and then the model itself is returned
+func (c Controller) GetSearchHTTPHandlerWithListDTOs(limit int, newObjFuncs []func() interface{}, newObjListFuncs []func() interface{}) http.Handler {
+	for i, newObjFunc := range newObjFuncs {
+		if i < len(newObjListFuncs) {
+			c.initHelpersForHTTPHandler(newObjFunc, nil, nil, nil, nil, newObjListFuncs[i])
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := c.withResponseSerializer(r).withRequest(r)
+		if settings := GetSessionSettings(r); settings != nil {
+			c.sessionSettings = settings
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			c.writeErrText(w, http.StatusBadRequest, "invalid_query")
+			return
+		}
+		results, err := c.SearchAll(q, limit, newObjFuncs...)
+		if err != nil {
+			c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+			return
+		}
+		for i, res := range results {
+			if i < len(newObjListFuncs) && newObjListFuncs[i] != nil {
+				res.Items, err = c.getListDTOs(newObjListFuncs[i], res.Items)
+				if err != nil {
+					c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+					return
+				}
+			}
+			items, err := c.getResponseItems(r, res.Items, nil)
+			if err != nil {
+				c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+				return
+			}
+			res.Items = c.getOrderedItems(res.Items, items, nil)
+		}
+		c.writeOK(w, http.StatusOK, map[string]interface{}{
+			"results": results,
+		})
+	})
+}
+
+// getListDTOs returns objects as list DTOs, ie. structs returned by
+// newObjListFunc, in the same order
+func (c Controller) getListDTOs(newObjListFunc func() interface{}, xobj []interface{}) ([]interface{}, *ErrController) {
+	if len(xobj) == 0 {
+		return xobj, nil
+	}
+	ids := make([]interface{}, len(xobj))
+	for i, obj := range xobj {
+		ids[i] = c.GetModelIDValue(obj)
+	}
+	xdto, err := c.GetFromDB(newObjListFunc, nil, 0, 0, map[string]interface{}{"ID": ids})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]interface{}, len(xdto))
+	for _, dto := range xdto {
+		byID[c.GetModelIDValue(dto)] = dto
+	}
+	o := make([]interface{}, 0, len(xobj))
+	for _, obj := range xobj {
+		if dto, ok := byID[c.GetModelIDValue(obj)]; ok {
+			o = append(o, dto)
+		}
+	}
+	return o, nil
+}
+
+// getLikeEscaped returns string with characters that have special meaning in
+// LIKE patterns escaped
+func getLikeEscaped(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
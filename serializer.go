@@ -0,0 +1,155 @@
+package crud
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Serializer marshals bodies of HTTP responses and unmarshals bodies of HTTP
+// requests, so that faster alternatives to encoding/json can be used
+type Serializer interface {
+	// ContentType returns value of the Content-Type header of the bodies
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONSerializer is the default Serializer that uses encoding/json
+type JSONSerializer struct{}
+
+// ContentType returns "application/json"
+func (JSONSerializer) ContentType() string {
+	return "application/json"
+}
+
+// Marshal returns JSON encoding of v
+func (JSONSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses JSON data into v
+func (JSONSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// isJSONSerializer checks if serializer is JSONSerializer
+func isJSONSerializer(serializer Serializer) bool {
+	_, ok := serializer.(JSONSerializer)
+	return ok
+}
+
+// MsgpackSerializer is a Serializer that uses MessagePack. Like with JSON,
+// names of the struct fields are taken from the "json" tag
+type MsgpackSerializer struct{}
+
+// ContentType returns "application/msgpack"
+func (MsgpackSerializer) ContentType() string {
+	return "application/msgpack"
+}
+
+// Marshal returns MessagePack encoding of v
+func (MsgpackSerializer) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := msgpack.NewEncoder(&b)
+	enc.SetCustomStructTag("json")
+	err := enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal parses MessagePack data into v
+func (MsgpackSerializer) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// CBORSerializer is a Serializer that uses CBOR. Names of the struct fields
+// are taken from the "json" tag, unless there is a "cbor" one
+type CBORSerializer struct{}
+
+// ContentType returns "application/cbor"
+func (CBORSerializer) ContentType() string {
+	return "application/cbor"
+}
+
+// Marshal returns CBOR encoding of v
+func (CBORSerializer) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+// Unmarshal parses CBOR data into v. Maps decoded into interface{} values get
+// string keys, like in JSON, so that they can be marshaled again
+func (CBORSerializer) Unmarshal(data []byte, v interface{}) error {
+	err := cbor.Unmarshal(data, v)
+	if err != nil {
+		return err
+	}
+	// The library decodes such maps to map[interface{}]interface{} and its
+	// version in use has no DecOptions.DefaultMapType to change it
+	convertCBORMaps(reflect.ValueOf(v))
+	return nil
+}
+
+// convertCBORMaps replaces maps with interface{} keys in interface{} values
+// that are reachable from v with maps with string keys
+func convertCBORMaps(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			convertCBORMaps(v.Elem())
+		}
+	case reflect.Interface:
+		if !v.IsNil() && v.CanSet() {
+			v.Set(reflect.ValueOf(getCBORMapsConverted(v.Interface())))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				convertCBORMaps(v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			convertCBORMaps(v.Index(i))
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.Interface {
+			return
+		}
+		for _, k := range v.MapKeys() {
+			if e := v.MapIndex(k); !e.IsNil() {
+				v.SetMapIndex(k, reflect.ValueOf(getCBORMapsConverted(e.Interface())))
+			}
+		}
+	}
+}
+
+// getCBORMapsConverted returns v with maps with interface{} keys replaced
+// with maps with string keys
+func getCBORMapsConverted(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[fmt.Sprint(k)] = getCBORMapsConverted(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = getCBORMapsConverted(e)
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = getCBORMapsConverted(e)
+		}
+	}
+	return v
+}
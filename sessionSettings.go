@@ -0,0 +1,49 @@
+package crud
+
+import (
+	"context"
+	"net/http"
+	"sort"
+)
+
+type sessionSettingsCtxKey struct{}
+
+// WithSessionSettings returns shallow copy of the request with database
+// session settings attached to its context. HTTP handler runs queries of the
+// request with them set, see Controller.WithSessionSettings
+func WithSessionSettings(r *http.Request, settings map[string]string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionSettingsCtxKey{}, settings))
+}
+
+// GetSessionSettings returns session settings attached to the request with
+// WithSessionSettings or nil when there are none
+func GetSessionSettings(r *http.Request) map[string]string {
+	settings, _ := r.Context().Value(sessionSettingsCtxKey{}).(map[string]string)
+	return settings
+}
+
+// WithSessionSettings returns copy of the controller that runs queries in
+// a transaction with the session settings applied first, the same way
+// "SET LOCAL" does, eg. {"role": "app_user", "app.tenant_id": "5"} for
+// policies of row-level security, or {"statement_timeout": "5s"}. Values are
+// passed as query arguments so they do not need escaping
+func (c Controller) WithSessionSettings(settings map[string]string) *Controller {
+	c.sessionSettings = settings
+	return &c
+}
+
+// applySessionSettings sets session settings within the transaction
+func (c Controller) applySessionSettings(q dbQuerier) error {
+	names := make([]string, 0, len(c.sessionSettings))
+	for name := range c.sessionSettings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, err := q.Exec("SELECT set_config($1, $2, true)", name, c.sessionSettings[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package crud
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShareTokenParam is the query parameter with token from GetShareToken, that
+// grants read access to an object in endpoints with Share
+const ShareTokenParam = "share_token"
+
+// SetShareSecret sets the key that share tokens are signed with. Tokens
+// signed with previous key are no longer valid
+func (c *Controller) SetShareSecret(secret string) {
+	c.shareSecret = []byte(secret)
+}
+
+// GetShareToken returns token granting read access to the object until ttl
+// passes, eg. for "share this item" links. Token is valid only for the model
+// and ID of the object and it is signed with HMAC-SHA256, so share secret
+// must be set with SetShareSecret
+func (c Controller) GetShareToken(obj interface{}, ttl time.Duration) (string, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return "", err
+	}
+	if len(c.shareSecret) == 0 {
+		return "", &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Share secret is not set"),
+		}
+	}
+	id := c.GetModelIDValue(obj)
+	if id == 0 {
+		return "", &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Object has no ID"),
+		}
+	}
+	expiresAt := c.clock.Now().Add(ttl).Unix()
+	return fmt.Sprintf("%d.%d.%s", id, expiresAt, c.getShareSignature(h, id, expiresAt)), nil
+}
+
+// VerifyShareToken returns true when token was returned by GetShareToken for
+// object of obj's model with the ID and it has not expired
+func (c Controller) VerifyShareToken(obj interface{}, id int64, token string) bool {
+	h, err := c.getHelper(obj)
+	if err != nil || len(c.shareSecret) == 0 {
+		return false
+	}
+	xs := strings.Split(token, ".")
+	if len(xs) != 3 || xs[0] != strconv.FormatInt(id, 10) {
+		return false
+	}
+	expiresAt, err2 := strconv.ParseInt(xs[1], 10, 64)
+	if err2 != nil || expiresAt < c.clock.Now().Unix() {
+		return false
+	}
+	return hmac.Equal([]byte(xs[2]), []byte(c.getShareSignature(h, id, expiresAt)))
+}
+
+// getShareSignature returns signature of share token
+func (c Controller) getShareSignature(h *Helper, id int64, expiresAt int64) string {
+	mac := hmac.New(sha256.New, c.shareSecret)
+	mac.Write([]byte(fmt.Sprintf("%s:%d:%d", h.dbTbl, id, expiresAt)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hasShareToken returns true when read request of endpoint has valid share
+// token for the object in the path, which can be its ID, formatted ID or slug
+func (c Controller) hasShareToken(e Endpoint, r *http.Request) bool {
+	token := r.URL.Query().Get(ShareTokenParam)
+	if token == "" {
+		return false
+	}
+	obj := e.Model()
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return false
+	}
+	path, _ := c.getRelativePath(e.Path, r.URL.EscapedPath())
+	path = c.getPathWithParsedIDs(path, h)
+	if idRegExp.MatchString(path) {
+		id, err := strconv.ParseInt(path, 10, 64)
+		return err == nil && c.VerifyShareToken(obj, id, token)
+	}
+	slugField := h.getSlugField()
+	if slugField == "" || !slugRegExp.MatchString(path) {
+		return false
+	}
+	if c.SetFromDBByField(obj, slugField, path) != nil || c.GetModelIDValue(obj) == 0 {
+		return false
+	}
+	return c.VerifyShareToken(obj, c.GetModelIDValue(obj), token)
+}
+
+// withoutRelationParams returns shallow copy of the request without "include"
+// and "join" query parameters, so that share token grants access only to the
+// object and not to its related ones
+func withoutRelationParams(r *http.Request) *http.Request {
+	q := r.URL.Query()
+	q.Del("include")
+	q.Del("join")
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	r = r.WithContext(r.Context())
+	r.URL = &u
+	return r
+}
@@ -0,0 +1,473 @@
+package crud
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// SubjectModel describes a model that contains personal data of a subject
+// (user), registered with AddSubjectModel for EraseSubject and ExportSubject
+type SubjectModel struct {
+	// NewObjFunc returns new instance of the struct
+	NewObjFunc func() interface{}
+	// Field is int64 field with ID of the subject, eg. "ID" for the users
+	// model. When empty, field with "createdby" tag is used
+	Field string
+	// Redact makes EraseSubject keep the objects, eg. orders needed for
+	// accounting, with sensitive fields anonymized (see Anonymize) and Field
+	// set to 0, instead of deleting them
+	Redact bool
+}
+
+// SubjectReport contains numbers of objects of each table affected by
+// EraseSubject or ExportSubject
+type SubjectReport struct {
+	SubjectID int64                `json:"subject_id"`
+	Tables    []SubjectTableReport `json:"tables"`
+	// Data contains exported objects per table, only in ExportSubject
+	Data map[string][]interface{} `json:"data,omitempty"`
+}
+
+// SubjectTableReport contains numbers of subject's objects in a table
+type SubjectTableReport struct {
+	Tbl      string `json:"table"`
+	Deleted  int64  `json:"deleted"`
+	Redacted int64  `json:"redacted"`
+	Exported int64  `json:"exported"`
+}
+
+// AddSubjectModel registers model containing personal data of subjects, that
+// EraseSubject and ExportSubject go through
+func (c *Controller) AddSubjectModel(m SubjectModel) *ErrController {
+	if m.NewObjFunc == nil {
+		return &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Subject model has no NewObjFunc"),
+		}
+	}
+	h, err := c.getHelper(m.NewObjFunc())
+	if err != nil {
+		return err
+	}
+	if m.Field == "" {
+		m.Field = h.fieldCreatedBy
+	}
+	if m.Field == "" || h.fieldsFlags[m.Field]&TypeInt64 == 0 {
+		return &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Field %s is not an int64", m.Field),
+		}
+	}
+	c.subjects[h.dbTbl] = m
+	return nil
+}
+
+// EraseSubject removes personal data of a subject from all the models
+// registered with AddSubjectModel, in one transaction: objects are deleted
+// or, for models with Redact, anonymized. Objects of other models (that the
+// controller has used) linking to deleted objects with "fk" tag, other than
+// "ondelete:setnull" ones, are deleted as well, and so on. Tables are
+// processed in the order of the links, the linking ones first. Versions,
+// change requests, outbox events and webhook deliveries of deleted and
+// redacted objects are deleted too. Hooks are not run. It returns report of
+// affected tables, in the order they were processed
+func (c Controller) EraseSubject(subjectID int64) (*SubjectReport, *ErrController) {
+	report := &SubjectReport{
+		SubjectID: subjectID,
+		Tables:    []SubjectTableReport{},
+	}
+	erase := func(tc *Controller) *ErrController {
+		xt, err := tc.eraseSubject(tc.tx, subjectID)
+		if err != nil {
+			return err
+		}
+		report.Tables = xt
+		return nil
+	}
+	var err *ErrController
+	if c.tx != nil {
+		err = erase(&c)
+	} else {
+		err = c.WithTx(erase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ExportSubject returns all objects of a subject from the models registered
+// with AddSubjectModel, eg. for a data access request. Objects are in Data of
+// the report, keyed by table names
+func (c Controller) ExportSubject(subjectID int64) (*SubjectReport, *ErrController) {
+	report := &SubjectReport{
+		SubjectID: subjectID,
+		Tables:    []SubjectTableReport{},
+		Data:      map[string][]interface{}{},
+	}
+	for _, tbl := range c.getSubjectTbls() {
+		m := c.subjects[tbl]
+		h, err := c.getHelper(m.NewObjFunc())
+		if err != nil {
+			return nil, err
+		}
+		objs, err2 := c.getAllByFieldFromDB(c.getQuerier(), h, m.NewObjFunc, m.Field, subjectID)
+		if err2 != nil {
+			return nil, &ErrController{
+				Op:  "DBQuery",
+				Err: fmt.Errorf("Error executing DB query: %w", err2),
+			}
+		}
+		report.Data[tbl] = objs
+		report.Tables = append(report.Tables, SubjectTableReport{
+			Tbl:      tbl,
+			Exported: int64(len(objs)),
+		})
+	}
+	return report, nil
+}
+
+// getSubjectTbls returns sorted tables of models registered with
+// AddSubjectModel
+func (c Controller) getSubjectTbls() []string {
+	tbls := []string{}
+	for tbl := range c.subjects {
+		tbls = append(tbls, tbl)
+	}
+	sort.Strings(tbls)
+	return tbls
+}
+
+// eraseSubject deletes and redacts subject's objects, and the objects that
+// link to the deleted ones, and returns reports of affected tables
+func (c Controller) eraseSubject(q dbQuerier, subjectID int64) ([]SubjectTableReport, *ErrController) {
+	helpers := c.getModelHelpers()
+	reports := map[string]*SubjectTableReport{}
+	deleted := map[string]map[int64]bool{}
+	queue := []string{}
+	add := func(tbl string, ids []int64) {
+		if len(ids) == 0 {
+			return
+		}
+		if deleted[tbl] == nil {
+			deleted[tbl] = map[int64]bool{}
+		}
+		added := false
+		for _, id := range ids {
+			if !deleted[tbl][id] {
+				deleted[tbl][id] = true
+				added = true
+			}
+		}
+		if added {
+			queue = append(queue, tbl)
+		}
+	}
+	for _, tbl := range c.getSubjectTbls() {
+		m := c.subjects[tbl]
+		h, err := c.getHelper(m.NewObjFunc())
+		if err != nil {
+			return nil, err
+		}
+		helpers[tbl] = h
+		reports[tbl] = &SubjectTableReport{Tbl: tbl}
+		if m.Redact {
+			continue
+		}
+		ids, err := c.getSubjectIDs(q, h, m.Field, []int64{subjectID})
+		if err != nil {
+			return nil, err
+		}
+		add(tbl, ids)
+	}
+	for len(queue) > 0 {
+		tbl := queue[0]
+		queue = queue[1:]
+		parentIDs := getSortedIDs(deleted[tbl])
+		for _, childTbl := range getSortedTbls(helpers) {
+			h := helpers[childTbl]
+			for _, k := range h.fields {
+				if h.fieldsFKRef[k][0] != tbl || h.fieldsOnDelete[k] == "SET NULL" {
+					continue
+				}
+				// Redacted objects stay, with the field cleared
+				if m, ok := c.subjects[childTbl]; ok && m.Redact && m.Field == k {
+					continue
+				}
+				ids, err := c.getSubjectIDs(q, h, k, parentIDs)
+				if err != nil {
+					return nil, err
+				}
+				add(childTbl, ids)
+			}
+		}
+	}
+
+	affected := map[string][]int64{}
+	for _, tbl := range c.getSubjectTbls() {
+		if !c.subjects[tbl].Redact {
+			continue
+		}
+		t, ids, err := c.redactSubjectInTbl(q, c.subjects[tbl], subjectID, deleted[tbl])
+		if err != nil {
+			return nil, err
+		}
+		reports[tbl] = t
+		affected[tbl] = ids
+	}
+	for tbl, ids := range deleted {
+		affected[tbl] = append(affected[tbl], getSortedIDs(ids)...)
+		if reports[tbl] == nil {
+			reports[tbl] = &SubjectTableReport{Tbl: tbl}
+		}
+	}
+
+	tbls := getFKOrderedTbls(helpers, reports)
+	for _, tbl := range tbls {
+		if len(deleted[tbl]) == 0 {
+			continue
+		}
+		h := helpers[tbl]
+		query, args, errI := c.interceptQuery(h, OpDelete, h.getQueryDeleteByIDs(), []interface{}{pq.Array(getSortedIDs(deleted[tbl]))})
+		if errI != nil {
+			return nil, errI
+		}
+		res, err := q.Exec(query, args...)
+		if err == nil {
+			reports[tbl].Deleted, err = res.RowsAffected()
+		}
+		if err != nil {
+			return nil, &ErrController{
+				Op:  "DBQuery",
+				Err: fmt.Errorf("Error executing DB query: %w", err),
+			}
+		}
+	}
+
+	o := []SubjectTableReport{}
+	for _, tbl := range tbls {
+		o = append(o, *reports[tbl])
+	}
+	for _, t := range [][3]string{
+		{c.getVersionsTbl(), "version_tbl", "version_obj_id"},
+		{c.getChangeRequestsTbl(), "change_request_tbl", "change_request_obj_id"},
+		{c.getOutboxTbl(), "event_tbl", "event_obj_id"},
+		{c.getWebhookDeliveriesTbl(), "delivery_tbl", "delivery_obj_id"},
+	} {
+		r, err := c.eraseSubjectRecords(q, t[0], t[1], t[2], tbls, affected)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			o = append(o, *r)
+		}
+	}
+	return o, nil
+}
+
+// eraseSubjectRecords deletes rows of a table that records objects, eg.
+// versions, that belong to objects with IDs, by table of the objects. It
+// returns nil when table does not exist or no rows were deleted
+func (c Controller) eraseSubjectRecords(q dbQuerier, recordsTbl string, tblCol string, idCol string, tbls []string, ids map[string][]int64) (*SubjectTableReport, *ErrController) {
+	errDB := func(err error) *ErrController {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	var exists bool
+	err := q.QueryRow("SELECT to_regclass($1) IS NOT NULL", recordsTbl).Scan(&exists)
+	if err != nil {
+		return nil, errDB(err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	t := &SubjectTableReport{
+		Tbl: recordsTbl,
+	}
+	for _, tbl := range tbls {
+		if len(ids[tbl]) == 0 {
+			continue
+		}
+		res, err := q.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND %s = ANY($2)", recordsTbl, tblCol, idCol), tbl, pq.Array(ids[tbl]))
+		if err != nil {
+			return nil, errDB(err)
+		}
+		cnt, err := res.RowsAffected()
+		if err != nil {
+			return nil, errDB(err)
+		}
+		t.Deleted += cnt
+	}
+	if t.Deleted == 0 {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// getSubjectIDs returns IDs of objects with value of a field that is one of
+// values
+func (c Controller) getSubjectIDs(q dbQuerier, h *Helper, fieldName string, values []int64) ([]int64, *ErrController) {
+	rows, err := q.Query(h.getQuerySelectIDsByField(fieldName), pq.Array(values))
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, &ErrController{
+				Op:  "DBQueryRowsScan",
+				Err: fmt.Errorf("Error scanning DB query row: %w", err),
+			}
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQueryRowsScan",
+			Err: fmt.Errorf("Error scanning DB query row: %w", err),
+		}
+	}
+	return ids, nil
+}
+
+// getModelHelpers returns Helpers of models that the controller has used, by
+// their tables, without the ones of DTOs
+func (c Controller) getModelHelpers() map[string]*Helper {
+	helpers := map[string]*Helper{}
+	c.helpersMu.RLock()
+	defer c.helpersMu.RUnlock()
+	for _, h := range c.modelHelpers {
+		if h.sourceDBTbl == "" {
+			helpers[h.dbTbl] = h
+		}
+	}
+	return helpers
+}
+
+// getFKOrderedTbls returns tables of reports ordered so that tables linking
+// to other ones with "fk" tag go before them, and by name otherwise
+func getFKOrderedTbls(helpers map[string]*Helper, reports map[string]*SubjectTableReport) []string {
+	tbls := []string{}
+	for tbl := range reports {
+		tbls = append(tbls, tbl)
+	}
+	sort.Strings(tbls)
+	o := []string{}
+	visited := map[string]bool{}
+	var visit func(tbl string)
+	visit = func(tbl string) {
+		if visited[tbl] {
+			return
+		}
+		visited[tbl] = true
+		for _, child := range tbls {
+			h := helpers[child]
+			for _, k := range h.fields {
+				if h.fieldsFKRef[k][0] == tbl && child != tbl {
+					visit(child)
+				}
+			}
+		}
+		o = append(o, tbl)
+	}
+	for _, tbl := range tbls {
+		visit(tbl)
+	}
+	return o
+}
+
+// getSortedTbls returns sorted tables of Helpers
+func getSortedTbls(helpers map[string]*Helper) []string {
+	tbls := []string{}
+	for tbl := range helpers {
+		tbls = append(tbls, tbl)
+	}
+	sort.Strings(tbls)
+	return tbls
+}
+
+// getSortedIDs returns sorted IDs from set
+func getSortedIDs(ids map[int64]bool) []int64 {
+	o := make([]int64, 0, len(ids))
+	for id := range ids {
+		o = append(o, id)
+	}
+	sort.Slice(o, func(i, j int) bool { return o[i] < o[j] })
+	return o
+}
+
+// redactSubjectInTbl anonymizes subject's objects of a model, other than the
+// ones that are going to be deleted, and returns their IDs
+func (c Controller) redactSubjectInTbl(q dbQuerier, m SubjectModel, subjectID int64, deleted map[int64]bool) (*SubjectTableReport, []int64, *ErrController) {
+	h, errC := c.getHelper(m.NewObjFunc())
+	if errC != nil {
+		return nil, nil, errC
+	}
+	errDB := func(err error) *ErrController {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	t := &SubjectTableReport{
+		Tbl: h.dbTbl,
+	}
+	objs, err := c.getAllByFieldFromDB(q, h, m.NewObjFunc, m.Field, subjectID)
+	if err != nil {
+		return nil, nil, errDB(err)
+	}
+	ids := []int64{}
+	for _, obj := range objs {
+		if deleted[c.GetModelIDValue(obj)] {
+			continue
+		}
+		ids = append(ids, c.GetModelIDValue(obj))
+		h.anonymize(obj)
+		if m.Field != "ID" {
+			reflect.ValueOf(obj).Elem().FieldByName(m.Field).SetInt(0)
+		}
+		query, args, errI := c.interceptQuery(h, OpUpdate, h.GetQueryUpdateById(), append(c.GetModelFieldInterfaces(obj), c.GetModelIDInterface(obj)))
+		if errI != nil {
+			return nil, nil, errI
+		}
+		_, err = q.Exec(query, args...)
+		if err != nil {
+			return nil, nil, errDB(err)
+		}
+		t.Redacted++
+	}
+	return t, ids, nil
+}
+
+// getAllByFieldFromDB returns all objects, including expired ones, with
+// value of a field
+func (c Controller) getAllByFieldFromDB(q dbQuerier, h *Helper, newObjFunc func() interface{}, fieldName string, value interface{}) ([]interface{}, error) {
+	rows, err := q.Query(h.GetQuerySelectAllByField(fieldName), value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objs := []interface{}{}
+	for rows.Next() {
+		obj := newObjFunc()
+		err = rows.Scan(append(append(make([]interface{}, 0), c.GetModelIDInterface(obj)), c.GetModelFieldInterfaces(obj)...)...)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, rows.Err()
+}
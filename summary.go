@@ -0,0 +1,19 @@
+package crud
+
+// Summary describes a model whose objects contain numbers of objects of
+// another (source) model, grouped by values of fields that both structs have,
+// eg. number of products per category. Table of the summary model is filled
+// by RefreshSummary and it can be queried like any other model
+type Summary struct {
+	// Source returns new instance of the source struct
+	Source func() interface{}
+	// GroupBy contains fields that objects are grouped by. They must exist in
+	// both the summary and the source struct
+	GroupBy []string
+	// CountField is int64 field of the summary struct that gets the number of
+	// objects in the group
+	CountField string
+	// Filters limit counted objects of the source model, just like filters
+	// of GetFromDB
+	Filters map[string]interface{}
+}
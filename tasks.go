@@ -0,0 +1,409 @@
+package crud
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values of Task Status
+const (
+	TaskPending = "pending"
+	TaskRunning = "running"
+	TaskDone    = "done"
+	TaskFailed  = "failed"
+)
+
+// defaultTaskOutputLimit is the default maximum size of output of task in
+// bytes, see SetTaskOutputLimit
+const defaultTaskOutputLimit = 16 << 20
+
+var errTaskOutputTooLarge = errors.New("Task output is too large")
+
+// Task is a long-running operation started with RunTask, eg. a bulk import,
+// that runs in the background
+type Task struct {
+	ID     int64  `json:"task_id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// CreatedBy is ID of the identity that started the task
+	CreatedBy int64 `json:"created_by"`
+	// Result is returned by the task when it is done, eg. number of objects
+	Result map[string]interface{} `json:"result,omitempty"`
+	// Error is code of the error of failed task, eg. "cannot_run_delete",
+	// followed by the full error in verbose mode (see SetVerboseErrors)
+	Error string `json:"error,omitempty"`
+	// HasOutput is true when task wrote output, which can be got with
+	// GetTaskOutputFromDB
+	HasOutput  bool       `json:"has_output"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// TaskFunc is a function run by RunTask. Data written to output is stored
+// with the task, eg. an export. Writes over the limit set with
+// SetTaskOutputLimit fail
+type TaskFunc func(c *Controller, output io.Writer) (map[string]interface{}, error)
+
+// taskOutput is a buffer of output of task that refuses writes over limit
+type taskOutput struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (o *taskOutput) Write(p []byte) (int, error) {
+	if o.buf.Len()+len(p) > o.limit {
+		return 0, errTaskOutputTooLarge
+	}
+	return o.buf.Write(p)
+}
+
+// SetTaskOutputLimit sets maximum size of output of task in bytes, which is
+// stored in a single row of the tasks table. Task that writes more fails.
+// Default is 16MB
+func (c *Controller) SetTaskOutputLimit(n int) {
+	c.taskOutputLimit = n
+}
+
+// CreateTasksTable creates the tasks table if it does not exist
+func (c Controller) CreateTasksTable() *ErrController {
+	_, err := c.dbConn.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (task_id BIGSERIAL PRIMARY KEY,task_name VARCHAR(255) DEFAULT '',task_status VARCHAR(16) DEFAULT '%s',task_created_by BIGINT DEFAULT 0,task_result JSONB,task_error TEXT DEFAULT '',task_output TEXT,task_created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),task_finished_at TIMESTAMP WITH TIME ZONE)", c.getTasksTbl(), TaskPending))
+	if err != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	return nil
+}
+
+// RunTask stores a new task in the tasks table (created with
+// CreateTasksTable) and runs fn in a goroutine, with status of the task
+// updated when it starts and finishes. It returns ID of the task
+// immediately, so that its status can be checked with GetTaskFromDB, eg. by
+// the client polling GetTasksHTTPHandler. Task is not cancelled when context
+// of the controller is done, and it runs with the identity from the context
+// (see WithIdentity), which is stored as its creator, and with the session
+// settings of the controller. Task that panics is marked as failed.
+// WaitTasks waits for the running tasks, eg. on shutdown
+func (c Controller) RunTask(name string, fn TaskFunc) (int64, *ErrController) {
+	if c.tx != nil {
+		return 0, &ErrController{
+			Op:  "DBTx",
+			Err: fmt.Errorf("Task cannot be started in a transaction"),
+		}
+	}
+	var id int64
+	identity := getContextIdentity(c.getContext())
+	err := c.getQuerier().QueryRow(fmt.Sprintf("INSERT INTO %s(task_name,task_created_by) VALUES ($1,$2) RETURNING task_id", c.getTasksTbl()), name, identity).Scan(&id)
+	if err != nil {
+		return 0, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+
+	tc := c
+	tc.ctx = context.WithValue(context.Background(), identityCtxKey{}, identity)
+	if tc.sessionSettings == nil && c.req != nil {
+		tc.sessionSettings = GetSessionSettings(c.req)
+	}
+	tc.req = nil
+	c.tasksWG.Add(1)
+	go func() {
+		defer c.tasksWG.Done()
+		defer func() {
+			if p := recover(); p != nil {
+				tc.finishTask(id, name, nil, fmt.Errorf("Task panicked: %v", p), nil)
+			}
+		}()
+		tc.runTask(id, name, fn)
+	}()
+	return id, nil
+}
+
+// WaitTasks waits for tasks started with RunTask to finish
+func (c Controller) WaitTasks() {
+	c.tasksWG.Wait()
+}
+
+// GetTaskFromDB returns task with ID, or nil when it does not exist
+func (c Controller) GetTaskFromDB(id int64) (*Task, *ErrController) {
+	t := &Task{}
+	var result sql.NullString
+	var finishedAt sql.NullTime
+	err := c.getQuerier().QueryRow(fmt.Sprintf("SELECT task_id,task_name,task_status,task_created_by,task_result,task_error,task_output IS NOT NULL,task_created_at,task_finished_at FROM %s WHERE task_id = $1", c.getTasksTbl()), id).Scan(&t.ID, &t.Name, &t.Status, &t.CreatedBy, &result, &t.Error, &t.HasOutput, &t.CreatedAt, &finishedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	if result.Valid {
+		err = json.Unmarshal([]byte(result.String), &t.Result)
+		if err != nil {
+			return nil, &ErrController{
+				Op:  "DBQueryRowsScan",
+				Err: fmt.Errorf("Error unmarshalling task result: %w", err),
+			}
+		}
+	}
+	if finishedAt.Valid {
+		t.FinishedAt = &finishedAt.Time
+	}
+	return t, nil
+}
+
+// GetTaskOutputFromDB returns output written by task with ID, which is empty
+// when task does not exist or has not written any
+func (c Controller) GetTaskOutputFromDB(id int64) (string, *ErrController) {
+	var output sql.NullString
+	err := c.getQuerier().QueryRow(fmt.Sprintf("SELECT task_output FROM %s WHERE task_id = $1", c.getTasksTbl()), id).Scan(&output)
+	if err != nil && err != sql.ErrNoRows {
+		return "", &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	return output.String, nil
+}
+
+// GetTasksHTTPHandler returns HTTP handler that responds with status of task
+// for GET of "/:id", and with its output for GET of "/:id/output", eg. to be
+// attached to "/tasks/". Only the identity that started the task (see
+// WithIdentity) can get it, and it is not found for others. Output can
+// contain exports of whole tables, so it should be protected
+func (c Controller) GetTasksHTTPHandler(uri string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := c.withResponseSerializer(r).withRequest(r)
+		path, ok := c.getRelativePath(uri, r.URL.EscapedPath())
+		xs := strings.Split(strings.SplitN(path, "?", 2)[0], "/")
+		if !ok || r.Method != http.MethodGet || !idRegExp.MatchString(xs[0]) || len(xs) > 2 || (len(xs) == 2 && xs[1] != "output") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		id, _ := strconv.ParseInt(xs[0], 10, 64)
+		t, err := c.GetTaskFromDB(id)
+		if err != nil {
+			c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+			return
+		}
+		if t == nil || t.CreatedBy != GetIdentity(r) {
+			c.writeErrText(w, http.StatusNotFound, "not_found_in_db")
+			return
+		}
+		if len(xs) == 1 {
+			c.writeOK(w, http.StatusOK, map[string]interface{}{
+				"task": t,
+			})
+			return
+		}
+		output, err := c.GetTaskOutputFromDB(id)
+		if err != nil {
+			c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(output))
+	})
+}
+
+// GetBulkHTTPHandler returns HTTP handler of bulk operations on objects of
+// model, eg. to be attached to "/bulk/users/": GET of "/export" responds
+// with dump of all objects (see DumpModel), PUT of "/import" loads dump from
+// the request body (see LoadModel), and DELETE removes objects matching
+// "filter_" query parameters, which are required (see DeleteManyFromDB).
+// With "async=1" query parameter, operation is run with RunTask and response
+// is "202 Accepted" with ID of the task. Import and delete cannot be stored
+// as change requests, so they are refused with "403 Forbidden" for requests
+// that require approval (see WithApprovalRequired). It is meant for
+// administrators so it should be protected
+func (c Controller) GetBulkHTTPHandler(uri string, newObjFunc func() interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := c.withResponseSerializer(r).withRequest(r)
+		if settings := GetSessionSettings(r); settings != nil {
+			c.sessionSettings = settings
+		}
+		path, ok := c.getRelativePath(uri, r.URL.EscapedPath())
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(c.jsonError("invalid path"))
+			return
+		}
+		path = strings.SplitN(path, "?", 2)[0]
+		async := r.URL.Query().Get("async") == "1" || r.URL.Query().Get("async") == "true"
+		if r.Method != http.MethodGet && isApprovalRequired(r) {
+			c.writeErrText(w, http.StatusForbidden, "approval_required")
+			return
+		}
+
+		var name string
+		var fn TaskFunc
+		switch {
+		case r.Method == http.MethodGet && path == "export":
+			if !async {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				_, err := c.DumpModel(newObjFunc, w)
+				if err != nil {
+					c.logError(err)
+				}
+				return
+			}
+			name = "export"
+			fn = func(tc *Controller, output io.Writer) (map[string]interface{}, error) {
+				cnt, err := tc.DumpModel(newObjFunc, output)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"count": cnt}, nil
+			}
+		case r.Method == http.MethodPut && path == "import":
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				c.writeErrText(w, http.StatusInternalServerError, "cannot_read_request_body")
+				return
+			}
+			name = "import"
+			fn = func(tc *Controller, output io.Writer) (map[string]interface{}, error) {
+				cnt, err := tc.LoadModel(newObjFunc, bytes.NewReader(body))
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"count": cnt}, nil
+			}
+		case r.Method == http.MethodDelete && path == "":
+			params, _, err := c.parseListParams(r, newObjFunc())
+			if err != nil || len(params.Filters) == 0 {
+				c.writeErrText(w, http.StatusBadRequest, "invalid_filter")
+				return
+			}
+			name = "delete"
+			fn = func(tc *Controller, output io.Writer) (map[string]interface{}, error) {
+				cnt, err := tc.DeleteManyFromDB(newObjFunc, params.Filters)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"count": cnt}, nil
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if async {
+			h, err := c.getHelper(newObjFunc())
+			if err != nil {
+				c.writeDBErrText(w, err, http.StatusInternalServerError, "get_helper")
+				return
+			}
+			id, err := c.RunTask(h.dbTbl+"."+name, fn)
+			if err != nil {
+				c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_save_to_db")
+				return
+			}
+			c.writeOK(w, http.StatusAccepted, map[string]interface{}{
+				"task_id": id,
+			})
+			return
+		}
+		result, err := fn(&c, ioutil.Discard)
+		if err != nil {
+			errC, ok := err.(*ErrController)
+			if !ok {
+				errC = &ErrController{Op: "Task", Err: err}
+			}
+			if errC.Op == "InvalidDump" {
+				c.writeErrText(w, http.StatusBadRequest, "invalid_dump")
+				return
+			}
+			c.writeDBErrText(w, errC, http.StatusInternalServerError, "cannot_run_"+name)
+			return
+		}
+		c.writeOK(w, http.StatusOK, result)
+	})
+}
+
+// getTasksTbl returns name of the tasks table
+func (c Controller) getTasksTbl() string {
+	return c.dbTblPrefix + "tasks"
+}
+
+// runTask runs task and stores its result. Errors of updating the task are
+// passed to the error logger (see SetErrorLogger)
+func (c Controller) runTask(id int64, name string, fn TaskFunc) {
+	_, err := c.getQuerier().Exec(fmt.Sprintf("UPDATE %s SET task_status = $1 WHERE task_id = $2", c.getTasksTbl()), TaskRunning, id)
+	if err != nil {
+		c.logError(&ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		})
+		return
+	}
+
+	output := &taskOutput{limit: c.taskOutputLimit}
+	result, errTask := fn(&c, output)
+	c.finishTask(id, name, result, errTask, &output.buf)
+}
+
+// finishTask stores status of finished task with its result, error and
+// output
+func (c Controller) finishTask(id int64, name string, result map[string]interface{}, errTask error, output *bytes.Buffer) {
+	status, errText := TaskDone, ""
+	if errTask != nil {
+		status, errText = TaskFailed, c.getTaskErrText(name, errTask)
+	}
+	var resultJSON, outputText interface{}
+	if result != nil {
+		b, err := json.Marshal(result)
+		if err == nil {
+			resultJSON = string(b)
+		}
+	}
+	if output != nil && output.Len() > 0 && errTask == nil {
+		outputText = output.String()
+	}
+	_, err := c.getQuerier().Exec(fmt.Sprintf("UPDATE %s SET task_status = $1,task_result = $2,task_error = $3,task_output = $4,task_finished_at = NOW() WHERE task_id = $5", c.getTasksTbl()), status, resultJSON, errText, outputText, id)
+	if err != nil {
+		c.logError(&ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		})
+	}
+}
+
+// getTaskErrText returns error code stored with failed task, eg.
+// "cannot_run_delete" for "users.delete" task, as tasks are returned to
+// clients and errors can contain SQL and values. Full error is passed to the
+// error logger, and it is added to the code only in verbose mode
+func (c Controller) getTaskErrText(name string, errTask error) string {
+	errC, ok := errTask.(*ErrController)
+	if !ok {
+		errC = &ErrController{Op: "Task", Err: errTask}
+	}
+	c.logError(errC)
+
+	errText := "cannot_run_" + strings.Trim(slugInvalidCharsRegExp.ReplaceAllString(strings.ToLower(name[strings.LastIndex(name, ".")+1:]), "_"), "_")
+	switch errC.Op {
+	case "InvalidDump":
+		errText = "invalid_dump"
+	case "Hook":
+		errText = "operation_aborted"
+	}
+	if c.verboseErrs {
+		errText += ": " + errTask.Error()
+	}
+	return errText
+}
@@ -0,0 +1,121 @@
+package crud
+
+import (
+	"fmt"
+)
+
+// Begin starts a database transaction and returns copy of the controller that
+// runs all the queries of objects within it, eg. to save parent and its
+// children atomically. The transaction must be finished with Commit or
+// Rollback of the returned controller. Session settings of the controller
+// are applied to the whole transaction
+func (c Controller) Begin() (*Controller, *ErrController) {
+	if c.tx != nil {
+		return nil, &ErrController{
+			Op:  "DBTx",
+			Err: fmt.Errorf("Controller is already in a transaction"),
+		}
+	}
+	tx, err := c.dbConn.BeginTx(c.getContext(), nil)
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBTx",
+			Err: fmt.Errorf("Error starting transaction: %w", err),
+		}
+	}
+	err = c.applySessionSettings(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, &ErrController{
+			Op:  "DBTx",
+			Err: fmt.Errorf("Error applying session settings: %w", err),
+		}
+	}
+	c.tx = tx
+	if c.secondary != nil {
+		c.mirrorQueue = &[]mirrorWrite{}
+	}
+	return &c, nil
+}
+
+// Commit commits transaction of controller returned by Begin
+func (c Controller) Commit() *ErrController {
+	if c.tx == nil {
+		return &ErrController{
+			Op:  "DBTx",
+			Err: fmt.Errorf("Controller is not in a transaction"),
+		}
+	}
+	err := c.tx.Commit()
+	if err != nil {
+		return &ErrController{
+			Op:  "DBTx",
+			Err: fmt.Errorf("Error committing transaction: %w", err),
+		}
+	}
+	if c.mirrorQueue != nil {
+		c.applyMirrorWrites(*c.mirrorQueue)
+		*c.mirrorQueue = nil
+	}
+	return nil
+}
+
+// Rollback aborts transaction of controller returned by Begin
+func (c Controller) Rollback() *ErrController {
+	if c.tx == nil {
+		return &ErrController{
+			Op:  "DBTx",
+			Err: fmt.Errorf("Controller is not in a transaction"),
+		}
+	}
+	if c.mirrorQueue != nil {
+		*c.mirrorQueue = nil
+	}
+	err := c.tx.Rollback()
+	if err != nil {
+		return &ErrController{
+			Op:  "DBTx",
+			Err: fmt.Errorf("Error rolling back transaction: %w", err),
+		}
+	}
+	return nil
+}
+
+// WithTx calls fn with controller in a transaction, which is committed when
+// fn returns nil and rolled back otherwise. When fn panics, the transaction
+// is rolled back and the panic is propagated:
+//
+//	err := c.WithTx(func(tc *crud.Controller) *crud.ErrController {
+//		err := tc.SaveToDB(order)
+//		if err != nil {
+//			return err
+//		}
+//		return tc.SaveToDB(orderLine)
+//	})
+func (c Controller) WithTx(fn func(tc *Controller) *ErrController) *ErrController {
+	tc, err := c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tc.Rollback()
+			panic(p)
+		}
+	}()
+	err = fn(tc)
+	if err != nil {
+		tc.Rollback()
+		return err
+	}
+	return tc.Commit()
+}
+
+// getQuerier returns transaction of controller returned by Begin or the
+// database connection
+func (c Controller) getQuerier() dbQuerier {
+	if c.tx != nil {
+		return c.withContextQuerier(c.tx)
+	}
+	return c.withContextQuerier(c.dbConn)
+}
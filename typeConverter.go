@@ -0,0 +1,50 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+)
+
+// TypeConverter converts values of a custom field type (eg. decimal.Decimal)
+// to values that can be stored in the database and back
+type TypeConverter struct {
+	// DBType is a column type used in CREATE TABLE, eg. "NUMERIC(12,2)"
+	DBType string
+	// ToDB converts field value to a value that is passed to the database
+	ToDB func(interface{}) (driver.Value, error)
+	// FromDB converts value from the database (or string from URI filter)
+	// to field value
+	FromDB func(interface{}) (interface{}, error)
+}
+
+// convertedValue wraps pointer to a struct field which type has
+// a TypeConverter, so that it can be passed to the database driver as a query
+// argument or as a scan destination
+type convertedValue struct {
+	field reflect.Value
+	conv  *TypeConverter
+}
+
+// Value converts the field value with ToDB
+func (c *convertedValue) Value() (driver.Value, error) {
+	return c.conv.ToDB(c.field.Interface())
+}
+
+// Scan converts value from the database with FromDB and sets the field
+func (c *convertedValue) Scan(src interface{}) error {
+	if src == nil {
+		c.field.Set(reflect.Zero(c.field.Type()))
+		return nil
+	}
+	v, err := c.conv.FromDB(src)
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || !rv.Type().AssignableTo(c.field.Type()) {
+		return fmt.Errorf("cannot assign %T to field of type %s", v, c.field.Type())
+	}
+	c.field.Set(rv)
+	return nil
+}
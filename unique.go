@@ -0,0 +1,130 @@
+package crud
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// IsUnique checks if there is no object other than the one with excludeID
+// (0 when object is not created yet) that has field set to value, eg. to
+// check if username is available before the object is saved. Soft-deleted
+// objects are included, just like for the unique constraint of "uniq" tag
+func (c Controller) IsUnique(newObjFunc func() interface{}, fieldName string, value interface{}, excludeID int64) (bool, *ErrController) {
+	h, err := c.getHelper(newObjFunc())
+	if err != nil {
+		return false, err
+	}
+	if h.dbFieldCols[fieldName] == "" {
+		return false, &ErrController{
+			Op:  "InvalidField",
+			Err: fmt.Errorf("Field %s is not a column", fieldName),
+		}
+	}
+	var cnt int64
+	err2 := c.runWithHints(h, OpRead, func(q dbQuerier) error {
+		return q.QueryRow(h.GetQueryCountByFieldExcludingID(fieldName), value, excludeID).Scan(&cnt)
+	})
+	if err2 != nil {
+		return false, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err2),
+		}
+	}
+	return cnt == 0, nil
+}
+
+// handleHTTPValidate validates fields that are in the request body, just like
+// they are validated on create (or update when "id" query parameter is set),
+// and checks if values of fields with "uniq" tag are not taken by other
+// objects. Object is not saved
+func (c Controller) handleHTTPValidate(w http.ResponseWriter, r *http.Request, newObjFunc func() interface{}) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.writeErrText(w, http.StatusInternalServerError, "cannot_read_request_body")
+		return
+	}
+	var id int64
+	op := OpCreate
+	if r.URL.Query().Get("id") != "" {
+		id, err = strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil || id < 1 {
+			c.writeErrText(w, http.StatusBadRequest, "invalid_id")
+			return
+		}
+		op = OpUpdate
+	}
+
+	obj := newObjFunc()
+	h, err2 := c.getHelper(obj)
+	if err2 != nil {
+		c.writeDBErrText(w, err2, http.StatusInternalServerError, "get_helper")
+		return
+	}
+	serializer := c.getRequestSerializer(r)
+	m := map[string]interface{}{}
+	err = serializer.Unmarshal(c.replaceJSONAliases(obj, serializer, body), &m)
+	if err == nil {
+		err = c.unmarshalRequestBody(serializer, body, obj)
+	}
+	if err != nil {
+		c.writeErrText(w, http.StatusBadRequest, "invalid_json")
+		return
+	}
+	c.TransformFields(obj)
+
+	fields := []string{}
+	for _, k := range h.fields {
+		if _, ok := m[h.fieldsJSONName[k]]; ok && !h.fieldsJSONHidden[k] {
+			fields = append(fields, k)
+		}
+	}
+	invalid := []string{}
+	if len(fields) > 0 {
+		_, invalid, err = c.ValidateWithOptions(obj, nil, ValidationOptions{Op: op, Fields: fields})
+		if err != nil {
+			c.writeErrText(w, http.StatusInternalServerError, "cannot_validate")
+			return
+		}
+	}
+	isInvalid := map[string]bool{}
+	for _, k := range invalid {
+		isInvalid[k] = true
+	}
+
+	invalidJSON := []string{}
+	taken := []string{}
+	for _, k := range fields {
+		if isInvalid[k] {
+			invalidJSON = append(invalidJSON, c.getResponseJSONName(h.fieldsJSONName[k]))
+			continue
+		}
+		if !h.fieldsUniq[k] {
+			continue
+		}
+		unique, err := c.IsUnique(newObjFunc, k, reflect.ValueOf(obj).Elem().FieldByName(k).Interface(), id)
+		if err != nil {
+			c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+			return
+		}
+		if !unique {
+			taken = append(taken, c.getResponseJSONName(h.fieldsJSONName[k]))
+		}
+	}
+	c.writeOK(w, http.StatusOK, map[string]interface{}{
+		"valid":          len(invalidJSON) == 0 && len(taken) == 0,
+		"invalid_fields": invalidJSON,
+		"taken_fields":   taken,
+	})
+}
+
+// getResponseJSONName returns JSON name of field as it is in responses, which
+// is in camelCase when it is set with SetJSONNaming
+func (c Controller) getResponseJSONName(name string) string {
+	if c.jsonNaming == JSONNamingCamelCase {
+		return getCamelCaseName(name)
+	}
+	return name
+}
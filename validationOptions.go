@@ -0,0 +1,17 @@
+package crud
+
+// ValidationOptions changes the behaviour of ValidateWithOptions
+type ValidationOptions struct {
+	// FailFast stops validation on the first invalid field
+	FailFast bool
+	// MaxErrors stops validation when number of invalid fields reaches it;
+	// 0 means no limit
+	MaxErrors int
+	// Op is the operation (OpCreate, OpUpdate etc.) that object is validated
+	// for. Fields with "req:create" like tags are required only when it
+	// matches
+	Op int
+	// Fields limits validation to these fields; when empty, all the fields
+	// are validated
+	Fields []string
+}
@@ -0,0 +1,22 @@
+package crud
+
+// ValidationReport contains result of validating a batch of rows that are
+// already in the database table with ValidateDBTableBatch
+type ValidationReport struct {
+	Tbl string `json:"table"`
+	// Scanned is the number of rows that were checked
+	Scanned int `json:"scanned"`
+	// LastID is ID of the last checked row. It should be passed as afterID
+	// to get the next batch
+	LastID int64 `json:"last_id"`
+	// Done is true when there are no more rows to check
+	Done    bool         `json:"done"`
+	Invalid []InvalidRow `json:"invalid"`
+}
+
+// InvalidRow contains ID of a row that does not pass validation and its
+// invalid fields
+type InvalidRow struct {
+	ID     int64    `json:"id"`
+	Fields []string `json:"fields"`
+}
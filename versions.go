@@ -0,0 +1,330 @@
+package crud
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxVersionsLimit is the maximum number of versions listed in one HTTP
+// response
+const maxVersionsLimit = 100
+
+// Version is a previous state of object, stored when it was updated
+type Version struct {
+	ID        int64       `json:"version_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Obj       interface{} `json:"obj"`
+}
+
+// EnableVersions makes updates of model's objects with SaveToDB and
+// SaveFieldsToDB store the previous state of the row in the versions table,
+// in the same transaction. Versions can be listed with GetVersionsFromDB and
+// restored with RestoreVersion, and HTTP handler lists them at
+// "/:id/versions" and restores them with PUT of "/:id/versions/:version_id".
+// Versions table must be created with CreateVersionsTable
+func (c *Controller) EnableVersions(obj interface{}) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	c.versioned[h.dbTbl] = true
+	return nil
+}
+
+// CreateVersionsTable creates the versions table if it does not exist
+func (c Controller) CreateVersionsTable() *ErrController {
+	_, err := c.dbConn.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version_id BIGSERIAL PRIMARY KEY,version_tbl VARCHAR(255) DEFAULT '',version_obj_id BIGINT DEFAULT 0,version_payload JSONB,version_created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW())", c.getVersionsTbl()))
+	if err != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	_, err = c.dbConn.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_obj_idx ON %s (version_tbl,version_obj_id)", c.getVersionsTbl(), c.getVersionsTbl()))
+	if err != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	return nil
+}
+
+// GetVersionsFromDB returns previous versions of object with ID set, the
+// latest first. Objects in versions are of the same struct as obj
+func (c Controller) GetVersionsFromDB(obj interface{}, limit int, offset int) ([]*Version, *ErrController) {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return nil, err
+	}
+	return c.getVersionsFromDB(h, obj, 0, limit, offset)
+}
+
+// RestoreVersion sets object with ID set to the values from its version with
+// versionID and saves it with SaveToDB, so that the current state is stored
+// as a new version. Fields that are not in the struct of obj are not restored
+func (c Controller) RestoreVersion(obj interface{}, versionID int64) *ErrController {
+	err := c.setFromVersion(obj, versionID)
+	if err != nil {
+		return err
+	}
+	return c.SaveToDB(obj)
+}
+
+// setFromVersion sets object with ID set to the values from its version with
+// versionID, without saving it
+func (c Controller) setFromVersion(obj interface{}, versionID int64) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	versions, err := c.getVersionsFromDB(h, obj, versionID, 1, 0)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Version %d does not exist", versionID),
+		}
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(versions[0].Obj).Elem())
+	return nil
+}
+
+// getVersionsTbl returns name of the versions table
+func (c Controller) getVersionsTbl() string {
+	return c.dbTblPrefix + "versions"
+}
+
+// recordsVersions returns true when operation stores versions of model's
+// objects
+func (c Controller) recordsVersions(h *Helper, op int) bool {
+	return op == OpUpdate && c.versioned[h.dbTbl]
+}
+
+// recordVersion inserts current state of row with id into the versions table,
+// when model has versions enabled
+func (c Controller) recordVersion(q dbQuerier, h *Helper, op int, id int64) error {
+	if !c.recordsVersions(h, op) {
+		return nil
+	}
+	_, err := q.Exec(fmt.Sprintf("INSERT INTO %s(version_tbl,version_obj_id,version_payload) SELECT $1,%s,to_jsonb(t) FROM %s t WHERE %s = $2", c.getVersionsTbl(), h.dbFieldCols["ID"], h.dbTbl, h.dbFieldCols["ID"]), h.dbTbl, id)
+	return err
+}
+
+// getVersionPayloads returns current state of rows matching filters, keyed by
+// their IDs, when model has versions enabled. Arguments of filters are
+// numbered from 1. Rows are locked until the end of the transaction
+func (c Controller) getVersionPayloads(q dbQuerier, h *Helper, op int, filters map[string]interface{}, args []interface{}) (map[int64]string, error) {
+	if !c.recordsVersions(h, op) {
+		return nil, nil
+	}
+	query := fmt.Sprintf("SELECT %s,to_jsonb(t) FROM %s t", h.dbFieldCols["ID"], h.dbTbl)
+	if qWhere := h.getWhereCondition(filters, 1); qWhere != "" {
+		query += " WHERE " + qWhere
+	}
+	return c.queryVersionPayloads(q, query+" FOR UPDATE", args...)
+}
+
+// getVersionPayloadsByIDs works like getVersionPayloads, but it returns state
+// of rows with ids
+func (c Controller) getVersionPayloadsByIDs(q dbQuerier, h *Helper, op int, ids []int64) (map[int64]string, error) {
+	if !c.recordsVersions(h, op) || len(ids) == 0 {
+		return nil, nil
+	}
+	query := fmt.Sprintf("SELECT %s,to_jsonb(t) FROM %s t WHERE %s = ANY($1) FOR UPDATE", h.dbFieldCols["ID"], h.dbTbl, h.dbFieldCols["ID"])
+	return c.queryVersionPayloads(q, query, pq.Array(ids))
+}
+
+// queryVersionPayloads runs query that returns IDs and states of rows, and
+// returns the states keyed by the IDs
+func (c Controller) queryVersionPayloads(q dbQuerier, query string, args ...interface{}) (map[int64]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	payloads := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var payload string
+		err = rows.Scan(&id, &payload)
+		if err != nil {
+			return nil, err
+		}
+		payloads[id] = payload
+	}
+	return payloads, rows.Err()
+}
+
+// recordVersionPayload inserts state of row with id, returned by
+// getVersionPayloads, into the versions table
+func (c Controller) recordVersionPayload(q dbQuerier, h *Helper, id int64, payloads map[int64]string) error {
+	payload, ok := payloads[id]
+	if !ok {
+		return nil
+	}
+	_, err := q.Exec(fmt.Sprintf("INSERT INTO %s(version_tbl,version_obj_id,version_payload) VALUES ($1,$2,$3)", c.getVersionsTbl()), h.dbTbl, id, payload)
+	return err
+}
+
+// getVersionsFromDB returns versions of object, or only the one with
+// versionID when it is not 0. Rows stored in versions are converted back to
+// columns of the model's table, so they can be scanned just like rows of it
+func (c Controller) getVersionsFromDB(h *Helper, obj interface{}, versionID int64, limit int, offset int) ([]*Version, *ErrController) {
+	cols := ""
+	for _, f := range h.fields {
+		cols = h.addWithComma(cols, h.getColWithAlias(h.dbFieldCols[f], "r"))
+	}
+	query := fmt.Sprintf("SELECT v.version_id,v.version_created_at,%s FROM %s v CROSS JOIN LATERAL jsonb_populate_record(NULL::%s, v.version_payload) r WHERE v.version_tbl = $1 AND v.version_obj_id = $2", cols, c.getVersionsTbl(), h.dbTbl)
+	args := []interface{}{h.dbTbl, c.GetModelIDValue(obj)}
+	if versionID != 0 {
+		query += " AND v.version_id = $3"
+		args = append(args, versionID)
+	}
+	query += " ORDER BY v.version_id DESC"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	}
+
+	rows, err := c.getQuerier().Query(query, args...)
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	defer rows.Close()
+
+	versions := []*Version{}
+	for rows.Next() {
+		v := &Version{
+			Obj: reflect.New(reflect.TypeOf(obj).Elem()).Interface(),
+		}
+		err = rows.Scan(append([]interface{}{&v.ID, &v.CreatedAt, c.GetModelIDInterface(v.Obj)}, c.GetModelFieldInterfaces(v.Obj)...)...)
+		if err != nil {
+			return nil, &ErrController{
+				Op:  "DBQueryRowsScan",
+				Err: fmt.Errorf("Error scanning DB query row: %w", err),
+			}
+		}
+		versions = append(versions, v)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, &ErrController{
+			Op:  "DBQueryRowsScan",
+			Err: fmt.Errorf("Error scanning DB query row: %w", err),
+		}
+	}
+	return versions, nil
+}
+
+// getVersionsFromURI returns ID of object and version from "id/versions" or
+// "id/versions/version_id" path of model with versions enabled
+func (c Controller) getVersionsFromURI(uri string, h *Helper) (string, string, bool) {
+	if h == nil || !c.versioned[h.dbTbl] {
+		return "", "", false
+	}
+	xs := strings.Split(strings.SplitN(uri, "?", 2)[0], "/")
+	if len(xs) < 2 || len(xs) > 3 || xs[1] != "versions" || !idRegExp.MatchString(xs[0]) {
+		return "", "", false
+	}
+	if len(xs) == 3 {
+		if !idRegExp.MatchString(xs[2]) {
+			return "", "", false
+		}
+		return xs[0], xs[2], true
+	}
+	return xs[0], "", true
+}
+
+// handleHTTPVersions lists versions of object with GET or restores one of
+// them with PUT. Restore of request that requires approval (see
+// WithApprovalRequired) is stored as a change request. Objects in versions are formatted just like in the read
+// response, so newObjFunc should be the one for reading when listing, and the
+// one for updating when restoring
+func (c Controller) handleHTTPVersions(w http.ResponseWriter, r *http.Request, newObjFunc func() interface{}, id string, versionID string) {
+	if (r.Method != http.MethodGet || versionID != "") && (r.Method != http.MethodPut || versionID == "") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	objClone := newObjFunc()
+	err := c.SetFromDB(objClone, id)
+	if err != nil {
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+		return
+	}
+	if c.GetModelIDValue(objClone) == 0 {
+		c.writeErrText(w, http.StatusNotFound, "not_found_in_db")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if limit < 1 {
+			limit = 10
+		}
+		if limit > maxVersionsLimit {
+			limit = maxVersionsLimit
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		versions, err := c.GetVersionsFromDB(objClone, limit, offset)
+		if err != nil {
+			c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+			return
+		}
+		objs := make([]interface{}, len(versions))
+		for i, v := range versions {
+			objs[i] = v.Obj
+		}
+		items, err := c.getResponseItems(r, objs, nil)
+		if err != nil {
+			c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_get_from_db")
+			return
+		}
+		items = c.getOrderedItems(objs, items, nil)
+		xv := make([]interface{}, len(versions))
+		for i, v := range versions {
+			v.Obj = items[i]
+			xv[i] = v
+		}
+		c.writeResponse(w, http.StatusOK, NewListResponse(xv, nil))
+		return
+	}
+
+	vid, _ := strconv.ParseInt(versionID, 10, 64)
+	if isApprovalRequired(r) {
+		err = c.setFromVersion(objClone, vid)
+		if err == nil {
+			c.writeChangeRequest(w, r, objClone, OpUpdate)
+			return
+		}
+	} else {
+		err = c.RestoreVersion(objClone, vid)
+	}
+	if err != nil && err.Op == "InvalidValue" {
+		c.writeErrText(w, http.StatusNotFound, "version_not_found")
+		return
+	}
+	if err != nil && err.Op == "Validate" {
+		c.writeErrText(w, http.StatusBadRequest, "validation_failed")
+		return
+	}
+	if err != nil {
+		c.writeDBErrText(w, err, http.StatusInternalServerError, "cannot_save_to_db")
+		return
+	}
+	c.writeResponse(w, http.StatusOK, NewIDResponse(c.GetModelIDValue(objClone)))
+}
@@ -0,0 +1,311 @@
+package crud
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Webhook is a URL that gets POST request with the object after it is
+// created, updated or deleted. Deliveries are recorded in the webhook
+// deliveries table in the same transaction as the change and they are sent
+// by WebhookDispatcher
+type Webhook struct {
+	URL string
+	// Ops are operations that trigger the webhook, eg. OpCreate|OpDelete
+	Ops int
+	// Secret is the key of HMAC-SHA256 signature of the request body, sent
+	// in hex in X-Crud-Signature header. Empty Secret means no signature
+	Secret string
+}
+
+// WebhookPayload is the body of webhook request
+type WebhookPayload struct {
+	DeliveryID int64           `json:"delivery_id"`
+	Tbl        string          `json:"table"`
+	Op         string          `json:"op"`
+	ObjID      int64           `json:"id"`
+	Obj        json.RawMessage `json:"object"`
+	// Timestamp is Unix time of sending the request, which is signed with
+	// the body, so that receivers can reject replayed requests
+	Timestamp int64 `json:"timestamp"`
+}
+
+// Statuses of webhook deliveries. Delivery is sending when it is claimed by
+// a dispatcher, until the lease expires
+const (
+	WebhookPending   = "pending"
+	WebhookSending   = "sending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// AddWebhook registers webhook for model of obj. Webhook deliveries table
+// must be created with CreateWebhookDeliveriesTable
+func (c *Controller) AddWebhook(obj interface{}, wh Webhook) *ErrController {
+	h, err := c.getHelper(obj)
+	if err != nil {
+		return err
+	}
+	u, err2 := url.Parse(wh.URL)
+	if err2 != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Invalid webhook URL %s", wh.URL),
+		}
+	}
+	if wh.Ops == 0 || wh.Ops&^(OpCreate|OpUpdate|OpDelete) != 0 {
+		return &ErrController{
+			Op:  "InvalidValue",
+			Err: fmt.Errorf("Webhook operations must be OpCreate, OpUpdate or OpDelete"),
+		}
+	}
+	c.webhooks[h.dbTbl] = append(c.webhooks[h.dbTbl], wh)
+	return nil
+}
+
+// CreateWebhookDeliveriesTable creates the webhook deliveries table if it does
+// not exist
+func (c Controller) CreateWebhookDeliveriesTable() *ErrController {
+	_, err := c.dbConn.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (delivery_id BIGSERIAL PRIMARY KEY,delivery_tbl VARCHAR(255) DEFAULT '',delivery_op INTEGER DEFAULT 0,delivery_obj_id BIGINT DEFAULT 0,delivery_url TEXT DEFAULT '',delivery_payload JSONB,delivery_status VARCHAR(16) DEFAULT 'pending',delivery_attempts INTEGER DEFAULT 0,delivery_response_code INTEGER DEFAULT 0,delivery_error TEXT DEFAULT '',delivery_next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),delivery_created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),delivery_delivered_at TIMESTAMP WITH TIME ZONE)", c.getWebhookDeliveriesTbl()))
+	if err != nil {
+		return &ErrController{
+			Op:  "DBQuery",
+			Err: fmt.Errorf("Error executing DB query: %w", err),
+		}
+	}
+	return nil
+}
+
+// getWebhookDeliveriesTbl returns name of the webhook deliveries table
+func (c Controller) getWebhookDeliveriesTbl() string {
+	return c.dbTblPrefix + "webhook_deliveries"
+}
+
+// hasWebhooks returns true when model has webhooks for the operation
+func (c Controller) hasWebhooks(h *Helper, op int) bool {
+	for _, wh := range c.webhooks[h.dbTbl] {
+		if wh.Ops&op != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// recordWebhookDeliveries inserts pending deliveries of object's change for
+// model's webhooks
+func (c Controller) recordWebhookDeliveries(q dbQuerier, h *Helper, op int, obj interface{}, payload []byte) error {
+	for _, wh := range c.webhooks[h.dbTbl] {
+		if wh.Ops&op == 0 {
+			continue
+		}
+		_, err := q.Exec(fmt.Sprintf("INSERT INTO %s(delivery_tbl,delivery_op,delivery_obj_id,delivery_url,delivery_payload) VALUES ($1,$2,$3,$4,$5)", c.getWebhookDeliveriesTbl()), h.dbTbl, op, c.GetModelIDValue(obj), wh.URL, string(payload))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getWebhookSecret returns secret of webhook with URL registered for table
+func (c Controller) getWebhookSecret(tbl string, u string) (string, bool) {
+	for _, wh := range c.webhooks[tbl] {
+		if wh.URL == u {
+			return wh.Secret, true
+		}
+	}
+	return "", false
+}
+
+// WebhookDispatcher sends pending webhook deliveries. Failed deliveries are
+// retried with exponential backoff until maximum number of attempts
+type WebhookDispatcher struct {
+	c           *Controller
+	client      *http.Client
+	batchSize   int
+	maxAttempts int
+	backoff     time.Duration
+	lease       time.Duration
+}
+
+// NewWebhookDispatcher returns new WebhookDispatcher that sends deliveries
+// from the webhook deliveries table of Controller
+func NewWebhookDispatcher(c *Controller) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		c:           c,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		batchSize:   100,
+		maxAttempts: 5,
+		backoff:     time.Minute,
+		lease:       5 * time.Minute,
+	}
+}
+
+// SetLease sets how long deliveries claimed by DispatchOnce stay claimed.
+// Deliveries of dispatcher that stopped before recording them are sent again
+// after the lease expires, so it should be longer than sending a batch takes
+func (d *WebhookDispatcher) SetLease(lease time.Duration) {
+	d.lease = lease
+}
+
+// SetBatchSize sets maximum number of deliveries sent by a single
+// DispatchOnce call
+func (d *WebhookDispatcher) SetBatchSize(n int) {
+	d.batchSize = n
+}
+
+// SetHTTPClient sets client used for sending requests
+func (d *WebhookDispatcher) SetHTTPClient(client *http.Client) {
+	d.client = client
+}
+
+// SetRetries sets maximum number of attempts of a delivery and delay after
+// the first failed one, which doubles after each next failure
+func (d *WebhookDispatcher) SetRetries(maxAttempts int, backoff time.Duration) {
+	d.maxAttempts = maxAttempts
+	d.backoff = backoff
+}
+
+// DispatchOnce sends deliveries that are pending and due, in the order they
+// were recorded, and returns number of successful ones. Delivery succeeds
+// when the URL responds with 2xx status. Deliveries are claimed first with
+// a single query, so that many dispatchers can run at the same time, and no
+// rows are locked while requests are sent. Result of each attempt is stored
+// in the table separately, so delivered ones are not sent again when storing
+// another fails
+func (d *WebhookDispatcher) DispatchOnce() (int, error) {
+	deliveries, err := d.claim()
+	if err != nil {
+		return 0, err
+	}
+
+	tbl := d.c.getWebhookDeliveriesTbl()
+	cnt := 0
+	var errFirst error
+	for _, dl := range deliveries {
+		code, errSend := d.send(dl.url, &dl.payload)
+		if errSend == nil {
+			_, err = d.c.dbConn.Exec(fmt.Sprintf("UPDATE %s SET delivery_status = $1, delivery_attempts = delivery_attempts + 1, delivery_response_code = $2, delivery_error = '', delivery_delivered_at = NOW() WHERE delivery_id = $3 AND delivery_status = $4", tbl), WebhookDelivered, code, dl.payload.DeliveryID, WebhookSending)
+			cnt++
+		} else {
+			status := WebhookPending
+			if dl.attempts+1 >= d.maxAttempts {
+				status = WebhookFailed
+			}
+			delay := d.backoff * time.Duration(1<<uint(dl.attempts))
+			_, err = d.c.dbConn.Exec(fmt.Sprintf("UPDATE %s SET delivery_status = $1, delivery_attempts = delivery_attempts + 1, delivery_response_code = $2, delivery_error = $3, delivery_next_attempt_at = NOW() + $4 * INTERVAL '1 millisecond' WHERE delivery_id = $5 AND delivery_status = $6", tbl), status, code, errSend.Error(), delay.Milliseconds(), dl.payload.DeliveryID, WebhookSending)
+		}
+		if err != nil && errFirst == nil {
+			errFirst = err
+		}
+	}
+	return cnt, errFirst
+}
+
+// webhookDelivery is a delivery claimed by WebhookDispatcher
+type webhookDelivery struct {
+	payload  WebhookPayload
+	url      string
+	attempts int
+}
+
+// claim marks deliveries that are pending and due, or sending with expired
+// lease, as sending until the lease expires and returns them in the order
+// they were recorded
+func (d *WebhookDispatcher) claim() ([]*webhookDelivery, error) {
+	tbl := d.c.getWebhookDeliveriesTbl()
+	rows, err := d.c.dbConn.Query(fmt.Sprintf("UPDATE %s SET delivery_status = $1, delivery_next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond' WHERE delivery_id IN (SELECT delivery_id FROM %s WHERE delivery_status IN ($3, $1) AND delivery_next_attempt_at <= NOW() ORDER BY delivery_id LIMIT $4 FOR UPDATE SKIP LOCKED) RETURNING delivery_id, delivery_tbl, delivery_op, delivery_obj_id, delivery_url, delivery_payload, delivery_attempts", tbl, tbl), WebhookSending, d.lease.Milliseconds(), WebhookPending, d.batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*webhookDelivery{}
+	for rows.Next() {
+		dl := &webhookDelivery{}
+		var op int
+		var obj []byte
+		err = rows.Scan(&dl.payload.DeliveryID, &dl.payload.Tbl, &op, &dl.payload.ObjID, &dl.url, &obj, &dl.attempts)
+		if err != nil {
+			return nil, err
+		}
+		dl.payload.Op = getOpName(op)
+		dl.payload.Obj = json.RawMessage(obj)
+		deliveries = append(deliveries, dl)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].payload.DeliveryID < deliveries[j].payload.DeliveryID
+	})
+	return deliveries, nil
+}
+
+// send posts payload to URL and returns response status code. Webhooks that
+// are no longer registered fail
+func (d *WebhookDispatcher) send(u string, payload *WebhookPayload) (int, error) {
+	secret, ok := d.c.getWebhookSecret(payload.Tbl, u)
+	if !ok {
+		return 0, fmt.Errorf("Webhook is not registered")
+	}
+	payload.Timestamp = d.c.clock.Now().Unix()
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Crud-Delivery", fmt.Sprintf("%d", payload.DeliveryID))
+	if secret != "" {
+		req.Header.Set("X-Crud-Signature", GetWebhookSignature(secret, b))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Run calls DispatchOnce every interval until ctx is done. Errors are passed
+// to onErr, which can be nil
+func (d *WebhookDispatcher) Run(ctx context.Context, interval time.Duration, onErr func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := d.DispatchOnce()
+		if err != nil && onErr != nil {
+			onErr(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetWebhookSignature returns signature of webhook request body, that
+// receivers should compare with X-Crud-Signature header using hmac.Equal.
+// Body contains timestamp of the request, and receivers should also reject
+// the ones that are too old
+func GetWebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}